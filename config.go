@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"pos/internal/oauth"
 	"strconv"
 
 	"github.com/rs/zerolog/log"
@@ -95,6 +97,7 @@ func (l *listenConfig) loadFromEnv() {
 
 type jwtConfig struct {
 	Secret         string `yaml:"secret" json:"secret"`
+	KeysDir        string `yaml:"keys_dir" json:"keys_dir"`
 	RefreshExpTime uint   `yaml:"refresh_exp" json:"refresh_exp"`
 	AccessExpTime  uint   `yaml:"access_exp" json:"access_exp"`
 }
@@ -109,27 +112,150 @@ func defaultJwtConfig() jwtConfig {
 
 func (p *jwtConfig) loadFromEnv() {
 	loadEnvStr("JWT_SECRET", &p.Secret)
+	loadEnvStr("JWT_KEYS_DIR", &p.KeysDir)
 	loadEnvUint("JWT_REFRESH_TOKEN_EXP_TIME", &p.RefreshExpTime)
 	loadEnvUint("JWT_ACCESS_TOKEN_EXP_TIME", &p.AccessExpTime)
 }
 
+type sessionConfig struct {
+	MaxPerAccount uint   `yaml:"max_per_account" json:"max_per_account"`
+	LimitPolicy   string `yaml:"limit_policy" json:"limit_policy"`
+	TokenPepper   string `yaml:"token_pepper" json:"-"`
+	// PinMaxFailures wrong PINs in a row lock the PIN of an account for
+	// PinLockout minutes; zero never locks it. The same limit applies to
+	// passwords, given at login or by an approver of an override. After
+	// PinMaxLockouts lockouts the PIN stays locked until an administrator
+	// unlocks it; zero always lets it go.
+	PinMaxFailures uint `yaml:"pin_max_failures" json:"pin_max_failures"`
+	PinLockout     uint `yaml:"pin_lockout" json:"pin_lockout"`
+	PinMaxLockouts uint `yaml:"pin_max_lockouts" json:"pin_max_lockouts"`
+	// DeviceMaxPinFailures wrong PINs in a row on a device, whatever the
+	// account, disable the device; zero never disables it.
+	DeviceMaxPinFailures uint `yaml:"device_max_pin_failures" json:"device_max_pin_failures"`
+	// EnrollmentTTL is how many hours a device enrollment code can be used.
+	EnrollmentTTL uint `yaml:"enrollment_ttl" json:"enrollment_ttl"`
+}
+
+func defaultSessionConfig() sessionConfig {
+	return sessionConfig{
+		MaxPerAccount:        5,
+		LimitPolicy:          "evict_oldest",
+		TokenPepper:          "mypepper",
+		PinMaxFailures:       5,
+		PinLockout:           15,
+		PinMaxLockouts:       3,
+		DeviceMaxPinFailures: 20,
+		EnrollmentTTL:        24,
+	}
+}
+
+func (s *sessionConfig) loadFromEnv() {
+	loadEnvUint("SESSION_MAX_PER_ACCOUNT", &s.MaxPerAccount)
+	loadEnvStr("SESSION_LIMIT_POLICY", &s.LimitPolicy)
+	loadEnvStr("SESSION_TOKEN_PEPPER", &s.TokenPepper)
+	loadEnvUint("SESSION_PIN_MAX_FAILURES", &s.PinMaxFailures)
+	loadEnvUint("SESSION_PIN_LOCKOUT", &s.PinLockout)
+	loadEnvUint("SESSION_PIN_MAX_LOCKOUTS", &s.PinMaxLockouts)
+	loadEnvUint("SESSION_DEVICE_MAX_PIN_FAILURES", &s.DeviceMaxPinFailures)
+	loadEnvUint("SESSION_ENROLLMENT_TTL", &s.EnrollmentTTL)
+}
+
+func (s *sessionConfig) validate() error {
+	return oauth.ValidateLimitPolicy(s.LimitPolicy)
+}
+
+type authzConfig struct {
+	// CacheTTL bounds, in seconds, how long resolved permissions are kept
+	// if a change notification is missed.
+	CacheTTL uint `yaml:"cache_ttl" json:"cache_ttl"`
+	// SweepInterval is, in seconds, how often expired role assignments
+	// are removed.
+	SweepInterval uint `yaml:"sweep_interval" json:"sweep_interval"`
+	// ApprovalDeadline is, in hours, how long a role assignment waits for
+	// a second approver before the request expires.
+	ApprovalDeadline uint `yaml:"approval_deadline" json:"approval_deadline"`
+	// OverrideTTL is, in seconds, how long a manager override can be used
+	// once granted.
+	OverrideTTL uint `yaml:"override_ttl" json:"override_ttl"`
+}
+
+func defaultAuthzConfig() authzConfig {
+	return authzConfig{
+		CacheTTL:         60,
+		SweepInterval:    60,
+		ApprovalDeadline: 72,
+		OverrideTTL:      120,
+	}
+}
+
+// validate refuses zero durations: a zero SweepInterval cannot tick, a
+// zero CacheTTL would never keep permissions, and a zero OverrideTTL or
+// ApprovalDeadline would make overrides or approval requests expire as
+// they are made.
+func (a *authzConfig) validate() error {
+	switch {
+	case a.CacheTTL == 0:
+		return errors.New("config: authz cache_ttl must be positive")
+	case a.SweepInterval == 0:
+		return errors.New("config: authz sweep_interval must be positive")
+	case a.OverrideTTL == 0:
+		return errors.New("config: authz override_ttl must be positive")
+	case a.ApprovalDeadline == 0:
+		return errors.New("config: authz approval_deadline must be positive")
+	}
+	return nil
+}
+
+func (a *authzConfig) loadFromEnv() {
+	loadEnvUint("AUTHZ_CACHE_TTL", &a.CacheTTL)
+	loadEnvUint("AUTHZ_SWEEP_INTERVAL", &a.SweepInterval)
+	loadEnvUint("AUTHZ_APPROVAL_DEADLINE", &a.ApprovalDeadline)
+	loadEnvUint("AUTHZ_OVERRIDE_TTL", &a.OverrideTTL)
+}
+
+type organizationConfig struct {
+	// OperatorKey must be given to create an organization; the sign-up
+	// is closed while it is empty.
+	OperatorKey string `yaml:"operator_key" json:"-"`
+}
+
+func (o *organizationConfig) loadFromEnv() {
+	loadEnvStr("ORGANIZATION_OPERATOR_KEY", &o.OperatorKey)
+}
+
 type config struct {
-	Listen listenConfig `yaml:"listen" json:"listen"`
-	DBCfg  pgConfig     `yaml:"db" json:"db"`
-	JwtCfg jwtConfig    `yaml:"jwt" json:"jwt"`
+	Listen          listenConfig       `yaml:"listen" json:"listen"`
+	DBCfg           pgConfig           `yaml:"db" json:"db"`
+	JwtCfg          jwtConfig          `yaml:"jwt" json:"jwt"`
+	SessionCfg      sessionConfig      `yaml:"session" json:"session"`
+	AuthzCfg        authzConfig        `yaml:"authz" json:"authz"`
+	OrganizationCfg organizationConfig `yaml:"organization" json:"organization"`
 }
 
 func (c *config) loadFromEnv() {
 	c.Listen.loadFromEnv()
 	c.DBCfg.loadFromEnv()
 	c.JwtCfg.loadFromEnv()
+	c.SessionCfg.loadFromEnv()
+	c.AuthzCfg.loadFromEnv()
+	c.OrganizationCfg.loadFromEnv()
+}
+
+// validate refuses settings the server would otherwise misread.
+func (c *config) validate() error {
+	if err := c.SessionCfg.validate(); err != nil {
+		return err
+	}
+	return c.AuthzCfg.validate()
 }
 
 func defaultConfig() config {
 	return config{
-		Listen: defaultListenConfig(),
-		DBCfg:  defaultPgConfig(),
-		JwtCfg: defaultJwtConfig(),
+		Listen:     defaultListenConfig(),
+		DBCfg:      defaultPgConfig(),
+		JwtCfg:     defaultJwtConfig(),
+		SessionCfg: defaultSessionConfig(),
+		AuthzCfg:   defaultAuthzConfig(),
 	}
 }
 
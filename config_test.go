@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *config)
+		wantErr bool
+	}{
+		{"defaults", func(c *config) {}, false},
+		{"unknown limit policy", func(c *config) { c.SessionCfg.LimitPolicy = "evict_newest" }, true},
+		{"zero cache ttl", func(c *config) { c.AuthzCfg.CacheTTL = 0 }, true},
+		{"zero sweep interval", func(c *config) { c.AuthzCfg.SweepInterval = 0 }, true},
+		{"zero override ttl", func(c *config) { c.AuthzCfg.OverrideTTL = 0 }, true},
+		{"zero approval deadline", func(c *config) { c.AuthzCfg.ApprovalDeadline = 0 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			tt.change(&c)
+			if err := c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS family_id bytea,
+    ADD COLUMN IF NOT EXISTS parent_id bytea;
+
+UPDATE refresh_tokens SET family_id = id WHERE family_id IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS refresh_tokens_account_id_idx;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS device_name;
\ No newline at end of file
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS refresh_tokens_token_hash_key;
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS token_value VARCHAR(255);
+
+-- Plaintext tokens cannot be recovered from their hash; keep the rows but
+-- make sure none of them can be used.
+UPDATE refresh_tokens SET token_value = token_hash, revoked = TRUE;
+
+ALTER TABLE refresh_tokens ALTER COLUMN token_value SET NOT NULL;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS token_hash;
\ No newline at end of file
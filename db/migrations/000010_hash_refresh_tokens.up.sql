@@ -0,0 +1,15 @@
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS token_hash VARCHAR(64);
+
+-- The HMAC pepper only lives in the server configuration, so existing
+-- plaintext tokens cannot be re-keyed here. They are revoked and replaced by
+-- an unkeyed digest that never matches a lookup; affected accounts log in again.
+UPDATE refresh_tokens
+SET
+    token_hash = encode(sha256(convert_to(token_value, 'UTF8')), 'hex'),
+    revoked = TRUE
+WHERE token_hash IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS token_value;
+
+CREATE UNIQUE INDEX IF NOT EXISTS refresh_tokens_token_hash_key ON refresh_tokens (token_hash);
\ No newline at end of file
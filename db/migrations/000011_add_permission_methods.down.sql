@@ -0,0 +1,33 @@
+-- Rows differing only by methods would grant the same url: they are
+-- merged into the first of them before url is unique again.
+CREATE TEMPORARY TABLE permission_merges AS
+SELECT
+    p.id AS old_id,
+    (
+        SELECT f.id
+        FROM permissions f
+        WHERE f.url = p.url
+        ORDER BY f.id
+        LIMIT 1
+    ) AS new_id
+FROM permissions p;
+
+INSERT INTO role_permissions (permission_id, role_id)
+SELECT m.new_id, rp.role_id
+FROM role_permissions rp
+JOIN permission_merges m ON rp.permission_id = m.old_id
+WHERE m.old_id <> m.new_id
+ON CONFLICT DO NOTHING;
+DELETE FROM role_permissions rp
+USING permission_merges m
+WHERE rp.permission_id = m.old_id AND m.old_id <> m.new_id;
+DELETE FROM permissions p
+USING permission_merges m
+WHERE p.id = m.old_id AND m.old_id <> m.new_id;
+
+DROP TABLE permission_merges;
+
+DROP INDEX IF EXISTS permissions_url_methods_key;
+ALTER TABLE permissions ADD CONSTRAINT permissions_url_key UNIQUE (url);
+
+ALTER TABLE permissions DROP COLUMN IF EXISTS methods;
\ No newline at end of file
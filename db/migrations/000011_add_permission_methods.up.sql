@@ -0,0 +1,5 @@
+-- An empty method list means the permission covers every HTTP method.
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS methods VARCHAR(8)[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE permissions DROP CONSTRAINT IF EXISTS permissions_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_url_methods_key ON permissions (url, methods);
\ No newline at end of file
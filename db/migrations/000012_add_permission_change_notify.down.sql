@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS permissions_notify ON permissions;
+DROP TRIGGER IF EXISTS role_permissions_notify ON role_permissions;
+DROP TRIGGER IF EXISTS account_roles_notify ON account_roles;
+
+DROP FUNCTION IF EXISTS notify_permission_change();
+DROP FUNCTION IF EXISTS notify_role_permission_change();
+DROP FUNCTION IF EXISTS notify_account_role_change();
\ No newline at end of file
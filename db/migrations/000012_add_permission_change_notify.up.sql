@@ -0,0 +1,52 @@
+-- Every change that can alter an account's effective permissions is
+-- published on the rbac_changed channel. The payload is the hex encoded
+-- account id, or '*' when every account may be affected.
+CREATE OR REPLACE FUNCTION notify_account_role_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM pg_notify('rbac_changed', encode(OLD.account_id, 'hex'));
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM pg_notify('rbac_changed', encode(NEW.account_id, 'hex'));
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_role_permission_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM pg_notify('rbac_changed', encode(ar.account_id, 'hex'))
+        FROM account_roles ar
+        WHERE ar.role_id = OLD.role_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM pg_notify('rbac_changed', encode(ar.account_id, 'hex'))
+        FROM account_roles ar
+        WHERE ar.role_id = NEW.role_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_permission_change() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('rbac_changed', '*');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS account_roles_notify ON account_roles;
+CREATE TRIGGER account_roles_notify
+    AFTER INSERT OR UPDATE OR DELETE ON account_roles
+    FOR EACH ROW EXECUTE FUNCTION notify_account_role_change();
+
+DROP TRIGGER IF EXISTS role_permissions_notify ON role_permissions;
+CREATE TRIGGER role_permissions_notify
+    AFTER INSERT OR UPDATE OR DELETE ON role_permissions
+    FOR EACH ROW EXECUTE FUNCTION notify_role_permission_change();
+
+DROP TRIGGER IF EXISTS permissions_notify ON permissions;
+CREATE TRIGGER permissions_notify
+    AFTER UPDATE OR DELETE ON permissions
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_permission_change();
\ No newline at end of file
@@ -0,0 +1,19 @@
+DROP TRIGGER IF EXISTS role_parents_notify ON role_parents;
+
+CREATE OR REPLACE FUNCTION notify_role_permission_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM pg_notify('rbac_changed', encode(ar.account_id, 'hex'))
+        FROM account_roles ar
+        WHERE ar.role_id = OLD.role_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM pg_notify('rbac_changed', encode(ar.account_id, 'hex'))
+        FROM account_roles ar
+        WHERE ar.role_id = NEW.role_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS role_parents;
\ No newline at end of file
@@ -0,0 +1,44 @@
+-- A role inherits every permission of its parent roles, transitively.
+CREATE TABLE IF NOT EXISTS role_parents (
+    role_id bytea,
+    parent_id bytea,
+    PRIMARY KEY (role_id, parent_id),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES roles(id) ON DELETE CASCADE,
+    CHECK (role_id <> parent_id)
+);
+CREATE INDEX IF NOT EXISTS role_parents_parent_id_idx ON role_parents (parent_id);
+
+-- A permission change on a role reaches every account holding the role or
+-- one of the roles inheriting from it.
+CREATE OR REPLACE FUNCTION notify_role_permission_change() RETURNS trigger AS $$
+DECLARE
+    changed_role bytea;
+BEGIN
+    FOREACH changed_role IN ARRAY CASE TG_OP
+        WHEN 'INSERT' THEN ARRAY[NEW.role_id]
+        WHEN 'DELETE' THEN ARRAY[OLD.role_id]
+        ELSE ARRAY[OLD.role_id, NEW.role_id]
+    END LOOP
+        PERFORM pg_notify('rbac_changed', encode(ar.account_id, 'hex'))
+        FROM (
+            WITH RECURSIVE descendants(id) AS (
+                SELECT changed_role
+                UNION
+                SELECT rp.role_id
+                FROM role_parents rp
+                JOIN descendants d ON rp.parent_id = d.id
+            )
+            SELECT DISTINCT ar.account_id
+            FROM account_roles ar
+            JOIN descendants d ON ar.role_id = d.id
+        ) ar;
+    END LOOP;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS role_parents_notify ON role_parents;
+CREATE TRIGGER role_parents_notify
+    AFTER INSERT OR UPDATE OR DELETE ON role_parents
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_permission_change();
\ No newline at end of file
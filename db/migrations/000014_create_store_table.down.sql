@@ -0,0 +1,6 @@
+DELETE FROM account_roles WHERE store_id IS NOT NULL;
+DROP INDEX IF EXISTS account_roles_scope_key;
+ALTER TABLE account_roles DROP COLUMN IF EXISTS store_id;
+ALTER TABLE account_roles ADD PRIMARY KEY (account_id, role_id);
+
+DROP TABLE IF EXISTS stores;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS stores (
+    id bytea PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    address TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+-- An assignment without a store applies to every store.
+ALTER TABLE account_roles ADD COLUMN IF NOT EXISTS store_id bytea REFERENCES stores(id) ON DELETE CASCADE;
+ALTER TABLE account_roles DROP CONSTRAINT IF EXISTS account_roles_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS account_roles_scope_key ON account_roles (account_id, role_id, COALESCE(store_id, ''::bytea));
\ No newline at end of file
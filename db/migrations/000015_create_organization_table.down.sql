@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS stores_organization_name_key;
+ALTER TABLE stores ADD CONSTRAINT stores_name_key UNIQUE (name);
+DROP INDEX IF EXISTS permissions_url_methods_key;
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_url_methods_key ON permissions (url, methods);
+
+ALTER TABLE stores DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE accounts DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE roles DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE permissions DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organizations;
\ No newline at end of file
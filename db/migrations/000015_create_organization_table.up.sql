@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id bytea PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Rows created before organizations existed belong to a default one.
+INSERT INTO organizations (id, name, created_at)
+VALUES (decode('00000000000000000000000000000001', 'hex'), 'default', NOW())
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS organization_id bytea REFERENCES organizations(id);
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS organization_id bytea REFERENCES organizations(id);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS organization_id bytea REFERENCES organizations(id);
+ALTER TABLE stores ADD COLUMN IF NOT EXISTS organization_id bytea REFERENCES organizations(id);
+
+UPDATE permissions SET organization_id = decode('00000000000000000000000000000001', 'hex') WHERE organization_id IS NULL;
+UPDATE roles SET organization_id = decode('00000000000000000000000000000001', 'hex') WHERE organization_id IS NULL;
+UPDATE accounts SET organization_id = decode('00000000000000000000000000000001', 'hex') WHERE organization_id IS NULL;
+UPDATE stores SET organization_id = decode('00000000000000000000000000000001', 'hex') WHERE organization_id IS NULL;
+
+ALTER TABLE permissions ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE roles ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE accounts ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE stores ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS permissions_organization_id_idx ON permissions (organization_id);
+CREATE INDEX IF NOT EXISTS roles_organization_id_idx ON roles (organization_id);
+CREATE INDEX IF NOT EXISTS accounts_organization_id_idx ON accounts (organization_id);
+
+-- Names are unique per organization. Emails stay globally unique, since
+-- the login form does not ask for an organization.
+DROP INDEX IF EXISTS permissions_url_methods_key;
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_url_methods_key ON permissions (organization_id, url, methods);
+ALTER TABLE stores DROP CONSTRAINT IF EXISTS stores_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS stores_organization_name_key ON stores (organization_id, name);
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS account_role_history;
+
+DROP INDEX IF EXISTS account_roles_valid_until_idx;
+ALTER TABLE account_roles DROP CONSTRAINT IF EXISTS account_roles_validity_check;
+ALTER TABLE account_roles
+    DROP COLUMN IF EXISTS valid_from,
+    DROP COLUMN IF EXISTS valid_until;
\ No newline at end of file
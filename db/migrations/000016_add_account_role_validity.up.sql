@@ -0,0 +1,21 @@
+-- A NULL bound leaves that side of the assignment open.
+ALTER TABLE account_roles
+    ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS valid_until TIMESTAMP;
+ALTER TABLE account_roles ADD CONSTRAINT account_roles_validity_check
+    CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_from < valid_until);
+CREATE INDEX IF NOT EXISTS account_roles_valid_until_idx ON account_roles (valid_until) WHERE valid_until IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS account_role_history (
+    id BIGSERIAL PRIMARY KEY,
+    account_id bytea NOT NULL,
+    role_id bytea NOT NULL,
+    store_id bytea,
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    event VARCHAR(16) NOT NULL,
+    recorded_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS account_role_history_account_id_idx ON account_role_history (account_id);
\ No newline at end of file
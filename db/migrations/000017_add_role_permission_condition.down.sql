@@ -0,0 +1,3 @@
+ALTER TABLE stores DROP COLUMN IF EXISTS timezone;
+
+ALTER TABLE role_permissions DROP COLUMN IF EXISTS condition;
\ No newline at end of file
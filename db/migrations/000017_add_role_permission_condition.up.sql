@@ -0,0 +1,5 @@
+-- An empty condition grants the permission unconditionally.
+ALTER TABLE role_permissions ADD COLUMN IF NOT EXISTS condition TEXT NOT NULL DEFAULT '';
+
+-- Time conditions are evaluated in the time zone of the store.
+ALTER TABLE stores ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
\ No newline at end of file
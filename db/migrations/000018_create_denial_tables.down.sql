@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_denials;
+DROP TABLE IF EXISTS role_denials;
\ No newline at end of file
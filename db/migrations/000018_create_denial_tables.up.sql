@@ -0,0 +1,34 @@
+-- A denial blocks a permission whatever grants it: on a role it applies to
+-- every account holding the role or one of its descendants, on an account
+-- to that account alone.
+CREATE TABLE IF NOT EXISTS role_denials (
+    role_id bytea NOT NULL,
+    permission_id bytea NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS role_denials_permission_id_idx ON role_denials (permission_id);
+
+CREATE TABLE IF NOT EXISTS account_denials (
+    account_id bytea NOT NULL,
+    permission_id bytea NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (account_id, permission_id),
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS account_denials_permission_id_idx ON account_denials (permission_id);
+
+DROP TRIGGER IF EXISTS role_denials_notify ON role_denials;
+CREATE TRIGGER role_denials_notify
+    AFTER INSERT OR UPDATE OR DELETE ON role_denials
+    FOR EACH ROW EXECUTE FUNCTION notify_role_permission_change();
+
+DROP TRIGGER IF EXISTS account_denials_notify ON account_denials;
+CREATE TRIGGER account_denials_notify
+    AFTER INSERT OR UPDATE OR DELETE ON account_denials
+    FOR EACH ROW EXECUTE FUNCTION notify_account_role_change();
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS session_roles;
+ALTER TABLE roles DROP COLUMN IF EXISTS max_accounts;
+DROP TABLE IF EXISTS sod_constraint_roles;
+DROP TABLE IF EXISTS sod_constraints;
\ No newline at end of file
@@ -0,0 +1,45 @@
+-- A static constraint forbids an account from holding more than one of its
+-- roles; a dynamic one lets the account hold them all but activate only one
+-- of them per session.
+CREATE TABLE IF NOT EXISTS sod_constraints (
+    id bytea PRIMARY KEY,
+    organization_id bytea NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('static', 'dynamic')),
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS sod_constraint_roles (
+    constraint_id bytea NOT NULL,
+    role_id bytea NOT NULL,
+    PRIMARY KEY (constraint_id, role_id),
+    FOREIGN KEY (constraint_id) REFERENCES sod_constraints(id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS sod_constraint_roles_role_id_idx ON sod_constraint_roles (role_id);
+
+-- Most accounts a role may be assigned to, NULL for no limit.
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS max_accounts INTEGER CHECK (max_accounts > 0);
+
+-- Roles of dynamic constraints activated in a session, the session being
+-- the refresh token family.
+CREATE TABLE IF NOT EXISTS session_roles (
+    session_id bytea NOT NULL,
+    account_id bytea NOT NULL,
+    role_id bytea NOT NULL,
+    activated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (session_id, role_id),
+    FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+
+DROP TRIGGER IF EXISTS session_roles_notify ON session_roles;
+CREATE TRIGGER session_roles_notify
+    AFTER INSERT OR UPDATE OR DELETE ON session_roles
+    FOR EACH ROW EXECUTE FUNCTION notify_account_role_change();
+
+DROP TRIGGER IF EXISTS sod_constraint_roles_notify ON sod_constraint_roles;
+CREATE TRIGGER sod_constraint_roles_notify
+    AFTER INSERT OR UPDATE OR DELETE ON sod_constraint_roles
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_permission_change();
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS approval_requests;
+ALTER TABLE roles DROP COLUMN IF EXISTS requires_approval;
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- Roles whose assignments wait for a second account to approve them.
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS requires_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Assignments of such roles held back for approval. Requests are kept once
+-- decided, as the record of who asked for an assignment and who approved
+-- or rejected it. A pending request past expires_at counts as expired.
+CREATE TABLE IF NOT EXISTS approval_requests (
+    id bytea PRIMARY KEY,
+    organization_id bytea NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    account_id bytea NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    role_id bytea NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    store_id bytea REFERENCES stores(id) ON DELETE CASCADE,
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'approved', 'rejected', 'expired')),
+    requested_by bytea NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    decided_by bytea,
+    decided_at TIMESTAMP,
+    comment TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS approval_requests_organization_id_idx ON approval_requests (organization_id, created_at);
+
+-- At most one pending request per assignment.
+CREATE UNIQUE INDEX IF NOT EXISTS approval_requests_pending_idx
+    ON approval_requests (account_id, role_id, COALESCE(store_id, ''::bytea))
+    WHERE status = 'pending';
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS access_review_items;
+DROP TABLE IF EXISTS access_review_reviewers;
+DROP TABLE IF EXISTS access_reviews;
\ No newline at end of file
@@ -0,0 +1,48 @@
+-- Access review campaigns recertify role assignments, and optionally role
+-- permissions, as snapshotted when the campaign opens.
+CREATE TABLE IF NOT EXISTS access_reviews (
+    id bytea PRIMARY KEY,
+    organization_id bytea NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('open', 'closed')),
+    include_permissions BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by bytea NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    due_at TIMESTAMP,
+    closed_by bytea,
+    closed_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS access_reviews_organization_id_idx ON access_reviews (organization_id, created_at);
+
+-- A reviewer decides on the items of one role or of one store.
+CREATE TABLE IF NOT EXISTS access_review_reviewers (
+    review_id bytea NOT NULL REFERENCES access_reviews(id) ON DELETE CASCADE,
+    account_id bytea NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    role_id bytea REFERENCES roles(id) ON DELETE CASCADE,
+    store_id bytea REFERENCES stores(id) ON DELETE CASCADE,
+    CHECK ((role_id IS NULL) <> (store_id IS NULL))
+);
+CREATE INDEX IF NOT EXISTS access_review_reviewers_review_id_idx ON access_review_reviewers (review_id, account_id);
+
+-- Items are copies, names included, so the record of a campaign outlives
+-- the accounts, roles and permissions it reviewed.
+CREATE TABLE IF NOT EXISTS access_review_items (
+    id bytea PRIMARY KEY,
+    review_id bytea NOT NULL REFERENCES access_reviews(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('account_role', 'role_permission')),
+    account_id bytea,
+    account_email VARCHAR(255) NOT NULL DEFAULT '',
+    role_id bytea NOT NULL,
+    role_name VARCHAR(255) NOT NULL,
+    store_id bytea,
+    permission_id bytea,
+    grants TEXT[] NOT NULL DEFAULT '{}',
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    decision VARCHAR(16) CHECK (decision IN ('keep', 'revoke')),
+    decided_by bytea,
+    decided_at TIMESTAMP,
+    comment TEXT NOT NULL DEFAULT '',
+    applied_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS access_review_items_review_id_idx ON access_review_items (review_id);
\ No newline at end of file
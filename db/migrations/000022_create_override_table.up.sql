@@ -0,0 +1,16 @@
+-- Manager overrides: single use grants letting an account perform one
+-- request on the word of an approver holding the permission. Rows are
+-- kept as the record of both identities.
+CREATE TABLE IF NOT EXISTS overrides (
+    id bytea PRIMARY KEY,
+    organization_id bytea NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    account_id bytea NOT NULL,
+    approver_id bytea NOT NULL,
+    method VARCHAR(16) NOT NULL,
+    resource VARCHAR(255) NOT NULL,
+    store_id bytea,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS overrides_organization_id_idx ON overrides (organization_id, created_at);
\ No newline at end of file
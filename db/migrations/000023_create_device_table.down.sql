@@ -0,0 +1,5 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS device_id;
+
+DROP TABLE IF EXISTS account_pins;
+DROP TABLE IF EXISTS devices;
\ No newline at end of file
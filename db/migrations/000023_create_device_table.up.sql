@@ -0,0 +1,26 @@
+-- Registered POS terminals. A device authenticates with its id and a
+-- secret handed out once at registration; only a keyed hash of the secret
+-- is kept.
+CREATE TABLE IF NOT EXISTS devices (
+    id bytea PRIMARY KEY,
+    organization_id bytea NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS devices_organization_id_idx ON devices (organization_id);
+
+-- Short numeric PINs accounts sign in with on a device, hashed apart from
+-- the password. failures counts the wrong PINs since the last lockout.
+CREATE TABLE IF NOT EXISTS account_pins (
+    account_id bytea PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    pin_hash VARCHAR(255) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Sessions opened on a device are only valid from that device, and end
+-- when it is removed.
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS device_id bytea REFERENCES devices(id) ON DELETE CASCADE;
\ No newline at end of file
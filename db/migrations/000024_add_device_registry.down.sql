@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS device_enrollments;
+
+DELETE FROM devices WHERE secret_hash IS NULL;
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS store_id,
+    DROP COLUMN IF EXISTS public_key,
+    ALTER COLUMN secret_hash SET NOT NULL;
\ No newline at end of file
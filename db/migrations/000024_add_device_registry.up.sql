@@ -0,0 +1,25 @@
+-- Devices may enroll with a code issued by an administrator and sign in
+-- with a key of their own instead of a secret, be assigned to a store and
+-- be disabled. last_seen_at is when the device last authenticated.
+ALTER TABLE devices
+    ALTER COLUMN secret_hash DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS public_key TEXT,
+    ADD COLUMN IF NOT EXISTS store_id bytea REFERENCES stores(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
+
+-- Single use codes a device enrolls with. Only a keyed hash of the code is
+-- kept; device_id is the device enrolled with it.
+CREATE TABLE IF NOT EXISTS device_enrollments (
+    id bytea PRIMARY KEY,
+    organization_id bytea NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    store_id bytea REFERENCES stores(id) ON DELETE CASCADE,
+    created_by bytea NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    device_id bytea REFERENCES devices(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS device_enrollments_organization_id_idx ON device_enrollments (organization_id, created_at);
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- Rows merged by the up migration stay merged.
+UPDATE permissions
+SET url = 'view-inventory', methods = '{}'
+WHERE url = 'inventory' AND methods = '{GET}';
+
+UPDATE permissions
+SET url = 'manage-inventory', methods = '{}'
+WHERE url = 'inventory' AND methods = '{POST,PUT,DELETE}';
\ No newline at end of file
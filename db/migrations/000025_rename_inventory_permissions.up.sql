@@ -0,0 +1,75 @@
+-- Inventory permissions moved from the view-inventory and manage-inventory
+-- urls to a single inventory url split by method. A row without methods
+-- gets the methods of the routes its url guarded. Rows ending up with the
+-- same organization and methods are merged into one, the inventory row
+-- already there if any, along with the grants, denials and open reviews
+-- pointing at them.
+CREATE TEMPORARY TABLE inventory_renames AS
+SELECT
+    id AS old_id,
+    organization_id,
+    CASE
+        WHEN methods <> '{}' THEN methods
+        WHEN url = 'view-inventory' THEN '{GET}'::VARCHAR(8)[]
+        ELSE '{POST,PUT,DELETE}'::VARCHAR(8)[]
+    END AS methods,
+    NULL::bytea AS new_id
+FROM permissions
+WHERE url IN ('view-inventory', 'manage-inventory');
+
+UPDATE inventory_renames r
+SET new_id = COALESCE(
+    (
+        SELECT p.id
+        FROM permissions p
+        WHERE p.organization_id = r.organization_id AND p.url = 'inventory' AND p.methods = r.methods
+    ),
+    (
+        SELECT o.old_id
+        FROM inventory_renames o
+        WHERE o.organization_id = r.organization_id AND o.methods = r.methods
+        ORDER BY o.old_id
+        LIMIT 1
+    )
+);
+
+INSERT INTO role_permissions (permission_id, role_id, condition)
+SELECT r.new_id, rp.role_id, rp.condition
+FROM role_permissions rp
+JOIN inventory_renames r ON rp.permission_id = r.old_id
+WHERE r.old_id <> r.new_id
+ON CONFLICT DO NOTHING;
+DELETE FROM role_permissions rp
+USING inventory_renames r
+WHERE rp.permission_id = r.old_id AND r.old_id <> r.new_id;
+
+INSERT INTO role_denials (role_id, permission_id, reason, created_at)
+SELECT rd.role_id, r.new_id, rd.reason, rd.created_at
+FROM role_denials rd
+JOIN inventory_renames r ON rd.permission_id = r.old_id
+WHERE r.old_id <> r.new_id
+ON CONFLICT DO NOTHING;
+
+INSERT INTO account_denials (account_id, permission_id, reason, created_at)
+SELECT ad.account_id, r.new_id, ad.reason, ad.created_at
+FROM account_denials ad
+JOIN inventory_renames r ON ad.permission_id = r.old_id
+WHERE r.old_id <> r.new_id
+ON CONFLICT DO NOTHING;
+
+UPDATE access_review_items i
+SET permission_id = r.new_id
+FROM inventory_renames r
+WHERE i.permission_id = r.old_id AND r.old_id <> r.new_id;
+
+-- Denials of the merged rows go with them.
+DELETE FROM permissions p
+USING inventory_renames r
+WHERE p.id = r.old_id AND r.old_id <> r.new_id;
+
+UPDATE permissions p
+SET url = 'inventory', methods = r.methods
+FROM inventory_renames r
+WHERE p.id = r.old_id AND r.old_id = r.new_id;
+
+DROP TABLE inventory_renames;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions
+WHERE permission_id IN (SELECT id FROM permissions WHERE url = 'store:manage');
+DELETE FROM permissions WHERE url = 'store:manage';
\ No newline at end of file
@@ -0,0 +1,29 @@
+-- Stores are managed under store:manage. Every organization gets the
+-- permission, granted to the roles already managing users so that existing
+-- administrators keep managing their stores.
+INSERT INTO permissions (id, organization_id, name, description, url, methods, created_at)
+SELECT
+    -- A ULID: 48 bits of milliseconds, then 80 random bits.
+    substring(int8send((extract(epoch FROM clock_timestamp()) * 1000)::bigint) FROM 3)
+        || substring(decode(md5(random()::text || encode(o.id, 'hex')), 'hex') FROM 1 FOR 10),
+    o.id,
+    'Manage Stores',
+    'Permission to create, change and remove the outlets of the organization.',
+    'store:manage',
+    '{}',
+    NOW()
+FROM organizations o
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM permissions p
+    WHERE p.organization_id = o.id AND p.url = 'store:manage' AND p.methods = '{}'
+);
+
+INSERT INTO role_permissions (permission_id, role_id)
+SELECT DISTINCT np.id, rp.role_id
+FROM role_permissions rp
+JOIN permissions up ON rp.permission_id = up.id
+JOIN permissions np ON np.organization_id = up.organization_id
+WHERE up.url = 'user-management' AND up.methods = '{}' AND rp.condition = ''
+    AND np.url = 'store:manage' AND np.methods = '{}'
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,24 @@
+DELETE FROM role_permissions
+WHERE permission_id IN (
+    SELECT id
+    FROM permissions
+    WHERE url IN (
+        'role:manage',
+        'account-role:assign',
+        'access-review:manage',
+        'account-role:approve',
+        'override:audit',
+        'device:manage',
+        'authz/check'
+    )
+);
+DELETE FROM permissions
+WHERE url IN (
+    'role:manage',
+    'account-role:assign',
+    'access-review:manage',
+    'account-role:approve',
+    'override:audit',
+    'device:manage',
+    'authz/check'
+);
\ No newline at end of file
@@ -0,0 +1,48 @@
+-- The administration endpoints are guarded by their own permissions.
+-- Every organization gets those it lacks, granted to the roles already
+-- managing users so that existing administrators keep administering.
+CREATE TEMPORARY TABLE admin_permissions (
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    url TEXT NOT NULL
+);
+
+INSERT INTO admin_permissions (name, description, url) VALUES
+    ('Manage Roles', 'Permission to manage roles, permissions and their constraints.', 'role:manage'),
+    ('Assign Roles', 'Permission to assign roles to and deny grants from accounts.', 'account-role:assign'),
+    ('Manage Access Reviews', 'Permission to open, close and report on access review campaigns.', 'access-review:manage'),
+    ('Approve Roles', 'Permission to approve or reject role assignments awaiting a second approver.', 'account-role:approve'),
+    ('Audit Overrides', 'Permission to list the manager overrides granted in the organization.', 'override:audit'),
+    ('Manage Devices', 'Permission to register, rename and remove the POS terminals of the organization.', 'device:manage'),
+    ('Check Authorization', 'Permission to ask whether an account may perform a request.', 'authz/check');
+
+INSERT INTO permissions (id, organization_id, name, description, url, methods, created_at)
+SELECT
+    -- A ULID: 48 bits of milliseconds, then 80 random bits.
+    substring(int8send((extract(epoch FROM clock_timestamp()) * 1000)::bigint) FROM 3)
+        || substring(decode(md5(random()::text || encode(o.id, 'hex') || ap.url), 'hex') FROM 1 FOR 10),
+    o.id,
+    ap.name,
+    ap.description,
+    ap.url,
+    '{}',
+    NOW()
+FROM organizations o
+CROSS JOIN admin_permissions ap
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM permissions p
+    WHERE p.organization_id = o.id AND p.url = ap.url AND p.methods = '{}'
+);
+
+INSERT INTO role_permissions (permission_id, role_id)
+SELECT DISTINCT np.id, rp.role_id
+FROM role_permissions rp
+JOIN permissions up ON rp.permission_id = up.id
+JOIN permissions np ON np.organization_id = up.organization_id
+JOIN admin_permissions ap ON np.url = ap.url
+WHERE up.url = 'user-management' AND up.methods = '{}' AND rp.condition = ''
+    AND np.methods = '{}'
+ON CONFLICT DO NOTHING;
+
+DROP TABLE admin_permissions;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE overrides DROP COLUMN IF EXISTS attributes;
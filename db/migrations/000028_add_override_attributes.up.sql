@@ -0,0 +1,3 @@
+-- Overrides are bound to the request attributes the approver's conditions
+-- were checked against, such as the amount of a refund.
+ALTER TABLE overrides ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+    DROP COLUMN IF EXISTS password_locked_until,
+    DROP COLUMN IF EXISTS password_failures;
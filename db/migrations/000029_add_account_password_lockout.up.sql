@@ -0,0 +1,5 @@
+-- Wrong passwords given to approve an override count towards a lockout,
+-- as wrong PINs do on account_pins.
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS password_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS password_locked_until TIMESTAMP;
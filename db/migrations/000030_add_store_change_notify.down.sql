@@ -0,0 +1 @@
+DROP TRIGGER IF EXISTS stores_notify ON stores;
@@ -0,0 +1,6 @@
+-- Changing the time zone of a store, or removing it, changes how the time
+-- conditions of its grants are evaluated: every instance drops its cache.
+DROP TRIGGER IF EXISTS stores_notify ON stores;
+CREATE TRIGGER stores_notify
+    AFTER UPDATE OF timezone OR DELETE ON stores
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_permission_change();
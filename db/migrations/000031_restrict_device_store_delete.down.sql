@@ -0,0 +1,4 @@
+ALTER TABLE devices DROP CONSTRAINT IF EXISTS devices_store_id_fkey;
+ALTER TABLE devices
+    ADD CONSTRAINT devices_store_id_fkey
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE SET NULL;
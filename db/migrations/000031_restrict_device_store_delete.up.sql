@@ -0,0 +1,7 @@
+-- A device assigned to a store is locked to it: the store cannot be
+-- removed while a device is assigned to it, rather than set the device
+-- loose in every store.
+ALTER TABLE devices DROP CONSTRAINT IF EXISTS devices_store_id_fkey;
+ALTER TABLE devices
+    ADD CONSTRAINT devices_store_id_fkey
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE RESTRICT;
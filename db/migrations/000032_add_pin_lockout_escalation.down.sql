@@ -0,0 +1,5 @@
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS pin_failures;
+
+ALTER TABLE account_pins
+    DROP COLUMN IF EXISTS lockouts;
@@ -0,0 +1,9 @@
+-- lockouts counts how often the PIN of an account locked since it was
+-- last unlocked by an administrator; past a limit it stays locked until
+-- then. pin_failures counts the wrong PINs keyed in on a device in a row;
+-- past a limit the device is disabled.
+ALTER TABLE account_pins
+    ADD COLUMN IF NOT EXISTS lockouts INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS pin_failures INTEGER NOT NULL DEFAULT 0;
@@ -9,15 +9,63 @@ import (
 )
 
 type Account struct {
-	Id        ulid.ULID `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
+	Id             ulid.ULID `json:"id"`
+	OrganizationId ulid.ULID `json:"organization_id"`
+	Email          string    `json:"email"`
+	Password       string    `json:"password"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
+// AccountPin is the PIN an account signs in with on a device. Failures
+// counts the PINs entered since the last lockout or right PIN; the PIN is
+// refused until LockedUntil once too many were.
+type AccountPin struct {
+	AccountId   ulid.ULID  `json:"account_id"`
+	Hash        string     `json:"-"`
+	Failures    int        `json:"failures"`
+	Lockouts    int        `json:"lockouts"`
+	LockedUntil *time.Time `json:"locked_until"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// LockedAt reports whether the PIN is refused at t.
+func (p AccountPin) LockedAt(t time.Time) bool {
+	return p.LockedUntil != nil && t.Before(*p.LockedUntil)
+}
+
+// AccountRole assigns a role to an account, in one store or, when StoreId
+// is nil, in every store.
 type AccountRole struct {
-	RoleId    ulid.ULID `json:"role_id"`
-	AccountId ulid.ULID `json:"account_id"`
+	RoleId    ulid.ULID  `json:"role_id"`
+	AccountId ulid.ULID  `json:"account_id"`
+	StoreId   *ulid.ULID `json:"store_id"`
+	Validity
+}
+
+// AssignedRole is a role as held by an account, with the store the
+// assignment is limited to.
+type AssignedRole struct {
+	Role
+	StoreId *ulid.ULID `json:"store_id"`
+	Validity
+}
+
+// Validity bounds a role assignment in time. A nil bound is open, so the
+// zero Validity never expires.
+type Validity struct {
+	From  *time.Time `json:"valid_from"`
+	Until *time.Time `json:"valid_until"`
+}
+
+// ActiveAt reports whether the assignment is in force at t.
+func (v Validity) ActiveAt(t time.Time) bool {
+	if v.From != nil && t.Before(*v.From) {
+		return false
+	}
+	if v.Until != nil && !t.Before(*v.Until) {
+		return false
+	}
+	return true
 }
 
 func NewAccount(email, pwd string) (Account, error) {
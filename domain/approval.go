@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Statuses of an approval request. A pending request nobody decided
+// before its deadline is expired.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// ApprovalRequest is the assignment of a role that needs a second approver,
+// held back until another account approves it. RequestedBy and DecidedBy
+// record who asked for the assignment and who approved or rejected it.
+type ApprovalRequest struct {
+	Id        ulid.ULID  `json:"id"`
+	AccountId ulid.ULID  `json:"account_id"`
+	RoleId    ulid.ULID  `json:"role_id"`
+	RoleName  string     `json:"role_name"`
+	StoreId   *ulid.ULID `json:"store_id"`
+	Validity
+	Status      string     `json:"status"`
+	RequestedBy ulid.ULID  `json:"requested_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	DecidedBy   *ulid.ULID `json:"decided_by"`
+	DecidedAt   *time.Time `json:"decided_at"`
+	Comment     string     `json:"comment"`
+}
+
+func NewApprovalRequest(requestedBy, accountId, roleId ulid.ULID, storeId *ulid.ULID, validity Validity, deadline time.Duration) ApprovalRequest {
+	id := ulid.Make()
+	now := time.Now()
+	return ApprovalRequest{
+		Id:          id,
+		AccountId:   accountId,
+		RoleId:      roleId,
+		StoreId:     storeId,
+		Validity:    validity,
+		Status:      ApprovalPending,
+		RequestedBy: requestedBy,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(deadline),
+	}
+}
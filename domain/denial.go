@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Where a denial is set.
+const (
+	DenialOnRole    = "role"
+	DenialOnAccount = "account"
+)
+
+// Denial blocks a permission, for every holder of a role or for a single
+// account, even when another role grants it. Grants are the permission in
+// the form written by FormatGrant.
+type Denial struct {
+	PermissionId ulid.ULID `json:"permission_id"`
+	Name         string    `json:"name"`
+	Grants       []string  `json:"grants"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// DeniedGrant is a grant an account is denied, along with the denial that
+// blocks it. RoleId and RoleName are only set for a denial on a role.
+type DeniedGrant struct {
+	Grant        string     `json:"grant"`
+	On           string     `json:"on"`
+	RoleId       *ulid.ULID `json:"role_id,omitempty"`
+	RoleName     string     `json:"role_name,omitempty"`
+	PermissionId ulid.ULID  `json:"permission_id"`
+	Reason       string     `json:"reason"`
+}
+
+// Rule describes the denial in a few words, for decision reasons.
+func (d DeniedGrant) Rule() string {
+	var rule string
+	switch d.On {
+	case DenialOnRole:
+		rule = "denial on role " + d.RoleName
+	case DenialOnAccount:
+		rule = "denial on the account"
+	default:
+		rule = "a denial"
+	}
+	if d.Reason != "" {
+		rule += " (" + d.Reason + ")"
+	}
+	return rule
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Device is a registered POS terminal. It authenticates either with a
+// secret handed out at registration, of which only a keyed hash is kept,
+// or, once enrolled, with assertions signed by the key whose PEM encoded
+// public half is PublicKey. Sessions opened on a device are bound to it.
+// A device assigned to a store only serves requests in that store; a
+// disabled one is refused.
+type Device struct {
+	Id             ulid.ULID  `json:"id"`
+	OrganizationId ulid.ULID  `json:"organization_id"`
+	Name           string     `json:"name"`
+	SecretHash     string     `json:"-"`
+	PublicKey      string     `json:"public_key,omitempty"`
+	StoreId        *ulid.ULID `json:"store_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DisabledAt     *time.Time `json:"disabled_at"`
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+}
+
+func NewDevice(name string, storeId *ulid.ULID) Device {
+	id := ulid.Make()
+	return Device{
+		Id:        id,
+		Name:      name,
+		StoreId:   storeId,
+		CreatedAt: time.Now(),
+	}
+}
+
+// DeviceRegistration hands the secret of a new device to the one
+// registering it. The secret is not shown again.
+type DeviceRegistration struct {
+	Device Device `json:"device"`
+	Secret string `json:"secret"`
+}
+
+// DeviceEnrollment lets one device enroll itself, named Name and assigned
+// to StoreId, until ExpiresAt. Only a keyed hash of its code is kept;
+// DeviceId is the device enrolled with it.
+type DeviceEnrollment struct {
+	Id             ulid.ULID  `json:"id"`
+	OrganizationId ulid.ULID  `json:"organization_id"`
+	CodeHash       string     `json:"-"`
+	Name           string     `json:"name"`
+	StoreId        *ulid.ULID `json:"store_id"`
+	CreatedBy      ulid.ULID  `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	UsedAt         *time.Time `json:"used_at"`
+	DeviceId       *ulid.ULID `json:"device_id"`
+}
+
+func NewDeviceEnrollment(createdBy ulid.ULID, name string, storeId *ulid.ULID, codeHash string, ttl time.Duration) DeviceEnrollment {
+	id := ulid.Make()
+	now := time.Now()
+	return DeviceEnrollment{
+		Id:        id,
+		CodeHash:  codeHash,
+		Name:      name,
+		StoreId:   storeId,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+// DeviceEnrollmentCode hands the code of a new enrollment to the one
+// issuing it, to be keyed in on the device. The code is not shown again.
+type DeviceEnrollmentCode struct {
+	Enrollment DeviceEnrollment `json:"enrollment"`
+	Code       string           `json:"code"`
+}
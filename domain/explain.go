@@ -0,0 +1,38 @@
+package domain
+
+import "github.com/oklog/ulid/v2"
+
+// States of a path granting a permission.
+const (
+	PathActive     = "active"
+	PathPending    = "pending"
+	PathExpired    = "expired"
+	PathOtherStore = "other_store"
+)
+
+// PermissionPath is one way an account gets a grant: an assignment of a
+// role that holds the grant itself or, when InheritedFromId is set,
+// through the ancestor role named there. Status tells whether the path
+// currently applies.
+type PermissionPath struct {
+	RoleId            ulid.ULID  `json:"role_id"`
+	RoleName          string     `json:"role_name"`
+	InheritedFromId   *ulid.ULID `json:"inherited_from_id,omitempty"`
+	InheritedFromName string     `json:"inherited_from,omitempty"`
+	StoreId           *ulid.ULID `json:"store_id"`
+	Validity
+	Condition string `json:"condition,omitempty"`
+	Status    string `json:"status"`
+}
+
+// EffectivePermission is a grant an account holds, held once or through
+// some path, with the denials restricting it. Effective is set when an
+// active path grants it and no denial takes it away whole: "**" with a
+// denial of refund-transaction is still effective, restricted by that
+// denial. Conditions are not evaluated.
+type EffectivePermission struct {
+	Grant     string           `json:"grant"`
+	Effective bool             `json:"effective"`
+	Paths     []PermissionPath `json:"paths,omitempty"`
+	Denials   []DeniedGrant    `json:"denials,omitempty"`
+}
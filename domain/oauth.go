@@ -7,9 +7,28 @@ import (
 	"github.com/oklog/ulid/v2"
 )
 
+// Audiences of the tokens signed with the keyring. Every token carries
+// the one of its kind in its aud claim, and is only accepted for it.
+const (
+	AudienceAccess       = "pos:access"
+	AudienceOverride     = "pos:override"
+	AudienceReviewReport = "pos:review-report"
+)
+
+// Oauth holds the access token claims. Permissions are the effective
+// permission urls of the account at the time the token was issued,
+// Denials the grants denied to it whatever its roles, and OrganizationId
+// the tenant every request of the token is scoped to. DeviceId is set when
+// the session was opened on a device, and the token is then only valid
+// from it.
 type Oauth struct {
-	Id    ulid.ULID `json:"ulid"`
-	Email string    `json:"email"`
+	Id             ulid.ULID  `json:"ulid"`
+	OrganizationId ulid.ULID  `json:"org"`
+	Email          string     `json:"email"`
+	SessionId      ulid.ULID  `json:"sid"`
+	Permissions    []string   `json:"permissions,omitempty"`
+	Denials        []string   `json:"deny,omitempty"`
+	DeviceId       *ulid.ULID `json:"did,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -21,26 +40,66 @@ type LoginResponse struct {
 	Scope        string `json:"scope"`
 }
 
+// RefreshToken is a single link in a token family. Every refresh rotates
+// the token, so a family is the chain of tokens issued for one login. Only
+// a keyed hash of the token is kept; the plaintext is handed to the client
+// once in LoginResponse.
 type RefreshToken struct {
-	ID         ulid.ULID
-	TokenValue string
-	UserID     ulid.ULID
-	CreatedAt  time.Time
-	ExpiresAt  time.Time
-	Revoked    bool
+	ID        ulid.ULID
+	TokenHash string
+	UserID    ulid.ULID
+	FamilyID  ulid.ULID
+	ParentID  *ulid.ULID
+	SessionMeta
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Revoked   bool
 }
 
-func NewRefreshToken(uid ulid.ULID, token string, expiredAt time.Time) RefreshToken {
+// SessionMeta describes the client a session was opened from. DeviceId is
+// the registered device the session is bound to, if any.
+type SessionMeta struct {
+	DeviceName string     `json:"device_name"`
+	DeviceId   *ulid.ULID `json:"device_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+}
+
+func NewRefreshToken(uid ulid.ULID, tokenHash string, expiredAt time.Time, meta SessionMeta) RefreshToken {
 	id := ulid.Make()
 
 	res := RefreshToken{
-		ID:         id,
-		TokenValue: token,
-		UserID:     uid,
-		CreatedAt:  time.Now(),
-		ExpiresAt:  expiredAt,
-		Revoked:    false,
+		ID:          id,
+		TokenHash:   tokenHash,
+		UserID:      uid,
+		FamilyID:    id,
+		SessionMeta: meta,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   expiredAt,
+		Revoked:     false,
 	}
 
 	return res
 }
+
+// NewRotatedRefreshToken creates the successor of parent within the same family.
+func NewRotatedRefreshToken(parent *RefreshToken, tokenHash string, expiredAt time.Time) RefreshToken {
+	res := NewRefreshToken(parent.UserID, tokenHash, expiredAt, parent.SessionMeta)
+	parentID := parent.ID
+	res.FamilyID = parent.FamilyID
+	res.ParentID = &parentID
+
+	return res
+}
+
+// Session is the client facing view of a refresh token family: one login
+// on one device, identified by the family id.
+type Session struct {
+	Id        ulid.ULID `json:"id"`
+	AccountId ulid.ULID `json:"account_id"`
+	SessionMeta
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Organization is a merchant hosted on the deployment. Every account, role,
+// permission and store belongs to exactly one organization.
+type Organization struct {
+	Id        ulid.ULID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewOrganization(name string) Organization {
+	id := ulid.Make()
+	return Organization{
+		Id:        id,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+}
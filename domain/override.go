@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// Override lets AccountId perform one request it lacks the permission for,
+// on the word of ApproverId, an account holding that permission. It is
+// bound to the request method, to Resource, the permission url with its
+// parameters filled, in a store, and to Attributes, the request attributes
+// the approver's conditions were checked against. It can be used once
+// before ExpiresAt.
+type Override struct {
+	Id             ulid.ULID         `json:"id"`
+	OrganizationId ulid.ULID         `json:"organization_id"`
+	AccountId      ulid.ULID         `json:"account_id"`
+	ApproverId     ulid.ULID         `json:"approver_id"`
+	Method         string            `json:"method"`
+	Resource       string            `json:"resource"`
+	StoreId        *ulid.ULID        `json:"store_id"`
+	Attributes     map[string]string `json:"attributes"`
+	CreatedAt      time.Time         `json:"created_at"`
+	ExpiresAt      time.Time         `json:"expires_at"`
+	UsedAt         *time.Time        `json:"used_at"`
+}
+
+func NewOverride(org, accountId, approverId ulid.ULID, method, resource string, storeId *ulid.ULID, attrs map[string]string, ttl time.Duration) Override {
+	id := ulid.Make()
+	now := time.Now()
+	return Override{
+		Id:             id,
+		OrganizationId: org,
+		AccountId:      accountId,
+		ApproverId:     approverId,
+		Method:         method,
+		Resource:       resource,
+		StoreId:        storeId,
+		Attributes:     attrs,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+	}
+}
+
+// OverrideClaims are the claims of an override token, with the
+// AudienceOverride audience so that it is never taken for an access
+// token.
+type OverrideClaims struct {
+	Override Override `json:"override"`
+	jwt.RegisteredClaims
+}
+
+// OverrideResponse hands an override token to the account it was granted
+// to, to be sent in the X-Override-Token header of the request.
+type OverrideResponse struct {
+	Token    string   `json:"token"`
+	Override Override `json:"override"`
+}
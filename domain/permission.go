@@ -2,6 +2,8 @@ package domain
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/oklog/ulid/v2"
@@ -12,32 +14,91 @@ type Permission struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Url         string    `json:"url"`
+	Methods     []string  `json:"methods"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-func NewPermission(name, desc, url string) Permission {
+func NewPermission(name, desc, url string, methods []string) Permission {
 	id := ulid.Make()
 	return Permission{
 		Id:          id,
 		Name:        name,
 		Description: desc,
 		Url:         url,
+		Methods:     NormalizeMethods(methods),
 		CreatedAt:   time.Now(),
 	}
 }
 
+// NormalizeMethods upper-cases, de-duplicates and sorts methods so that the
+// same set is always stored the same way.
+func NormalizeMethods(methods []string) []string {
+	seen := make(map[string]struct{}, len(methods))
+	res := make([]string, 0, len(methods))
+	for _, m := range methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			continue
+		}
+		if _, ok := seen[m]; ok {
+			continue
+		}
+		seen[m] = struct{}{}
+		res = append(res, m)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Grants returns the permission in grant form, one entry per method, as
+// carried in access tokens. See FormatGrant.
+func (a *Permission) Grants() []string {
+	if len(a.Methods) == 0 {
+		return []string{a.Url}
+	}
+	res := make([]string, len(a.Methods))
+	for i, m := range a.Methods {
+		res[i] = FormatGrant(m, a.Url)
+	}
+	return res
+}
+
+// FormatGrant writes a grant as "METHOD url", or just "url" when the grant
+// applies to every method.
+func FormatGrant(method, url string) string {
+	if method == "" {
+		return url
+	}
+	return method + " " + url
+}
+
+// ParseGrant splits a grant written by FormatGrant. The method is empty for
+// grants that apply to every method.
+func ParseGrant(grant string) (method, url string) {
+	grant = strings.TrimSpace(grant)
+	if i := strings.IndexByte(grant, ' '); i > 0 {
+		return strings.ToUpper(grant[:i]), strings.TrimSpace(grant[i+1:])
+	}
+	return "", grant
+}
+
 func (a *Permission) MarshalJSON() ([]byte, error) {
 	var j struct {
-		Id   ulid.ULID `json:"id"`
-		Name string    `json:"name"`
-		Desc string    `json:"description"`
-		Url  string    `json:"url"`
+		Id      ulid.ULID `json:"id"`
+		Name    string    `json:"name"`
+		Desc    string    `json:"description"`
+		Url     string    `json:"url"`
+		Methods []string  `json:"methods"`
 	}
 
 	j.Id = a.Id
 	j.Name = a.Name
 	j.Desc = a.Description
 	j.Url = a.Url
+	j.Methods = a.Methods
+	if j.Methods == nil {
+		j.Methods = []string{}
+	}
 
 	return json.Marshal(j)
 }
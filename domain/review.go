@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Statuses of an access review campaign.
+const (
+	ReviewOpen   = "open"
+	ReviewClosed = "closed"
+)
+
+// Decisions on a reviewed item. An item nobody decided is kept.
+const (
+	ReviewKeep   = "keep"
+	ReviewRevoke = "revoke"
+)
+
+// Kinds of reviewed items: the assignment of a role to an account, or the
+// grant of a permission to a role.
+const (
+	ReviewItemAccountRole    = "account_role"
+	ReviewItemRolePermission = "role_permission"
+)
+
+// AccessReview is a campaign recertifying the role assignments, and
+// optionally the role permissions, as they stood when it was opened.
+type AccessReview struct {
+	Id                 ulid.ULID  `json:"id"`
+	Name               string     `json:"name"`
+	Status             string     `json:"status"`
+	IncludePermissions bool       `json:"include_permissions"`
+	Reviewers          []Reviewer `json:"reviewers"`
+	CreatedBy          ulid.ULID  `json:"created_by"`
+	CreatedAt          time.Time  `json:"created_at"`
+	DueAt              *time.Time `json:"due_at"`
+	ClosedBy           *ulid.ULID `json:"closed_by"`
+	ClosedAt           *time.Time `json:"closed_at"`
+}
+
+func NewAccessReview(createdBy ulid.ULID, name string, includePermissions bool, dueAt *time.Time, reviewers []Reviewer) AccessReview {
+	id := ulid.Make()
+	return AccessReview{
+		Id:                 id,
+		Name:               name,
+		Status:             ReviewOpen,
+		IncludePermissions: includePermissions,
+		Reviewers:          reviewers,
+		CreatedBy:          createdBy,
+		CreatedAt:          time.Now(),
+		DueAt:              dueAt,
+	}
+}
+
+// Reviewer is an account reviewing the items of one role, or of one store.
+// Exactly one of RoleId and StoreId is set.
+type Reviewer struct {
+	AccountId ulid.ULID  `json:"account_id"`
+	RoleId    *ulid.ULID `json:"role_id,omitempty"`
+	StoreId   *ulid.ULID `json:"store_id,omitempty"`
+}
+
+// ReviewItem is an assignment or a grant as snapshotted by a campaign, with
+// the decision taken on it. Names are copied so the record outlives the
+// account, role or permission. AppliedAt is set once a revoke was carried
+// out.
+type ReviewItem struct {
+	Id           ulid.ULID  `json:"id"`
+	Kind         string     `json:"kind"`
+	AccountId    *ulid.ULID `json:"account_id,omitempty"`
+	AccountEmail string     `json:"account_email,omitempty"`
+	RoleId       ulid.ULID  `json:"role_id"`
+	RoleName     string     `json:"role_name"`
+	StoreId      *ulid.ULID `json:"store_id"`
+	PermissionId *ulid.ULID `json:"permission_id,omitempty"`
+	Grants       []string   `json:"grants,omitempty"`
+	Validity
+	Decision  string     `json:"decision"`
+	DecidedBy *ulid.ULID `json:"decided_by"`
+	DecidedAt *time.Time `json:"decided_at"`
+	Comment   string     `json:"comment"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// ReviewReport is the record of a campaign handed to auditors.
+type ReviewReport struct {
+	Review      AccessReview `json:"review"`
+	Items       []ReviewItem `json:"items"`
+	Kept        int          `json:"kept"`
+	Revoked     int          `json:"revoked"`
+	Undecided   int          `json:"undecided"`
+	GeneratedAt time.Time    `json:"generated_at"`
+}
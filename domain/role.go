@@ -14,9 +14,19 @@ type Role struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// RolePermission grants a permission to a role. A non empty Condition, in
+// the language of package policy, limits when the grant applies.
 type RolePermission struct {
 	PermissionId ulid.ULID `json:"permission_id"`
 	RoleId       ulid.ULID `json:"role_id"`
+	Condition    string    `json:"condition"`
+}
+
+// ConditionalGrant is a grant, as written by FormatGrant, that only applies
+// when Condition holds. An empty Condition always holds.
+type ConditionalGrant struct {
+	Grant     string `json:"grant"`
+	Condition string `json:"condition"`
 }
 
 func NewRole(name, desc string) Role {
@@ -29,19 +39,36 @@ func NewRole(name, desc string) Role {
 	}
 }
 
+// InheritedPermission is a grant a role holds through one of its ancestors,
+// RoleId being the ancestor the grant is assigned to.
+type InheritedPermission struct {
+	Grant     string    `json:"grant"`
+	Condition string    `json:"condition,omitempty"`
+	RoleId    ulid.ULID `json:"role_id"`
+	RoleName  string    `json:"role_name"`
+}
+
 type ReadRoleResponse struct {
 	Role
-	TotalPermissions int      `json:"total_permission"`
-	Permissions      []string `json:"permissions"`
+	TotalPermissions     int                   `json:"total_permission"`
+	Permissions          []string              `json:"permissions"`
+	Conditions           map[string]string     `json:"conditions"`
+	Parents              []Role                `json:"parents"`
+	InheritedPermissions []InheritedPermission `json:"inherited_permissions"`
+	Denials              []Denial              `json:"denials"`
 }
 
 func (a *ReadRoleResponse) MarshalJSON() ([]byte, error) {
 	var j struct {
-		Id              ulid.ULID `json:"id"`
-		Name            string    `json:"name"`
-		Desc            string    `json:"description"`
-		TotalPermission int       `json:"total_permission"`
-		Permissions     []string  `json:"permissions"`
+		Id              ulid.ULID             `json:"id"`
+		Name            string                `json:"name"`
+		Desc            string                `json:"description"`
+		TotalPermission int                   `json:"total_permission"`
+		Permissions     []string              `json:"permissions"`
+		Conditions      map[string]string     `json:"conditions"`
+		Parents         []Role                `json:"parents"`
+		Inherited       []InheritedPermission `json:"inherited_permissions"`
+		Denials         []Denial              `json:"denials"`
 	}
 
 	j.Id = a.Id
@@ -49,6 +76,22 @@ func (a *ReadRoleResponse) MarshalJSON() ([]byte, error) {
 	j.Desc = a.Description
 	j.TotalPermission = a.TotalPermissions
 	j.Permissions = a.Permissions
+	j.Conditions = a.Conditions
+	if j.Conditions == nil {
+		j.Conditions = map[string]string{}
+	}
+	j.Parents = a.Parents
+	if j.Parents == nil {
+		j.Parents = []Role{}
+	}
+	j.Inherited = a.InheritedPermissions
+	if j.Inherited == nil {
+		j.Inherited = []InheritedPermission{}
+	}
+	j.Denials = a.Denials
+	if j.Denials == nil {
+		j.Denials = []Denial{}
+	}
 
 	return json.Marshal(j)
 }
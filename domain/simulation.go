@@ -0,0 +1,51 @@
+package domain
+
+import "github.com/oklog/ulid/v2"
+
+// RolePermissionChange grants, or takes away, a permission of a role.
+// Condition is only read when granting.
+type RolePermissionChange struct {
+	RoleId       ulid.ULID `json:"role_id"`
+	PermissionId ulid.ULID `json:"permission_id"`
+	Condition    string    `json:"condition"`
+}
+
+// AccountRoleChange assigns, or unassigns, a role to an account. The zero
+// StoreId stands for every store; Validity is only read when assigning.
+type AccountRoleChange struct {
+	AccountId ulid.ULID `json:"account_id"`
+	RoleId    ulid.ULID `json:"role_id"`
+	StoreId   ulid.ULID `json:"store_id"`
+	Validity
+}
+
+// ChangeSet is a proposed set of role changes, applied in the order of its
+// fields.
+type ChangeSet struct {
+	AddRolePermissions    []RolePermissionChange `json:"add_role_permissions"`
+	RemoveRolePermissions []RolePermissionChange `json:"remove_role_permissions"`
+	AddAccountRoles       []AccountRoleChange    `json:"add_account_roles"`
+	RemoveAccountRoles    []AccountRoleChange    `json:"remove_account_roles"`
+}
+
+// Len returns the number of changes in the set.
+func (c ChangeSet) Len() int {
+	return len(c.AddRolePermissions) + len(c.RemoveRolePermissions) +
+		len(c.AddAccountRoles) + len(c.RemoveAccountRoles)
+}
+
+// SimulatedGrant is a grant of an account in the result of a simulation,
+// StoreId being set for a grant only held in that store.
+type SimulatedGrant struct {
+	Grant     string     `json:"grant"`
+	Condition string     `json:"condition,omitempty"`
+	StoreId   *ulid.ULID `json:"store_id,omitempty"`
+}
+
+// AccountDiff is what a change set would make an account gain and lose.
+type AccountDiff struct {
+	AccountId ulid.ULID        `json:"account_id"`
+	Email     string           `json:"email"`
+	Gained    []SimulatedGrant `json:"gained"`
+	Lost      []SimulatedGrant `json:"lost"`
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Kinds of separation of duties constraints. An account may hold at most
+// one role of a static constraint. It may hold every role of a dynamic
+// constraint but only activate one of them per session; the roles of a
+// dynamic constraint grant nothing until activated.
+const (
+	SoDStatic  = "static"
+	SoDDynamic = "dynamic"
+)
+
+// ViolationCardinality is the kind of the violation of a role's maximum
+// number of accounts.
+const ViolationCardinality = "cardinality"
+
+// SoDConstraint is a set of conflicting roles.
+type SoDConstraint struct {
+	Id        ulid.ULID `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Roles     []Role    `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewSoDConstraint(name, kind string, roles []Role) SoDConstraint {
+	id := ulid.Make()
+	return SoDConstraint{
+		Id:        id,
+		Name:      name,
+		Kind:      kind,
+		Roles:     roles,
+		CreatedAt: time.Now(),
+	}
+}
+
+// ConstraintViolation describes an account breaking a separation of duties
+// constraint, or a role assigned to more accounts than it allows. Kind is
+// SoDStatic, SoDDynamic or ViolationCardinality.
+type ConstraintViolation struct {
+	Kind           string     `json:"kind"`
+	ConstraintId   *ulid.ULID `json:"constraint_id,omitempty"`
+	ConstraintName string     `json:"constraint_name,omitempty"`
+	AccountId      *ulid.ULID `json:"account_id,omitempty"`
+	Roles          []string   `json:"roles"`
+	Limit          int        `json:"limit,omitempty"`
+	Count          int        `json:"count,omitempty"`
+}
+
+func (v ConstraintViolation) String() string {
+	roles := strings.Join(v.Roles, ", ")
+	if v.Kind == ViolationCardinality {
+		return fmt.Sprintf("role %s is limited to %d accounts, %d hold it", roles, v.Limit, v.Count)
+	}
+	return fmt.Sprintf("%s constraint %s forbids holding %s together", v.Kind, v.ConstraintName, roles)
+}
+
+// ConstraintError is returned when a change would break a separation of
+// duties constraint.
+type ConstraintError struct {
+	Violation ConstraintViolation
+}
+
+func (e *ConstraintError) Error() string {
+	return "separation of duties: " + e.Violation.String()
+}
+
+// ActiveRole is a role of a dynamic constraint activated in a session.
+type ActiveRole struct {
+	Role
+	ActivatedAt time.Time `json:"activated_at"`
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Store is an outlet. Role assignments can be limited to one store.
+// Timezone is the IANA name time conditions on permissions are evaluated
+// in.
+type Store struct {
+	Id        ulid.ULID `json:"id"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address"`
+	Timezone  string    `json:"timezone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultTimezone is the time zone of stores created without one.
+const DefaultTimezone = "UTC"
+
+func NewStore(name, address, timezone string) Store {
+	id := ulid.Make()
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+	return Store{
+		Id:        id,
+		Name:      name,
+		Address:   address,
+		Timezone:  timezone,
+		CreatedAt: time.Now(),
+	}
+}
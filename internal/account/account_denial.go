@@ -0,0 +1,162 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDenialAlreadyExist   = errors.New("account: permission already denied")
+	ErrDenialNotFound       = errors.New("account: denial not found")
+	ErrDenialTargetNotFound = errors.New("account: account or permission not found")
+	ErrOwnDenial            = errors.New("account: cannot lift a denial of your own account")
+)
+
+type DenialList struct {
+	Denials []domain.Denial `json:"data"`
+	Count   int             `json:"count"`
+}
+
+var emptyDenialList = DenialList{
+	Denials: []domain.Denial{},
+	Count:   0,
+}
+
+// AddDenial implements Repo. The account loses the permission whatever
+// role grants it. Both the account and the permission must belong to the
+// organization of ctx.
+func (r *repo) AddDenial(ctx context.Context, accountId, permissionId ulid.ULID, reason string) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			INSERT INTO account_denials (
+				account_id,
+				permission_id,
+				reason,
+				created_at
+			)
+			SELECT a.id, p.id, $4, $5
+			FROM accounts a, permissions p
+			WHERE a.id = $1 AND p.id = $2
+				AND a.organization_id = $3 AND p.organization_id = $3;
+		`,
+		accountId,
+		permissionId,
+		org,
+		reason,
+		time.Now(),
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrDenialTargetNotFound
+	}
+	if err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDenialAlreadyExist
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveDenial implements Repo.
+func (r *repo) RemoveDenial(ctx context.Context, accountId, permissionId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			DELETE FROM account_denials
+			WHERE account_id = $1 AND permission_id = $2
+				AND account_id IN (SELECT id FROM accounts WHERE organization_id = $3);
+		`,
+		accountId,
+		permissionId,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDenialNotFound
+	}
+	return nil
+}
+
+// FetchDenials implements ReadModel. Only the denials set on the account
+// itself are returned, not those of its roles.
+func (r *repo) FetchDenials(ctx context.Context, id ulid.ULID) (DenialList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyDenialList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				p.id,
+				p.name,
+				p.url,
+				p.methods,
+				ad.reason,
+				ad.created_at
+			FROM
+				account_denials ad
+			JOIN
+				permissions p
+			ON
+				ad.permission_id = p.id
+			WHERE
+				ad.account_id = $1 AND
+				p.organization_id = $2
+			ORDER BY
+				p.url, p.id;
+		`,
+		id,
+		org,
+	)
+	if err != nil {
+		return emptyDenialList, err
+	}
+	defer rows.Close()
+
+	items := []domain.Denial{}
+	for rows.Next() {
+		var item domain.Denial
+		var permission domain.Permission
+		if err := rows.Scan(
+			&item.PermissionId,
+			&item.Name,
+			&permission.Url,
+			&permission.Methods,
+			&item.Reason,
+			&item.CreatedAt,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyDenialList, err
+		}
+		item.Grants = permission.Grants()
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyDenialList, err
+	}
+	list := DenialList{
+		Denials: items,
+		Count:   len(items),
+	}
+	return list, nil
+}
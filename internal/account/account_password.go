@@ -0,0 +1,93 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+)
+
+var ErrPasswordLocked = errors.New("account: password locked after too many failures")
+
+// ReservePasswordAttempt implements RepoPassword. Like ReservePinAttempt
+// it counts an attempt before the password is checked: the attempt that
+// reaches maxFailures locks the password until lockedUntil and starts the
+// count over, and a password locked at now is refused with
+// ErrPasswordLocked. It returns the password hash and the lockout, nil
+// while the password is not locked.
+func (r *repo) ReservePasswordAttempt(ctx context.Context, accountId ulid.ULID, maxFailures uint, now, lockedUntil time.Time) (string, *time.Time, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		`
+			UPDATE accounts
+			SET
+				password_failures = CASE WHEN password_failures + 1 >= $3 THEN 0 ELSE password_failures + 1 END,
+				password_locked_until = CASE WHEN password_failures + 1 >= $3 THEN $5 ELSE NULL END
+			WHERE id = $1 AND organization_id = $2
+				AND (password_locked_until IS NULL OR password_locked_until <= $4)
+			RETURNING password, password_locked_until;
+		`,
+		accountId,
+		org,
+		maxFailures,
+		now,
+		lockedUntil,
+	)
+	var hash string
+	var until *time.Time
+	if err := row.Scan(&hash, &until); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return "", nil, err
+		}
+		// Either the account does not exist or its password is locked.
+		if _, err := r.FindById(ctx, accountId); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrPasswordLocked
+	}
+	return hash, until, nil
+}
+
+// ResetPasswordFailures implements RepoPassword. It lifts a lockout too.
+func (r *repo) ResetPasswordFailures(ctx context.Context, accountId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE accounts
+			SET
+				password_failures = 0,
+				password_locked_until = NULL
+			WHERE id = $1 AND organization_id = $2
+		`,
+		accountId,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+type RepoPassword interface {
+	ReservePasswordAttempt(ctx context.Context, accountId ulid.ULID, maxFailures uint, now, lockedUntil time.Time) (string, *time.Time, error)
+	ResetPasswordFailures(ctx context.Context, accountId ulid.ULID) error
+}
+
+func NewRepoPassword(db *pgxpool.Pool) RepoPassword {
+	return &repo{db: db}
+}
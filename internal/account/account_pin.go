@@ -0,0 +1,250 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrPinNotSet     = errors.New("account: no pin set")
+	ErrPinWrong      = errors.New("account: wrong pin")
+	ErrPinLocked     = errors.New("account: pin locked after too many failures")
+	ErrPasswordWrong = errors.New("account: wrong password")
+)
+
+// FindPin implements ReadModelPin.
+func (r *repo) FindPin(ctx context.Context, accountId ulid.ULID) (*domain.AccountPin, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		`
+			SELECT
+				p.account_id,
+				p.pin_hash,
+				p.failures,
+				p.lockouts,
+				p.locked_until,
+				p.updated_at
+			FROM
+				account_pins p
+			JOIN
+				accounts a
+			ON
+				p.account_id = a.id
+			WHERE
+				p.account_id = $1 AND
+				a.organization_id = $2
+		`,
+		accountId,
+		org,
+	)
+	var data domain.AccountPin
+	if err := row.Scan(
+		&data.AccountId,
+		&data.Hash,
+		&data.Failures,
+		&data.Lockouts,
+		&data.LockedUntil,
+		&data.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrPinNotSet
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// SetPin implements RepoPin. Setting the PIN clears its failures and
+// lockouts.
+func (r *repo) SetPin(ctx context.Context, accountId ulid.ULID, pinHash string) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			INSERT INTO account_pins (
+				account_id,
+				pin_hash,
+				failures,
+				locked_until,
+				updated_at
+			)
+			SELECT a.id, $3, 0, NULL, $4
+			FROM accounts a
+			WHERE a.id = $1 AND a.organization_id = $2
+			ON CONFLICT (account_id) DO UPDATE
+			SET pin_hash = excluded.pin_hash,
+				failures = 0,
+				lockouts = 0,
+				locked_until = NULL,
+				updated_at = excluded.updated_at;
+		`,
+		accountId,
+		org,
+		pinHash,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// ReservePinAttempt implements RepoPin. It counts an attempt before the
+// PIN is checked, so that concurrent attempts cannot all get past the
+// lockout: the attempt that reaches maxFailures locks the PIN until
+// lockedUntil, counts a lockout and starts the count of failures over.
+// Once maxLockouts lockouts are counted the PIN stays locked until
+// UnlockPin; zero never keeps it locked. A PIN locked at now is not
+// returned, see ErrPinLocked. The PIN is returned as it is after the
+// attempt was counted.
+func (r *repo) ReservePinAttempt(ctx context.Context, accountId ulid.ULID, maxFailures, maxLockouts uint, now, lockedUntil time.Time) (*domain.AccountPin, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		`
+			UPDATE account_pins p
+			SET
+				failures = CASE WHEN p.failures + 1 >= $3 THEN 0 ELSE p.failures + 1 END,
+				lockouts = CASE WHEN p.failures + 1 >= $3 THEN p.lockouts + 1 ELSE p.lockouts END,
+				locked_until = CASE WHEN p.failures + 1 >= $3 THEN $5 ELSE NULL END
+			FROM accounts a
+			WHERE p.account_id = a.id
+				AND p.account_id = $1 AND a.organization_id = $2
+				AND (p.locked_until IS NULL OR p.locked_until <= $4)
+				AND ($6 = 0 OR p.lockouts < $6)
+			RETURNING
+				p.account_id,
+				p.pin_hash,
+				p.failures,
+				p.lockouts,
+				p.locked_until,
+				p.updated_at;
+		`,
+		accountId,
+		org,
+		maxFailures,
+		now,
+		lockedUntil,
+		maxLockouts,
+	)
+	var data domain.AccountPin
+	if err := row.Scan(
+		&data.AccountId,
+		&data.Hash,
+		&data.Failures,
+		&data.Lockouts,
+		&data.LockedUntil,
+		&data.UpdatedAt,
+	); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		// Either no PIN is set or it is locked.
+		if _, err := r.FindPin(ctx, accountId); err != nil {
+			return nil, err
+		}
+		return nil, ErrPinLocked
+	}
+	return &data, nil
+}
+
+// ResetPinFailures implements RepoPin. It lifts a lockout too but keeps
+// the count of lockouts, see UnlockPin.
+func (r *repo) ResetPinFailures(ctx context.Context, accountId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE account_pins p
+			SET
+				failures = 0,
+				locked_until = NULL
+			FROM accounts a
+			WHERE p.account_id = a.id
+				AND p.account_id = $1 AND a.organization_id = $2
+		`,
+		accountId,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPinNotSet
+	}
+	return nil
+}
+
+// UnlockPin implements RepoPin. It clears the failures and the lockouts.
+func (r *repo) UnlockPin(ctx context.Context, accountId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE account_pins p
+			SET
+				failures = 0,
+				lockouts = 0,
+				locked_until = NULL
+			FROM accounts a
+			WHERE p.account_id = a.id
+				AND p.account_id = $1 AND a.organization_id = $2
+		`,
+		accountId,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPinNotSet
+	}
+	return nil
+}
+
+type ReadModelPin interface {
+	FindPin(ctx context.Context, accountId ulid.ULID) (*domain.AccountPin, error)
+}
+
+func NewReadModelPin(db *pgxpool.Pool) ReadModelPin {
+	return &repo{db: db}
+}
+
+type RepoPin interface {
+	SetPin(ctx context.Context, accountId ulid.ULID, pinHash string) error
+	ReservePinAttempt(ctx context.Context, accountId ulid.ULID, maxFailures, maxLockouts uint, now, lockedUntil time.Time) (*domain.AccountPin, error)
+	ResetPinFailures(ctx context.Context, accountId ulid.ULID) error
+	UnlockPin(ctx context.Context, accountId ulid.ULID) error
+}
+
+func NewRepoPin(db *pgxpool.Pool) RepoPin {
+	return &repo{db: db}
+}
@@ -3,8 +3,9 @@ package account
 import (
 	"context"
 	"errors"
-	"fmt"
 	"pos/domain"
+	"pos/internal/role"
+	"pos/internal/tenant"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -17,31 +18,56 @@ import (
 var (
 	ErrRoleNotFound               = errors.New("account role: not found")
 	ErrAccountRoleAlreadyAssigned = errors.New("account role: already assigned")
+	ErrAssignmentTargetNotFound   = errors.New("account role: account, role or store not found")
+	ErrInvalidValidity            = errors.New("account role: valid_until must be after valid_from")
+	ErrAssignmentPending          = errors.New("account role: assignment already awaits approval")
 )
 
+// storeScope turns a store id into the account_roles.store_id value, the
+// zero ULID standing for an assignment valid in every store.
+func storeScope(storeId ulid.ULID) *ulid.ULID {
+	if storeId == (ulid.ULID{}) {
+		return nil
+	}
+	return &storeId
+}
+
 type ReadModelAccountRole interface {
 	FetchByAccount(ctx context.Context, id ulid.ULID) (RoleAccountList, error)
 	FetchByRole(ctx context.Context, id ulid.ULID) (AccountRoleList, error)
-	Find(ctx context.Context, rid, uid ulid.ULID) (*domain.AccountRole, error)
+	Find(ctx context.Context, rid, uid, storeId ulid.ULID) (*domain.AccountRole, error)
+	FetchExpiredByAccount(ctx context.Context, id ulid.ULID) (RoleAccountList, error)
 }
 
 type RoleAccountList struct {
-	Roles []domain.Role `json:"data"`
-	Count int           `json:"count"`
+	Roles []domain.AssignedRole `json:"data"`
+	Count int                   `json:"count"`
 }
 
 var emptyRole = RoleAccountList{
-	Roles: []domain.Role{},
+	Roles: []domain.AssignedRole{},
 	Count: 0,
 }
 
-// FetchByAccount implements ReadModelAccountRole.
+// FetchByAccount implements ReadModelAccountRole. Expired assignments are
+// left out; assignments that have not started yet are listed.
 func (r *repo) FetchByAccount(ctx context.Context, id ulid.ULID) (RoleAccountList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyRole, err
+	}
 	var itemCount int
 	row := r.db.QueryRow(
 		ctx,
-		`SELECT COUNT(*) as c FROM account_roles WHERE account_id = $1`,
+		`
+			SELECT COUNT(*) as c
+			FROM account_roles ar
+			JOIN roles r ON ar.role_id = r.id
+			WHERE ar.account_id = $1 AND r.organization_id = $2
+				AND (ar.valid_until IS NULL OR ar.valid_until > NOW())
+		`,
 		id,
+		org,
 	)
 	if err := row.Scan(&itemCount); err != nil {
 		log.Warn().Err(err).Msg("cannot find a count in role")
@@ -52,14 +78,17 @@ func (r *repo) FetchByAccount(ctx context.Context, id ulid.ULID) (RoleAccountLis
 		return emptyRole, nil
 	}
 	log.Debug().Int("count", itemCount).Msg("found role items")
-	items := make([]domain.Role, itemCount)
+	items := make([]domain.AssignedRole, itemCount)
 	rows, err := r.db.Query(
 		ctx,
 		`
 		SELECT
 			p.id,
 			p.name AS role_name,
-			p.description AS role_description
+			p.description AS role_description,
+			rp.store_id,
+			rp.valid_from,
+			rp.valid_until
 		FROM
 			account_roles rp
 		JOIN
@@ -67,9 +96,12 @@ func (r *repo) FetchByAccount(ctx context.Context, id ulid.ULID) (RoleAccountLis
 		ON
 			rp.role_id = p.id
 		WHERE
-			rp.account_id = $1;	
+			rp.account_id = $1 AND
+			p.organization_id = $2 AND
+			(rp.valid_until IS NULL OR rp.valid_until > NOW());
 		`,
 		id,
+		org,
 	)
 	if err != nil {
 		return emptyRole, err
@@ -81,6 +113,8 @@ func (r *repo) FetchByAccount(ctx context.Context, id ulid.ULID) (RoleAccountLis
 		var id ulid.ULID
 		var name string
 		var desc string
+		var storeId *ulid.ULID
+		var validity domain.Validity
 		if !rows.Next() {
 			break
 		}
@@ -88,16 +122,22 @@ func (r *repo) FetchByAccount(ctx context.Context, id ulid.ULID) (RoleAccountLis
 			&id,
 			&name,
 			&desc,
+			&storeId,
+			&validity.From,
+			&validity.Until,
 		); err != nil {
 			log.Warn().Err(err).Msg("cannot scan an item")
 			return emptyRole, err
 		}
-		fmt.Println(name)
-		items[count] = domain.Role{
-			Id:          id,
-			Name:        name,
-			Description: desc,
-			CreatedAt:   time.Time{},
+		items[count] = domain.AssignedRole{
+			Role: domain.Role{
+				Id:          id,
+				Name:        name,
+				Description: desc,
+				CreatedAt:   time.Time{},
+			},
+			StoreId:  storeId,
+			Validity: validity,
 		}
 	}
 	list := RoleAccountList{
@@ -119,11 +159,21 @@ var emptyAccount = AccountRoleList{
 
 // FetchByRole implements ReadModelAccountRole.
 func (r *repo) FetchByRole(ctx context.Context, id ulid.ULID) (AccountRoleList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyAccount, err
+	}
 	var itemCount int
 	row := r.db.QueryRow(
 		ctx,
-		`SELECT COUNT(*) as c FROM account_roles WHERE role_id = $1`,
+		`
+			SELECT COUNT(DISTINCT ar.account_id) as c
+			FROM account_roles ar
+			JOIN accounts a ON ar.account_id = a.id
+			WHERE ar.role_id = $1 AND a.organization_id = $2
+		`,
 		id,
+		org,
 	)
 	if err := row.Scan(&itemCount); err != nil {
 		log.Warn().Err(err).Msg("cannot find a count in role")
@@ -138,7 +188,7 @@ func (r *repo) FetchByRole(ctx context.Context, id ulid.ULID) (AccountRoleList,
 	rows, err := r.db.Query(
 		ctx,
 		`
-		SELECT
+		SELECT DISTINCT
 			p.id AS account_id,
 			p.email
 		FROM
@@ -148,9 +198,11 @@ func (r *repo) FetchByRole(ctx context.Context, id ulid.ULID) (AccountRoleList,
 		ON
 			rp.account_id = p.id
 		WHERE
-			rp.role_id = $1;
+			rp.role_id = $1 AND
+			p.organization_id = $2;
 		`,
 		id,
+		org,
 	)
 	if err != nil {
 		return emptyAccount, err
@@ -183,27 +235,46 @@ func (r *repo) FetchByRole(ctx context.Context, id ulid.ULID) (AccountRoleList,
 	return list, nil
 }
 
-// Find implements ReadModelAccountRole.
-func (r *repo) Find(ctx context.Context, rid, uid ulid.ULID) (*domain.AccountRole, error) {
+// Find implements ReadModelAccountRole. Pass the zero ULID as storeId for
+// the assignment valid in every store.
+func (r *repo) Find(ctx context.Context, rid, uid, storeId ulid.ULID) (*domain.AccountRole, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	row := r.db.QueryRow(
 		ctx,
 		`
 			SELECT
-				role_id,
-				account_id
+				ar.role_id,
+				ar.account_id,
+				ar.store_id,
+				ar.valid_from,
+				ar.valid_until
 			FROM
-				account_roles
+				account_roles ar
+			JOIN
+				accounts a
+			ON
+				ar.account_id = a.id
 			WHERE
-				role_id = $1 AND
-				account_id = $2
+				ar.role_id = $1 AND
+				ar.account_id = $2 AND
+				ar.store_id IS NOT DISTINCT FROM $3 AND
+				a.organization_id = $4
 		`,
 		rid,
 		uid,
+		storeScope(storeId),
+		org,
 	)
 	var data domain.AccountRole
 	if err := row.Scan(
 		&data.RoleId,
 		&data.AccountId,
+		&data.StoreId,
+		&data.Validity.From,
+		&data.Validity.Until,
 	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Debug().Err(err).Msg("can't find any item")
@@ -219,50 +290,101 @@ func NewReadModelAccountRole(db *pgxpool.Pool) ReadModelAccountRole {
 }
 
 type RepoAccountRole interface {
-	AssignRole(ctx context.Context, accountId, roleId ulid.ULID) error
-	RemoveRole(ctx context.Context, accountId, roleId ulid.ULID) error
+	AssignRole(ctx context.Context, roleId, accountId, storeId ulid.ULID, validity domain.Validity) error
+	RemoveRole(ctx context.Context, accountId, roleId, storeId ulid.ULID) error
+	SweepAssignments(ctx context.Context, since time.Time) (SweepResult, error)
 }
 
-// AssignRole implements RepoAccountRole.
-func (r *repo) AssignRole(ctx context.Context, roleId, accountId ulid.ULID) error {
-	_, err := r.db.Exec(
+// AssignRole implements RepoAccountRole. Pass the zero ULID as storeId to
+// assign the role in every store. The account, the role and the store must
+// belong to the organization of ctx. The zero validity never expires. An
+// assignment breaking a static separation of duties constraint or the
+// maximum number of accounts of the role fails with a
+// *domain.ConstraintError.
+func (r *repo) AssignRole(ctx context.Context, roleId, accountId, storeId ulid.ULID, validity domain.Validity) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := role.LockConstraints(ctx, tx); err != nil {
+		return err
+	}
+	if err := checkConstraints(ctx, tx, org, accountId, roleId); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(
 		ctx,
 		`
 			INSERT INTO account_roles (
 				account_id,
-				role_id
-			) VALUES (
-				$1,
-				$2
-			);
+				role_id,
+				store_id,
+				valid_from,
+				valid_until
+			)
+			SELECT a.id, r.id, $3::bytea, $5, $6
+			FROM accounts a, roles r
+			WHERE a.id = $1 AND r.id = $2
+				AND a.organization_id = $4 AND r.organization_id = $4
+				AND ($3::bytea IS NULL OR EXISTS (
+					SELECT 1 FROM stores s WHERE s.id = $3 AND s.organization_id = $4
+				));
 		`,
 		accountId,
 		roleId,
+		storeScope(storeId),
+		org,
+		validity.From,
+		validity.Until,
 	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrAssignmentTargetNotFound
+	}
 	if err != nil {
-		pqErr := err.(*pgconn.PgError)
-		if pqErr.Code == "23505" {
-			return ErrRoleNotFound
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case "23505":
+				return ErrAccountRoleAlreadyAssigned
+			case "23503":
+				return ErrAssignmentTargetNotFound
+			case "23514":
+				return ErrInvalidValidity
+			}
 		}
 		return err
 	}
-	return nil
+	return tx.Commit(ctx)
 }
 
 // RemoveRole implements RepoAccountRole.
-func (r *repo) RemoveRole(ctx context.Context, accountId, roleId ulid.ULID) error {
-	_, err := r.db.Exec(
+func (r *repo) RemoveRole(ctx context.Context, accountId, roleId, storeId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			DELETE FROM account_roles 
-			WHERE account_id = $1 AND role_id = $2;
+			WHERE account_id = $1 AND role_id = $2 AND store_id IS NOT DISTINCT FROM $3
+				AND account_id IN (SELECT id FROM accounts WHERE organization_id = $4);
 		`,
 		accountId,
 		roleId,
+		storeScope(storeId),
+		org,
 	)
 	if err != nil {
-		pqErr := err.(*pgconn.PgError)
-		if pqErr.Code == "23505" {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return ErrRoleNotFound
 		}
 		return err
@@ -273,3 +395,74 @@ func (r *repo) RemoveRole(ctx context.Context, accountId, roleId ulid.ULID) erro
 func NewRepoAccountRole(db *pgxpool.Pool) RepoAccountRole {
 	return &repo{db: db}
 }
+
+// NewRepoAccountRoleTx runs the mutations in tx, leaving the commit to the
+// caller.
+func NewRepoAccountRoleTx(tx pgx.Tx) RepoAccountRole {
+	return &repo{db: tx}
+}
+
+// FetchExpiredByAccount implements ReadModelAccountRole. It returns the
+// assignments of the account that expired, the latest one per role and
+// store.
+func (r *repo) FetchExpiredByAccount(ctx context.Context, id ulid.ULID) (RoleAccountList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyRole, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT DISTINCT ON (h.role_id, h.store_id)
+				p.id,
+				p.name,
+				p.description,
+				h.store_id,
+				h.valid_from,
+				h.valid_until
+			FROM
+				account_role_history h
+			JOIN
+				roles p
+			ON
+				h.role_id = p.id
+			WHERE
+				h.account_id = $1 AND
+				p.organization_id = $2 AND
+				h.event = 'expired'
+			ORDER BY
+				h.role_id, h.store_id, h.recorded_at DESC;
+		`,
+		id,
+		org,
+	)
+	if err != nil {
+		return emptyRole, err
+	}
+	defer rows.Close()
+
+	items := []domain.AssignedRole{}
+	for rows.Next() {
+		var item domain.AssignedRole
+		if err := rows.Scan(
+			&item.Id,
+			&item.Name,
+			&item.Description,
+			&item.StoreId,
+			&item.From,
+			&item.Until,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyRole, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyRole, err
+	}
+	list := RoleAccountList{
+		Roles: items,
+		Count: len(items),
+	}
+	return list, nil
+}
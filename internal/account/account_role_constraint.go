@@ -0,0 +1,60 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/role"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// checkConstraints returns a *domain.ConstraintError when giving roleId to
+// accountId would break a static separation of duties constraint or the
+// maximum number of accounts of the role. Static constraints are checked
+// against every role the account would hold, inherited ones included; the
+// maximum counts direct assignments that have not expired, in any store.
+func checkConstraints(ctx context.Context, tx pgx.Tx, org, accountId, roleId ulid.ULID) error {
+	if err := role.CheckStaticConstraints(ctx, tx, org, roleId, []ulid.ULID{accountId}); err != nil {
+		return err
+	}
+
+	var roleName string
+	var limit int
+	var count int
+	row := tx.QueryRow(
+		ctx,
+		`
+			SELECT r.name, r.max_accounts, (
+				SELECT COUNT(DISTINCT ar.account_id)
+				FROM account_roles ar
+				WHERE ar.role_id = r.id AND ar.account_id <> $1
+					AND (ar.valid_until IS NULL OR ar.valid_until > NOW())
+			)
+			FROM roles r
+			WHERE r.id = $2 AND r.organization_id = $3 AND r.max_accounts IS NOT NULL;
+		`,
+		accountId,
+		roleId,
+		org,
+	)
+	err := row.Scan(&roleName, &limit, &count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return &domain.ConstraintError{
+			Violation: domain.ConstraintViolation{
+				Kind:  domain.ViolationCardinality,
+				Roles: []string{roleName},
+				Limit: limit,
+				Count: count,
+			},
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"pos/domain"
+	"pos/internal/tenant"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -24,11 +25,16 @@ var emptyList = AccountList{
 
 // Fetch implements ReadModel.
 func (r *repo) Fetch(ctx context.Context) (AccountList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
 	var itemCount int
 
 	row := r.db.QueryRow(
 		ctx,
-		`SELECT COUNT(id) as c FROM accounts`,
+		`SELECT COUNT(id) as c FROM accounts WHERE organization_id = $1`,
+		org,
 	)
 	if err := row.Scan(&itemCount); err != nil {
 		log.Warn().Err(err).Msg("cannot find a count in Account")
@@ -45,14 +51,18 @@ func (r *repo) Fetch(ctx context.Context) (AccountList, error) {
 		`
 			SELECT
 				id,
+				organization_id,
 				email,
 				password,
 				created_at
 			FROM
 				accounts
+			WHERE
+				organization_id = $1
 			ORDER BY
 				id
 		`,
+		org,
 	)
 	if err != nil {
 		return emptyList, err
@@ -62,6 +72,7 @@ func (r *repo) Fetch(ctx context.Context) (AccountList, error) {
 	var count int
 	for count = range items {
 		var id ulid.ULID
+		var organizationId ulid.ULID
 		var email string
 		var password string
 		var createdAt time.Time
@@ -70,6 +81,7 @@ func (r *repo) Fetch(ctx context.Context) (AccountList, error) {
 		}
 		if err := rows.Scan(
 			&id,
+			&organizationId,
 			&email,
 			&password,
 			&createdAt,
@@ -78,10 +90,11 @@ func (r *repo) Fetch(ctx context.Context) (AccountList, error) {
 			return emptyList, err
 		}
 		items[count] = domain.Account{
-			Id:        id,
-			Password:  password,
-			Email:     email,
-			CreatedAt: createdAt,
+			Id:             id,
+			OrganizationId: organizationId,
+			Password:       password,
+			Email:          email,
+			CreatedAt:      createdAt,
 		}
 	}
 	list := AccountList{
@@ -93,24 +106,32 @@ func (r *repo) Fetch(ctx context.Context) (AccountList, error) {
 
 // FindById implements ReadModel.
 func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Account, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	row := r.db.QueryRow(
 		ctx,
 		`
 			SELECT
 				id,
+				organization_id,
 				email,
 				password,
 				created_at
 			FROM
 				accounts
 			WHERE
-				id = $1
+				id = $1 AND
+				organization_id = $2
 		`,
 		id,
+		org,
 	)
 	var data domain.Account
 	if err := row.Scan(
 		&data.Id,
+		&data.OrganizationId,
 		&data.Email,
 		&data.Password,
 		&data.CreatedAt,
@@ -119,17 +140,21 @@ func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Account, err
 			log.Debug().Err(err).Msg("can't find any item")
 			return nil, ErrAccountNotFound
 		}
+		return nil, err
 	}
 	return &data, nil
 }
 
-// FindByEmail implements ReadModel.
+// FindByEmail implements ReadModel. Emails are unique across organizations
+// and this lookup is not scoped: it is how login finds the organization of
+// an account.
 func (r *repo) FindByEmail(ctx context.Context, email string) (*domain.Account, error) {
 	row := r.db.QueryRow(
 		ctx,
 		`
 			SELECT
 				id,
+				organization_id,
 				email,
 				password,
 				created_at
@@ -143,6 +168,7 @@ func (r *repo) FindByEmail(ctx context.Context, email string) (*domain.Account,
 	var data domain.Account
 	if err := row.Scan(
 		&data.Id,
+		&data.OrganizationId,
 		&data.Email,
 		&data.Password,
 		&data.CreatedAt,
@@ -151,6 +177,7 @@ func (r *repo) FindByEmail(ctx context.Context, email string) (*domain.Account,
 			log.Debug().Err(err).Msg("can't find any item")
 			return nil, ErrAccountNotFound
 		}
+		return nil, err
 	}
 	return &data, nil
 }
@@ -159,6 +186,7 @@ type ReadModel interface {
 	Fetch(ctx context.Context) (AccountList, error)
 	FindById(ctx context.Context, id ulid.ULID) (*domain.Account, error)
 	FindByEmail(ctx context.Context, email string) (*domain.Account, error)
+	FetchDenials(ctx context.Context, id ulid.ULID) (DenialList, error)
 }
 
 func NewReadModel(db *pgxpool.Pool) ReadModel {
@@ -4,29 +4,38 @@ import (
 	"context"
 	"errors"
 	"pos/domain"
+	"pos/internal/database"
+	"pos/internal/tenant"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
 )
 
 var (
-	ErrAccountNotFound     = errors.New("account: not found")
-	ErrAccountAlreadyExist = errors.New("account: email already exists")
+	ErrAccountNotFound      = errors.New("account: not found")
+	ErrAccountAlreadyExist  = errors.New("account: email already exists")
+	ErrOrganizationNotFound = errors.New("account: organization not found")
 )
 
 type repo struct {
-	db *pgxpool.Pool
+	db database.DBTX
 }
 
 // Delete implements Repo.
 func (r *repo) Delete(ctx context.Context, data *domain.Account) error {
-	_, err := r.db.Exec(
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			DELETE FROM accounts
-			WHERE id = $1
+			WHERE id = $1 AND organization_id = $2
 		`,
 		data.Id,
+		org,
 	)
 	if err != nil {
 		return err
@@ -36,11 +45,16 @@ func (r *repo) Delete(ctx context.Context, data *domain.Account) error {
 
 // Save implements Repo.
 func (r *repo) Save(ctx context.Context, data *domain.Account) error {
-	_, err := r.db.Exec(
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			INSERT INTO accounts (
 				id,
+				organization_id,
 				email,
 				password,
 				created_at
@@ -48,29 +62,40 @@ func (r *repo) Save(ctx context.Context, data *domain.Account) error {
 				$1,
 				$2,
 				$3,
-				$4
+				$4,
+				$5
 			) ON CONFLICT (id) DO UPDATE
 			SET
-				password = excluded.password;
+				password = excluded.password
+			WHERE accounts.organization_id = excluded.organization_id;
 		`,
 		data.Id,
+		org,
 		data.Email,
 		data.Password,
 		data.CreatedAt,
 	)
 	if err != nil {
-		pqErr := err.(*pgconn.PgError)
-		if pqErr.Code == "23505" {
-			return ErrAccountAlreadyExist
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case "23505":
+				return ErrAccountAlreadyExist
+			case "23503":
+				return ErrOrganizationNotFound
+			}
 		}
 		return err
 	}
+	data.OrganizationId = org
 	return nil
 }
 
 type Repo interface {
 	Save(ctx context.Context, data *domain.Account) error
 	Delete(ctx context.Context, data *domain.Account) error
+	AddDenial(ctx context.Context, accountId, permissionId ulid.ULID, reason string) error
+	RemoveDenial(ctx context.Context, accountId, permissionId ulid.ULID) error
 }
 
 func NewRepo(db *pgxpool.Pool) Repo {
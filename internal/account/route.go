@@ -4,7 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"pos/domain"
+	"pos/internal/authz"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/permission"
 	"pos/utils/httpresponse"
+	"pos/utils/key"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	validation "github.com/go-ozzo/ozzo-validation"
@@ -13,51 +20,117 @@ import (
 )
 
 type accountRoute struct {
-	mutate MutationData
-	read   ReadData
+	mutate      MutationData
+	read        ReadData
+	permissions EffectivePermissionService
+	pins        PinService
 }
 
 func NewRoute(
 	mutate MutationData,
 	read ReadData,
+	permissions EffectivePermissionService,
+	pins PinService,
 ) *accountRoute {
 	return &accountRoute{
-		mutate: mutate,
-		read:   read,
+		mutate:      mutate,
+		read:        read,
+		permissions: permissions,
+		pins:        pins,
 	}
 }
 
-type publicAccountRoute struct {
-	mutate MutationData
-	read   ReadData
+func (p *accountRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Put("/pin", p.setMyPin)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.SelfOrProtectedMiddleware("id", "user-management"))
+		r.Patch("/password/{id}", p.updatePassword)
+		r.Get("/{id}/deny", p.getDenials)
+		r.Get("/{id}/effective-permissions", p.getEffectivePermissions)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("account-role:assign"))
+		r.Post("/{id}/deny", p.addDenial)
+		r.Delete("/{id}/deny/{permissionId}", p.removeDenial)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("user-management"))
+		r.Get("/", p.getAllAccount)
+		r.Post("/", p.createAccount)
+		r.Get("/{id}", p.getOneAccount)
+		r.Delete("/{id}", p.deleteAccount)
+		r.Post("/{id}/pin/unlock", p.unlockPin)
+	})
+	return r
 }
 
-func NewPublicRoute(
-	mutate MutationData,
-	read ReadData,
-) *publicAccountRoute {
-	return &publicAccountRoute{
-		mutate: mutate,
-		read:   read,
+// getEffectivePermissions lists the grants of an account. The store_id
+// query parameter names the store to resolve them in; explain=true adds
+// where each grant comes from, see
+// EffectivePermissionService.GetEffectivePermissions.
+func (p *accountRoute) getEffectivePermissions(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var storeId ulid.ULID
+	if raw := r.URL.Query().Get("store_id"); raw != "" {
+		storeId, err = ulid.Parse(raw)
+		if err != nil {
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
 	}
+	explain := false
+	if raw := r.URL.Query().Get("explain"); raw != "" {
+		explain, err = strconv.ParseBool(raw)
+		if err != nil {
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	ctx := r.Context()
+
+	data, err := p.permissions.GetEffectivePermissions(ctx, id, storeId, explain)
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total   int                  `json:"total"`
+		Denials []domain.DeniedGrant `json:"denials,omitempty"`
+	}
+	meta.Total = data.Count
+	if explain {
+		meta.Denials = data.Denials
+	}
+	httpresponse.WriteData(w, http.StatusOK, data.Permissions, meta)
 }
 
-func (p *publicAccountRoute) Routes() *chi.Mux {
-	r := chi.NewMux()
-	r.Post("/", p.createAccount)
-	return r
+type addDenialRequest struct {
+	PermissionId ulid.ULID `json:"permission_id" validate:"required"`
+	Reason       string    `json:"reason"`
 }
 
-func (p *accountRoute) Routes() *chi.Mux {
-	r := chi.NewMux()
-	r.Get("/", p.getAllAccount)
-	r.Get("/{id}", p.getOneAccount)
-	r.Patch("/password/{id}", p.updatePassword)
-	r.Delete("/{id}", p.deleteAccount)
-	return r
+func (c addDenialRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.PermissionId, validation.Required),
+		validation.Field(&c.Reason, validation.Length(0, 255)),
+	)
 }
 
-func (p *accountRoute) deleteAccount(
+func (p *accountRoute) getDenials(
 	w http.ResponseWriter,
 	r *http.Request,
 ) {
@@ -69,10 +142,114 @@ func (p *accountRoute) deleteAccount(
 	}
 	ctx := r.Context()
 
-	if err := p.mutate.DeleteAccount(ctx, id); err != nil {
+	data, err := p.read.GetDenials(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Denials, meta)
+}
+
+func (p *accountRoute) addDenial(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body addDenialRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.mutate.AddDenial(ctx, id, body.PermissionId, body.Reason); err != nil {
+		switch {
+		case errors.Is(err, ErrAccountNotFound), errors.Is(err, ErrDenialTargetNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrDenialAlreadyExist):
+			httpresponse.WriteError(w, http.StatusConflict, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusCreated, "success deny a permission")
+}
+
+func (p *accountRoute) removeDenial(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	id, err := ulid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	permissionId, err := ulid.Parse(chi.URLParam(r, "permissionId"))
+	if err != nil {
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.mutate.RemoveDenial(ctx, token.Id, id, permissionId); err != nil {
+		var delegationErr *authz.DelegationError
+		switch {
+		case errors.As(err, &delegationErr), errors.Is(err, ErrOwnDenial):
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrDenialNotFound), errors.Is(err, permission.ErrPermissionNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success remove a denial")
+}
+
+func (p *accountRoute) deleteAccount(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.mutate.DeleteAccount(ctx, token.Id, id); err != nil {
+		var delegationErr *authz.DelegationError
+		switch {
+		case errors.As(err, &delegationErr):
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrAccountNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
 	httpresponse.WriteMessage(w, http.StatusOK, "success delete Account")
 }
 
@@ -109,15 +286,90 @@ func (p *accountRoute) updatePassword(
 	}
 
 	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
 
-	data, err := p.mutate.EditAccount(ctx, id, body.Password)
+	data, err := p.mutate.EditAccount(ctx, token.Id, id, body.Password)
 	if err != nil {
-		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		var delegationErr *authz.DelegationError
+		switch {
+		case errors.As(err, &delegationErr):
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrAccountNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
 		return
 	}
 	httpresponse.WriteData(w, http.StatusOK, data, nil)
 }
 
+type setPinRequest struct {
+	Password string `json:"password"`
+	Pin      string `json:"pin"`
+}
+
+func (c setPinRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Password, validation.Required, validation.Length(8, 32)),
+		validation.Field(&c.Pin, validation.Required, validation.Length(4, 8), is.Digit),
+	)
+}
+
+// setMyPin sets the PIN the account of the token signs in with on a
+// device.
+func (p *accountRoute) setMyPin(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body setPinRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.pins.SetPin(ctx, token.Id, body.Password, body.Pin); err != nil {
+		if errors.Is(err, ErrPasswordWrong) {
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success set pin")
+}
+
+func (p *accountRoute) unlockPin(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.pins.UnlockPin(ctx, id); err != nil {
+		if errors.Is(err, ErrPinNotSet) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success unlock pin")
+}
+
 type createAccountRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -131,7 +383,9 @@ func (c createAccountRequest) Validate() error {
 	)
 }
 
-func (p *publicAccountRoute) createAccount(
+// createAccount adds an account to the organization of the token; a new
+// organization signs up through package organization instead.
+func (p *accountRoute) createAccount(
 	w http.ResponseWriter,
 	r *http.Request,
 ) {
@@ -219,9 +473,12 @@ func NewRoleRoute(
 func (p *accountRoleRoute) Routes() *chi.Mux {
 	r := chi.NewMux()
 	r.Get("/{id}/role", p.getListRole)
-	r.Post("/", p.assignRole)
-	r.Delete("/", p.deleteRole)
 	r.Get("/{id}/account", p.getRole)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("account-role:assign"))
+		r.Post("/", p.assignRole)
+		r.Delete("/", p.deleteRole)
+	})
 	return r
 }
 
@@ -284,6 +541,13 @@ func (p *accountRoleRoute) getListRole(
 type assignRoleRequest struct {
 	AccountId ulid.ULID `json:"account_id" validate:"required"`
 	RoleId    ulid.ULID `json:"role_id" validate:"required"`
+	// StoreId limits the assignment to one store; left out, the role
+	// applies in every store.
+	StoreId ulid.ULID `json:"store_id"`
+	// ValidFrom and ValidUntil bound the assignment in time; either may be
+	// left out for an open bound.
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
 }
 
 func (c assignRoleRequest) Validate() error {
@@ -291,9 +555,24 @@ func (c assignRoleRequest) Validate() error {
 		&c,
 		validation.Field(&c.AccountId, validation.Required),
 		validation.Field(&c.RoleId, validation.Required),
+		validation.Field(&c.ValidUntil, validation.By(c.validUntil)),
 	)
 }
 
+// validUntil rejects an end that is already past or not after the start.
+func (c assignRoleRequest) validUntil(value interface{}) error {
+	if c.ValidUntil == nil {
+		return nil
+	}
+	if !c.ValidUntil.After(time.Now()) {
+		return errors.New("must be in the future")
+	}
+	if c.ValidFrom != nil && !c.ValidUntil.After(*c.ValidFrom) {
+		return errors.New("must be after valid_from")
+	}
+	return nil
+}
+
 func (p *accountRoleRoute) assignRole(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -309,12 +588,36 @@ func (p *accountRoleRoute) assignRole(
 		return
 	}
 	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
 
-	err := p.accountRoleSvc.AssignRole(ctx, body.RoleId, body.AccountId)
+	validity := domain.Validity{
+		From:  body.ValidFrom,
+		Until: body.ValidUntil,
+	}
+	request, err := p.accountRoleSvc.AssignRole(ctx, token.Id, body.RoleId, body.AccountId, body.StoreId, validity)
 	if err != nil {
+		var constraintErr *domain.ConstraintError
+		if errors.As(err, &constraintErr) {
+			httpresponse.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		var delegationErr *authz.DelegationError
+		if errors.As(err, &delegationErr) {
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		if errors.Is(err, ErrAssignmentPending) {
+			httpresponse.WriteError(w, http.StatusConflict, err)
+			return
+		}
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	if request != nil {
+		// The role needs a second approver, see package approval.
+		httpresponse.WriteData(w, http.StatusAccepted, request, nil)
+		return
+	}
 	httpresponse.WriteMessage(w, http.StatusCreated, "success assign a role")
 }
 func (p *accountRoleRoute) deleteRole(
@@ -333,7 +636,7 @@ func (p *accountRoleRoute) deleteRole(
 	}
 	ctx := r.Context()
 
-	err := p.accountRoleSvc.DeleteRole(ctx, body.RoleId, body.AccountId)
+	err := p.accountRoleSvc.DeleteRole(ctx, body.RoleId, body.AccountId, body.StoreId)
 	if err != nil {
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
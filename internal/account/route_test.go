@@ -0,0 +1,114 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pos/domain"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/keyring"
+	"pos/internal/tenant"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// fakeAccounts keeps the accounts of every organization and lists those
+// of the organization in the context, as the accounts queries filter on
+// organization_id.
+type fakeAccounts struct {
+	ReadModel
+	data []domain.Account
+}
+
+func (f *fakeAccounts) Fetch(ctx context.Context) (AccountList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	res := AccountList{Accounts: []domain.Account{}}
+	for _, a := range f.data {
+		if a.OrganizationId == org {
+			res.Accounts = append(res.Accounts, a)
+		}
+	}
+	res.Count = len(res.Accounts)
+	return res, nil
+}
+
+func TestListAccountsStaysInTenant(t *testing.T) {
+	k, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	custommiddleware.SetKeyring(k)
+	defer custommiddleware.SetKeyring(nil)
+
+	orgA, orgB := ulid.Make(), ulid.Make()
+	accounts := &fakeAccounts{data: []domain.Account{
+		{Id: ulid.Make(), OrganizationId: orgA, Email: "a1@a.test"},
+		{Id: ulid.Make(), OrganizationId: orgB, Email: "b1@b.test"},
+		{Id: ulid.Make(), OrganizationId: orgA, Email: "a2@a.test"},
+		{Id: ulid.Make(), OrganizationId: orgB, Email: "b2@b.test"},
+	}}
+	route := NewRoute(nil, NewReadData(nil, accounts), nil, nil).Routes()
+	handler := custommiddleware.AuthJwtMiddleware(route)
+
+	tests := []struct {
+		name   string
+		org    ulid.ULID
+		target string
+		want   []string
+	}{
+		{"tenant A", orgA, "/", []string{"a1@a.test", "a2@a.test"}},
+		{"tenant B", orgB, "/", []string{"b1@b.test", "b2@b.test"}},
+		{"tenant A naming B in the query", orgA, "/?organization_id=" + orgB.String(), []string{"a1@a.test", "a2@a.test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &domain.Oauth{
+				Id:             ulid.Make(),
+				OrganizationId: tt.org,
+				Permissions:    []string{"user-management"},
+				RegisteredClaims: jwt.RegisteredClaims{
+					Audience:  jwt.ClaimStrings{domain.AudienceAccess},
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+				},
+			}
+			raw, err := k.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Header.Set("Authorization", "Bearer "+raw)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			var body struct {
+				Data []struct {
+					Email string `json:"email"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, a := range body.Data {
+				got = append(got, a.Email)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("accounts = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("accounts = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
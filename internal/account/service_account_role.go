@@ -3,6 +3,9 @@ package account
 import (
 	"context"
 	"errors"
+	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/role"
 
 	"github.com/oklog/ulid/v2"
 )
@@ -10,42 +13,79 @@ import (
 type RoleAccountService interface {
 	GetAccount(ctx context.Context, rid ulid.ULID) (AccountRoleList, error)
 	GetRoleByAccount(ctx context.Context, uid ulid.ULID) (RoleAccountList, error)
-	AssignRole(ctx context.Context, uid, rid ulid.ULID) error
-	DeleteRole(ctx context.Context, uid, rid ulid.ULID) error
+	AssignRole(ctx context.Context, actorId, rid, uid, storeId ulid.ULID, validity domain.Validity) (*domain.ApprovalRequest, error)
+	DeleteRole(ctx context.Context, rid, uid, storeId ulid.ULID) error
 }
 
+// ApprovalGate holds back the assignments of roles that need a second
+// approver; package approval implements it.
+type ApprovalGate interface {
+	// Hold files a request for the assignment and returns it, or returns
+	// nil when the role needs no approval.
+	Hold(ctx context.Context, requestedBy, rid, uid, storeId ulid.ULID, validity domain.Validity) (*domain.ApprovalRequest, error)
+}
+
+// NewAccountRoleService checks with permissions that administrators only
+// assign roles whose grants they hold, and passes assignments through
+// approvals, see AssignRole.
 func NewAccountRoleService(
 	repo Repo,
 	readModel ReadModel,
 	accountRoleRepo RepoAccountRole,
 	accountRoleReadModel ReadModelAccountRole,
+	rolePermissionReadModel role.ReadModelRolePermission,
+	permissions authz.PermissionReader,
+	approvals ApprovalGate,
 ) RoleAccountService {
 	return &services{
-		repo:                 repo,
-		readModel:            readModel,
-		accountRoleRepo:      accountRoleRepo,
-		accountRoleReadModel: accountRoleReadModel,
+		repo:                    repo,
+		readModel:               readModel,
+		accountRoleRepo:         accountRoleRepo,
+		accountRoleReadModel:    accountRoleReadModel,
+		rolePermissionReadModel: rolePermissionReadModel,
+		permissions:             permissions,
+		approvals:               approvals,
 	}
 }
 
-// AssignRole implements RoleAccountService.
-func (s *services) AssignRole(ctx context.Context, rid, uid ulid.ULID) error {
-	_, err := s.accountRoleReadModel.Find(ctx, rid, uid)
+// AssignRole implements RoleAccountService. The zero ULID as storeId
+// assigns the role in every store, the zero validity assigns it for good.
+// Account actorId, the administrator, must hold every grant of the role,
+// its own and inherited ones, without condition in the same store;
+// otherwise an *authz.DelegationError is returned. When the role needs a
+// second approver nothing is assigned yet: the pending request is returned
+// instead.
+func (s *services) AssignRole(ctx context.Context, actorId, rid, uid, storeId ulid.ULID, validity domain.Validity) (*domain.ApprovalRequest, error) {
+	grants, err := role.Grants(ctx, s.rolePermissionReadModel, rid)
 	if err != nil {
-		if errors.Is(err, ErrRoleNotFound) {
-			return s.accountRoleRepo.AssignRole(ctx, rid, uid)
-		}
+		return nil, err
+	}
+	actor := authz.Subject{AccountId: actorId, StoreId: storeId}
+	if err := authz.CheckDelegation(ctx, s.permissions, actor, grants); err != nil {
+		return nil, err
+	}
+
+	_, err = s.accountRoleReadModel.Find(ctx, rid, uid, storeId)
+	if err == nil {
+		return nil, ErrAccountRoleAlreadyAssigned
+	}
+	if !errors.Is(err, ErrRoleNotFound) {
+		return nil, err
+	}
+	request, err := s.approvals.Hold(ctx, actorId, rid, uid, storeId, validity)
+	if err != nil || request != nil {
+		return request, err
 	}
-	return ErrAccountRoleAlreadyAssigned
+	return nil, s.accountRoleRepo.AssignRole(ctx, rid, uid, storeId, validity)
 }
 
-// AssignRole implements RoleAccountService.
-func (s *services) DeleteRole(ctx context.Context, rid, uid ulid.ULID) error {
-	data, err := s.accountRoleReadModel.Find(ctx, rid, uid)
+// DeleteRole implements RoleAccountService.
+func (s *services) DeleteRole(ctx context.Context, rid, uid, storeId ulid.ULID) error {
+	_, err := s.accountRoleReadModel.Find(ctx, rid, uid, storeId)
 	if err != nil {
 		return err
 	}
-	return s.accountRoleRepo.RemoveRole(ctx, data.AccountId, data.RoleId)
+	return s.accountRoleRepo.RemoveRole(ctx, uid, rid, storeId)
 }
 
 // GetAccount implements RoleAccountService.
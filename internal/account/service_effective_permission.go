@@ -0,0 +1,236 @@
+package account
+
+import (
+	"context"
+	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/role"
+	"sort"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type EffectivePermissionList struct {
+	Permissions []domain.EffectivePermission `json:"data"`
+	Denials     []domain.DeniedGrant         `json:"denials"`
+	Count       int                          `json:"count"`
+}
+
+type EffectivePermissionService interface {
+	GetEffectivePermissions(ctx context.Context, uid, storeId ulid.ULID, explain bool) (EffectivePermissionList, error)
+}
+
+type effectivePermissionService struct {
+	readModel               ReadModel
+	accountRoleReadModel    ReadModelAccountRole
+	roleReadModel           role.ReadModel
+	rolePermissionReadModel role.ReadModelRolePermission
+}
+
+func NewEffectivePermissionService(
+	readModel ReadModel,
+	accountRoleReadModel ReadModelAccountRole,
+	roleReadModel role.ReadModel,
+	rolePermissionReadModel role.ReadModelRolePermission,
+) EffectivePermissionService {
+	return &effectivePermissionService{
+		readModel:               readModel,
+		accountRoleReadModel:    accountRoleReadModel,
+		roleReadModel:           roleReadModel,
+		rolePermissionReadModel: rolePermissionReadModel,
+	}
+}
+
+// GetEffectivePermissions implements EffectivePermissionService. It lists
+// the grants of the account in a store, or outside of any store for the
+// zero ULID; roles of dynamic separation of duties constraints count
+// whether or not a session activated them. Unless explain is set only the
+// effective grants are returned, without their paths. With explain every
+// grant the account holds or held through an assignment is returned, with
+// every path to it, including expired assignments, assignments yet to
+// start or made in another store, and the denials restricting it.
+func (s *effectivePermissionService) GetEffectivePermissions(ctx context.Context, uid, storeId ulid.ULID, explain bool) (EffectivePermissionList, error) {
+	res := EffectivePermissionList{
+		Permissions: []domain.EffectivePermission{},
+		Denials:     []domain.DeniedGrant{},
+	}
+	if _, err := s.readModel.FindById(ctx, uid); err != nil {
+		return res, err
+	}
+	current, err := s.accountRoleReadModel.FetchByAccount(ctx, uid)
+	if err != nil {
+		return res, err
+	}
+	expired, err := s.accountRoleReadModel.FetchExpiredByAccount(ctx, uid)
+	if err != nil {
+		return res, err
+	}
+
+	now := time.Now()
+	grants := map[string]*domain.EffectivePermission{}
+	active := []ulid.ULID{}
+	addPaths := func(assignment domain.AssignedRole, status string) error {
+		own, err := s.rolePermissionReadModel.FetchByRole(ctx, assignment.Id)
+		if err != nil {
+			return err
+		}
+		inherited, err := s.rolePermissionReadModel.FetchInheritedByRole(ctx, assignment.Id)
+		if err != nil {
+			return err
+		}
+		path := domain.PermissionPath{
+			RoleId:   assignment.Id,
+			RoleName: assignment.Name,
+			StoreId:  assignment.StoreId,
+			Validity: assignment.Validity,
+			Status:   status,
+		}
+		add := func(grant string, path domain.PermissionPath) {
+			item, ok := grants[grant]
+			if !ok {
+				item = &domain.EffectivePermission{Grant: grant}
+				grants[grant] = item
+			}
+			item.Paths = append(item.Paths, path)
+		}
+		for _, grant := range own.Permissions {
+			p := path
+			p.Condition = own.Conditions[grant]
+			add(grant, p)
+		}
+		for _, ip := range inherited.Permissions {
+			p := path
+			ancestor := ip.RoleId
+			p.InheritedFromId = &ancestor
+			p.InheritedFromName = ip.RoleName
+			p.Condition = ip.Condition
+			add(ip.Grant, p)
+		}
+		return nil
+	}
+	for _, assignment := range current.Roles {
+		status := domain.PathActive
+		switch {
+		case !assignment.ActiveAt(now):
+			status = domain.PathPending
+		case assignment.StoreId != nil && *assignment.StoreId != storeId:
+			status = domain.PathOtherStore
+		default:
+			active = append(active, assignment.Id)
+		}
+		if err := addPaths(assignment, status); err != nil {
+			return res, err
+		}
+	}
+	for _, assignment := range expired.Roles {
+		if err := addPaths(assignment, domain.PathExpired); err != nil {
+			return res, err
+		}
+	}
+
+	denials, err := s.denials(ctx, uid, active)
+	if err != nil {
+		return res, err
+	}
+	set := authz.NewPermissionSet(nil).WithDenials(denials)
+
+	keys := make([]string, 0, len(grants))
+	for grant := range grants {
+		keys = append(keys, grant)
+	}
+	sort.Strings(keys)
+	for _, grant := range keys {
+		item := grants[grant]
+		item.Denials = set.Restricting(grant)
+		for _, path := range item.Paths {
+			if path.Status == domain.PathActive {
+				item.Effective = !set.Revokes(grant)
+				break
+			}
+		}
+		if !explain {
+			if item.Effective {
+				res.Permissions = append(res.Permissions, domain.EffectivePermission{
+					Grant:     item.Grant,
+					Effective: true,
+					Denials:   item.Denials,
+				})
+			}
+			continue
+		}
+		res.Permissions = append(res.Permissions, *item)
+	}
+	if explain {
+		res.Denials = denials
+	}
+	res.Count = len(res.Permissions)
+	return res, nil
+}
+
+// denials returns the denials applying to the account: its own first, then
+// those of the roles in roleIds and their ancestors by role name.
+func (s *effectivePermissionService) denials(ctx context.Context, uid ulid.ULID, roleIds []ulid.ULID) ([]domain.DeniedGrant, error) {
+	res := []domain.DeniedGrant{}
+	own, err := s.readModel.FetchDenials(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range own.Denials {
+		for _, grant := range d.Grants {
+			res = append(res, domain.DeniedGrant{
+				Grant:        grant,
+				On:           domain.DenialOnAccount,
+				PermissionId: d.PermissionId,
+				Reason:       d.Reason,
+			})
+		}
+	}
+
+	roles := []domain.Role{}
+	seen := map[ulid.ULID]bool{}
+	queue := append([]ulid.ULID{}, roleIds...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		data, err := s.roleReadModel.FindById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *data)
+		parents, err := s.roleReadModel.FetchParents(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range parents.Roles {
+			queue = append(queue, parent.Id)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+	for _, r := range roles {
+		list, err := s.roleReadModel.FetchDenials(ctx, r.Id)
+		if err != nil {
+			return nil, err
+		}
+		roleId := r.Id
+		for _, d := range list.Denials {
+			for _, grant := range d.Grants {
+				res = append(res, domain.DeniedGrant{
+					Grant:        grant,
+					On:           domain.DenialOnRole,
+					RoleId:       &roleId,
+					RoleName:     r.Name,
+					PermissionId: d.PermissionId,
+					Reason:       d.Reason,
+				})
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,138 @@
+package account
+
+import (
+	"context"
+	"pos/domain"
+	"pos/internal/role"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// fakeExplainSource holds one account assigned one role, with the denials
+// of the account. Only the methods GetEffectivePermissions uses are
+// implemented.
+type fakeExplainSource struct {
+	ReadModel
+	ReadModelAccountRole
+	assigned domain.Role
+	denials  []domain.Denial
+}
+
+type fakeExplainGrants struct {
+	role.ReadModelRolePermission
+	grants []string
+}
+
+func (f *fakeExplainSource) FindById(ctx context.Context, id ulid.ULID) (*domain.Account, error) {
+	return &domain.Account{Id: id}, nil
+}
+
+func (f *fakeExplainSource) FetchDenials(ctx context.Context, id ulid.ULID) (DenialList, error) {
+	return DenialList{Denials: f.denials, Count: len(f.denials)}, nil
+}
+
+func (f *fakeExplainSource) FetchByAccount(ctx context.Context, id ulid.ULID) (RoleAccountList, error) {
+	return RoleAccountList{Roles: []domain.AssignedRole{{Role: f.assigned}}, Count: 1}, nil
+}
+
+func (f *fakeExplainSource) FetchExpiredByAccount(ctx context.Context, id ulid.ULID) (RoleAccountList, error) {
+	return emptyRole, nil
+}
+
+func (f *fakeExplainGrants) FetchByRole(ctx context.Context, id ulid.ULID) (role.RolePermissionList, error) {
+	return role.RolePermissionList{Permissions: f.grants, Conditions: map[string]string{}, Count: len(f.grants)}, nil
+}
+
+func (f *fakeExplainGrants) FetchInheritedByRole(ctx context.Context, id ulid.ULID) (role.InheritedPermissionList, error) {
+	return role.InheritedPermissionList{Permissions: []domain.InheritedPermission{}}, nil
+}
+
+type fakeExplainRoles struct {
+	role.ReadModel
+	assigned domain.Role
+}
+
+func (f *fakeExplainRoles) FindById(ctx context.Context, id ulid.ULID) (*domain.Role, error) {
+	return &f.assigned, nil
+}
+
+func (f *fakeExplainRoles) FetchParents(ctx context.Context, id ulid.ULID) (role.RoleList, error) {
+	return role.RoleList{Roles: []domain.Role{}}, nil
+}
+
+func (f *fakeExplainRoles) FetchDenials(ctx context.Context, id ulid.ULID) (role.DenialList, error) {
+	return role.DenialList{Denials: []domain.Denial{}}, nil
+}
+
+func TestEffectivePermissionsDenials(t *testing.T) {
+	tests := []struct {
+		name          string
+		grants        []string
+		denied        []string
+		wantEffective map[string]bool
+		wantDenials   map[string]int
+	}{
+		{
+			name:          "denial under a broader grant",
+			grants:        []string{"**"},
+			denied:        []string{"refund-transaction"},
+			wantEffective: map[string]bool{"**": true},
+			wantDenials:   map[string]int{"**": 1},
+		},
+		{
+			name:          "denial of the whole grant",
+			grants:        []string{"refund-transaction", "create-sale"},
+			denied:        []string{"refund-transaction"},
+			wantEffective: map[string]bool{"refund-transaction": false, "create-sale": true},
+			wantDenials:   map[string]int{"refund-transaction": 1, "create-sale": 0},
+		},
+		{
+			name:          "denial of one method",
+			grants:        []string{"refund-transaction"},
+			denied:        []string{"POST refund-transaction"},
+			wantEffective: map[string]bool{"refund-transaction": true},
+			wantDenials:   map[string]int{"refund-transaction": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assigned := domain.Role{Id: ulid.Make(), Name: "Administrator"}
+			source := &fakeExplainSource{assigned: assigned}
+			for _, d := range tt.denied {
+				source.denials = append(source.denials, domain.Denial{PermissionId: ulid.Make(), Grants: []string{d}})
+			}
+			svc := NewEffectivePermissionService(source, source, &fakeExplainRoles{assigned: assigned}, &fakeExplainGrants{grants: tt.grants})
+
+			for _, explain := range []bool{false, true} {
+				list, err := svc.GetEffectivePermissions(context.Background(), ulid.Make(), ulid.ULID{}, explain)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := map[string]domain.EffectivePermission{}
+				for _, item := range list.Permissions {
+					got[item.Grant] = item
+				}
+				for grant, effective := range tt.wantEffective {
+					item, ok := got[grant]
+					if !effective && !explain {
+						if ok {
+							t.Errorf("explain=%v: %q listed, want it left out", explain, grant)
+						}
+						continue
+					}
+					if !ok {
+						t.Errorf("explain=%v: %q missing", explain, grant)
+						continue
+					}
+					if item.Effective != effective {
+						t.Errorf("explain=%v: %q effective = %v, want %v", explain, grant, item.Effective, effective)
+					}
+					if len(item.Denials) != tt.wantDenials[grant] {
+						t.Errorf("explain=%v: %q restricted by %d denials, want %d", explain, grant, len(item.Denials), tt.wantDenials[grant])
+					}
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package account
 import (
 	"context"
 	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/permission"
+	"pos/internal/role"
 
 	"github.com/oklog/ulid/v2"
 	"golang.org/x/crypto/bcrypt"
@@ -20,21 +23,30 @@ func (s *services) CreateAccount(ctx context.Context, email, pwd string) (*domai
 	return &newData, nil
 }
 
-// DeleteAccount implements MutationData.
-func (s *services) DeleteAccount(ctx context.Context, id ulid.ULID) error {
+// DeleteAccount implements MutationData. Account uid, the administrator,
+// must hold every grant of the account, see checkHeldGrants.
+func (s *services) DeleteAccount(ctx context.Context, uid, id ulid.ULID) error {
 	currentData, err := s.readModel.FindById(ctx, id)
 	if err != nil {
 		return err
 	}
+	if err := s.checkHeldGrants(ctx, uid, id); err != nil {
+		return err
+	}
 	return s.repo.Delete(ctx, currentData)
 }
 
-// EditAccount implements MutationData.
-func (s *services) EditAccount(ctx context.Context, id ulid.ULID, pwd string) (*domain.Account, error) {
+// EditAccount implements MutationData. Unless it changes its own password,
+// account uid, the administrator, must hold every grant of the account,
+// see checkHeldGrants.
+func (s *services) EditAccount(ctx context.Context, uid, id ulid.ULID, pwd string) (*domain.Account, error) {
 	currentData, err := s.readModel.FindById(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkHeldGrants(ctx, uid, id); err != nil {
+		return nil, err
+	}
 	bytes, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
@@ -46,15 +58,85 @@ func (s *services) EditAccount(ctx context.Context, id ulid.ULID, pwd string) (*
 	return currentData, nil
 }
 
+// checkHeldGrants returns an *authz.DelegationError unless account uid
+// holds without condition every grant of the roles assigned to account id,
+// own and inherited, in the store of each assignment. Taking over an
+// account would otherwise hand out its grants.
+func (s *services) checkHeldGrants(ctx context.Context, uid, id ulid.ULID) error {
+	if uid == id {
+		return nil
+	}
+	assigned, err := s.accountRoleReadModel.FetchByAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, assignment := range assigned.Roles {
+		grants, err := role.Grants(ctx, s.rolePermissionReadModel, assignment.Id)
+		if err != nil {
+			return err
+		}
+		actor := authz.Subject{AccountId: uid}
+		if assignment.StoreId != nil {
+			actor.StoreId = *assignment.StoreId
+		}
+		if err := authz.CheckDelegation(ctx, s.permissions, actor, grants); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddDenial implements MutationData.
+func (s *services) AddDenial(ctx context.Context, id, permissionId ulid.ULID, reason string) error {
+	if _, err := s.readModel.FindById(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.AddDenial(ctx, id, permissionId, reason)
+}
+
+// RemoveDenial implements MutationData. Account uid, the administrator,
+// cannot lift a denial of its own account, see ErrOwnDenial, and must hold
+// the grant without condition; otherwise an *authz.DelegationError is
+// returned.
+func (s *services) RemoveDenial(ctx context.Context, uid, id, permissionId ulid.ULID) error {
+	if uid == id {
+		return ErrOwnDenial
+	}
+	data, err := s.permissionReadModel.FindById(ctx, permissionId)
+	if err != nil {
+		return err
+	}
+	if err := authz.CheckDelegation(ctx, s.permissions, authz.Subject{AccountId: uid}, data.Grants()); err != nil {
+		return err
+	}
+	return s.repo.RemoveDenial(ctx, id, permissionId)
+}
+
 type MutationData interface {
 	CreateAccount(ctx context.Context, email, pwd string) (*domain.Account, error)
-	EditAccount(ctx context.Context, id ulid.ULID, pwd string) (*domain.Account, error)
-	DeleteAccount(ctx context.Context, id ulid.ULID) error
+	EditAccount(ctx context.Context, uid, id ulid.ULID, pwd string) (*domain.Account, error)
+	DeleteAccount(ctx context.Context, uid, id ulid.ULID) error
+	AddDenial(ctx context.Context, id, permissionId ulid.ULID, reason string) error
+	RemoveDenial(ctx context.Context, uid, id, permissionId ulid.ULID) error
 }
 
+// NewMutationData checks with permissions that administrators only lift
+// denials of grants they hold, see RemoveDenial, and only take over
+// accounts whose grants they hold, see EditAccount and DeleteAccount.
 func NewMutationData(
 	repo Repo,
 	readModel ReadModel,
+	accountRoleReadModel ReadModelAccountRole,
+	rolePermissionReadModel role.ReadModelRolePermission,
+	permissionReadModel permission.ReadModel,
+	permissions authz.PermissionReader,
 ) MutationData {
-	return &services{repo: repo, readModel: readModel}
+	return &services{
+		repo:                    repo,
+		readModel:               readModel,
+		accountRoleReadModel:    accountRoleReadModel,
+		rolePermissionReadModel: rolePermissionReadModel,
+		permissionReadModel:     permissionReadModel,
+		permissions:             permissions,
+	}
 }
@@ -0,0 +1,81 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordService checks the password of an account, at login or on
+// behalf of another one such as an approver of an override, with the same
+// attempt limit as PINs. Both share one count, so that a password cannot
+// be guessed through one of them once the other locked it.
+type PasswordService interface {
+	VerifyPassword(ctx context.Context, id ulid.ULID, password string) error
+}
+
+type passwordService struct {
+	readModel    ReadModel
+	passwordRepo RepoPassword
+	maxFailures  uint
+	lockout      time.Duration
+}
+
+// NewPasswordService returns the password checks of accounts. maxFailures
+// wrong passwords in a row lock the password for lockout; zero never locks
+// it.
+func NewPasswordService(
+	readModel ReadModel,
+	passwordRepo RepoPassword,
+	maxFailures uint,
+	lockout time.Duration,
+) PasswordService {
+	return &passwordService{
+		readModel:    readModel,
+		passwordRepo: passwordRepo,
+		maxFailures:  maxFailures,
+		lockout:      lockout,
+	}
+}
+
+// VerifyPassword implements PasswordService. It works as
+// PinService.VerifyPin does: every attempt counts towards the lockout
+// before the password is checked, and a right password clears the
+// failures.
+func (s *passwordService) VerifyPassword(ctx context.Context, id ulid.ULID, password string) error {
+	if s.maxFailures == 0 {
+		acc, err := s.readModel.FindById(ctx, id)
+		if err != nil {
+			return err
+		}
+		return comparePassword(acc.Password, password)
+	}
+	now := time.Now()
+	hash, until, err := s.passwordRepo.ReservePasswordAttempt(ctx, id, s.maxFailures, now, now.Add(s.lockout))
+	if err != nil {
+		return err
+	}
+	if err := comparePassword(hash, password); err != nil {
+		if until != nil && now.Before(*until) {
+			log.Warn().
+				Str("account", id.String()).
+				Time("until", *until).
+				Msg("password locked after too many failures")
+		}
+		return err
+	}
+	return s.passwordRepo.ResetPasswordFailures(ctx, id)
+}
+
+func comparePassword(hash, password string) error {
+	if err := bcrypt.CompareHashAndPassword(
+		[]byte(hash),
+		[]byte(password),
+	); err != nil {
+		return ErrPasswordWrong
+	}
+	return nil
+}
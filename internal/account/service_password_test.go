@@ -0,0 +1,86 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakePasswords keeps one password in memory and counts attempts the way
+// the accounts UPDATE does.
+type fakePasswords struct {
+	mu       sync.Mutex
+	hash     string
+	failures uint
+	until    *time.Time
+}
+
+func (f *fakePasswords) ReservePasswordAttempt(ctx context.Context, accountId ulid.ULID, maxFailures uint, now, lockedUntil time.Time) (string, *time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.until != nil && now.Before(*f.until) {
+		return "", nil, ErrPasswordLocked
+	}
+	f.failures++
+	f.until = nil
+	if f.failures >= maxFailures {
+		f.failures = 0
+		f.until = &lockedUntil
+	}
+	return f.hash, f.until, nil
+}
+
+func (f *fakePasswords) ResetPasswordFailures(ctx context.Context, accountId ulid.ULID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = 0
+	f.until = nil
+	return nil
+}
+
+func TestVerifyPasswordLocksParallelAttempts(t *testing.T) {
+	const (
+		maxFailures = 3
+		attempts    = 20
+	)
+	hash, err := bcrypt.GenerateFromPassword([]byte("right password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewPasswordService(nil, &fakePasswords{hash: string(hash)}, maxFailures, time.Minute)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- svc.VerifyPassword(context.Background(), ulid.ULID{}, "wrong password")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	wrong, locked := 0, 0
+	for err := range errs {
+		switch {
+		case errors.Is(err, ErrPasswordWrong):
+			wrong++
+		case errors.Is(err, ErrPasswordLocked):
+			locked++
+		default:
+			t.Fatalf("VerifyPassword() error = %v", err)
+		}
+	}
+	if wrong != maxFailures || locked != attempts-maxFailures {
+		t.Fatalf("got %d wrong and %d locked, want %d and %d", wrong, locked, maxFailures, attempts-maxFailures)
+	}
+	if err := svc.VerifyPassword(context.Background(), ulid.ULID{}, "right password"); !errors.Is(err, ErrPasswordLocked) {
+		t.Fatalf("right password while locked: error = %v, want %v", err, ErrPasswordLocked)
+	}
+}
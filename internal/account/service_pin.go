@@ -0,0 +1,118 @@
+package account
+
+import (
+	"context"
+	"pos/domain"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PinService interface {
+	SetPin(ctx context.Context, id ulid.ULID, password, pin string) error
+	VerifyPin(ctx context.Context, id ulid.ULID, pin string) error
+	UnlockPin(ctx context.Context, id ulid.ULID) error
+}
+
+type pinService struct {
+	readModel    ReadModel
+	pinRepo      RepoPin
+	pinReadModel ReadModelPin
+	maxFailures  uint
+	maxLockouts  uint
+	lockout      time.Duration
+}
+
+// NewPinService returns the PINs of accounts. maxFailures wrong PINs in a
+// row lock the PIN for lockout; zero never locks it. After maxLockouts
+// lockouts the PIN stays locked until an administrator unlocks it; zero
+// always lets it go after lockout.
+func NewPinService(
+	readModel ReadModel,
+	pinRepo RepoPin,
+	pinReadModel ReadModelPin,
+	maxFailures uint,
+	maxLockouts uint,
+	lockout time.Duration,
+) PinService {
+	return &pinService{
+		readModel:    readModel,
+		pinRepo:      pinRepo,
+		pinReadModel: pinReadModel,
+		maxFailures:  maxFailures,
+		maxLockouts:  maxLockouts,
+		lockout:      lockout,
+	}
+}
+
+// SetPin implements PinService. The account confirms the change with its
+// password.
+func (s *pinService) SetPin(ctx context.Context, id ulid.ULID, password, pin string) error {
+	acc, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword(
+		[]byte(acc.Password),
+		[]byte(password),
+	); err != nil {
+		return ErrPasswordWrong
+	}
+	bytes, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.pinRepo.SetPin(ctx, id, string(bytes))
+}
+
+// VerifyPin implements PinService. A locked PIN is refused without being
+// checked. Every attempt counts towards the lockout before the PIN is
+// checked, so that parallel attempts cannot get past it; a right PIN then
+// clears the failures, but not the lockouts counted so far.
+func (s *pinService) VerifyPin(ctx context.Context, id ulid.ULID, pin string) error {
+	if s.maxFailures == 0 {
+		data, err := s.pinReadModel.FindPin(ctx, id)
+		if err != nil {
+			return err
+		}
+		return comparePin(data, pin)
+	}
+	now := time.Now()
+	data, err := s.pinRepo.ReservePinAttempt(ctx, id, s.maxFailures, s.maxLockouts, now, now.Add(s.lockout))
+	if err != nil {
+		return err
+	}
+	if err := comparePin(data, pin); err != nil {
+		switch {
+		case s.maxLockouts > 0 && uint(data.Lockouts) >= s.maxLockouts:
+			log.Warn().
+				Str("account", id.String()).
+				Int("lockouts", data.Lockouts).
+				Msg("pin locked until an administrator unlocks it")
+		case data.LockedAt(now):
+			log.Warn().
+				Str("account", id.String()).
+				Time("until", *data.LockedUntil).
+				Msg("pin locked after too many failures")
+		}
+		return err
+	}
+	return s.pinRepo.ResetPinFailures(ctx, id)
+}
+
+func comparePin(data *domain.AccountPin, pin string) error {
+	if err := bcrypt.CompareHashAndPassword(
+		[]byte(data.Hash),
+		[]byte(pin),
+	); err != nil {
+		return ErrPinWrong
+	}
+	return nil
+}
+
+// UnlockPin implements PinService. It clears the lockouts too.
+func (s *pinService) UnlockPin(ctx context.Context, id ulid.ULID) error {
+	return s.pinRepo.UnlockPin(ctx, id)
+}
@@ -0,0 +1,164 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakePins keeps one PIN in memory and counts attempts the way the
+// account_pins UPDATE does, under a lock standing for the row lock.
+type fakePins struct {
+	RepoPin
+	ReadModelPin
+	mu   sync.Mutex
+	data *domain.AccountPin
+}
+
+func newFakePins(t *testing.T, pin string) *fakePins {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakePins{data: &domain.AccountPin{Hash: string(hash)}}
+}
+
+func (f *fakePins) ReservePinAttempt(ctx context.Context, accountId ulid.ULID, maxFailures, maxLockouts uint, now, lockedUntil time.Time) (*domain.AccountPin, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data.LockedAt(now) || (maxLockouts > 0 && uint(f.data.Lockouts) >= maxLockouts) {
+		return nil, ErrPinLocked
+	}
+	f.data.Failures++
+	f.data.LockedUntil = nil
+	if uint(f.data.Failures) >= maxFailures {
+		f.data.Failures = 0
+		f.data.Lockouts++
+		f.data.LockedUntil = &lockedUntil
+	}
+	copied := *f.data
+	return &copied, nil
+}
+
+func (f *fakePins) ResetPinFailures(ctx context.Context, accountId ulid.ULID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data.Failures = 0
+	f.data.LockedUntil = nil
+	return nil
+}
+
+func (f *fakePins) UnlockPin(ctx context.Context, accountId ulid.ULID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data.Failures = 0
+	f.data.Lockouts = 0
+	f.data.LockedUntil = nil
+	return nil
+}
+
+func TestVerifyPinLocksParallelAttempts(t *testing.T) {
+	const (
+		maxFailures = 3
+		attempts    = 20
+	)
+	pins := newFakePins(t, "1234")
+	svc := NewPinService(nil, pins, pins, maxFailures, 0, time.Minute)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- svc.VerifyPin(context.Background(), ulid.ULID{}, "0000")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	wrong, locked := 0, 0
+	for err := range errs {
+		switch {
+		case errors.Is(err, ErrPinWrong):
+			wrong++
+		case errors.Is(err, ErrPinLocked):
+			locked++
+		default:
+			t.Fatalf("VerifyPin() error = %v", err)
+		}
+	}
+	if wrong != maxFailures || locked != attempts-maxFailures {
+		t.Fatalf("got %d wrong and %d locked, want %d and %d", wrong, locked, maxFailures, attempts-maxFailures)
+	}
+	if err := svc.VerifyPin(context.Background(), ulid.ULID{}, "1234"); !errors.Is(err, ErrPinLocked) {
+		t.Fatalf("right pin while locked: error = %v, want %v", err, ErrPinLocked)
+	}
+}
+
+func TestVerifyPinRightPinClearsFailures(t *testing.T) {
+	pins := newFakePins(t, "1234")
+	svc := NewPinService(nil, pins, pins, 3, 0, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := svc.VerifyPin(ctx, ulid.ULID{}, "0000"); !errors.Is(err, ErrPinWrong) {
+			t.Fatalf("wrong pin: error = %v, want %v", err, ErrPinWrong)
+		}
+	}
+	if err := svc.VerifyPin(ctx, ulid.ULID{}, "1234"); err != nil {
+		t.Fatalf("right pin: error = %v", err)
+	}
+	if pins.data.Failures != 0 || pins.data.LockedUntil != nil {
+		t.Fatalf("failures = %d, locked until %v after a right pin", pins.data.Failures, pins.data.LockedUntil)
+	}
+	if err := svc.VerifyPin(ctx, ulid.ULID{}, "0000"); !errors.Is(err, ErrPinWrong) {
+		t.Fatalf("wrong pin after a right one: error = %v, want %v", err, ErrPinWrong)
+	}
+}
+
+func TestVerifyPinLockoutsNeedUnlock(t *testing.T) {
+	const (
+		maxFailures = 2
+		maxLockouts = 3
+	)
+	pins := newFakePins(t, "1234")
+	// A lockout of zero lets the PIN go as soon as it locks, so only the
+	// count of lockouts keeps it locked.
+	svc := NewPinService(nil, pins, pins, maxFailures, maxLockouts, 0)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		pin  string
+		want error
+	}{
+		{"first lockout", "0000", ErrPinWrong},
+		{"first lockout", "0000", ErrPinWrong},
+		{"right pin keeps the lockouts", "1234", nil},
+		{"second lockout", "0000", ErrPinWrong},
+		{"second lockout", "0000", ErrPinWrong},
+		{"third lockout", "0000", ErrPinWrong},
+		{"third lockout", "0000", ErrPinWrong},
+		{"wrong pin once blocked", "0000", ErrPinLocked},
+		{"right pin once blocked", "1234", ErrPinLocked},
+	}
+	for i, tt := range tests {
+		if err := svc.VerifyPin(ctx, ulid.ULID{}, tt.pin); !errors.Is(err, tt.want) {
+			t.Fatalf("attempt %d (%s): error = %v, want %v", i, tt.name, err, tt.want)
+		}
+	}
+	if err := svc.UnlockPin(ctx, ulid.ULID{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.VerifyPin(ctx, ulid.ULID{}, "1234"); err != nil {
+		t.Fatalf("right pin after unlock: error = %v", err)
+	}
+}
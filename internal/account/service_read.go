@@ -3,15 +3,22 @@ package account
 import (
 	"context"
 	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/permission"
+	"pos/internal/role"
 
 	"github.com/oklog/ulid/v2"
 )
 
 type services struct {
-	repo                 Repo
-	readModel            ReadModel
-	accountRoleRepo      RepoAccountRole
-	accountRoleReadModel ReadModelAccountRole
+	repo                    Repo
+	readModel               ReadModel
+	accountRoleRepo         RepoAccountRole
+	accountRoleReadModel    ReadModelAccountRole
+	rolePermissionReadModel role.ReadModelRolePermission
+	permissionReadModel     permission.ReadModel
+	permissions             authz.PermissionReader
+	approvals               ApprovalGate
 }
 
 // GetAll implements ReadData.
@@ -24,9 +31,18 @@ func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.Accoun
 	return s.readModel.FindById(ctx, id)
 }
 
+// GetDenials implements ReadData.
+func (s *services) GetDenials(ctx context.Context, id ulid.ULID) (DenialList, error) {
+	if _, err := s.readModel.FindById(ctx, id); err != nil {
+		return emptyDenialList, err
+	}
+	return s.readModel.FetchDenials(ctx, id)
+}
+
 type ReadData interface {
 	GetAll(ctx context.Context) (AccountList, error)
 	GetOneById(ctx context.Context, id ulid.ULID) (*domain.Account, error)
+	GetDenials(ctx context.Context, id ulid.ULID) (DenialList, error)
 }
 
 func NewReadData(
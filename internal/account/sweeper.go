@@ -0,0 +1,140 @@
+package account
+
+import (
+	"context"
+	"pos/internal/authz"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SweepResult reports what a sweep of the role assignments changed.
+type SweepResult struct {
+	// At is the database time the sweep ran at, to be passed as since to
+	// the next sweep.
+	At        time.Time
+	Expired   int
+	Activated int
+}
+
+// SweepAssignments implements RepoAccountRole. Assignments past their
+// valid_until are moved to account_role_history and the refresh tokens of
+// their accounts are revoked; accounts whose assignments started after
+// since are notified so their cached permissions are dropped. It runs for
+// every organization at once and so does not read the tenant of ctx.
+func (r *repo) SweepAssignments(ctx context.Context, since time.Time) (SweepResult, error) {
+	var res SweepResult
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.QueryRow(ctx, `SELECT NOW()::timestamp`).Scan(&res.At); err != nil {
+		return res, err
+	}
+
+	// Deleting the rows fires account_roles_notify, which already drops
+	// the cached permissions of the affected accounts.
+	row := tx.QueryRow(
+		ctx,
+		`
+			WITH expired AS (
+				DELETE FROM account_roles
+				WHERE valid_until IS NOT NULL AND valid_until <= $1
+				RETURNING account_id, role_id, store_id, valid_from, valid_until
+			), history AS (
+				INSERT INTO account_role_history (
+					account_id,
+					role_id,
+					store_id,
+					valid_from,
+					valid_until,
+					event,
+					recorded_at
+				)
+				SELECT account_id, role_id, store_id, valid_from, valid_until, 'expired', $1
+				FROM expired
+			), revoked AS (
+				UPDATE refresh_tokens
+				SET revoked = TRUE
+				WHERE revoked = FALSE AND account_id IN (SELECT account_id FROM expired)
+			)
+			SELECT COUNT(*) FROM expired;
+		`,
+		res.At,
+	)
+	if err := row.Scan(&res.Expired); err != nil {
+		return res, err
+	}
+
+	// On the first sweep there is nothing cached from before to drop.
+	if since.IsZero() {
+		return res, tx.Commit(ctx)
+	}
+	row = tx.QueryRow(
+		ctx,
+		`
+			WITH activated AS (
+				SELECT DISTINCT account_id
+				FROM account_roles
+				WHERE valid_from > $1 AND valid_from <= $2
+			)
+			SELECT COUNT(pg_notify($3, encode(account_id, 'hex'))) FROM activated;
+		`,
+		since,
+		res.At,
+		authz.NotifyChannel,
+	)
+	if err := row.Scan(&res.Activated); err != nil {
+		return res, err
+	}
+
+	return res, tx.Commit(ctx)
+}
+
+// AssignmentSweeper periodically expires time-bound role assignments.
+type AssignmentSweeper struct {
+	repo     RepoAccountRole
+	interval time.Duration
+}
+
+func NewAssignmentSweeper(repo RepoAccountRole, interval time.Duration) *AssignmentSweeper {
+	return &AssignmentSweeper{
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Run sweeps every interval until ctx is done. The first sweep happens
+// right away, picking up assignments that expired while the server was
+// down.
+func (s *AssignmentSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	var since time.Time
+	for {
+		res, err := s.repo.SweepAssignments(ctx, since)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Msg("cannot sweep role assignments")
+		} else {
+			since = res.At
+			if res.Expired > 0 || res.Activated > 0 {
+				log.Info().
+					Int("expired", res.Expired).
+					Int("activated", res.Activated).
+					Msg("swept role assignments")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrRequestNotFound   = errors.New("approval: request not found")
+	ErrRequestNotPending = errors.New("approval: request already decided")
+	ErrRequestExpired    = errors.New("approval: request expired")
+	ErrRoleNotFound      = errors.New("approval: role not found")
+)
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+type RequestList struct {
+	Requests []domain.ApprovalRequest `json:"data"`
+	Count    int                      `json:"count"`
+}
+
+var emptyList = RequestList{
+	Requests: []domain.ApprovalRequest{},
+	Count:    0,
+}
+
+// requestStatus is the status a request has now, a pending request past
+// its deadline being expired.
+const requestStatus = `
+	CASE
+		WHEN ar.status = 'pending' AND ar.expires_at <= NOW() THEN 'expired'
+		ELSE ar.status
+	END
+`
+
+const requestQuery = `
+	SELECT
+		ar.id,
+		ar.account_id,
+		ar.role_id,
+		r.name,
+		ar.store_id,
+		ar.valid_from,
+		ar.valid_until,
+		` + requestStatus + `,
+		ar.requested_by,
+		ar.created_at,
+		ar.expires_at,
+		ar.decided_by,
+		ar.decided_at,
+		ar.comment
+	FROM
+		approval_requests ar
+	JOIN
+		roles r
+	ON
+		ar.role_id = r.id
+`
+
+func scanRequest(row pgx.Row, item *domain.ApprovalRequest) error {
+	return row.Scan(
+		&item.Id,
+		&item.AccountId,
+		&item.RoleId,
+		&item.RoleName,
+		&item.StoreId,
+		&item.From,
+		&item.Until,
+		&item.Status,
+		&item.RequestedBy,
+		&item.CreatedAt,
+		&item.ExpiresAt,
+		&item.DecidedBy,
+		&item.DecidedAt,
+		&item.Comment,
+	)
+}
+
+// Fetch implements ReadModel. An empty status lists every request, the
+// latest first.
+func (r *repo) Fetch(ctx context.Context, status string) (RequestList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		requestQuery+`
+			WHERE ar.organization_id = $1 AND ($2 = '' OR `+requestStatus+` = $2)
+			ORDER BY ar.created_at DESC;
+		`,
+		org,
+		status,
+	)
+	if err != nil {
+		return emptyList, err
+	}
+	defer rows.Close()
+
+	items := []domain.ApprovalRequest{}
+	for rows.Next() {
+		var item domain.ApprovalRequest
+		if err := scanRequest(rows, &item); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyList, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyList, err
+	}
+	list := RequestList{
+		Requests: items,
+		Count:    len(items),
+	}
+	return list, nil
+}
+
+// FindById implements ReadModel.
+func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.ApprovalRequest, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		requestQuery+`
+			WHERE ar.id = $1 AND ar.organization_id = $2;
+		`,
+		id,
+		org,
+	)
+	var item domain.ApprovalRequest
+	if err := scanRequest(row, &item); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrRequestNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RequiresApproval implements ReadModel.
+func (r *repo) RequiresApproval(ctx context.Context, roleId ulid.ULID) (bool, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	var required bool
+	err = r.db.QueryRow(
+		ctx,
+		`SELECT requires_approval FROM roles WHERE id = $1 AND organization_id = $2`,
+		roleId,
+		org,
+	).Scan(&required)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrRoleNotFound
+		}
+		return false, err
+	}
+	return required, nil
+}
+
+// Save implements Repo. The account, the role and the store must belong to
+// the organization of ctx. A request still pending for the same assignment
+// fails with account.ErrAssignmentPending; one past its deadline is marked
+// expired first.
+func (r *repo) Save(ctx context.Context, data *domain.ApprovalRequest) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`
+			UPDATE approval_requests
+			SET status = 'expired'
+			WHERE status = 'pending' AND expires_at <= NOW()
+				AND account_id = $1 AND role_id = $2 AND store_id IS NOT DISTINCT FROM $3;
+		`,
+		data.AccountId,
+		data.RoleId,
+		data.StoreId,
+	)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`
+			INSERT INTO approval_requests (
+				id,
+				organization_id,
+				account_id,
+				role_id,
+				store_id,
+				valid_from,
+				valid_until,
+				status,
+				requested_by,
+				created_at,
+				expires_at
+			)
+			SELECT $1, $2, a.id, r.id, $5::bytea, $6, $7, $8, $9, $10, $11
+			FROM accounts a, roles r
+			WHERE a.id = $3 AND r.id = $4
+				AND a.organization_id = $2 AND r.organization_id = $2
+				AND ($5::bytea IS NULL OR EXISTS (
+					SELECT 1 FROM stores s WHERE s.id = $5 AND s.organization_id = $2
+				));
+		`,
+		data.Id,
+		org,
+		data.AccountId,
+		data.RoleId,
+		data.StoreId,
+		data.From,
+		data.Until,
+		data.Status,
+		data.RequestedBy,
+		data.CreatedAt,
+		data.ExpiresAt,
+	)
+	if err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return account.ErrAssignmentPending
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return account.ErrAssignmentTargetNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// Approve implements Repo. The request must still be pending and within its
+// deadline. It is marked approved and the role assigned in the same
+// transaction, so a rejected assignment, a *domain.ConstraintError for
+// instance, leaves the request pending.
+func (r *repo) Approve(ctx context.Context, id, approverId ulid.ULID, comment string) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	data, err := decide(ctx, tx, org, id, approverId, domain.ApprovalApproved, comment)
+	if err != nil {
+		return err
+	}
+	storeId := ulid.ULID{}
+	if data.StoreId != nil {
+		storeId = *data.StoreId
+	}
+	err = account.NewRepoAccountRoleTx(tx).AssignRole(ctx, data.RoleId, data.AccountId, storeId, data.Validity)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Reject implements Repo. The request must still be pending and within its
+// deadline.
+func (r *repo) Reject(ctx context.Context, id, approverId ulid.ULID, comment string) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := decide(ctx, tx, org, id, approverId, domain.ApprovalRejected, comment); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// decide records the decision of approverId on a pending request and
+// returns the request. The row stays locked until tx ends.
+func decide(ctx context.Context, tx pgx.Tx, org, id, approverId ulid.ULID, status, comment string) (*domain.ApprovalRequest, error) {
+	var data domain.ApprovalRequest
+	var expired bool
+	err := tx.QueryRow(
+		ctx,
+		`
+			SELECT account_id, role_id, store_id, valid_from, valid_until, status, expires_at <= NOW()
+			FROM approval_requests
+			WHERE id = $1 AND organization_id = $2
+			FOR UPDATE;
+		`,
+		id,
+		org,
+	).Scan(
+		&data.AccountId,
+		&data.RoleId,
+		&data.StoreId,
+		&data.From,
+		&data.Until,
+		&data.Status,
+		&expired,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRequestNotFound
+		}
+		return nil, err
+	}
+	if data.Status != domain.ApprovalPending {
+		return nil, ErrRequestNotPending
+	}
+	if expired {
+		return nil, ErrRequestExpired
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`
+			UPDATE approval_requests
+			SET status = $2, decided_by = $3, decided_at = $4, comment = $5
+			WHERE id = $1;
+		`,
+		id,
+		status,
+		approverId,
+		time.Now(),
+		comment,
+	)
+	if err != nil {
+		return nil, err
+	}
+	data.Id = id
+	return &data, nil
+}
+
+// SetRoleApproval implements Repo.
+func (r *repo) SetRoleApproval(ctx context.Context, roleId ulid.ULID, required bool) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE roles
+			SET requires_approval = $2
+			WHERE id = $1 AND organization_id = $3
+		`,
+		roleId,
+		required,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+type Repo interface {
+	Save(ctx context.Context, data *domain.ApprovalRequest) error
+	Approve(ctx context.Context, id, approverId ulid.ULID, comment string) error
+	Reject(ctx context.Context, id, approverId ulid.ULID, comment string) error
+	SetRoleApproval(ctx context.Context, roleId ulid.ULID, required bool) error
+}
+
+type ReadModel interface {
+	Fetch(ctx context.Context, status string) (RequestList, error)
+	FindById(ctx context.Context, id ulid.ULID) (*domain.ApprovalRequest, error)
+	RequiresApproval(ctx context.Context, roleId ulid.ULID) (bool, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
+
+func NewReadModel(db *pgxpool.Pool) ReadModel {
+	return &repo{db: db}
+}
@@ -0,0 +1,227 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/authz"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/utils/httpresponse"
+	"pos/utils/key"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/oklog/ulid/v2"
+)
+
+var statuses = []interface{}{
+	domain.ApprovalPending,
+	domain.ApprovalApproved,
+	domain.ApprovalRejected,
+	domain.ApprovalExpired,
+}
+
+type approvalRoute struct {
+	svc Service
+}
+
+func NewRoute(
+	svc Service,
+) *approvalRoute {
+	return &approvalRoute{
+		svc: svc,
+	}
+}
+
+// Routes serves the approval requests to accounts holding
+// account-role:approve; which roles need approval is set by those holding
+// role:manage.
+func (p *approvalRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("account-role:approve"))
+		r.Get("/", p.getAllRequest)
+		r.Get("/{id}", p.getOneRequest)
+		r.Post("/{id}/approve", p.approve)
+		r.Post("/{id}/reject", p.reject)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("role:manage"))
+		r.Put("/role/{id}", p.setRoleApproval)
+	})
+	return r
+}
+
+type decisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+func (c decisionRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Comment, validation.Length(0, 1024)),
+	)
+}
+
+type setRoleApprovalRequest struct {
+	// Required makes assignments of the role wait for a second approver.
+	Required bool `json:"required"`
+}
+
+// writeDecisionError answers a decision that cannot be made.
+func writeDecisionError(w http.ResponseWriter, err error) {
+	var constraintErr *domain.ConstraintError
+	var delegationErr *authz.DelegationError
+	switch {
+	case errors.Is(err, ErrRequestNotFound), errors.Is(err, account.ErrAssignmentTargetNotFound):
+		httpresponse.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrSelfApproval), errors.As(err, &delegationErr):
+		httpresponse.WriteError(w, http.StatusForbidden, err)
+	case errors.Is(err, ErrRequestNotPending),
+		errors.Is(err, ErrRequestExpired),
+		errors.Is(err, account.ErrAccountRoleAlreadyAssigned),
+		errors.As(err, &constraintErr):
+		httpresponse.WriteError(w, http.StatusConflict, err)
+	default:
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+	}
+}
+
+func (p *approvalRoute) getAllRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	status := r.URL.Query().Get("status")
+	if err := validation.Validate(status, validation.In(statuses...)); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.GetAll(ctx, status)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Requests, meta)
+}
+
+func (p *approvalRoute) getOneRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.GetOneById(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrRequestNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *approvalRoute) approve(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body decisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.Approve(ctx, token.Id, id, body.Comment)
+	if err != nil {
+		writeDecisionError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *approvalRoute) reject(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body decisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.Reject(ctx, token.Id, id, body.Comment)
+	if err != nil {
+		writeDecisionError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *approvalRoute) setRoleApproval(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body setRoleApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.svc.SetRoleApproval(ctx, id, body.Required); err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success set role approval")
+}
@@ -0,0 +1,147 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/role"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var ErrSelfApproval = errors.New("approval: the requester and the assignee cannot approve the request")
+
+type Service interface {
+	Hold(ctx context.Context, requestedBy, rid, uid, storeId ulid.ULID, validity domain.Validity) (*domain.ApprovalRequest, error)
+	GetAll(ctx context.Context, status string) (RequestList, error)
+	GetOneById(ctx context.Context, id ulid.ULID) (*domain.ApprovalRequest, error)
+	Approve(ctx context.Context, approverId, id ulid.ULID, comment string) (*domain.ApprovalRequest, error)
+	Reject(ctx context.Context, approverId, id ulid.ULID, comment string) (*domain.ApprovalRequest, error)
+	SetRoleApproval(ctx context.Context, roleId ulid.ULID, required bool) error
+}
+
+type services struct {
+	repo                    Repo
+	readModel               ReadModel
+	rolePermissionReadModel role.ReadModelRolePermission
+	permissions             authz.PermissionReader
+	deadline                time.Duration
+}
+
+// NewService returns the approval workflow. Requests not decided within
+// deadline expire.
+func NewService(
+	repo Repo,
+	readModel ReadModel,
+	rolePermissionReadModel role.ReadModelRolePermission,
+	permissions authz.PermissionReader,
+	deadline time.Duration,
+) Service {
+	return &services{
+		repo:                    repo,
+		readModel:               readModel,
+		rolePermissionReadModel: rolePermissionReadModel,
+		permissions:             permissions,
+		deadline:                deadline,
+	}
+}
+
+// Hold implements account.ApprovalGate. When role rid needs a second
+// approver the assignment is saved as a pending request and returned.
+func (s *services) Hold(ctx context.Context, requestedBy, rid, uid, storeId ulid.ULID, validity domain.Validity) (*domain.ApprovalRequest, error) {
+	required, err := s.readModel.RequiresApproval(ctx, rid)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			// Left to the assignment to report.
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !required {
+		return nil, nil
+	}
+	var store *ulid.ULID
+	if storeId != (ulid.ULID{}) {
+		store = &storeId
+	}
+	newData := domain.NewApprovalRequest(requestedBy, uid, rid, store, validity, s.deadline)
+	if err := s.repo.Save(ctx, &newData); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, newData.Id)
+}
+
+// GetAll implements Service.
+func (s *services) GetAll(ctx context.Context, status string) (RequestList, error) {
+	return s.readModel.Fetch(ctx, status)
+}
+
+// GetOneById implements Service.
+func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.ApprovalRequest, error) {
+	return s.readModel.FindById(ctx, id)
+}
+
+// Approve implements Service. The approver must be neither the requester
+// nor the assignee, and must hold every grant of the role in the store of
+// the request, as when assigning it; otherwise an *authz.DelegationError
+// is returned. Only then is the role assigned.
+func (s *services) Approve(ctx context.Context, approverId, id ulid.ULID, comment string) (*domain.ApprovalRequest, error) {
+	data, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if approverId == data.RequestedBy || approverId == data.AccountId {
+		return nil, ErrSelfApproval
+	}
+	grants, err := role.Grants(ctx, s.rolePermissionReadModel, data.RoleId)
+	if err != nil {
+		return nil, err
+	}
+	approver := authz.Subject{AccountId: approverId}
+	if data.StoreId != nil {
+		approver.StoreId = *data.StoreId
+	}
+	if err := authz.CheckDelegation(ctx, s.permissions, approver, grants); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Approve(ctx, id, approverId, comment); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, id)
+}
+
+// Reject implements Service. The requester may reject their own request to
+// withdraw it.
+func (s *services) Reject(ctx context.Context, approverId, id ulid.ULID, comment string) (*domain.ApprovalRequest, error) {
+	if _, err := s.pending(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Reject(ctx, id, approverId, comment); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, id)
+}
+
+// pending returns request id, failing unless it awaits a decision.
+func (s *services) pending(ctx context.Context, id ulid.ULID) (*domain.ApprovalRequest, error) {
+	data, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch data.Status {
+	case domain.ApprovalPending:
+		return data, nil
+	case domain.ApprovalExpired:
+		return nil, ErrRequestExpired
+	default:
+		return nil, ErrRequestNotPending
+	}
+}
+
+// SetRoleApproval implements Service. Requests already pending are left as
+// they are.
+func (s *services) SetRoleApproval(ctx context.Context, roleId ulid.ULID, required bool) error {
+	return s.repo.SetRoleApproval(ctx, roleId, required)
+}
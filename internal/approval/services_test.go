@@ -0,0 +1,125 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/role"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// fakeRequests keeps one approval request in memory.
+type fakeRequests struct {
+	Repo
+	ReadModel
+	data     domain.ApprovalRequest
+	approved bool
+}
+
+func (f *fakeRequests) FindById(ctx context.Context, id ulid.ULID) (*domain.ApprovalRequest, error) {
+	copied := f.data
+	return &copied, nil
+}
+
+func (f *fakeRequests) Approve(ctx context.Context, id, approverId ulid.ULID, comment string) error {
+	f.approved = true
+	f.data.Status = domain.ApprovalApproved
+	f.data.DecidedBy = &approverId
+	return nil
+}
+
+// fakeRoleGrants gives the role of the request one grant of its own and
+// one inherited.
+type fakeRoleGrants struct {
+	role.ReadModelRolePermission
+}
+
+func (f *fakeRoleGrants) FetchByRole(ctx context.Context, id ulid.ULID) (role.RolePermissionList, error) {
+	return role.RolePermissionList{Permissions: []string{"refund-transaction"}}, nil
+}
+
+func (f *fakeRoleGrants) FetchInheritedByRole(ctx context.Context, id ulid.ULID) (role.InheritedPermissionList, error) {
+	return role.InheritedPermissionList{Permissions: []domain.InheritedPermission{{Grant: "create-sale"}}}, nil
+}
+
+// fakePermissions holds the grants of each account in each store, the
+// zero ULID standing for every store.
+type fakePermissions map[ulid.ULID]map[ulid.ULID][]string
+
+func (f fakePermissions) Permissions(ctx context.Context, subject authz.Subject) (authz.PermissionSet, error) {
+	return authz.NewPermissionSet(f[subject.AccountId][subject.StoreId]), nil
+}
+
+func TestApprove(t *testing.T) {
+	requester, assignee := ulid.Make(), ulid.Make()
+	manager, supervisor, otherManager := ulid.Make(), ulid.Make(), ulid.Make()
+	store, otherStore := ulid.Make(), ulid.Make()
+	permissions := fakePermissions{
+		requester:    {store: {"**"}},
+		assignee:     {store: {"**"}},
+		manager:      {store: {"refund-transaction", "create-sale"}},
+		supervisor:   {store: {"refund-transaction"}},
+		otherManager: {otherStore: {"refund-transaction", "create-sale"}},
+	}
+
+	tests := []struct {
+		name        string
+		approver    ulid.ULID
+		status      string
+		want        error
+		wantMissing []string
+	}{
+		{"requester", requester, domain.ApprovalPending, ErrSelfApproval, nil},
+		{"assignee", assignee, domain.ApprovalPending, ErrSelfApproval, nil},
+		{"approver missing an inherited grant", supervisor, domain.ApprovalPending, nil, []string{"create-sale"}},
+		{"approver of another store", otherManager, domain.ApprovalPending, nil, []string{"refund-transaction", "create-sale"}},
+		{"approver holding the grants", manager, domain.ApprovalPending, nil, nil},
+		{"expired request", manager, domain.ApprovalExpired, ErrRequestExpired, nil},
+		{"decided request", manager, domain.ApprovalRejected, ErrRequestNotPending, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeId := store
+			requests := &fakeRequests{data: domain.ApprovalRequest{
+				Id:          ulid.Make(),
+				AccountId:   assignee,
+				RoleId:      ulid.Make(),
+				StoreId:     &storeId,
+				Status:      tt.status,
+				RequestedBy: requester,
+			}}
+			svc := NewService(requests, requests, &fakeRoleGrants{}, permissions, time.Hour)
+
+			_, err := svc.Approve(context.Background(), tt.approver, requests.data.Id, "")
+			var delegation *authz.DelegationError
+			switch {
+			case tt.want != nil:
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+			case tt.wantMissing != nil:
+				if !errors.As(err, &delegation) {
+					t.Fatalf("err = %v, want a delegation error", err)
+				}
+				if len(delegation.Missing) != len(tt.wantMissing) {
+					t.Fatalf("missing = %v, want %v", delegation.Missing, tt.wantMissing)
+				}
+				for i := range tt.wantMissing {
+					if delegation.Missing[i] != tt.wantMissing[i] {
+						t.Fatalf("missing = %v, want %v", delegation.Missing, tt.wantMissing)
+					}
+				}
+			case err != nil:
+				t.Fatalf("err = %v", err)
+			}
+			wantApproved := tt.want == nil && tt.wantMissing == nil
+			if requests.approved != wantApproved {
+				t.Errorf("approved = %v, want %v", requests.approved, wantApproved)
+			}
+		})
+	}
+}
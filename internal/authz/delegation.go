@@ -0,0 +1,42 @@
+package authz
+
+import (
+	"context"
+	"strings"
+)
+
+// PermissionReader reads the current permissions of a subject; Resolver
+// implements it.
+type PermissionReader interface {
+	Permissions(ctx context.Context, subject Subject) (PermissionSet, error)
+}
+
+// DelegationError is returned when an administrator hands out grants they
+// do not hold themselves. Missing lists them.
+type DelegationError struct {
+	Missing []string
+}
+
+func (e *DelegationError) Error() string {
+	return "delegation: you do not hold " + strings.Join(e.Missing, ", ")
+}
+
+// CheckDelegation returns a *DelegationError when the permissions of actor
+// do not cover every one of grants, see PermissionSet.Covers. An
+// administrator may only hand out what they hold.
+func CheckDelegation(ctx context.Context, reader PermissionReader, actor Subject, grants []string) error {
+	set, err := reader.Permissions(ctx, actor)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, grant := range grants {
+		if !set.Covers(grant) {
+			missing = append(missing, grant)
+		}
+	}
+	if len(missing) > 0 {
+		return &DelegationError{Missing: missing}
+	}
+	return nil
+}
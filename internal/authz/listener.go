@@ -0,0 +1,80 @@
+package authz
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// NotifyChannel is the channel the database triggers publish permission
+// changes on. The payload is the hex encoded id of the affected account, or
+// NotifyAll when any account may be affected.
+const (
+	NotifyChannel = "rbac_changed"
+	NotifyAll     = "*"
+)
+
+const listenRetryDelay = time.Second
+
+// Listen holds a connection from pool listening on NotifyChannel and
+// invalidates the cache as notifications arrive. It reconnects on failure
+// and returns once ctx is done.
+func (r *Resolver) Listen(ctx context.Context, pool *pgxpool.Pool) {
+	for {
+		err := r.listen(ctx, pool)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Msg("permission listener disconnected, retrying")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (r *Resolver) listen(ctx context.Context, pool *pgxpool.Pool) error {
+	c, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays in LISTEN mode, it must not go back to the pool.
+	conn := c.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+		return err
+	}
+	// Changes made while we were not listening were missed.
+	r.InvalidateAll()
+	log.Info().Str("channel", NotifyChannel).Msg("listening for permission changes")
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		r.handleNotification(n.Payload)
+	}
+}
+
+func (r *Resolver) handleNotification(payload string) {
+	if payload == NotifyAll {
+		r.InvalidateAll()
+		return
+	}
+	raw, err := hex.DecodeString(payload)
+	if err != nil || len(raw) != len(ulid.ULID{}) {
+		log.Warn().Str("payload", payload).Msg("unexpected permission change payload, dropping the whole cache")
+		r.InvalidateAll()
+		return
+	}
+	var id ulid.ULID
+	copy(id[:], raw)
+	r.Invalidate(id)
+}
@@ -0,0 +1,377 @@
+package authz
+
+import (
+	"fmt"
+	"pos/domain"
+	"pos/internal/policy"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Held permissions are grants as written by domain.FormatGrant: "url" for
+// every method or "METHOD url" for a single one.
+//
+// Permission urls are made of segments separated by "/" or ":", both
+// separators being equivalent. A held permission may use these segments:
+//
+//	"*"       matches exactly one segment          inventory:*
+//	"**"      as last segment, matches the rest    reports/**
+//	"{name}"  matches one segment with any value   generate-reports/{id}
+//
+// Every other segment has to match literally.
+//
+// A grant may carry a condition, see package policy, in which case it only
+// applies to requests whose attributes satisfy it.
+//
+// Denials are written and matched like grants and always win: a request
+// matching a denial is refused whatever grants match it, conditional or
+// not and whichever role they come from. Denials carry no condition. The
+// decision then lists every matching denial in the order they were added,
+// which for the resolver is the account's own denials first, then the
+// denials of its roles by role name.
+const (
+	wildcardOne  = "*"
+	wildcardRest = "**"
+)
+
+// rule is one held grant; a nil condition always holds.
+type rule struct {
+	grant     string
+	condition *policy.Condition
+}
+
+type pattern struct {
+	rule
+	method   string
+	segments []string
+}
+
+// PermissionSet is the parsed form of a list of held grants.
+type PermissionSet struct {
+	exact    map[string][]rule
+	patterns []pattern
+	denials  []denial
+}
+
+type denial struct {
+	domain.DeniedGrant
+	method   string
+	segments []string
+}
+
+// Decision is the outcome of a permission check. Reasons name the grant
+// that allowed the request or, on denial, why each candidate grant did not
+// apply. Denied is set when an explicit denial refused the request, rather
+// than a missing grant or a condition that did not hold.
+type Decision struct {
+	Allowed bool     `json:"allowed"`
+	Denied  bool     `json:"denied,omitempty"`
+	Reasons []string `json:"reasons"`
+}
+
+// Reason joins the reasons of the decision in one message.
+func (d Decision) Reason() string {
+	return strings.Join(d.Reasons, "; ")
+}
+
+func NewPermissionSet(grants []string) PermissionSet {
+	set := PermissionSet{
+		exact: make(map[string][]rule, len(grants)),
+	}
+	for _, g := range grants {
+		set.add(g, nil)
+	}
+	return set
+}
+
+// NewConditionalPermissionSet builds a set from grants that may carry a
+// condition. A grant whose condition does not parse is left out.
+func NewConditionalPermissionSet(grants []domain.ConditionalGrant) PermissionSet {
+	set := PermissionSet{
+		exact: make(map[string][]rule, len(grants)),
+	}
+	for _, g := range grants {
+		var condition *policy.Condition
+		if g.Condition != "" {
+			var err error
+			condition, err = policy.Parse(g.Condition)
+			if err != nil {
+				log.Warn().Err(err).Str("grant", g.Grant).Msg("ignoring grant with an invalid condition")
+				continue
+			}
+		}
+		set.add(g.Grant, condition)
+	}
+	return set
+}
+
+// WithDenials returns a copy of the set that also holds denials.
+func (s PermissionSet) WithDenials(denials []domain.DeniedGrant) PermissionSet {
+	res := s
+	res.denials = make([]denial, 0, len(s.denials)+len(denials))
+	res.denials = append(res.denials, s.denials...)
+	for _, d := range denials {
+		method, url := domain.ParseGrant(d.Grant)
+		segments := splitSegments(url)
+		if len(segments) == 0 {
+			continue
+		}
+		res.denials = append(res.denials, denial{
+			DeniedGrant: d,
+			method:      method,
+			segments:    segments,
+		})
+	}
+	return res
+}
+
+// Restricting returns the denials of the set that take away grant, wholly
+// or in part: those matching the grant, and those a pattern grant covers.
+func (s PermissionSet) Restricting(grant string) []domain.DeniedGrant {
+	method, url := domain.ParseGrant(grant)
+	segments := splitSegments(url)
+	var res []domain.DeniedGrant
+	for _, d := range s.denials {
+		if d.method != "" && method != "" && d.method != method {
+			continue
+		}
+		if matchSegments(d.segments, segments) || matchSegments(segments, d.segments) {
+			res = append(res, d.DeniedGrant)
+		}
+	}
+	return res
+}
+
+// Revokes reports whether a denial of the set takes away grant whole: a
+// denial matching every request grant may match. A denial that only
+// restricts part of grant, see Restricting, leaves the rest of it held.
+func (s PermissionSet) Revokes(grant string) bool {
+	method, url := domain.ParseGrant(grant)
+	segments := splitSegments(url)
+	if len(segments) == 0 {
+		return false
+	}
+	for _, d := range s.denials {
+		if d.method != "" && d.method != method {
+			continue
+		}
+		if coverSegments(d.segments, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the set holds grant for every request grant may
+// match: through a grant without condition, and with no denial restricting
+// it. A grant is covered by an equal or broader one, "reports/**" covering
+// "GET reports/daily" but not the other way round.
+func (s PermissionSet) Covers(grant string) bool {
+	method, url := domain.ParseGrant(grant)
+	segments := splitSegments(url)
+	if len(segments) == 0 || len(s.Restricting(grant)) > 0 {
+		return false
+	}
+	rules := append([]rule{}, s.exact[exactKey("", segments)]...)
+	if method != "" {
+		rules = append(rules, s.exact[exactKey(method, segments)]...)
+	}
+	for _, r := range rules {
+		if r.condition == nil {
+			return true
+		}
+	}
+	for _, p := range s.patterns {
+		if p.condition != nil || (p.method != "" && p.method != method) {
+			continue
+		}
+		if coverSegments(p.segments, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// coverSegments reports whether every url matched by the segments of a
+// grant is matched by the held pattern.
+func coverSegments(pattern, segments []string) bool {
+	for i, p := range pattern {
+		if p == wildcardRest && i == len(pattern)-1 {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		seg := segments[i]
+		if seg == wildcardRest && i == len(segments)-1 {
+			return false
+		}
+		if _, ok := paramName(p); ok || p == wildcardOne {
+			continue
+		}
+		if _, ok := paramName(seg); ok || seg == wildcardOne || p != seg {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+func (s *PermissionSet) add(grant string, condition *policy.Condition) {
+	method, url := domain.ParseGrant(grant)
+	segments := splitSegments(url)
+	if len(segments) == 0 {
+		return
+	}
+	r := rule{
+		grant:     domain.FormatGrant(method, url),
+		condition: condition,
+	}
+	if isPattern(segments) {
+		s.patterns = append(s.patterns, pattern{rule: r, method: method, segments: segments})
+		return
+	}
+	key := exactKey(method, segments)
+	s.exact[key] = append(s.exact[key], r)
+}
+
+// Allows reports whether the set grants method on required. Path
+// parameters written as {name} in required are replaced by their value
+// from params first, so holding generate-reports/42 grants
+// generate-reports/{id} only for id 42. Conditions are evaluated against
+// params.
+func (s PermissionSet) Allows(method, required string, params map[string]string) bool {
+	return s.Decide(method, required, params).Allowed
+}
+
+// Decide is Allows with the reasons of the decision. attrs fill the {name}
+// segments of required and are what conditions are evaluated against.
+func (s PermissionSet) Decide(method, required string, attrs policy.Attributes) Decision {
+	method = strings.ToUpper(method)
+	segments := fillSegments(splitSegments(required), attrs)
+	if len(segments) == 0 {
+		return Decision{Reasons: []string{"no permission is required"}}
+	}
+	requested := exactKey(method, segments)
+
+	var denied []string
+	for _, d := range s.denials {
+		if d.method != "" && d.method != method {
+			continue
+		}
+		if matchSegments(d.segments, segments) {
+			denied = append(denied, fmt.Sprintf("%q is denied by %s", d.Grant, d.Rule()))
+		}
+	}
+	if len(denied) > 0 {
+		return Decision{Denied: true, Reasons: denied}
+	}
+
+	var candidates []rule
+	candidates = append(candidates, s.exact[exactKey("", segments)]...)
+	candidates = append(candidates, s.exact[requested]...)
+	for _, p := range s.patterns {
+		if p.method != "" && p.method != method {
+			continue
+		}
+		if matchSegments(p.segments, segments) {
+			candidates = append(candidates, p.rule)
+		}
+	}
+	if len(candidates) == 0 {
+		return Decision{Reasons: []string{fmt.Sprintf("no permission grants %s", requested)}}
+	}
+
+	for _, c := range candidates {
+		if c.condition == nil {
+			return Decision{Allowed: true, Reasons: []string{fmt.Sprintf("granted by %q", c.grant)}}
+		}
+	}
+	var failed []string
+	for _, c := range candidates {
+		if err := c.condition.Evaluate(attrs); err != nil {
+			failed = append(failed, fmt.Sprintf("%q requires %s: %v", c.grant, c.condition, err))
+			continue
+		}
+		return Decision{Allowed: true, Reasons: []string{fmt.Sprintf("granted by %q when %s", c.grant, c.condition)}}
+	}
+	return Decision{Reasons: failed}
+}
+
+// Resource returns required with its {name} segments filled from attrs:
+// the permission url a request checked against required targets, as
+// Decide matches it.
+func Resource(required string, attrs policy.Attributes) string {
+	return strings.Join(fillSegments(splitSegments(required), attrs), "/")
+}
+
+// fillSegments replaces the {name} segments having a value in attrs.
+func fillSegments(segments []string, attrs policy.Attributes) []string {
+	for i, seg := range segments {
+		if name, ok := paramName(seg); ok {
+			if v, ok := attrs[name]; ok && v != "" {
+				segments[i] = v
+			}
+		}
+	}
+	return segments
+}
+
+func exactKey(method string, segments []string) string {
+	return domain.FormatGrant(method, strings.Join(segments, "/"))
+}
+
+// Len returns the number of permissions in the set, denials left aside.
+func (s PermissionSet) Len() int {
+	return len(s.exact) + len(s.patterns)
+}
+
+func splitSegments(p string) []string {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return nil
+	}
+	return strings.FieldsFunc(p, func(r rune) bool {
+		return r == '/' || r == ':'
+	})
+}
+
+func paramName(seg string) (string, bool) {
+	if len(seg) > 2 && strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+func isPattern(segments []string) bool {
+	for _, seg := range segments {
+		if seg == wildcardOne || seg == wildcardRest {
+			return true
+		}
+		if _, ok := paramName(seg); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for i, p := range pattern {
+		if p == wildcardRest && i == len(pattern)-1 {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if p == wildcardOne {
+			continue
+		}
+		if _, ok := paramName(p); ok {
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
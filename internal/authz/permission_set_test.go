@@ -0,0 +1,203 @@
+package authz
+
+import (
+	"pos/domain"
+	"pos/internal/policy"
+	"testing"
+)
+
+// The required permissions below are the slugs protected.Routes checks.
+func TestPermissionSetAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		held     []string
+		method   string
+		required string
+		params   map[string]string
+		want     bool
+	}{
+		// Exact match.
+		{"exact", []string{"create-sale"}, "POST", "create-sale", nil, true},
+		{"other permission", []string{"create-sale"}, "PUT", "edit-sale", nil, false},
+		{"prefix of a held permission", []string{"customer-management"}, "POST", "customer", nil, false},
+		{"held permission as prefix", []string{"user"}, "POST", "user-management", nil, false},
+		{"nothing held", nil, "GET", "access-settings", nil, false},
+		{"empty requirement", []string{"**"}, "GET", "", nil, false},
+
+		// generate-reports must not leak into generate-reports/{id}.
+		{"parent does not grant child", []string{"generate-reports"}, "GET", "generate-reports/{id}", map[string]string{"id": "42"}, false},
+		{"child does not grant parent", []string{"generate-reports/42"}, "GET", "generate-reports", nil, false},
+		{"concrete id", []string{"generate-reports/42"}, "GET", "generate-reports/{id}", map[string]string{"id": "42"}, true},
+		{"other id", []string{"generate-reports/42"}, "GET", "generate-reports/{id}", map[string]string{"id": "43"}, false},
+		{"unfilled parameter", []string{"generate-reports/42"}, "GET", "generate-reports/{id}", nil, false},
+		{"held parameter", []string{"generate-reports/{id}"}, "GET", "generate-reports/{id}", map[string]string{"id": "42"}, true},
+		{"held parameter needs a segment", []string{"generate-reports/{id}"}, "GET", "generate-reports", nil, false},
+
+		// Wildcards.
+		{"one segment", []string{"inventory:*"}, "GET", "inventory/items", nil, true},
+		{"one segment is not zero", []string{"inventory:*"}, "GET", "inventory", nil, false},
+		{"one segment is not two", []string{"inventory:*"}, "GET", "inventory/items/42", nil, false},
+		{"separators are equivalent", []string{"inventory:items"}, "GET", "inventory/items", nil, true},
+		{"rest", []string{"**"}, "DELETE", "user-management", nil, true},
+		{"rest of a prefix", []string{"generate-reports/**"}, "GET", "generate-reports/{id}", map[string]string{"id": "42"}, true},
+		{"rest includes the prefix", []string{"generate-reports/**"}, "GET", "generate-reports", nil, true},
+		{"rest of another prefix", []string{"generate-reports/**"}, "GET", "inventory", nil, false},
+		{"rest only last", []string{"**/inventory"}, "GET", "reports/inventory", nil, false},
+
+		// Methods.
+		{"method held", []string{"GET inventory"}, "GET", "inventory", nil, true},
+		{"other method", []string{"GET inventory"}, "POST", "inventory", nil, false},
+		{"method case", []string{"GET inventory"}, "get", "inventory", nil, true},
+		{"every method", []string{"inventory"}, "DELETE", "inventory", nil, true},
+		{"method on a pattern", []string{"GET inventory:*"}, "PUT", "inventory/items", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewPermissionSet(tt.held)
+			if got := set.Allows(tt.method, tt.required, tt.params); got != tt.want {
+				t.Errorf("%v.Allows(%s, %s, %v) = %v, want %v", tt.held, tt.method, tt.required, tt.params, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermissionSetDenials(t *testing.T) {
+	tests := []struct {
+		name     string
+		held     []string
+		denied   []string
+		method   string
+		required string
+		want     bool
+	}{
+		{"denial beats exact grant", []string{"refund-transaction"}, []string{"refund-transaction"}, "POST", "refund-transaction", false},
+		{"denial beats wildcard grant", []string{"**"}, []string{"POST refund-transaction"}, "POST", "refund-transaction", false},
+		{"denial of another method", []string{"**"}, []string{"DELETE inventory"}, "GET", "inventory", true},
+		{"denial of another permission", []string{"**"}, []string{"refund-transaction"}, "POST", "create-sale", true},
+		{"wildcard denial", []string{"inventory"}, []string{"inventory:**"}, "PUT", "inventory", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denials := make([]domain.DeniedGrant, 0, len(tt.denied))
+			for _, d := range tt.denied {
+				denials = append(denials, domain.DeniedGrant{Grant: d, On: domain.DenialOnAccount})
+			}
+			set := NewPermissionSet(tt.held).WithDenials(denials)
+			decision := set.Decide(tt.method, tt.required, nil)
+			if decision.Allowed != tt.want {
+				t.Errorf("Decide(%s, %s) = %v (%s), want %v", tt.method, tt.required, decision.Allowed, decision.Reason(), tt.want)
+			}
+			if decision.Denied == tt.want {
+				t.Errorf("Decide(%s, %s).Denied = %v, want %v", tt.method, tt.required, decision.Denied, !tt.want)
+			}
+		})
+	}
+}
+
+func TestPermissionSetConditions(t *testing.T) {
+	set := NewConditionalPermissionSet([]domain.ConditionalGrant{
+		{Grant: "refund-transaction", Condition: "amount <= 50"},
+		{Grant: "create-sale", Condition: "time between 06:00 and 23:00"},
+		{Grant: "edit-sale", Condition: "amount <="},
+	})
+	tests := []struct {
+		name     string
+		method   string
+		required string
+		attrs    policy.Attributes
+		want     bool
+	}{
+		{"condition holds", "POST", "refund-transaction", policy.Attributes{"amount": "50"}, true},
+		{"condition fails", "POST", "refund-transaction", policy.Attributes{"amount": "5000"}, false},
+		{"attribute missing", "POST", "refund-transaction", nil, false},
+		{"time in range", "POST", "create-sale", policy.Attributes{policy.AttrTime: "22:59:59"}, true},
+		{"time out of range", "POST", "create-sale", policy.Attributes{policy.AttrTime: "23:00:01"}, false},
+		{"invalid condition left out", "PUT", "edit-sale", policy.Attributes{"amount": "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := set.Decide(tt.method, tt.required, tt.attrs)
+			if decision.Allowed != tt.want {
+				t.Errorf("Decide(%s, %s, %v) = %v (%s), want %v", tt.method, tt.required, tt.attrs, decision.Allowed, decision.Reason(), tt.want)
+			}
+			if decision.Denied {
+				t.Errorf("Decide(%s, %s, %v) reported a denial", tt.method, tt.required, tt.attrs)
+			}
+		})
+	}
+}
+
+func TestPermissionSetCovers(t *testing.T) {
+	tests := []struct {
+		name   string
+		held   []string
+		denied []string
+		grant  string
+		want   bool
+	}{
+		{"equal grant", []string{"create-sale"}, nil, "create-sale", true},
+		{"every method covers one", []string{"inventory"}, nil, "GET inventory", true},
+		{"one method does not cover every method", []string{"GET inventory"}, nil, "inventory", false},
+		{"one method does not cover another", []string{"GET inventory"}, nil, "POST inventory", false},
+		{"rest covers below", []string{"generate-reports/**"}, nil, "GET generate-reports/42", true},
+		{"below does not cover rest", []string{"generate-reports/42"}, nil, "generate-reports/**", false},
+		{"parent does not cover child", []string{"generate-reports"}, nil, "generate-reports/{id}", false},
+		{"one segment covers a parameter", []string{"inventory:*"}, nil, "inventory/{id}", true},
+		{"parameter does not cover one segment", []string{"inventory/42"}, nil, "inventory/*", false},
+		{"one segment does not cover rest", []string{"inventory:*"}, nil, "inventory/**", false},
+		{"rest covers everything", []string{"**"}, nil, "**", true},
+		{"denial restricts the grant", []string{"**"}, []string{"POST refund-transaction"}, "refund-transaction", false},
+		{"denial restricts a pattern", []string{"**"}, []string{"refund-transaction"}, "**", false},
+		{"unrelated denial", []string{"**"}, []string{"refund-transaction"}, "create-sale", true},
+		{"empty grant", []string{"**"}, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denials := make([]domain.DeniedGrant, 0, len(tt.denied))
+			for _, d := range tt.denied {
+				denials = append(denials, domain.DeniedGrant{Grant: d})
+			}
+			set := NewPermissionSet(tt.held).WithDenials(denials)
+			if got := set.Covers(tt.grant); got != tt.want {
+				t.Errorf("%v.Covers(%q) = %v, want %v", tt.held, tt.grant, got, tt.want)
+			}
+		})
+	}
+
+	conditional := NewConditionalPermissionSet([]domain.ConditionalGrant{
+		{Grant: "refund-transaction", Condition: "amount <= 50"},
+	})
+	if conditional.Covers("refund-transaction") {
+		t.Error("a conditional grant covers the unconditional grant")
+	}
+}
+
+func TestPermissionSetRevokes(t *testing.T) {
+	tests := []struct {
+		name   string
+		denied []string
+		grant  string
+		want   bool
+	}{
+		{"equal denial", []string{"refund-transaction"}, "refund-transaction", true},
+		{"every method denied", []string{"refund-transaction"}, "POST refund-transaction", true},
+		{"one method of every method", []string{"POST refund-transaction"}, "refund-transaction", false},
+		{"same method", []string{"POST refund-transaction"}, "POST refund-transaction", true},
+		{"pattern denial", []string{"reports/**"}, "GET reports/daily", true},
+		{"denial under a pattern grant", []string{"refund-transaction"}, "**", false},
+		{"unrelated denial", []string{"refund-transaction"}, "create-sale", false},
+		{"no denial", nil, "**", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denials := make([]domain.DeniedGrant, 0, len(tt.denied))
+			for _, d := range tt.denied {
+				denials = append(denials, domain.DeniedGrant{Grant: d})
+			}
+			set := NewPermissionSet(nil).WithDenials(denials)
+			if got := set.Revokes(tt.grant); got != tt.want {
+				t.Errorf("%v.Revokes(%q) = %v, want %v", tt.denied, tt.grant, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/policy"
+	"pos/internal/tenant"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Grants are the effective grants and denials of an account, in the form
+// written by domain.FormatGrant.
+type Grants struct {
+	Allowed []domain.ConditionalGrant
+	Denied  []domain.DeniedGrant
+}
+
+// ErrUnknownStore is returned by PermissionSource.StoreLocation for a store
+// that is not one of the organization of the context.
+var ErrUnknownStore = errors.New("authz: unknown store")
+
+// PermissionSource loads the effective grants of a subject. The zero ULID
+// as StoreId asks for the grants valid in every store only.
+type PermissionSource interface {
+	EffectiveGrants(ctx context.Context, subject Subject) (Grants, error)
+	// StoreLocation returns the time zone of a store, or ErrUnknownStore.
+	StoreLocation(ctx context.Context, storeId ulid.ULID) (*time.Location, error)
+}
+
+// StoreInvalidator drops what is cached about a store; Resolver implements
+// it.
+type StoreInvalidator interface {
+	InvalidateStore(storeId ulid.ULID)
+}
+
+// Subject is who a permission check is made for, and in which store.
+// SessionId is the session the roles of dynamic separation of duties
+// constraints are activated in; outside of a session those roles grant
+// nothing.
+type Subject struct {
+	AccountId ulid.ULID
+	StoreId   ulid.ULID
+	SessionId ulid.ULID
+}
+
+// scope keys the cached permission sets of an account.
+type scope struct {
+	storeId   ulid.ULID
+	sessionId ulid.ULID
+}
+
+type cacheEntry struct {
+	set       PermissionSet
+	expiresAt time.Time
+}
+
+// storeKey keys the cached store time zones: a store is only looked up in
+// the organization it belongs to.
+type storeKey struct {
+	organizationId ulid.ULID
+	storeId        ulid.ULID
+}
+
+type locationEntry struct {
+	location  *time.Location
+	expiresAt time.Time
+}
+
+// Resolver answers permission checks from the database instead of the
+// snapshot taken in the access token at login. Results are cached per
+// account, store and session; the cache is dropped by Listen when the role tables
+// change and entries also expire after ttl, in case a notification was
+// missed. Expired entries are swept from the cache at most once per ttl,
+// as new entries are added, so that it does not grow with every session
+// ever seen.
+type Resolver struct {
+	source PermissionSource
+	ttl    time.Duration
+
+	mu        sync.RWMutex
+	cache     map[ulid.ULID]map[scope]cacheEntry
+	locations map[storeKey]locationEntry
+	// generation is bumped on every invalidation so that a lookup racing
+	// with a change does not put stale permissions back in the cache.
+	generation uint64
+	lastSweep  time.Time
+}
+
+func NewResolver(source PermissionSource, ttl time.Duration) *Resolver {
+	return &Resolver{
+		source:    source,
+		ttl:       ttl,
+		cache:     make(map[ulid.ULID]map[scope]cacheEntry),
+		locations: make(map[storeKey]locationEntry),
+	}
+}
+
+// Authorize decides whether subject may perform action, an HTTP method, on
+// resource, a permission url. attrs are the request attributes conditions
+// are evaluated against; the policy.AttrTime and policy.AttrWeekday
+// attributes are always set here from the clock of the subject's store,
+// UTC outside of any store. A store unknown to the organization of ctx
+// fails closed: the request is refused.
+func (r *Resolver) Authorize(
+	ctx context.Context,
+	subject Subject,
+	action, resource string,
+	attrs policy.Attributes,
+) (Decision, error) {
+	set, err := r.Permissions(ctx, subject)
+	if err != nil {
+		return Decision{}, err
+	}
+	location, err := r.location(ctx, subject.StoreId)
+	if errors.Is(err, ErrUnknownStore) {
+		return Decision{Reasons: []string{"unknown store " + subject.StoreId.String()}}, nil
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+	return set.Decide(action, resource, WithClock(attrs, time.Now().In(location))), nil
+}
+
+// WithClock returns a copy of attrs with the time of day and the weekday of
+// now.
+func WithClock(attrs policy.Attributes, now time.Time) policy.Attributes {
+	res := make(policy.Attributes, len(attrs)+2)
+	for k, v := range attrs {
+		res[k] = v
+	}
+	res[policy.AttrTime] = now.Format("15:04:05")
+	res[policy.AttrWeekday] = strings.ToLower(now.Weekday().String()[:3])
+	return res
+}
+
+func (r *Resolver) location(ctx context.Context, storeId ulid.ULID) (*time.Location, error) {
+	if storeId == (ulid.ULID{}) {
+		return time.UTC, nil
+	}
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := storeKey{organizationId: org, storeId: storeId}
+	now := time.Now()
+	r.mu.RLock()
+	entry, ok := r.locations[key]
+	r.mu.RUnlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.location, nil
+	}
+
+	location, err := r.source.StoreLocation(ctx, storeId)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.sweep(now)
+	r.locations[key] = locationEntry{
+		location:  location,
+		expiresAt: now.Add(r.ttl),
+	}
+	r.mu.Unlock()
+	return location, nil
+}
+
+// Permissions returns the current permission set of a subject. Leave
+// StoreId zero outside of any store.
+func (r *Resolver) Permissions(ctx context.Context, subject Subject) (PermissionSet, error) {
+	key := scope{storeId: subject.StoreId, sessionId: subject.SessionId}
+	now := time.Now()
+	r.mu.RLock()
+	entry, ok := r.cache[subject.AccountId][key]
+	generation := r.generation
+	r.mu.RUnlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.set, nil
+	}
+
+	grants, err := r.source.EffectiveGrants(ctx, subject)
+	if err != nil {
+		return PermissionSet{}, err
+	}
+	set := NewConditionalPermissionSet(grants.Allowed).WithDenials(grants.Denied)
+
+	r.mu.Lock()
+	r.sweep(now)
+	if r.generation == generation {
+		scopes, ok := r.cache[subject.AccountId]
+		if !ok {
+			scopes = make(map[scope]cacheEntry)
+			r.cache[subject.AccountId] = scopes
+		}
+		scopes[key] = cacheEntry{
+			set:       set,
+			expiresAt: now.Add(r.ttl),
+		}
+	}
+	r.mu.Unlock()
+	return set, nil
+}
+
+// sweep drops the expired entries of the cache, unless it was swept less
+// than ttl ago. r.mu must be held for writing.
+func (r *Resolver) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.ttl {
+		return
+	}
+	r.lastSweep = now
+	for accountId, scopes := range r.cache {
+		for key, entry := range scopes {
+			if !now.Before(entry.expiresAt) {
+				delete(scopes, key)
+			}
+		}
+		if len(scopes) == 0 {
+			delete(r.cache, accountId)
+		}
+	}
+	for key, entry := range r.locations {
+		if !now.Before(entry.expiresAt) {
+			delete(r.locations, key)
+		}
+	}
+}
+
+// Invalidate drops the cached permissions of one account, in every store
+// and session.
+func (r *Resolver) Invalidate(accountId ulid.ULID) {
+	r.mu.Lock()
+	delete(r.cache, accountId)
+	r.generation++
+	r.mu.Unlock()
+}
+
+// InvalidateStore implements StoreInvalidator: it drops the cached time
+// zone of a store.
+func (r *Resolver) InvalidateStore(storeId ulid.ULID) {
+	r.mu.Lock()
+	for key := range r.locations {
+		if key.storeId == storeId {
+			delete(r.locations, key)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// InvalidateAll drops the whole cache.
+func (r *Resolver) InvalidateAll() {
+	r.mu.Lock()
+	r.cache = make(map[ulid.ULID]map[scope]cacheEntry)
+	r.locations = make(map[storeKey]locationEntry)
+	r.generation++
+	r.mu.Unlock()
+}
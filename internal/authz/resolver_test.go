@@ -0,0 +1,129 @@
+package authz
+
+import (
+	"context"
+	"pos/internal/tenant"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type fakeSource struct {
+	loads         int
+	locationLoads int
+	locations     map[ulid.ULID]*time.Location
+}
+
+func (f *fakeSource) EffectiveGrants(ctx context.Context, subject Subject) (Grants, error) {
+	f.loads++
+	return Grants{}, nil
+}
+
+func (f *fakeSource) StoreLocation(ctx context.Context, storeId ulid.ULID) (*time.Location, error) {
+	f.locationLoads++
+	location, ok := f.locations[storeId]
+	if !ok {
+		return nil, ErrUnknownStore
+	}
+	return location, nil
+}
+
+func cachedScopes(r *Resolver) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for _, scopes := range r.cache {
+		n += len(scopes)
+	}
+	return n
+}
+
+func TestResolverCaches(t *testing.T) {
+	source := &fakeSource{}
+	r := NewResolver(source, time.Hour)
+	subject := Subject{AccountId: ulid.Make()}
+	for i := 0; i < 3; i++ {
+		if _, err := r.Permissions(context.Background(), subject); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if source.loads != 1 {
+		t.Errorf("loaded %d times, want 1", source.loads)
+	}
+	r.Invalidate(subject.AccountId)
+	if _, err := r.Permissions(context.Background(), subject); err != nil {
+		t.Fatal(err)
+	}
+	if source.loads != 2 {
+		t.Errorf("loaded %d times after invalidation, want 2", source.loads)
+	}
+}
+
+func TestResolverSweepsExpiredEntries(t *testing.T) {
+	source := &fakeSource{}
+	ttl := 20 * time.Millisecond
+	r := NewResolver(source, ttl)
+	for i := 0; i < 10; i++ {
+		subject := Subject{AccountId: ulid.Make(), SessionId: ulid.Make()}
+		if _, err := r.Permissions(context.Background(), subject); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := cachedScopes(r); n != 10 {
+		t.Fatalf("cached %d entries, want 10", n)
+	}
+
+	time.Sleep(2 * ttl)
+	if _, err := r.Permissions(context.Background(), Subject{AccountId: ulid.Make()}); err != nil {
+		t.Fatal(err)
+	}
+	if n := cachedScopes(r); n != 1 {
+		t.Errorf("cached %d entries after they expired, want 1", n)
+	}
+}
+
+func TestResolverRefusesUnknownStore(t *testing.T) {
+	known := ulid.Make()
+	source := &fakeSource{locations: map[ulid.ULID]*time.Location{known: time.UTC}}
+	r := NewResolver(source, time.Hour)
+	ctx := tenant.WithOrganization(context.Background(), ulid.Make())
+
+	for i := 0; i < 2; i++ {
+		subject := Subject{AccountId: ulid.Make(), StoreId: ulid.Make()}
+		decision, err := r.Authorize(ctx, subject, "GET", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision.Allowed {
+			t.Errorf("request in an unknown store allowed: %v", decision.Reasons)
+		}
+	}
+	if source.locationLoads != 2 {
+		t.Errorf("looked up %d times, want 2: an unknown store is not cached", source.locationLoads)
+	}
+}
+
+func TestResolverInvalidateStore(t *testing.T) {
+	storeId := ulid.Make()
+	source := &fakeSource{locations: map[ulid.ULID]*time.Location{storeId: time.UTC}}
+	r := NewResolver(source, time.Hour)
+	ctx := tenant.WithOrganization(context.Background(), ulid.Make())
+	subject := Subject{AccountId: ulid.Make(), StoreId: storeId}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Authorize(ctx, subject, "GET", "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if source.locationLoads != 1 {
+		t.Fatalf("looked up %d times, want 1", source.locationLoads)
+	}
+	r.InvalidateStore(storeId)
+	if _, err := r.Authorize(ctx, subject, "GET", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if source.locationLoads != 2 {
+		t.Errorf("looked up %d times after invalidation, want 2", source.locationLoads)
+	}
+}
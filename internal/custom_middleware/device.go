@@ -0,0 +1,76 @@
+package custommiddleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"pos/domain"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// A device authenticates, on the request signing in and on every request
+// of a session opened on it, either with an assertion signed by its key in
+// DeviceAssertionHeader or with its id in DeviceHeader and its secret in
+// DeviceSecretHeader.
+const (
+	DeviceAssertionHeader = "X-Device-Assertion"
+	DeviceHeader          = "X-Device-Id"
+	DeviceSecretHeader    = "X-Device-Secret"
+)
+
+var (
+	ErrDeviceRequired = errors.New("device: credentials required")
+	ErrDeviceMismatch = errors.New("device: session bound to another device")
+	ErrDeviceStore    = errors.New("device: assigned to another store")
+)
+
+// DeviceAuthenticator returns the device with the given credentials.
+type DeviceAuthenticator interface {
+	Authenticate(ctx context.Context, id ulid.ULID, secret string) (*domain.Device, error)
+	AuthenticateAssertion(ctx context.Context, assertion string) (*domain.Device, error)
+}
+
+var deviceAuthenticator DeviceAuthenticator
+
+// SetDeviceAuthenticator lets accounts sign in on devices. Without one,
+// sessions bound to a device are refused.
+func SetDeviceAuthenticator(a DeviceAuthenticator) {
+	deviceAuthenticator = a
+}
+
+// RequestDevice returns the device authenticated by the headers of r.
+func RequestDevice(r *http.Request) (*domain.Device, error) {
+	if deviceAuthenticator == nil {
+		return nil, ErrDeviceRequired
+	}
+	if assertion := r.Header.Get(DeviceAssertionHeader); assertion != "" {
+		return deviceAuthenticator.AuthenticateAssertion(r.Context(), assertion)
+	}
+	raw := r.Header.Get(DeviceHeader)
+	secret := r.Header.Get(DeviceSecretHeader)
+	if raw == "" || secret == "" {
+		return nil, ErrDeviceRequired
+	}
+	id, err := ulid.Parse(raw)
+	if err != nil {
+		return nil, ErrDeviceRequired
+	}
+	return deviceAuthenticator.Authenticate(r.Context(), id, secret)
+}
+
+// checkDevice makes sure a request of a session bound to a device comes
+// from that device, and returns the device; nil for other sessions.
+func checkDevice(r *http.Request, claims *domain.Oauth) (*domain.Device, error) {
+	if claims.DeviceId == nil {
+		return nil, nil
+	}
+	device, err := RequestDevice(r)
+	if err != nil {
+		return nil, err
+	}
+	if device.Id != *claims.DeviceId {
+		return nil, ErrDeviceMismatch
+	}
+	return device, nil
+}
@@ -5,19 +5,80 @@ import (
 	"errors"
 	"net/http"
 	"pos/domain"
+	"pos/internal/keyring"
+	"pos/internal/tenant"
 	"pos/utils/httpresponse"
 	"pos/utils/key"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
 )
 
-var jwtSecret = ""
+var jwtKeyring *keyring.Keyring
 
-func SetJwtSecret(j string) {
-	jwtSecret = j
+func SetKeyring(k *keyring.Keyring) {
+	jwtKeyring = k
 }
 
+// SessionValidator reports whether the session an access token was issued
+// for is still live, so that revoking a session also stops its access token.
+type SessionValidator interface {
+	IsActive(ctx context.Context, sid ulid.ULID) (bool, error)
+}
+
+var sessionValidator SessionValidator
+
+func SetSessionValidator(v SessionValidator) {
+	sessionValidator = v
+}
+
+// Errors of VerifyToken besides those of parsing the token.
+// ErrSessionUnchecked means the session could not be looked up, which is
+// no fault of the token.
+var (
+	ErrInvalidToken     = errors.New("auth: invalid token")
+	ErrSessionUnchecked = errors.New("auth: cannot check the session")
+)
+
+// VerifyToken checks the signature of an access token, that it is meant
+// as one, that it names an organization and, with a session validator
+// set, that its session is still live. It returns the claims of the token.
+func VerifyToken(ctx context.Context, jwtToken string) (*domain.Oauth, error) {
+	claims := &domain.Oauth{}
+	token, err := jwtKeyring.Parse(
+		jwtToken,
+		claims,
+		jwt.WithAudience(domain.AudienceAccess),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	// Every request is scoped to the organization of the token; tokens
+	// issued before organizations existed carry none.
+	if claims.OrganizationId == (ulid.ULID{}) {
+		return nil, ErrInvalidToken
+	}
+	if sessionValidator != nil && claims.SessionId != (ulid.ULID{}) {
+		ctx = tenant.WithOrganization(ctx, claims.OrganizationId)
+		active, err := sessionValidator.IsActive(ctx, claims.SessionId)
+		if err != nil {
+			return nil, ErrSessionUnchecked
+		}
+		if !active {
+			return nil, ErrInvalidToken
+		}
+	}
+	return claims, nil
+}
+
+// AuthJwtMiddleware serves requests bearing a valid access token, see
+// VerifyToken. Tokens of a session opened on a device are only accepted
+// along with the credentials of that device, which is then put in
+// key.DeviceValueKey.
 func AuthJwtMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
@@ -30,32 +91,40 @@ func AuthJwtMiddleware(next http.Handler) http.Handler {
 				return
 			}
 
-			jwtToken := splittedToken[1]
-			claims := &domain.Oauth{}
-
-			token, err := jwt.ParseWithClaims(
-				jwtToken,
-				claims,
-				func(t *jwt.Token) (interface{}, error) {
-					return []byte(jwtSecret), nil
-				},
-			)
-			if err != nil {
+			claims, err := VerifyToken(ctx, splittedToken[1])
+			switch {
+			case errors.Is(err, ErrSessionUnchecked):
+				httpresponse.WriteError(w, http.StatusInternalServerError, errors.New(http.StatusText((http.StatusInternalServerError))))
+				ctx.Done()
+				return
+			case errors.Is(err, ErrInvalidToken):
+				httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
+				ctx.Done()
+				return
+			case err != nil:
 				httpresponse.WriteError(w, http.StatusUnauthorized, err)
 				ctx.Done()
 				return
 			}
-			if !token.Valid {
-				httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
+
+			device, err := checkDevice(r, claims)
+			if err != nil {
+				if !errors.Is(err, ErrDeviceRequired) && !errors.Is(err, ErrDeviceMismatch) {
+					err = errors.New(http.StatusText((http.StatusUnauthorized)))
+				}
+				httpresponse.WriteError(w, http.StatusUnauthorized, err)
 				ctx.Done()
 				return
 			}
 
 			c := context.WithValue(
-				ctx,
+				tenant.WithOrganization(ctx, claims.OrganizationId),
 				key.UserValueKey,
 				claims,
 			)
+			if device != nil {
+				c = context.WithValue(c, key.DeviceValueKey, device)
+			}
 			next.ServeHTTP(w, r.WithContext(c))
 		},
 	)
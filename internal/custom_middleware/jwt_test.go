@@ -0,0 +1,88 @@
+package custommiddleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pos/domain"
+	"pos/internal/keyring"
+	"pos/internal/tenant"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// fakeSessions reports the sessions of live as active. The organization
+// the session is looked up in is recorded.
+type fakeSessions struct {
+	live map[ulid.ULID]bool
+	err  error
+	org  ulid.ULID
+}
+
+func (f *fakeSessions) IsActive(ctx context.Context, sid ulid.ULID) (bool, error) {
+	f.org, _ = tenant.FromContext(ctx)
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.live[sid], nil
+}
+
+func TestRevokedSessionRejected(t *testing.T) {
+	k, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	defer SetKeyring(nil)
+
+	live, revoked := ulid.Make(), ulid.Make()
+	tests := []struct {
+		name      string
+		sessionId ulid.ULID
+		lookupErr error
+		want      int
+	}{
+		{"live session", live, nil, http.StatusOK},
+		{"revoked session", revoked, nil, http.StatusUnauthorized},
+		{"session lookup failing", live, errors.New("connection refused"), http.StatusInternalServerError},
+		{"token without session", ulid.ULID{}, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &fakeSessions{live: map[ulid.ULID]bool{live: true}, err: tt.lookupErr}
+			SetSessionValidator(sessions)
+			defer SetSessionValidator(nil)
+
+			claims := &domain.Oauth{
+				Id:             ulid.Make(),
+				OrganizationId: ulid.Make(),
+				SessionId:      tt.sessionId,
+				RegisteredClaims: jwt.RegisteredClaims{
+					Audience:  jwt.ClaimStrings{domain.AudienceAccess},
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+				},
+			}
+			raw, err := k.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+raw)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			AuthJwtMiddleware(next).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.sessionId != (ulid.ULID{}) && sessions.org != claims.OrganizationId {
+				t.Errorf("session looked up in organization %s, want %s", sessions.org, claims.OrganizationId)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package custommiddleware
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/policy"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// OverrideHeader carries an override token, see package override.
+const OverrideHeader = "X-Override-Token"
+
+var (
+	ErrInvalidOverride  = errors.New("override: invalid token")
+	ErrOverrideMismatch = errors.New("override: token granted for another request")
+)
+
+// OverrideRedeemer marks an override used. Redeem fails when the override
+// was already used or expired.
+type OverrideRedeemer interface {
+	Redeem(ctx context.Context, id ulid.ULID) error
+}
+
+var overrideRedeemer OverrideRedeemer
+
+// SetOverrideRedeemer makes ProtectedMiddleware accept override tokens.
+func SetOverrideRedeemer(r OverrideRedeemer) {
+	overrideRedeemer = r
+}
+
+// redeemOverride checks that raw is an override granted to the account of
+// claims for method on resource in storeId with attrs, see
+// overrideAttributesMatch, then redeems it.
+func redeemOverride(ctx context.Context, raw string, claims *domain.Oauth, method, resource string, storeId ulid.ULID, attrs policy.Attributes) (*domain.Override, error) {
+	if overrideRedeemer == nil {
+		return nil, ErrInvalidOverride
+	}
+	overrideClaims := &domain.OverrideClaims{}
+	token, err := jwtKeyring.Parse(raw, overrideClaims, jwt.WithAudience(domain.AudienceOverride))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidOverride
+	}
+	override := overrideClaims.Override
+	if override.Id == (ulid.ULID{}) {
+		return nil, ErrInvalidOverride
+	}
+	overrideStore := ulid.ULID{}
+	if override.StoreId != nil {
+		overrideStore = *override.StoreId
+	}
+	if override.AccountId != claims.Id ||
+		override.OrganizationId != claims.OrganizationId ||
+		override.Method != method ||
+		override.Resource != resource ||
+		overrideStore != storeId ||
+		!overrideAttributesMatch(ctx, override.Attributes, attrs) {
+		return nil, ErrOverrideMismatch
+	}
+	if err := overrideRedeemer.Redeem(ctx, override.Id); err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// overrideAttributesMatch reports whether the attributes of a request are
+// those an override was granted for: every attribute bound to the override
+// has the same value in the request, and every other attribute of the
+// request is a route parameter. A missing attribute and an empty one are
+// the same.
+func overrideAttributesMatch(ctx context.Context, bound map[string]string, attrs policy.Attributes) bool {
+	for k, v := range bound {
+		if attrs[k] != v {
+			return false
+		}
+	}
+	rctx := chi.RouteContext(ctx)
+	for k, v := range attrs {
+		if _, ok := bound[k]; ok || v == "" {
+			continue
+		}
+		if rctx == nil || rctx.URLParam(k) != v {
+			return false
+		}
+	}
+	return true
+}
@@ -1,60 +1,220 @@
 package custommiddleware
 
 import (
-	"encoding/base64"
+	"bytes"
 	"errors"
+	"io"
 	"net/http"
+	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/policy"
 	"pos/utils/httpresponse"
-	"strings"
+	"pos/utils/key"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
 )
 
-var (
-	ErrValueTooLong = errors.New("cookie value too long")
-	ErrInvalidValue = errors.New("invalid cookie value")
+// The store a request targets is read from the StoreParam route parameter,
+// or from the StoreHeader header on routes without one.
+const (
+	StoreParam  = "storeId"
+	StoreHeader = "X-Store-Id"
 )
 
-func ProtectedMiddleware(grant string) func(http.Handler) http.Handler {
+var permissionResolver *authz.Resolver
+
+// SetPermissionResolver makes ProtectedMiddleware check the current
+// permissions of the account instead of the ones carried in the token.
+func SetPermissionResolver(r *authz.Resolver) {
+	permissionResolver = r
+}
+
+// ProtectedMiddleware grants access when the subject of the access token
+// holds grant. It must run behind AuthJwtMiddleware, which puts the verified
+// claims in key.UserValueKey. With a resolver set the permissions are looked
+// up for the token subject, so role changes apply to tokens already issued;
+// otherwise the permissions carried in the token are used. Roles assigned
+// in a single store only count when the request targets that store, which
+// needs the resolver.
+//
+// grant is matched exactly against the request method and the permission
+// url, see authz.PermissionSet for the wildcard rules; {name} segments in
+// grant are filled from the chi route parameters. Conditions on grants are
+// evaluated against the route parameters of the request and the attributes
+// hooks extract from its body, never against the query, see
+// requestAttributes. A denial carries the reason in the error message.
+//
+// A request refused for a missing grant or a condition that did not hold
+// may still go through with an override token in the OverrideHeader
+// header, granted to the account for this method, this permission url
+// with its parameters filled, this store and these attributes; the
+// override is used up by the request. No override lifts an explicit
+// denial.
+func ProtectedMiddleware(grant string, hooks ...AttributeHook) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
 				ctx := r.Context()
-				cookie, err := r.Cookie("permissions")
-				if err != nil {
+				claims, ok := ctx.Value(key.UserValueKey).(*domain.Oauth)
+				if !ok {
 					httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
 					ctx.Done()
 					return
 				}
 
-				value, err := base64.URLEncoding.DecodeString(cookie.Value)
+				storeId, err := requestStore(r)
+				if errors.Is(err, ErrDeviceStore) {
+					httpresponse.WriteError(w, http.StatusForbidden, err)
+					ctx.Done()
+					return
+				}
 				if err != nil {
-					httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
+					httpresponse.WriteError(w, http.StatusBadRequest, err)
 					ctx.Done()
 					return
 				}
+
+				attrs, err := requestAttributes(r, hooks)
 				if err != nil {
-					switch {
-					case errors.Is(err, http.ErrNoCookie):
-						httpresponse.WriteError(w, http.StatusBadRequest, errors.New(http.StatusText((http.StatusBadRequest))))
-						ctx.Done()
-						return
-					case errors.Is(err, ErrInvalidValue):
-						httpresponse.WriteError(w, http.StatusBadRequest, errors.New(http.StatusText((http.StatusBadRequest))))
+					httpresponse.WriteError(w, http.StatusBadRequest, err)
+					ctx.Done()
+					return
+				}
+				var decision authz.Decision
+				if permissionResolver != nil {
+					subject := authz.Subject{
+						AccountId: claims.Id,
+						StoreId:   storeId,
+						SessionId: claims.SessionId,
+					}
+					decision, err = permissionResolver.Authorize(ctx, subject, r.Method, grant, attrs)
+					if err != nil {
+						log.Error().Err(err).Str("account", claims.Id.String()).Msg("cannot resolve permissions")
+						httpresponse.WriteError(w, http.StatusInternalServerError, errors.New(http.StatusText((http.StatusInternalServerError))))
 						ctx.Done()
 						return
-					default:
-						httpresponse.WriteError(w, http.StatusInternalServerError, errors.New(http.StatusText((http.StatusInternalServerError))))
+					}
+				} else {
+					denials := make([]domain.DeniedGrant, 0, len(claims.Denials))
+					for _, grant := range claims.Denials {
+						denials = append(denials, domain.DeniedGrant{Grant: grant})
+					}
+					set := authz.NewPermissionSet(claims.Permissions).WithDenials(denials)
+					decision = set.Decide(r.Method, grant, authz.WithClock(attrs, time.Now().UTC()))
+				}
+				if decision.Allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if raw := r.Header.Get(OverrideHeader); raw != "" && !decision.Denied {
+					override, err := redeemOverride(ctx, raw, claims, r.Method, authz.Resource(grant, attrs), storeId, attrs)
+					if err != nil {
+						httpresponse.WriteError(w, http.StatusUnauthorized, err)
 						ctx.Done()
 						return
 					}
+					log.Info().
+						Str("account", claims.Id.String()).
+						Str("approver", override.ApproverId.String()).
+						Str("override", override.Id.String()).
+						Msg("request authorized by an override")
+					next.ServeHTTP(w, r)
+					return
 				}
-				if strings.Contains(string(value), grant) {
+				httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(decision.Reason()))
+				ctx.Done()
+			},
+		)
+	}
+}
+
+// SelfOrProtectedMiddleware lets the subject of the access token through
+// on its own account, the one the param route parameter names, and
+// otherwise asks for grant as ProtectedMiddleware does.
+func SelfOrProtectedMiddleware(param, grant string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		protected := ProtectedMiddleware(grant)(next)
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				claims, ok := r.Context().Value(key.UserValueKey).(*domain.Oauth)
+				if ok && chi.URLParam(r, param) == claims.Id.String() {
 					next.ServeHTTP(w, r)
-				} else {
-					httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
-					ctx.Done()
 					return
 				}
+				protected.ServeHTTP(w, r)
 			},
 		)
 	}
 }
+
+// requestStore returns the store targeted by r, or the zero ULID. A
+// request from a device assigned to a store targets that store, and may
+// not name another one.
+func requestStore(r *http.Request) (ulid.ULID, error) {
+	raw := chi.URLParam(r, StoreParam)
+	if raw == "" {
+		raw = r.Header.Get(StoreHeader)
+	}
+	device, _ := r.Context().Value(key.DeviceValueKey).(*domain.Device)
+	if device != nil && device.StoreId != nil {
+		if raw != "" && raw != device.StoreId.String() {
+			return ulid.ULID{}, ErrDeviceStore
+		}
+		return *device.StoreId, nil
+	}
+	if raw == "" {
+		return ulid.ULID{}, nil
+	}
+	return ulid.Parse(raw)
+}
+
+// maxHookBody bounds the body read for attribute hooks.
+const maxHookBody = 1 << 20
+
+var ErrBodyTooLarge = errors.New("request: body too large")
+
+// AttributeHook extracts the condition attributes of a request from its
+// body, such as the amount of a refund, and fails when the body is not
+// valid. The hook may consume the body: the handler gets it whole.
+type AttributeHook func(r *http.Request) (policy.Attributes, error)
+
+// requestAttributes collects the attributes conditions are checked
+// against: the chi route parameters, then the attributes of hooks, which
+// cannot replace a route parameter. The query is left out: any client can
+// put what it likes there.
+func requestAttributes(r *http.Request, hooks []AttributeHook) (policy.Attributes, error) {
+	attrs := policy.Attributes{}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, k := range rctx.URLParams.Keys {
+			attrs[k] = rctx.URLParams.Values[i]
+		}
+	}
+	if len(hooks) == 0 || r.Body == nil {
+		return attrs, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHookBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxHookBody {
+		return nil, ErrBodyTooLarge
+	}
+	r.Body.Close()
+	for _, hook := range hooks {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		extracted, err := hook(r)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range extracted {
+			if _, ok := attrs[k]; !ok {
+				attrs[k] = v
+			}
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return attrs, nil
+}
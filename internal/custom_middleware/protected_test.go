@@ -0,0 +1,282 @@
+package custommiddleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pos/domain"
+	"pos/internal/keyring"
+	"pos/internal/policy"
+	"pos/utils/key"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+func amountHook(r *http.Request) (policy.Attributes, error) {
+	var body struct {
+		Amount string `json:"amount"`
+		Id     string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return policy.Attributes{"amount": body.Amount, "id": body.Id}, nil
+}
+
+func newRequest(target, body string, params map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestRequestAttributesIgnoreQuery(t *testing.T) {
+	r := newRequest("/refund-transaction?amount=1&id=7", "", map[string]string{"storeId": "main"})
+	attrs, err := requestAttributes(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := attrs["amount"]; ok {
+		t.Errorf("amount taken from the query: %v", attrs)
+	}
+	if _, ok := attrs["id"]; ok {
+		t.Errorf("id taken from the query: %v", attrs)
+	}
+	if attrs["storeId"] != "main" {
+		t.Errorf("storeId = %q, want the route parameter", attrs["storeId"])
+	}
+}
+
+func TestRequestAttributesFromHooks(t *testing.T) {
+	body := `{"amount":"5000","id":"forged"}`
+	r := newRequest("/refund-transaction/42?amount=1", body, map[string]string{"id": "42"})
+	attrs, err := requestAttributes(r, []AttributeHook{amountHook})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs["amount"] != "5000" {
+		t.Errorf("amount = %q, want the body amount", attrs["amount"])
+	}
+	if attrs["id"] != "42" {
+		t.Errorf("id = %q, want the route parameter", attrs["id"])
+	}
+	rest, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != body {
+		t.Errorf("body left for the handler = %q, want %q", rest, body)
+	}
+}
+
+func TestRequestAttributesHookError(t *testing.T) {
+	r := newRequest("/refund-transaction", "not json", nil)
+	if _, err := requestAttributes(r, []AttributeHook{amountHook}); err == nil {
+		t.Error("invalid body accepted")
+	}
+}
+
+func TestRequestAttributesBodyTooLarge(t *testing.T) {
+	r := newRequest("/refund-transaction", strings.Repeat(" ", maxHookBody+1), nil)
+	if _, err := requestAttributes(r, []AttributeHook{amountHook}); err != ErrBodyTooLarge {
+		t.Errorf("err = %v, want %v", err, ErrBodyTooLarge)
+	}
+}
+
+func TestSelfOrProtected(t *testing.T) {
+	self := ulid.Make()
+	other := ulid.Make()
+	tests := []struct {
+		name        string
+		id          ulid.ULID
+		permissions []string
+		want        int
+	}{
+		{"own account", self, nil, http.StatusOK},
+		{"other account", other, nil, http.StatusUnauthorized},
+		{"other account with the grant", other, []string{"user-management"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest("/"+tt.id.String()+"/deny", "", map[string]string{"id": tt.id.String()})
+			claims := &domain.Oauth{Id: self, Permissions: tt.permissions}
+			r = r.WithContext(context.WithValue(r.Context(), key.UserValueKey, claims))
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			SelfOrProtectedMiddleware("id", "user-management")(next).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+type fakeRedeemer struct {
+	redeemed []ulid.ULID
+}
+
+func (f *fakeRedeemer) Redeem(ctx context.Context, id ulid.ULID) error {
+	f.redeemed = append(f.redeemed, id)
+	return nil
+}
+
+func TestOverrideCannotLiftDenial(t *testing.T) {
+	k, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	defer SetKeyring(nil)
+
+	tests := []struct {
+		name    string
+		denials []string
+		want    int
+	}{
+		{"missing grant", nil, http.StatusOK},
+		{"explicit denial", []string{"refund-transaction"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redeemer := &fakeRedeemer{}
+			SetOverrideRedeemer(redeemer)
+			defer SetOverrideRedeemer(nil)
+
+			claims := &domain.Oauth{Id: ulid.Make(), OrganizationId: ulid.Make(), Denials: tt.denials}
+			override := domain.NewOverride(claims.OrganizationId, claims.Id, ulid.Make(), http.MethodPost, "refund-transaction", nil, nil, time.Minute)
+			raw, err := k.Sign(&domain.OverrideClaims{
+				Override:         override,
+				RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{domain.AudienceOverride}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := newRequest("/refund-transaction", "", nil)
+			r = r.WithContext(context.WithValue(r.Context(), key.UserValueKey, claims))
+			r.Header.Set(OverrideHeader, raw)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			ProtectedMiddleware("refund-transaction")(next).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if used := len(redeemer.redeemed) > 0; used != (tt.want == http.StatusOK) {
+				t.Errorf("override redeemed = %v", used)
+			}
+		})
+	}
+}
+
+func TestOverrideBoundToAttributes(t *testing.T) {
+	k, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	defer SetKeyring(nil)
+
+	tests := []struct {
+		name  string
+		bound map[string]string
+		body  string
+		want  int
+	}{
+		{"same amount", map[string]string{"amount": "50"}, `{"amount":"50"}`, http.StatusOK},
+		{"other amount", map[string]string{"amount": "50"}, `{"amount":"5000"}`, http.StatusUnauthorized},
+		{"no amount bound", nil, `{"amount":"5000"}`, http.StatusUnauthorized},
+		{"bound amount missing", map[string]string{"amount": "50"}, `{}`, http.StatusUnauthorized},
+		{"body id under the route parameter", map[string]string{"amount": "50"}, `{"amount":"50","id":"7"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redeemer := &fakeRedeemer{}
+			SetOverrideRedeemer(redeemer)
+			defer SetOverrideRedeemer(nil)
+
+			claims := &domain.Oauth{Id: ulid.Make(), OrganizationId: ulid.Make()}
+			override := domain.NewOverride(claims.OrganizationId, claims.Id, ulid.Make(), http.MethodPost, "refund-transaction/42", nil, tt.bound, time.Minute)
+			raw, err := k.Sign(&domain.OverrideClaims{
+				Override:         override,
+				RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{domain.AudienceOverride}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := newRequest("/refund-transaction/42", tt.body, map[string]string{"id": "42"})
+			r = r.WithContext(context.WithValue(r.Context(), key.UserValueKey, claims))
+			r.Header.Set(OverrideHeader, raw)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			ProtectedMiddleware("refund-transaction/{id}", amountHook)(next).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if used := len(redeemer.redeemed) > 0; used != (tt.want == http.StatusOK) {
+				t.Errorf("override redeemed = %v", used)
+			}
+		})
+	}
+}
+
+func TestTokenKindsAreNotInterchangeable(t *testing.T) {
+	k, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(k)
+	defer SetKeyring(nil)
+	SetOverrideRedeemer(&fakeRedeemer{})
+	defer SetOverrideRedeemer(nil)
+
+	claims := &domain.Oauth{Id: ulid.Make(), OrganizationId: ulid.Make()}
+	override := domain.NewOverride(claims.OrganizationId, claims.Id, ulid.Make(), http.MethodPost, "refund-transaction", nil, nil, time.Minute)
+	tests := []struct {
+		name         string
+		aud          []string
+		wantAccess   bool
+		wantOverride bool
+	}{
+		{"access token", []string{domain.AudienceAccess}, true, false},
+		{"override token", []string{domain.AudienceOverride}, false, true},
+		{"review report", []string{domain.AudienceReviewReport}, false, false},
+		{"no audience", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The token carries the claims of both kinds, so that only
+			// its audience tells them apart.
+			raw, err := k.Sign(jwt.MapClaims{
+				"ulid":     claims.Id.String(),
+				"org":      claims.OrganizationId.String(),
+				"override": override,
+				"aud":      tt.aud,
+				"exp":      time.Now().Add(time.Minute).Unix(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := VerifyToken(context.Background(), raw); (err == nil) != tt.wantAccess {
+				t.Errorf("taken as an access token: err = %v", err)
+			}
+			_, err = redeemOverride(context.Background(), raw, claims, http.MethodPost, "refund-transaction", ulid.ULID{}, nil)
+			if (err == nil) != tt.wantOverride {
+				t.Errorf("taken as an override token: err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package custommiddleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/tenant"
+	"pos/utils/key"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// storeGrants grants refund-transaction in one store only, as a role
+// assigned in that store does.
+type storeGrants struct {
+	storeId ulid.ULID
+	stores  map[ulid.ULID]bool
+}
+
+func (s *storeGrants) EffectiveGrants(ctx context.Context, subject authz.Subject) (authz.Grants, error) {
+	if subject.StoreId != s.storeId {
+		return authz.Grants{}, nil
+	}
+	return authz.Grants{Allowed: []domain.ConditionalGrant{{Grant: "refund-transaction"}}}, nil
+}
+
+func (s *storeGrants) StoreLocation(ctx context.Context, storeId ulid.ULID) (*time.Location, error) {
+	if !s.stores[storeId] {
+		return nil, authz.ErrUnknownStore
+	}
+	return time.UTC, nil
+}
+
+func TestStoreScopedGrant(t *testing.T) {
+	storeA, storeB := ulid.Make(), ulid.Make()
+	SetPermissionResolver(authz.NewResolver(&storeGrants{
+		storeId: storeA,
+		stores:  map[ulid.ULID]bool{storeA: true, storeB: true},
+	}, time.Hour))
+	defer SetPermissionResolver(nil)
+
+	tests := []struct {
+		name        string
+		param       string
+		header      string
+		deviceStore *ulid.ULID
+		want        int
+	}{
+		{"store of the assignment in the route", storeA.String(), "", nil, http.StatusOK},
+		{"store of the assignment in the header", "", storeA.String(), nil, http.StatusOK},
+		{"other store", storeB.String(), "", nil, http.StatusUnauthorized},
+		{"unknown store", ulid.Make().String(), "", nil, http.StatusUnauthorized},
+		{"no store", "", "", nil, http.StatusUnauthorized},
+		{"invalid store", "", "main", nil, http.StatusBadRequest},
+		{"device of the store", "", "", &storeA, http.StatusOK},
+		{"device of the store naming another", "", storeB.String(), &storeA, http.StatusForbidden},
+		{"device of another store", "", "", &storeB, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]string{}
+			if tt.param != "" {
+				params[StoreParam] = tt.param
+			}
+			r := newRequest("/refund-transaction", "", params)
+			if tt.header != "" {
+				r.Header.Set(StoreHeader, tt.header)
+			}
+			claims := &domain.Oauth{Id: ulid.Make(), OrganizationId: ulid.Make()}
+			ctx := context.WithValue(tenant.WithOrganization(r.Context(), claims.OrganizationId), key.UserValueKey, claims)
+			if tt.deviceStore != nil {
+				ctx = context.WithValue(ctx, key.DeviceValueKey, &domain.Device{Id: ulid.Make(), StoreId: tt.deviceStore})
+			}
+			r = r.WithContext(ctx)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			ProtectedMiddleware("refund-transaction")(next).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
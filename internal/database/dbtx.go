@@ -0,0 +1,20 @@
+// Package database holds what the repositories share about the connection
+// they run on.
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DBTX is what a repository runs its queries on: a *pgxpool.Pool, or a
+// pgx.Tx to run repository methods inside a transaction of the caller. Begin
+// on a transaction opens a savepoint.
+type DBTX interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
@@ -0,0 +1,254 @@
+// Package decision lets other services ask for authorization decisions
+// instead of checking tokens themselves. Decisions come from the same
+// authz.Resolver that ProtectedMiddleware uses, so they follow role changes
+// and honour conditions and denials.
+package decision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"pos/internal/account"
+	"pos/internal/authz"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/policy"
+	"pos/internal/tenant"
+	"pos/utils/httpresponse"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/oklog/ulid/v2"
+)
+
+// maxBatchChecks bounds the checks of a single batch request.
+const maxBatchChecks = 100
+
+var (
+	ErrSubjectRequired  = errors.New("decision: either token or account_id is required")
+	ErrSubjectAmbiguous = errors.New("decision: token and account_id are exclusive")
+	ErrForeignToken     = errors.New("decision: token of another organization")
+)
+
+var allowedActions = []interface{}{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+type decisionRoute struct {
+	resolver         *authz.Resolver
+	accountReadModel account.ReadModel
+}
+
+func NewRoute(
+	resolver *authz.Resolver,
+	accountReadModel account.ReadModel,
+) *decisionRoute {
+	return &decisionRoute{
+		resolver:         resolver,
+		accountReadModel: accountReadModel,
+	}
+}
+
+// Routes serves the decisions. Callers authenticate with their own access
+// token and must hold the authz/check grant; the subject of the check is
+// named in the body.
+func (p *decisionRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Use(custommiddleware.ProtectedMiddleware("authz/check"))
+	r.Post("/check", p.check)
+	r.Post("/check/batch", p.checkBatch)
+	return r
+}
+
+// checkRequest asks whether a subject may perform action, an HTTP method,
+// on resource, a permission url. The subject is either an access token,
+// whose session counts for dynamic separation of duties, or an account id.
+// Attributes are those the conditions of grants are evaluated against; the
+// clock attributes are always set from the store.
+type checkRequest struct {
+	Token      string            `json:"token"`
+	AccountId  ulid.ULID         `json:"account_id"`
+	StoreId    ulid.ULID         `json:"store_id"`
+	Action     string            `json:"action"`
+	Resource   string            `json:"resource"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+func (c checkRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Action, validation.Required, validation.In(allowedActions...)),
+		validation.Field(&c.Resource, validation.Required, validation.Length(1, 255)),
+	)
+}
+
+type checkBatchRequest struct {
+	Checks []checkRequest `json:"checks"`
+}
+
+func (c checkBatchRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Checks, validation.Required, validation.Length(1, maxBatchChecks)),
+	)
+}
+
+type checkResult struct {
+	authz.Decision
+	AccountId ulid.ULID `json:"account_id"`
+	StoreId   ulid.ULID `json:"store_id"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+}
+
+// subject resolves the subject of c. The account, or the token, must
+// belong to the organization of the caller.
+func (p *decisionRoute) subject(r *http.Request, c checkRequest) (authz.Subject, error) {
+	ctx := r.Context()
+	hasAccount := c.AccountId != (ulid.ULID{})
+	switch {
+	case c.Token == "" && !hasAccount:
+		return authz.Subject{}, ErrSubjectRequired
+	case c.Token != "" && hasAccount:
+		return authz.Subject{}, ErrSubjectAmbiguous
+	case hasAccount:
+		if _, err := p.accountReadModel.FindById(ctx, c.AccountId); err != nil {
+			return authz.Subject{}, err
+		}
+		return authz.Subject{AccountId: c.AccountId, StoreId: c.StoreId}, nil
+	}
+
+	claims, err := custommiddleware.VerifyToken(ctx, c.Token)
+	if err != nil {
+		return authz.Subject{}, err
+	}
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return authz.Subject{}, err
+	}
+	if claims.OrganizationId != org {
+		return authz.Subject{}, ErrForeignToken
+	}
+	return authz.Subject{
+		AccountId: claims.Id,
+		StoreId:   c.StoreId,
+		SessionId: claims.SessionId,
+	}, nil
+}
+
+func (p *decisionRoute) decide(r *http.Request, c checkRequest, subject authz.Subject) (checkResult, error) {
+	decision, err := p.resolver.Authorize(r.Context(), subject, c.Action, c.Resource, policy.Attributes(c.Attributes))
+	if err != nil {
+		return checkResult{}, err
+	}
+	return checkResult{
+		Decision:  decision,
+		AccountId: subject.AccountId,
+		StoreId:   subject.StoreId,
+		Action:    c.Action,
+		Resource:  c.Resource,
+	}, nil
+}
+
+// writeSubjectError answers a subject that cannot be resolved.
+func writeSubjectError(w http.ResponseWriter, err error) {
+	if errors.Is(err, custommiddleware.ErrSessionUnchecked) {
+		httpresponse.WriteError(w, http.StatusInternalServerError, errors.New(http.StatusText((http.StatusInternalServerError))))
+		return
+	}
+	if errors.Is(err, account.ErrAccountNotFound) {
+		httpresponse.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	httpresponse.WriteError(w, http.StatusBadRequest, err)
+}
+
+func (p *decisionRoute) check(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body checkRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	body.Action = strings.ToUpper(body.Action)
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	subject, err := p.subject(r, body)
+	if err != nil {
+		writeSubjectError(w, err)
+		return
+	}
+
+	data, err := p.decide(r, body, subject)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusInternalServerError, errors.New(http.StatusText((http.StatusInternalServerError))))
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+// checkBatch answers several checks in the order given. The whole batch is
+// rejected when any check is malformed or names an unknown subject.
+func (p *decisionRoute) checkBatch(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body checkBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for i := range body.Checks {
+		body.Checks[i].Action = strings.ToUpper(body.Checks[i].Action)
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	subjects := make([]authz.Subject, len(body.Checks))
+	for i := range body.Checks {
+		if err := body.Checks[i].Validate(); err != nil {
+			httpresponse.WriteError(w, http.StatusBadRequest, fmt.Errorf("checks[%d]: %w", i, err))
+			return
+		}
+		subject, err := p.subject(r, body.Checks[i])
+		if err != nil {
+			writeSubjectError(w, fmt.Errorf("checks[%d]: %w", i, err))
+			return
+		}
+		subjects[i] = subject
+	}
+
+	items := make([]checkResult, 0, len(body.Checks))
+	allowed := 0
+	for i, c := range body.Checks {
+		data, err := p.decide(r, c, subjects[i])
+		if err != nil {
+			httpresponse.WriteError(w, http.StatusInternalServerError, errors.New(http.StatusText((http.StatusInternalServerError))))
+			return
+		}
+		if data.Allowed {
+			allowed++
+		}
+		items = append(items, data)
+	}
+	var meta struct {
+		Total   int `json:"total"`
+		Allowed int `json:"allowed"`
+	}
+	meta.Total = len(items)
+	meta.Allowed = allowed
+	httpresponse.WriteData(w, http.StatusOK, items, meta)
+}
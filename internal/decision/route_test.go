@@ -0,0 +1,195 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/authz"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/keyring"
+	"pos/internal/tenant"
+	"pos/utils/key"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// fakeGrants hands out the grants of each account.
+type fakeGrants struct {
+	grants map[ulid.ULID][]string
+}
+
+func (f *fakeGrants) EffectiveGrants(ctx context.Context, subject authz.Subject) (authz.Grants, error) {
+	res := authz.Grants{}
+	for _, grant := range f.grants[subject.AccountId] {
+		res.Allowed = append(res.Allowed, domain.ConditionalGrant{Grant: grant})
+	}
+	return res, nil
+}
+
+func (f *fakeGrants) StoreLocation(ctx context.Context, storeId ulid.ULID) (*time.Location, error) {
+	return time.UTC, nil
+}
+
+// fakeAccounts knows the accounts of one organization.
+type fakeAccounts struct {
+	account.ReadModel
+	ids map[ulid.ULID]bool
+}
+
+func (f *fakeAccounts) FindById(ctx context.Context, id ulid.ULID) (*domain.Account, error) {
+	if !f.ids[id] {
+		return nil, account.ErrAccountNotFound
+	}
+	return &domain.Account{Id: id}, nil
+}
+
+func repeat(s string, n int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = s
+	}
+	return res
+}
+
+func TestCheckBatch(t *testing.T) {
+	k, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	custommiddleware.SetKeyring(k)
+	defer custommiddleware.SetKeyring(nil)
+
+	org := ulid.Make()
+	cashier, clerk := ulid.Make(), ulid.Make()
+	resolver := authz.NewResolver(&fakeGrants{grants: map[ulid.ULID][]string{
+		cashier: {"refund-transaction"},
+	}}, time.Hour)
+	accounts := &fakeAccounts{ids: map[ulid.ULID]bool{cashier: true, clerk: true}}
+	route := NewRoute(resolver, accounts).Routes()
+
+	foreignToken, err := k.Sign(&domain.Oauth{
+		Id:             cashier,
+		OrganizationId: ulid.Make(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{domain.AudienceAccess},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(subject, action string) string {
+		return fmt.Sprintf(`{%s,"action":%q,"resource":"refund-transaction"}`, subject, action)
+	}
+	accountOf := func(id ulid.ULID) string {
+		return fmt.Sprintf(`"account_id":%q`, id.String())
+	}
+
+	tests := []struct {
+		name        string
+		checks      []string
+		want        int
+		wantAllowed []bool
+	}{
+		{
+			name:        "answers in order",
+			checks:      []string{check(accountOf(cashier), "post"), check(accountOf(clerk), "POST"), check(accountOf(cashier), "GET")},
+			want:        http.StatusOK,
+			wantAllowed: []bool{true, false, true},
+		},
+		{
+			name:   "unknown account rejects the batch",
+			checks: []string{check(accountOf(cashier), "POST"), check(accountOf(ulid.Make()), "POST")},
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "malformed check rejects the batch",
+			checks: []string{check(accountOf(cashier), "POST"), check(accountOf(cashier), "FETCH")},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "token of another organization",
+			checks: []string{check(fmt.Sprintf(`"token":%q`, foreignToken), "POST")},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "no subject",
+			checks: []string{`{"action":"POST","resource":"refund-transaction"}`},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "no checks",
+			checks: []string{},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "too many checks",
+			checks: repeat(check(accountOf(cashier), "POST"), maxBatchChecks+1),
+			want:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"checks":[` + strings.Join(tt.checks, ",") + `]}`
+			r := httptest.NewRequest(http.MethodPost, "/check/batch", strings.NewReader(body))
+			claims := &domain.Oauth{Id: ulid.Make(), OrganizationId: org, Permissions: []string{"authz/check"}}
+			r = r.WithContext(context.WithValue(tenant.WithOrganization(r.Context(), org), key.UserValueKey, claims))
+			w := httptest.NewRecorder()
+			route.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var res struct {
+				Data []checkResult `json:"data"`
+				Meta struct {
+					Total   int `json:"total"`
+					Allowed int `json:"allowed"`
+				} `json:"meta"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Data) != len(tt.wantAllowed) || res.Meta.Total != len(tt.wantAllowed) {
+				t.Fatalf("got %d results, total %d, want %d", len(res.Data), res.Meta.Total, len(tt.wantAllowed))
+			}
+			allowed := 0
+			for i, item := range res.Data {
+				if item.Allowed != tt.wantAllowed[i] {
+					t.Errorf("checks[%d] allowed = %v, want %v", i, item.Allowed, tt.wantAllowed[i])
+				}
+				if item.Allowed {
+					allowed++
+				}
+			}
+			if res.Meta.Allowed != allowed {
+				t.Errorf("meta allowed = %d, want %d", res.Meta.Allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestCheckNeedsGrant(t *testing.T) {
+	resolver := authz.NewResolver(&fakeGrants{}, time.Hour)
+	route := NewRoute(resolver, &fakeAccounts{}).Routes()
+	body := `{"account_id":"` + ulid.Make().String() + `","action":"POST","resource":"refund-transaction"}`
+	r := httptest.NewRequest(http.MethodPost, "/check", strings.NewReader(body))
+	org := ulid.Make()
+	claims := &domain.Oauth{Id: ulid.Make(), OrganizationId: org}
+	r = r.WithContext(context.WithValue(tenant.WithOrganization(r.Context(), org), key.UserValueKey, claims))
+	w := httptest.NewRecorder()
+	route.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
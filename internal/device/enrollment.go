@@ -0,0 +1,217 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrEnrollmentNotFound = errors.New("device: unknown enrollment code")
+	ErrEnrollmentUsed     = errors.New("device: enrollment code already used or expired")
+)
+
+type EnrollmentList struct {
+	Enrollments []domain.DeviceEnrollment `json:"data"`
+	Count       int                       `json:"count"`
+}
+
+var emptyEnrollmentList = EnrollmentList{
+	Enrollments: []domain.DeviceEnrollment{},
+	Count:       0,
+}
+
+// enrollmentColumns is the column list scanned by scanEnrollment.
+const enrollmentColumns = `
+	id,
+	organization_id,
+	code_hash,
+	name,
+	store_id,
+	created_by,
+	created_at,
+	expires_at,
+	used_at,
+	device_id
+`
+
+func scanEnrollment(row pgx.Row) (*domain.DeviceEnrollment, error) {
+	var item domain.DeviceEnrollment
+	if err := row.Scan(
+		&item.Id,
+		&item.OrganizationId,
+		&item.CodeHash,
+		&item.Name,
+		&item.StoreId,
+		&item.CreatedBy,
+		&item.CreatedAt,
+		&item.ExpiresAt,
+		&item.UsedAt,
+		&item.DeviceId,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrEnrollmentNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// FetchEnrollments implements ReadModel. Enrollments are listed the latest
+// first.
+func (r *repo) FetchEnrollments(ctx context.Context) (EnrollmentList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyEnrollmentList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+enrollmentColumns+`
+			FROM
+				device_enrollments
+			WHERE
+				organization_id = $1
+			ORDER BY
+				created_at DESC
+		`,
+		org,
+	)
+	if err != nil {
+		return emptyEnrollmentList, err
+	}
+	defer rows.Close()
+
+	items := []domain.DeviceEnrollment{}
+	for rows.Next() {
+		item, err := scanEnrollment(rows)
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyEnrollmentList, err
+		}
+		items = append(items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyEnrollmentList, err
+	}
+	list := EnrollmentList{
+		Enrollments: items,
+		Count:       len(items),
+	}
+	return list, nil
+}
+
+// FindEnrollmentByCode implements ReadModel. The lookup is not scoped: it
+// is how an enrolling device finds its organization.
+func (r *repo) FindEnrollmentByCode(ctx context.Context, codeHash string) (*domain.DeviceEnrollment, error) {
+	row := r.db.QueryRow(
+		ctx,
+		`SELECT `+enrollmentColumns+`
+			FROM
+				device_enrollments
+			WHERE
+				code_hash = $1
+		`,
+		codeHash,
+	)
+	return scanEnrollment(row)
+}
+
+// SaveEnrollment implements Repo. The store must belong to the
+// organization of ctx.
+func (r *repo) SaveEnrollment(ctx context.Context, data *domain.DeviceEnrollment) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			INSERT INTO device_enrollments (
+				id,
+				organization_id,
+				code_hash,
+				name,
+				store_id,
+				created_by,
+				created_at,
+				expires_at
+			)
+			SELECT $1, $2, $3, $4, $5, $6, $7, $8
+			WHERE $5::bytea IS NULL OR EXISTS (
+				SELECT 1 FROM stores s WHERE s.id = $5 AND s.organization_id = $2
+			);
+		`,
+		data.Id,
+		org,
+		data.CodeHash,
+		data.Name,
+		data.StoreId,
+		data.CreatedBy,
+		data.CreatedAt,
+		data.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStoreNotFound
+	}
+	data.OrganizationId = org
+	return nil
+}
+
+// Enroll implements Repo. The enrollment is used up and the device saved
+// in its organization in one transaction; of concurrent enrollments with
+// one code only one succeeds.
+func (r *repo) Enroll(ctx context.Context, enrollment *domain.DeviceEnrollment, data *domain.Device) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	tag, err := tx.Exec(
+		ctx,
+		`
+			UPDATE device_enrollments
+			SET used_at = $2
+			WHERE id = $1 AND used_at IS NULL AND expires_at > $2
+		`,
+		enrollment.Id,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEnrollmentUsed
+	}
+	if err := saveDevice(ctx, tx, enrollment.OrganizationId, data); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		ctx,
+		`
+			UPDATE device_enrollments
+			SET device_id = $2
+			WHERE id = $1
+		`,
+		enrollment.Id,
+		data.Id,
+	); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	enrollment.UsedAt = &now
+	enrollment.DeviceId = &data.Id
+	return nil
+}
@@ -0,0 +1,358 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/database"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDeviceNotFound = errors.New("device: not found")
+	ErrStoreNotFound  = errors.New("device: store not found")
+)
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+type DeviceList struct {
+	Devices []domain.Device `json:"data"`
+	Count   int             `json:"count"`
+}
+
+var emptyList = DeviceList{
+	Devices: []domain.Device{},
+	Count:   0,
+}
+
+// deviceColumns is the column list scanned by scanDevice.
+const deviceColumns = `
+	id,
+	organization_id,
+	name,
+	COALESCE(secret_hash, ''),
+	COALESCE(public_key, ''),
+	store_id,
+	created_at,
+	disabled_at,
+	last_seen_at
+`
+
+func scanDevice(row pgx.Row) (*domain.Device, error) {
+	var item domain.Device
+	if err := row.Scan(
+		&item.Id,
+		&item.OrganizationId,
+		&item.Name,
+		&item.SecretHash,
+		&item.PublicKey,
+		&item.StoreId,
+		&item.CreatedAt,
+		&item.DisabledAt,
+		&item.LastSeenAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrDeviceNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Fetch implements ReadModel.
+func (r *repo) Fetch(ctx context.Context) (DeviceList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+deviceColumns+`
+			FROM
+				devices
+			WHERE
+				organization_id = $1
+			ORDER BY
+				id
+		`,
+		org,
+	)
+	if err != nil {
+		return emptyList, err
+	}
+	defer rows.Close()
+
+	items := []domain.Device{}
+	for rows.Next() {
+		item, err := scanDevice(rows)
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyList, err
+		}
+		items = append(items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyList, err
+	}
+	list := DeviceList{
+		Devices: items,
+		Count:   len(items),
+	}
+	return list, nil
+}
+
+// FindById implements ReadModel.
+func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Device, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		`SELECT `+deviceColumns+`
+			FROM
+				devices
+			WHERE
+				id = $1 AND
+				organization_id = $2
+		`,
+		id,
+		org,
+	)
+	return scanDevice(row)
+}
+
+// FindByCredential implements ReadModel. The lookup is not scoped: it is
+// how a device signing in finds its organization.
+func (r *repo) FindByCredential(ctx context.Context, id ulid.ULID, secretHash string) (*domain.Device, error) {
+	row := r.db.QueryRow(
+		ctx,
+		`SELECT `+deviceColumns+`
+			FROM
+				devices
+			WHERE
+				id = $1 AND
+				secret_hash = $2
+		`,
+		id,
+		secretHash,
+	)
+	return scanDevice(row)
+}
+
+// FindEnrolled implements ReadModel. The lookup is not scoped: it is how
+// an assertion finds the key of the device that signed it. Only devices
+// enrolled with a key are found.
+func (r *repo) FindEnrolled(ctx context.Context, id ulid.ULID) (*domain.Device, error) {
+	row := r.db.QueryRow(
+		ctx,
+		`SELECT `+deviceColumns+`
+			FROM
+				devices
+			WHERE
+				id = $1 AND
+				public_key IS NOT NULL
+		`,
+		id,
+	)
+	return scanDevice(row)
+}
+
+// Save implements Repo. The store must belong to the organization of ctx.
+// The credential of a device is kept as it was first saved.
+func (r *repo) Save(ctx context.Context, data *domain.Device) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return saveDevice(ctx, r.db, org, data)
+}
+
+// saveDevice stores data in org, through db or a transaction.
+func saveDevice(ctx context.Context, db database.DBTX, org ulid.ULID, data *domain.Device) error {
+	tag, err := db.Exec(
+		ctx,
+		`
+			INSERT INTO devices (
+				id,
+				organization_id,
+				name,
+				secret_hash,
+				public_key,
+				store_id,
+				created_at
+			)
+			SELECT $1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7
+			WHERE $6::bytea IS NULL OR EXISTS (
+				SELECT 1 FROM stores s WHERE s.id = $6 AND s.organization_id = $2
+			)
+			ON CONFLICT (id) DO UPDATE
+			SET name = excluded.name,
+				store_id = excluded.store_id
+			WHERE devices.organization_id = excluded.organization_id;
+		`,
+		data.Id,
+		org,
+		data.Name,
+		data.SecretHash,
+		data.PublicKey,
+		data.StoreId,
+		data.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStoreNotFound
+	}
+	data.OrganizationId = org
+	return nil
+}
+
+// SetDisabled implements Repo. A nil disabledAt enables the device again
+// and clears its PIN failures.
+func (r *repo) SetDisabled(ctx context.Context, id ulid.ULID, disabledAt *time.Time) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE devices
+			SET
+				disabled_at = $3,
+				pin_failures = CASE WHEN $3 IS NULL THEN 0 ELSE pin_failures END
+			WHERE id = $1 AND organization_id = $2
+		`,
+		id,
+		org,
+		disabledAt,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// AddPinFailure implements Repo. It returns the wrong PINs keyed in on
+// the device in a row, this one included.
+func (r *repo) AddPinFailure(ctx context.Context, id ulid.ULID) (int, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var failures int
+	if err := r.db.QueryRow(
+		ctx,
+		`
+			UPDATE devices
+			SET pin_failures = pin_failures + 1
+			WHERE id = $1 AND organization_id = $2
+			RETURNING pin_failures
+		`,
+		id,
+		org,
+	).Scan(&failures); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrDeviceNotFound
+		}
+		return 0, err
+	}
+	return failures, nil
+}
+
+// ResetPinFailures implements Repo.
+func (r *repo) ResetPinFailures(ctx context.Context, id ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		ctx,
+		`
+			UPDATE devices
+			SET pin_failures = 0
+			WHERE id = $1 AND organization_id = $2 AND pin_failures > 0
+		`,
+		id,
+		org,
+	)
+	return err
+}
+
+// TouchLastSeen implements Repo. last_seen_at is only written once it is
+// older than a minute, so devices busy with requests do not write on every
+// one of them.
+func (r *repo) TouchLastSeen(ctx context.Context, id ulid.ULID, at time.Time) error {
+	_, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE devices
+			SET last_seen_at = $2
+			WHERE id = $1
+				AND (last_seen_at IS NULL OR last_seen_at < $2 - INTERVAL '1 minute')
+		`,
+		id,
+		at,
+	)
+	return err
+}
+
+// Delete implements Repo. The sessions opened on the device go with it.
+func (r *repo) Delete(ctx context.Context, data *domain.Device) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		ctx,
+		`
+			DELETE FROM devices
+			WHERE id = $1 AND organization_id = $2
+		`,
+		data.Id,
+		org,
+	)
+	return err
+}
+
+type Repo interface {
+	Save(ctx context.Context, data *domain.Device) error
+	Delete(ctx context.Context, data *domain.Device) error
+	SetDisabled(ctx context.Context, id ulid.ULID, disabledAt *time.Time) error
+	AddPinFailure(ctx context.Context, id ulid.ULID) (int, error)
+	ResetPinFailures(ctx context.Context, id ulid.ULID) error
+	TouchLastSeen(ctx context.Context, id ulid.ULID, at time.Time) error
+	SaveEnrollment(ctx context.Context, data *domain.DeviceEnrollment) error
+	Enroll(ctx context.Context, enrollment *domain.DeviceEnrollment, data *domain.Device) error
+}
+
+type ReadModel interface {
+	Fetch(ctx context.Context) (DeviceList, error)
+	FindById(ctx context.Context, id ulid.ULID) (*domain.Device, error)
+	FindByCredential(ctx context.Context, id ulid.ULID, secretHash string) (*domain.Device, error)
+	FindEnrolled(ctx context.Context, id ulid.ULID) (*domain.Device, error)
+	FetchEnrollments(ctx context.Context) (EnrollmentList, error)
+	FindEnrollmentByCode(ctx context.Context, codeHash string) (*domain.DeviceEnrollment, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
+
+func NewReadModel(db *pgxpool.Pool) ReadModel {
+	return &repo{db: db}
+}
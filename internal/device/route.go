@@ -0,0 +1,335 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pos/domain"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/utils/httpresponse"
+	"pos/utils/key"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/oklog/ulid/v2"
+)
+
+type deviceRoute struct {
+	svc Service
+}
+
+func NewRoute(
+	svc Service,
+) *deviceRoute {
+	return &deviceRoute{
+		svc: svc,
+	}
+}
+
+type publicDeviceRoute struct {
+	svc Service
+}
+
+func NewPublicRoute(
+	svc Service,
+) *publicDeviceRoute {
+	return &publicDeviceRoute{
+		svc: svc,
+	}
+}
+
+// Routes serves the enrollment of devices, which have no session yet.
+func (p *publicDeviceRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Post("/", p.enrollDevice)
+	return r
+}
+
+// Routes serves the devices and their enrollment codes to accounts holding
+// device:manage.
+func (p *deviceRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("device:manage"))
+		r.Post("/", p.registerDevice)
+		r.Get("/", p.getAllDevice)
+		r.Post("/enrollment", p.issueEnrollment)
+		r.Get("/enrollment", p.getAllEnrollment)
+		r.Get("/{id}", p.getOneDevice)
+		r.Patch("/{id}", p.updateDevice)
+		r.Delete("/{id}", p.deleteDevice)
+		r.Post("/{id}/disable", p.disableDevice)
+		r.Post("/{id}/enable", p.enableDevice)
+	})
+	return r
+}
+
+// deviceRequest describes a device, or the device an enrollment code is
+// for. A device without a store serves every store.
+type deviceRequest struct {
+	Name    string     `json:"name" validate:"required"`
+	StoreId *ulid.ULID `json:"store_id"`
+}
+
+func (c deviceRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Name, validation.Required, validation.Length(1, 255)),
+	)
+}
+
+func (p *deviceRoute) registerDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body deviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.Register(ctx, body.Name, body.StoreId)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+// writeDeviceError answers a request on a device that cannot be served.
+func writeDeviceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrDeviceNotFound), errors.Is(err, ErrStoreNotFound):
+		httpresponse.WriteError(w, http.StatusNotFound, err)
+	default:
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+	}
+}
+
+func (p *deviceRoute) issueEnrollment(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body deviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.IssueEnrollment(ctx, token.Id, body.Name, body.StoreId)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+func (p *deviceRoute) getAllEnrollment(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+
+	data, err := p.svc.GetEnrollments(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Enrollments, meta)
+}
+
+type enrollRequest struct {
+	Code string `json:"code" validate:"required"`
+	// PublicKey is the PEM encoded public half of the Ed25519 key the
+	// device signs its assertions with.
+	PublicKey string `json:"public_key" validate:"required"`
+}
+
+func (c enrollRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Code, validation.Required, validation.Length(1, 32)),
+		validation.Field(&c.PublicKey, validation.Required, validation.Length(1, 1024)),
+	)
+}
+
+func (p *publicDeviceRoute) enrollDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body enrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.Enroll(ctx, body.Code, body.PublicKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEnrollmentNotFound), errors.Is(err, ErrEnrollmentUsed):
+			httpresponse.WriteError(w, http.StatusUnauthorized, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+func (p *deviceRoute) disableDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.Disable(ctx, id)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *deviceRoute) enableDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.Enable(ctx, id)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *deviceRoute) getAllDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+
+	data, err := p.svc.GetAll(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Devices, meta)
+}
+
+func (p *deviceRoute) getOneDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.GetOneById(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *deviceRoute) updateDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body deviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.Update(ctx, id, body.Name, body.StoreId)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *deviceRoute) deleteDevice(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.svc.Delete(ctx, id); err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success delete device")
+}
@@ -0,0 +1,351 @@
+package device
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"pos/domain"
+	"pos/utils"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDeviceDisabled   = errors.New("device: disabled")
+	ErrInvalidKey       = errors.New("device: public key must be a PEM encoded Ed25519 key")
+	ErrInvalidAssertion = errors.New("device: invalid assertion")
+)
+
+// secretBytes is the amount of entropy in a device secret.
+const secretBytes = 32
+
+// Enrollment codes are enrollmentCodeLength characters of codeAlphabet,
+// which leaves out letters easily mistaken for digits, shown in groups of
+// five.
+const (
+	codeAlphabet         = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	enrollmentCodeLength = 10
+)
+
+// maxAssertionLifetime bounds how long an assertion may be valid for, so a
+// captured one is of little use.
+const maxAssertionLifetime = 5 * time.Minute
+
+// SessionRevoker ends the sessions opened on a device.
+type SessionRevoker interface {
+	RevokeByDevice(ctx context.Context, deviceId ulid.ULID) error
+}
+
+type Service interface {
+	Register(ctx context.Context, name string, storeId *ulid.ULID) (*domain.DeviceRegistration, error)
+	Update(ctx context.Context, id ulid.ULID, name string, storeId *ulid.ULID) (*domain.Device, error)
+	GetAll(ctx context.Context) (DeviceList, error)
+	GetOneById(ctx context.Context, id ulid.ULID) (*domain.Device, error)
+	Delete(ctx context.Context, id ulid.ULID) error
+	Disable(ctx context.Context, id ulid.ULID) (*domain.Device, error)
+	Enable(ctx context.Context, id ulid.ULID) (*domain.Device, error)
+	IssueEnrollment(ctx context.Context, createdBy ulid.ULID, name string, storeId *ulid.ULID) (*domain.DeviceEnrollmentCode, error)
+	GetEnrollments(ctx context.Context) (EnrollmentList, error)
+	Enroll(ctx context.Context, code, publicKey string) (*domain.Device, error)
+	Authenticate(ctx context.Context, id ulid.ULID, secret string) (*domain.Device, error)
+	AuthenticateAssertion(ctx context.Context, assertion string) (*domain.Device, error)
+	RecordPinFailure(ctx context.Context, id ulid.ULID) error
+	ClearPinFailures(ctx context.Context, id ulid.ULID) error
+}
+
+type services struct {
+	repo           Repo
+	readModel      ReadModel
+	sessions       SessionRevoker
+	pepper         string
+	enrollmentTTL  time.Duration
+	maxPinFailures uint
+}
+
+// NewService returns the devices. Secrets and enrollment codes are stored
+// hashed with pepper, like refresh tokens; an enrollment code can be used
+// for enrollmentTTL once issued. Disabling a device ends its sessions
+// through sessions. maxPinFailures wrong PINs in a row on a device disable
+// it; zero never does.
+func NewService(
+	repo Repo,
+	readModel ReadModel,
+	sessions SessionRevoker,
+	pepper string,
+	enrollmentTTL time.Duration,
+	maxPinFailures uint,
+) Service {
+	return &services{
+		repo:           repo,
+		readModel:      readModel,
+		sessions:       sessions,
+		pepper:         pepper,
+		enrollmentTTL:  enrollmentTTL,
+		maxPinFailures: maxPinFailures,
+	}
+}
+
+// hashSecret derives the value stored for a device secret or an enrollment
+// code.
+func (s *services) hashSecret(secret string) string {
+	mac := hmac.New(sha256.New, []byte(s.pepper))
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Register implements Service. The secret is returned once, to be set up
+// on the device.
+func (s *services) Register(ctx context.Context, name string, storeId *ulid.ULID) (*domain.DeviceRegistration, error) {
+	secret, err := utils.RandToken(secretBytes)
+	if err != nil {
+		return nil, err
+	}
+	newData := domain.NewDevice(name, storeId)
+	newData.SecretHash = s.hashSecret(secret)
+	if err := s.repo.Save(ctx, &newData); err != nil {
+		return nil, err
+	}
+	return &domain.DeviceRegistration{
+		Device: newData,
+		Secret: secret,
+	}, nil
+}
+
+// Update implements Service. A nil storeId lets the device serve every
+// store.
+func (s *services) Update(ctx context.Context, id ulid.ULID, name string, storeId *ulid.ULID) (*domain.Device, error) {
+	currentData, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	currentData.Name = name
+	currentData.StoreId = storeId
+	if err := s.repo.Save(ctx, currentData); err != nil {
+		return nil, err
+	}
+	return currentData, nil
+}
+
+// GetAll implements Service.
+func (s *services) GetAll(ctx context.Context) (DeviceList, error) {
+	return s.readModel.Fetch(ctx)
+}
+
+// GetOneById implements Service.
+func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.Device, error) {
+	return s.readModel.FindById(ctx, id)
+}
+
+// Delete implements Service. Sessions opened on the device end with it.
+func (s *services) Delete(ctx context.Context, id ulid.ULID) error {
+	currentData, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, currentData)
+}
+
+// Disable implements Service. The device is refused from then on and every
+// session opened on it is revoked, so enabling it again does not bring
+// them back.
+func (s *services) Disable(ctx context.Context, id ulid.ULID) (*domain.Device, error) {
+	now := time.Now()
+	if err := s.repo.SetDisabled(ctx, id, &now); err != nil {
+		return nil, err
+	}
+	if err := s.sessions.RevokeByDevice(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, id)
+}
+
+// RecordPinFailure implements Service. The failure that reaches
+// maxPinFailures disables the device, see Disable, so that one terminal
+// cannot go on guessing the PINs of every account of the organization.
+func (s *services) RecordPinFailure(ctx context.Context, id ulid.ULID) error {
+	if s.maxPinFailures == 0 {
+		return nil
+	}
+	failures, err := s.repo.AddPinFailure(ctx, id)
+	if err != nil {
+		return err
+	}
+	if uint(failures) < s.maxPinFailures {
+		return nil
+	}
+	log.Warn().
+		Str("device", id.String()).
+		Int("failures", failures).
+		Msg("device disabled after too many wrong pins")
+	_, err = s.Disable(ctx, id)
+	return err
+}
+
+// ClearPinFailures implements Service.
+func (s *services) ClearPinFailures(ctx context.Context, id ulid.ULID) error {
+	if s.maxPinFailures == 0 {
+		return nil
+	}
+	return s.repo.ResetPinFailures(ctx, id)
+}
+
+// Enable implements Service. The PIN failures of the device start over.
+func (s *services) Enable(ctx context.Context, id ulid.ULID) (*domain.Device, error) {
+	if err := s.repo.SetDisabled(ctx, id, nil); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, id)
+}
+
+// IssueEnrollment implements Service. The code is returned once, to be
+// keyed in on the device to enroll, see Enroll.
+func (s *services) IssueEnrollment(ctx context.Context, createdBy ulid.ULID, name string, storeId *ulid.ULID) (*domain.DeviceEnrollmentCode, error) {
+	code, err := enrollmentCode()
+	if err != nil {
+		return nil, err
+	}
+	newData := domain.NewDeviceEnrollment(createdBy, name, storeId, s.hashSecret(code), s.enrollmentTTL)
+	if err := s.repo.SaveEnrollment(ctx, &newData); err != nil {
+		return nil, err
+	}
+	return &domain.DeviceEnrollmentCode{
+		Enrollment: newData,
+		Code:       code[:enrollmentCodeLength/2] + "-" + code[enrollmentCodeLength/2:],
+	}, nil
+}
+
+// enrollmentCode returns a random code of enrollmentCodeLength characters.
+func enrollmentCode() (string, error) {
+	b := make([]byte, enrollmentCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// normalizeCode undoes the grouping and casing of a code keyed in.
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// GetEnrollments implements Service.
+func (s *services) GetEnrollments(ctx context.Context) (EnrollmentList, error) {
+	return s.readModel.FetchEnrollments(ctx)
+}
+
+// Enroll implements Service. The device keys in the code of an
+// enrollment, whatever the organization of ctx, with the public half of
+// its key; it is registered with the name and store of the enrollment and
+// from then on authenticates with assertions, see AuthenticateAssertion.
+func (s *services) Enroll(ctx context.Context, code, publicKey string) (*domain.Device, error) {
+	if _, err := parsePublicKey(publicKey); err != nil {
+		return nil, err
+	}
+	enrollment, err := s.readModel.FindEnrollmentByCode(ctx, s.hashSecret(normalizeCode(code)))
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.UsedAt != nil || !enrollment.ExpiresAt.After(time.Now()) {
+		return nil, ErrEnrollmentUsed
+	}
+	newData := domain.NewDevice(enrollment.Name, enrollment.StoreId)
+	newData.PublicKey = publicKey
+	if err := s.repo.Enroll(ctx, enrollment, &newData); err != nil {
+		return nil, err
+	}
+	log.Info().
+		Str("device", newData.Id.String()).
+		Str("enrollment", enrollment.Id.String()).
+		Msg("device enrolled")
+	return &newData, nil
+}
+
+// parsePublicKey decodes a PEM encoded Ed25519 public key.
+func parsePublicKey(raw string) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, ErrInvalidKey
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Authenticate implements Service and custommiddleware.DeviceAuthenticator.
+// It returns the device with id and secret, whatever the organization of
+// ctx, unless it is disabled.
+func (s *services) Authenticate(ctx context.Context, id ulid.ULID, secret string) (*domain.Device, error) {
+	data, err := s.readModel.FindByCredential(ctx, id, s.hashSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	return s.seen(ctx, data)
+}
+
+// AuthenticateAssertion implements Service and
+// custommiddleware.DeviceAuthenticator. An assertion is a JWT signed with
+// EdDSA by the key of an enrolled device, whose subject is the device id,
+// which expires within maxAssertionLifetime. It returns the device, whatever
+// the organization of ctx, unless it is disabled.
+func (s *services) AuthenticateAssertion(ctx context.Context, assertion string) (*domain.Device, error) {
+	var data *domain.Device
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(
+		assertion,
+		claims,
+		func(t *jwt.Token) (interface{}, error) {
+			id, err := ulid.Parse(claims.Subject)
+			if err != nil {
+				return nil, ErrInvalidAssertion
+			}
+			data, err = s.readModel.FindEnrolled(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return parsePublicKey(data.PublicKey)
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+	)
+	if err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, ErrInvalidAssertion
+	}
+	if claims.ExpiresAt == nil || claims.ExpiresAt.After(time.Now().Add(maxAssertionLifetime)) {
+		return nil, ErrInvalidAssertion
+	}
+	return s.seen(ctx, data)
+}
+
+// seen refuses a disabled device and records that an enabled one was seen.
+func (s *services) seen(ctx context.Context, data *domain.Device) (*domain.Device, error) {
+	if data.DisabledAt != nil {
+		return nil, ErrDeviceDisabled
+	}
+	now := time.Now()
+	if err := s.repo.TouchLastSeen(ctx, data.Id, now); err != nil {
+		log.Warn().Err(err).Str("device", data.Id.String()).Msg("cannot record when the device was seen")
+	}
+	return data, nil
+}
@@ -0,0 +1,140 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// fakeDevices keeps one device in memory.
+type fakeDevices struct {
+	Repo
+	ReadModel
+	data     domain.Device
+	failures int
+}
+
+func (f *fakeDevices) FindById(ctx context.Context, id ulid.ULID) (*domain.Device, error) {
+	copied := f.data
+	return &copied, nil
+}
+
+func (f *fakeDevices) SetDisabled(ctx context.Context, id ulid.ULID, disabledAt *time.Time) error {
+	f.data.DisabledAt = disabledAt
+	if disabledAt == nil {
+		f.failures = 0
+	}
+	return nil
+}
+
+func (f *fakeDevices) AddPinFailure(ctx context.Context, id ulid.ULID) (int, error) {
+	f.failures++
+	return f.failures, nil
+}
+
+func (f *fakeDevices) ResetPinFailures(ctx context.Context, id ulid.ULID) error {
+	f.failures = 0
+	return nil
+}
+
+// fakeSessions records the devices whose sessions are revoked, failing
+// with err.
+type fakeSessions struct {
+	err     error
+	revoked []ulid.ULID
+}
+
+func (f *fakeSessions) RevokeByDevice(ctx context.Context, deviceId ulid.ULID) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.revoked = append(f.revoked, deviceId)
+	return nil
+}
+
+func TestRecordPinFailure(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxPinFailures uint
+		failures       int
+		cleared        bool
+		wantDisabled   bool
+	}{
+		{"below the limit", 3, 2, false, false},
+		{"at the limit", 3, 3, false, true},
+		{"right pin in between", 3, 4, true, false},
+		{"no limit", 0, 50, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices := &fakeDevices{data: domain.Device{Id: ulid.Make()}}
+			sessions := &fakeSessions{}
+			svc := NewService(devices, devices, sessions, "pepper", time.Hour, tt.maxPinFailures)
+			ctx := context.Background()
+			for i := 0; i < tt.failures; i++ {
+				if tt.cleared && i == tt.failures/2 {
+					if err := svc.ClearPinFailures(ctx, devices.data.Id); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := svc.RecordPinFailure(ctx, devices.data.Id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if disabled := devices.data.DisabledAt != nil; disabled != tt.wantDisabled {
+				t.Errorf("disabled = %v, want %v", disabled, tt.wantDisabled)
+			}
+			if revoked := len(sessions.revoked) > 0; revoked != tt.wantDisabled {
+				t.Errorf("sessions revoked = %v, want %v", revoked, tt.wantDisabled)
+			}
+		})
+	}
+}
+
+func TestDisable(t *testing.T) {
+	errRevoke := errors.New("device test: cannot revoke")
+	tests := []struct {
+		name      string
+		revokeErr error
+		wantErr   error
+	}{
+		{"sessions revoked", nil, nil},
+		{"sessions not revoked", errRevoke, errRevoke},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices := &fakeDevices{data: domain.Device{Id: ulid.Make()}}
+			sessions := &fakeSessions{err: tt.revokeErr}
+			svc := NewService(devices, devices, sessions, "pepper", time.Hour, 0)
+			ctx := context.Background()
+
+			data, err := svc.Disable(ctx, devices.data.Id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if devices.data.DisabledAt == nil {
+				t.Error("device not disabled")
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if data.DisabledAt == nil {
+				t.Error("returned device not disabled")
+			}
+			if len(sessions.revoked) != 1 || sessions.revoked[0] != devices.data.Id {
+				t.Errorf("sessions revoked on %v, want [%s]", sessions.revoked, devices.data.Id)
+			}
+
+			if _, err := svc.Enable(ctx, devices.data.Id); err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions.revoked) != 1 {
+				t.Errorf("sessions revoked %d times, want once", len(sessions.revoked))
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	ErrUnknownKey        = errors.New("keyring: unknown signing key")
+	ErrAlgorithmMismatch = errors.New("keyring: algorithm does not match key")
+	ErrNoActiveKey       = errors.New("keyring: no active signing key")
+	ErrUnsupportedKey    = errors.New("keyring: unsupported key type")
+)
+
+// ManifestFile is read from the keys directory and decides which key signs
+// new tokens and which keys are no longer trusted.
+const ManifestFile = "keyring.yml"
+
+type manifest struct {
+	Active  string   `yaml:"active"`
+	Retired []string `yaml:"retired"`
+	// LegacyHS256 keeps accepting tokens signed with the shared secret
+	// while clients move over to the asymmetric keys.
+	LegacyHS256 bool `yaml:"legacy_hs256"`
+}
+
+// Key is one entry of the keyring. Keys loaded from a public key file can
+// only verify tokens.
+type Key struct {
+	Id      string
+	Method  jwt.SigningMethod
+	Public  crypto.PublicKey
+	Retired bool
+	private crypto.PrivateKey
+}
+
+// Keyring signs access tokens with its active key and verifies tokens
+// signed by any key that is not retired. Keys are loaded from PEM files in
+// a directory, the file name without extension being the key id (kid).
+//
+// Without a keys directory the keyring falls back to HS256 with the shared
+// secret, which keeps development setups working but cannot be published.
+type Keyring struct {
+	mu     sync.RWMutex
+	dir    string
+	secret []byte
+	active *Key
+	keys   map[string]*Key
+	legacy []byte
+}
+
+func New(dir, secret string) (*Keyring, error) {
+	k := &Keyring{
+		dir:    dir,
+		secret: []byte(secret),
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keys directory again. Rotating a key means dropping the
+// new PEM file in the directory, pointing the manifest at it, moving the
+// old key to retired once its tokens expired, then calling Reload.
+func (k *Keyring) Reload() error {
+	if k.dir == "" {
+		log.Warn().Msg("keyring: no keys directory configured, signing with the shared HS256 secret")
+		k.mu.Lock()
+		k.active = nil
+		k.keys = map[string]*Key{}
+		k.legacy = k.secret
+		k.mu.Unlock()
+		return nil
+	}
+
+	var m manifest
+	raw, err := os.ReadFile(filepath.Join(k.dir, ManifestFile))
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(raw, &m); err != nil {
+		return err
+	}
+	retired := make(map[string]bool, len(m.Retired))
+	for _, kid := range m.Retired {
+		retired[kid] = true
+	}
+
+	files, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*Key, len(files))
+	for _, fn := range files {
+		kid := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+		key, err := loadKey(fn)
+		if err != nil {
+			return fmt.Errorf("keyring: %s: %w", kid, err)
+		}
+		key.Id = kid
+		key.Retired = retired[kid]
+		keys[kid] = key
+	}
+
+	active, ok := keys[m.Active]
+	if !ok || active.private == nil || active.Retired {
+		return ErrNoActiveKey
+	}
+
+	var legacy []byte
+	if m.LegacyHS256 {
+		legacy = k.secret
+	}
+
+	k.mu.Lock()
+	k.active = active
+	k.keys = keys
+	k.legacy = legacy
+	k.mu.Unlock()
+
+	log.Info().Str("active", active.Id).Int("keys", len(keys)).Msg("keyring loaded")
+	return nil
+}
+
+func loadKey(fn string) (*Key, error) {
+	raw, err := os.ReadFile(filepath.Clean(fn))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{Method: jwt.SigningMethodRS256, Public: &v.PublicKey, private: v}, nil
+	case *rsa.PublicKey:
+		return &Key{Method: jwt.SigningMethodRS256, Public: v}, nil
+	case ed25519.PrivateKey:
+		return &Key{Method: jwt.SigningMethodEdDSA, Public: v.Public(), private: v}, nil
+	case ed25519.PublicKey:
+		return &Key{Method: jwt.SigningMethodEdDSA, Public: v}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// Sign signs claims with the active key and stamps its id in the kid header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	active, legacy := k.active, k.legacy
+	k.mu.RUnlock()
+
+	if active == nil {
+		if legacy == nil {
+			return "", ErrNoActiveKey
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(legacy)
+	}
+	token := jwt.NewWithClaims(active.Method, claims)
+	token.Header["kid"] = active.Id
+	return token.SignedString(active.private)
+}
+
+// Keyfunc resolves the verification key of a token. The algorithm in the
+// token header must match the key it names, so an RSA public key can never
+// be used as an HMAC secret.
+func (k *Keyring) Keyfunc(t *jwt.Token) (interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if t.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if k.legacy == nil {
+			return nil, ErrUnknownKey
+		}
+		return k.legacy, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok || key.Retired {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.Public, nil
+}
+
+// Parse verifies tokenString against the keyring and decodes it into
+// claims; opts add checks, such as jwt.WithAudience.
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, k.Keyfunc, opts...)
+}
+
+// Keys returns the keys that are currently trusted for verification.
+func (k *Keyring) Keys() []Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	res := make([]Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		if key.Retired {
+			continue
+		}
+		res = append(res, Key{
+			Id:     key.Id,
+			Method: key.Method,
+			Public: key.Public,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
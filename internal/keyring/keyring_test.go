@@ -0,0 +1,242 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeFile(t *testing.T, fn string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(fn, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeEd25519Key writes a PKCS #8 Ed25519 private key as kid in dir.
+func writeEd25519Key(t *testing.T, dir, kid string) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// writeRSAKey writes a PKCS #1 RSA private key as kid in dir.
+func writeRSAKey(t *testing.T, dir, kid string) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der := x509.MarshalPKCS1PrivateKey(private)
+	writeFile(t, filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}))
+}
+
+func writeManifest(t *testing.T, dir, manifest string) {
+	t.Helper()
+	writeFile(t, filepath.Join(dir, ManifestFile), []byte(manifest))
+}
+
+func newClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "account"}
+}
+
+func TestSharedSecretFallback(t *testing.T) {
+	k, err := New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := k.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := k.Parse(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+		t.Errorf("alg = %s, want HS256", parsed.Method.Alg())
+	}
+	if keys := k.Keys(); len(keys) != 0 {
+		t.Errorf("published %d keys, want none", len(keys))
+	}
+}
+
+func TestSignWithActiveKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, dir, kid string)
+		alg   string
+	}{
+		{"ed25519", writeEd25519Key, jwt.SigningMethodEdDSA.Alg()},
+		{"rsa", writeRSAKey, jwt.SigningMethodRS256.Alg()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.write(t, dir, "k1")
+			writeManifest(t, dir, "active: k1\n")
+			k, err := New(dir, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := k.Sign(newClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := k.Parse(token, jwt.MapClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Method.Alg() != tt.alg {
+				t.Errorf("alg = %s, want %s", parsed.Method.Alg(), tt.alg)
+			}
+			if kid := parsed.Header["kid"]; kid != "k1" {
+				t.Errorf("kid = %v, want k1", kid)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "k1")
+	writeManifest(t, dir, "active: k1\n")
+	k, err := New(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := k.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeEd25519Key(t, dir, "k2")
+	writeManifest(t, dir, "active: k2\n")
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Parse(old, jwt.MapClaims{}); err != nil {
+		t.Errorf("token of the previous key refused before it is retired: %v", err)
+	}
+	next, err := k.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := k.Parse(next, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := parsed.Header["kid"]; kid != "k2" {
+		t.Errorf("kid = %v, want k2", kid)
+	}
+	if keys := k.Keys(); len(keys) != 2 {
+		t.Errorf("published %d keys, want 2", len(keys))
+	}
+
+	writeManifest(t, dir, "active: k2\nretired: [k1]\n")
+	if err := k.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Parse(old, jwt.MapClaims{}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of a retired key: err = %v, want %v", err, ErrUnknownKey)
+	}
+	keys := k.Keys()
+	if len(keys) != 1 || keys[0].Id != "k2" {
+		t.Errorf("published keys = %v, want only k2", keys)
+	}
+}
+
+func TestReloadRefusesInactiveManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{"unknown active key", "active: k9\n"},
+		{"retired active key", "active: k1\nretired: [k1]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeEd25519Key(t, dir, "k1")
+			writeManifest(t, dir, tt.manifest)
+			if _, err := New(dir, "secret"); !errors.Is(err, ErrNoActiveKey) {
+				t.Errorf("err = %v, want %v", err, ErrNoActiveKey)
+			}
+		})
+	}
+}
+
+func TestSharedSecretTokens(t *testing.T) {
+	legacy, err := New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := legacy.Sign(newClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     error
+	}{
+		{"refused by default", "active: k1\n", ErrUnknownKey},
+		{"accepted with legacy_hs256", "active: k1\nlegacy_hs256: true\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeEd25519Key(t, dir, "k1")
+			writeManifest(t, dir, tt.manifest)
+			k, err := New(dir, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := k.Parse(token, jwt.MapClaims{}); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlgorithmMustMatchKey(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "k1")
+	writeManifest(t, dir, "active: k1\n")
+	k, err := New(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token claiming to be signed with EdDSA under the kid of an RSA key.
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, newClaims())
+	forged.Header["kid"] = "k1"
+	token, err := forged.SignedString(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Parse(token, jwt.MapClaims{}); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("err = %v, want %v", err, ErrAlgorithmMismatch)
+	}
+}
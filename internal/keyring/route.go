@@ -0,0 +1,86 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every trusted key as a JSON Web Key Set.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.Keys() {
+		jwk := JWK{
+			Kid: key.Id,
+			Use: "sig",
+			Alg: key.Method.Alg(),
+		}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+type jwksRoute struct {
+	keyring *Keyring
+}
+
+func NewRoute(
+	keyring *Keyring,
+) *jwksRoute {
+	return &jwksRoute{
+		keyring: keyring,
+	}
+}
+
+func (p *jwksRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Get("/jwks.json", p.getJwks)
+	return r
+}
+
+// getJwks serves the key set as a bare JWKS document, without the usual
+// data/meta envelope, so standard JWT libraries can consume it directly.
+func (p *jwksRoute) getJwks(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Add("content-type", "application/json")
+	w.Header().Add("cache-control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(p.keyring.JWKS()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
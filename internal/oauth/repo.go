@@ -4,7 +4,8 @@ import (
 	"context"
 	"errors"
 	"pos/domain"
-	"time"
+	"pos/internal/database"
+	"pos/internal/tenant"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -13,12 +14,15 @@ import (
 )
 
 var (
+	ErrSessionNotFound          = errors.New("session: not found")
 	ErrRefreshTokenNotFound     = errors.New("refresh token: not found")
 	ErrRefreshTokenAlreadyExist = errors.New("refresh token: url already exists")
+	ErrRefreshTokenReused       = errors.New("refresh token: reuse detected")
+	ErrRefreshTokenExpired      = errors.New("refresh token: expired")
 )
 
 type repo struct {
-	db *pgxpool.Pool
+	db database.DBTX
 }
 
 type RefreshTokenList struct {
@@ -31,6 +35,47 @@ var emptyList = RefreshTokenList{
 	Count:         0,
 }
 
+// refreshTokenColumns is the column list scanned by scanRefreshToken.
+const refreshTokenColumns = `
+	id,
+	token_hash,
+	account_id,
+	family_id,
+	parent_id,
+	device_name,
+	device_id,
+	user_agent,
+	ip_address,
+	created_at,
+	expires_at,
+	revoked
+`
+
+func scanRefreshToken(row pgx.Row) (*domain.RefreshToken, error) {
+	var item domain.RefreshToken
+	if err := row.Scan(
+		&item.ID,
+		&item.TokenHash,
+		&item.UserID,
+		&item.FamilyID,
+		&item.ParentID,
+		&item.DeviceName,
+		&item.DeviceId,
+		&item.UserAgent,
+		&item.IPAddress,
+		&item.CreatedAt,
+		&item.ExpiresAt,
+		&item.Revoked,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return &domain.RefreshToken{}, ErrRefreshTokenNotFound
+		}
+		return &domain.RefreshToken{}, err
+	}
+	return &item, nil
+}
+
 // Fetch implements ReadModel.
 func (r *repo) Fetch(ctx context.Context) (RefreshTokenList, error) {
 	var itemCount int
@@ -51,14 +96,7 @@ func (r *repo) Fetch(ctx context.Context) (RefreshTokenList, error) {
 	items := make([]domain.RefreshToken, itemCount)
 	rows, err := r.db.Query(
 		ctx,
-		`
-			SELECT
-				id,
-				token_value,
-				account_id,
-				created_at,
-				expires_at,
-				revoked
+		`SELECT `+refreshTokenColumns+`
 			FROM
 				refresh_tokens
 			ORDER BY
@@ -72,34 +110,15 @@ func (r *repo) Fetch(ctx context.Context) (RefreshTokenList, error) {
 
 	var count int
 	for count = range items {
-		var id ulid.ULID
-		var tokenValue string
-		var userId ulid.ULID
-		var createdAt time.Time
-		var expiresAt time.Time
-		var revoked bool
 		if !rows.Next() {
 			break
 		}
-		if err := rows.Scan(
-			&id,
-			&tokenValue,
-			&userId,
-			&createdAt,
-			&expiresAt,
-			&revoked,
-		); err != nil {
+		item, err := scanRefreshToken(rows)
+		if err != nil {
 			log.Warn().Err(err).Msg("cannot scan an item")
 			return emptyList, err
 		}
-		items[count] = domain.RefreshToken{
-			ID:         id,
-			TokenValue: tokenValue,
-			UserID:     userId,
-			ExpiresAt:  expiresAt,
-			Revoked:    revoked,
-			CreatedAt:  createdAt,
-		}
+		items[count] = *item
 	}
 	list := RefreshTokenList{
 		RefreshTokens: items,
@@ -110,139 +129,120 @@ func (r *repo) Fetch(ctx context.Context) (RefreshTokenList, error) {
 
 // FindById implements ReadModel.
 func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.RefreshToken, error) {
-	query := `
-		SELECT
-			id,
-			token_value,
-			account_id,
-			created_at,
-			expires_at,
-			revoked
+	query := `SELECT ` + refreshTokenColumns + `
 		FROM
 			refresh_tokens
 		WHERE
 			id = $1
-			AND expires_at > NOW()  
-			AND revoked = false;   
+			AND expires_at > NOW()
+			AND revoked = false;
 	`
 	row := r.db.QueryRow(
 		ctx,
 		query,
 		id,
 	)
-	var item domain.RefreshToken
-	if err := row.Scan(
-		&item.ID,
-		&item.TokenValue,
-		&item.UserID,
-		&item.CreatedAt,
-		&item.ExpiresAt,
-		&item.Revoked,
-	); err != nil {
-		if err == pgx.ErrNoRows {
-			log.Debug().Err(err).Msg("can't find any item")
-			return &domain.RefreshToken{}, ErrRefreshTokenNotFound
-		}
-		return &domain.RefreshToken{}, err
-	}
-	return &item, nil
+	return scanRefreshToken(row)
 }
 
-// FindById implements ReadModel.
-func (r *repo) FindByUserID(ctx context.Context, id ulid.ULID) (*domain.RefreshToken, error) {
-	query := `
-		SELECT
-			id,
-			token_value,
-			account_id,
-			created_at,
-			expires_at,
-			revoked
+// FindByUserID implements ReadModel. It returns the live token of every
+// session the account has open, oldest login first.
+func (r *repo) FindByUserID(ctx context.Context, id ulid.ULID) (RefreshTokenList, error) {
+	query := `SELECT ` + refreshTokenColumns + `
 		FROM
 			refresh_tokens
 		WHERE
 			account_id = $1
-			AND expires_at > NOW()  
-			AND revoked = false;   
+			AND expires_at > NOW()
+			AND revoked = false
+		ORDER BY
+			family_id;
 	`
-	row := r.db.QueryRow(
+	rows, err := r.db.Query(
 		ctx,
 		query,
 		id,
 	)
-	var item domain.RefreshToken
-	if err := row.Scan(
-		&item.ID,
-		&item.TokenValue,
-		&item.UserID,
-		&item.CreatedAt,
-		&item.ExpiresAt,
-		&item.Revoked,
-	); err != nil {
-		if err == pgx.ErrNoRows {
-			log.Debug().Err(err).Msg("can't find any item")
-			return &domain.RefreshToken{}, ErrRefreshTokenNotFound
+	if err != nil {
+		return emptyList, err
+	}
+	defer rows.Close()
+
+	items := []domain.RefreshToken{}
+	for rows.Next() {
+		item, err := scanRefreshToken(rows)
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyList, err
 		}
-		return &domain.RefreshToken{}, err
+		items = append(items, *item)
 	}
-	return &item, nil
+	if err := rows.Err(); err != nil {
+		return emptyList, err
+	}
+	list := RefreshTokenList{
+		RefreshTokens: items,
+		Count:         len(items),
+	}
+	return list, nil
 }
 
-// FindById implements ReadModel.
-func (r *repo) FindByToken(ctx context.Context, token string) (*domain.RefreshToken, error) {
-	query := `
-		SELECT
-			id,
-			token_value,
-			account_id,
-			created_at,
-			expires_at,
-			revoked
+// FindByTokenHash implements ReadModel.
+func (r *repo) FindByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + `
 		FROM
 			refresh_tokens
 		WHERE
-			token_value = $1
-			AND expires_at > NOW()  
-			AND revoked = false;   
+			token_hash = $1
+			AND expires_at > NOW()
+			AND revoked = false;
 	`
 	row := r.db.QueryRow(
 		ctx,
 		query,
-		token,
+		tokenHash,
 	)
-	var item domain.RefreshToken
-	if err := row.Scan(
-		&item.ID,
-		&item.TokenValue,
-		&item.UserID,
-		&item.CreatedAt,
-		&item.ExpiresAt,
-		&item.Revoked,
-	); err != nil {
-		if err == pgx.ErrNoRows {
-			log.Debug().Err(err).Msg("can't find any item")
-			return &domain.RefreshToken{}, ErrRefreshTokenNotFound
-		}
-		return &domain.RefreshToken{}, err
-	}
-	return &item, nil
+	return scanRefreshToken(row)
+}
+
+// FindAnyByTokenHash implements ReadModel. Unlike FindByTokenHash it also
+// returns revoked and expired tokens so that reuse can be detected.
+func (r *repo) FindAnyByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + `
+		FROM
+			refresh_tokens
+		WHERE
+			token_hash = $1;
+	`
+	row := r.db.QueryRow(
+		ctx,
+		query,
+		tokenHash,
+	)
+	return scanRefreshToken(row)
 }
 
 // Save implements Repo.
 func (r *repo) Save(ctx context.Context, data *domain.RefreshToken) error {
 	query := `
 		INSERT INTO refresh_tokens
-			(id, token_value, account_id, created_at, expires_at, revoked)
+			(id, token_hash, account_id, family_id, parent_id, device_name, device_id, user_agent, ip_address, created_at, expires_at, revoked)
 		VALUES
-			($1, $2, $3, $4, $5, $6);
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
 	`
 
 	if _, err := r.db.Exec(
 		ctx,
 		query,
 		data.ID,
-		data.TokenValue,
+		data.TokenHash,
 		data.UserID,
+		data.FamilyID,
+		data.ParentID,
+		data.DeviceName,
+		data.DeviceId,
+		data.UserAgent,
+		data.IPAddress,
 		data.CreatedAt,
 		data.ExpiresAt,
 		data.Revoked,
@@ -253,7 +253,51 @@ func (r *repo) Save(ctx context.Context, data *domain.RefreshToken) error {
 	return nil
 }
 
-// Save implements Repo.
+// SaveSession implements Repo. data opens a new session of its account;
+// when the account already holds maxSessions live sessions either
+// ErrTooManySessions is returned, if reject, or its oldest sessions are
+// revoked to make room. The account is locked for the count and the insert,
+// so that concurrent logins cannot go over the cap. A zero maxSessions sets
+// no cap.
+func (r *repo) SaveSession(ctx context.Context, data *domain.RefreshToken, maxSessions uint, reject bool) error {
+	if maxSessions == 0 {
+		return r.Save(ctx, data)
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(
+		ctx,
+		`SELECT id FROM accounts WHERE id = $1 FOR UPDATE`,
+		data.UserID,
+	); err != nil {
+		return err
+	}
+	txRepo := &repo{db: tx}
+	sessions, err := txRepo.FindByUserID(ctx, data.UserID)
+	if err != nil {
+		return err
+	}
+	if excess := sessions.Count - int(maxSessions) + 1; excess > 0 {
+		if reject {
+			return ErrTooManySessions
+		}
+		for _, oldest := range sessions.RefreshTokens[:excess] {
+			if err := txRepo.RevokeFamily(ctx, oldest.FamilyID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := txRepo.Save(ctx, data); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Revoke implements Repo.
 func (r *repo) Revoke(ctx context.Context, data *domain.RefreshToken) error {
 	query := `
 		UPDATE refresh_tokens
@@ -273,64 +317,448 @@ func (r *repo) Revoke(ctx context.Context, data *domain.RefreshToken) error {
 	return nil
 }
 
+// Rotate implements Repo. The current token is revoked and its successor
+// stored in one transaction; if the current token was already revoked by a
+// concurrent rotation ErrRefreshTokenReused is returned.
+func (r *repo) Rotate(ctx context.Context, current, next *domain.RefreshToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(
+		ctx,
+		`
+			UPDATE refresh_tokens
+			SET
+				revoked = TRUE
+			WHERE id = $1 AND revoked = FALSE
+		`,
+		current.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		`
+			INSERT INTO refresh_tokens
+				(id, token_hash, account_id, family_id, parent_id, device_name, device_id, user_agent, ip_address, created_at, expires_at, revoked)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
+		`,
+		next.ID,
+		next.TokenHash,
+		next.UserID,
+		next.FamilyID,
+		next.ParentID,
+		next.DeviceName,
+		next.DeviceId,
+		next.UserAgent,
+		next.IPAddress,
+		next.CreatedAt,
+		next.ExpiresAt,
+		next.Revoked,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeFamily implements Repo.
+func (r *repo) RevokeFamily(ctx context.Context, familyId ulid.ULID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET
+			revoked = TRUE
+		WHERE family_id = $1
+	`
+
+	if _, err := r.db.Exec(
+		ctx,
+		query,
+		familyId,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeByAccount implements Repo. The session identified by keep, if any,
+// is left untouched.
+func (r *repo) RevokeByAccount(ctx context.Context, accountId, keep ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE refresh_tokens
+		SET
+			revoked = TRUE
+		WHERE account_id = $1 AND family_id <> $2 AND revoked = FALSE
+			AND account_id IN (SELECT id FROM accounts WHERE organization_id = $3)
+	`
+
+	if _, err := r.db.Exec(
+		ctx,
+		query,
+		accountId,
+		keep,
+		org,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeByDevice implements Repo and device.SessionRevoker. Every session
+// opened on the device is revoked.
+func (r *repo) RevokeByDevice(ctx context.Context, deviceId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE refresh_tokens
+		SET
+			revoked = TRUE
+		WHERE device_id = $1 AND revoked = FALSE
+			AND account_id IN (SELECT id FROM accounts WHERE organization_id = $2)
+	`
+
+	if _, err := r.db.Exec(
+		ctx,
+		query,
+		deviceId,
+		org,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type SessionList struct {
+	Sessions []domain.Session `json:"data"`
+	Count    int              `json:"count"`
+}
+
+var emptySessionList = SessionList{
+	Sessions: []domain.Session{},
+	Count:    0,
+}
+
+// sessionQuery selects the live token of each session together with the
+// time its family was started. The caller adds the organization filter on
+// a.organization_id.
+const sessionQuery = `
+	SELECT
+		rt.family_id,
+		rt.account_id,
+		rt.device_name,
+		rt.device_id,
+		rt.user_agent,
+		rt.ip_address,
+		(
+			SELECT MIN(f.created_at)
+			FROM refresh_tokens f
+			WHERE f.family_id = rt.family_id
+		) AS started_at,
+		rt.created_at,
+		rt.expires_at
+	FROM
+		refresh_tokens rt
+	JOIN
+		accounts a
+	ON
+		rt.account_id = a.id
+	WHERE
+		rt.revoked = false
+		AND rt.expires_at > NOW()
+`
+
+func scanSession(row pgx.Row) (*domain.Session, error) {
+	var item domain.Session
+	if err := row.Scan(
+		&item.Id,
+		&item.AccountId,
+		&item.DeviceName,
+		&item.DeviceId,
+		&item.UserAgent,
+		&item.IPAddress,
+		&item.StartedAt,
+		&item.LastUsedAt,
+		&item.ExpiresAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// FetchSessions implements ReadModel.
+func (r *repo) FetchSessions(ctx context.Context, accountId ulid.ULID) (SessionList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptySessionList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		sessionQuery+`
+			AND rt.account_id = $1
+			AND a.organization_id = $2
+		ORDER BY
+			rt.family_id;
+		`,
+		accountId,
+		org,
+	)
+	if err != nil {
+		return emptySessionList, err
+	}
+	defer rows.Close()
+
+	items := []domain.Session{}
+	for rows.Next() {
+		item, err := scanSession(rows)
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptySessionList, err
+		}
+		items = append(items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptySessionList, err
+	}
+	list := SessionList{
+		Sessions: items,
+		Count:    len(items),
+	}
+	return list, nil
+}
+
+// FindSession implements ReadModel.
+func (r *repo) FindSession(ctx context.Context, id ulid.ULID) (*domain.Session, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		sessionQuery+`
+			AND rt.family_id = $1
+			AND a.organization_id = $2;
+		`,
+		id,
+		org,
+	)
+	return scanSession(row)
+}
+
 type Repo interface {
 	Save(ctx context.Context, data *domain.RefreshToken) error
+	SaveSession(ctx context.Context, data *domain.RefreshToken, maxSessions uint, reject bool) error
 	Revoke(ctx context.Context, data *domain.RefreshToken) error
+	Rotate(ctx context.Context, current, next *domain.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyId ulid.ULID) error
+	RevokeByAccount(ctx context.Context, accountId, keep ulid.ULID) error
+	RevokeByDevice(ctx context.Context, deviceId ulid.ULID) error
+	ActivateRole(ctx context.Context, sessionId, accountId, roleId ulid.ULID) error
+	DeactivateRole(ctx context.Context, sessionId, roleId ulid.ULID) error
 }
 
 type ReadModel interface {
-	GetPermissionById(ctx context.Context, id ulid.ULID) (PermissionList, error)
+	GetPermissionById(ctx context.Context, id, storeId, sessionId ulid.ULID) (PermissionList, error)
 	Fetch(ctx context.Context) (RefreshTokenList, error)
 	FindById(ctx context.Context, id ulid.ULID) (*domain.RefreshToken, error)
-	FindByUserID(ctx context.Context, id ulid.ULID) (*domain.RefreshToken, error)
-	FindByToken(ctx context.Context, token string) (*domain.RefreshToken, error)
+	FindByUserID(ctx context.Context, id ulid.ULID) (RefreshTokenList, error)
+	FindByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	FindAnyByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	FetchSessions(ctx context.Context, accountId ulid.ULID) (SessionList, error)
+	FindSession(ctx context.Context, id ulid.ULID) (*domain.Session, error)
+	FetchActiveRoles(ctx context.Context, sessionId ulid.ULID) (ActiveRoleList, error)
 }
+
+// PermissionList holds the effective grants of an account. Permissions
+// are the grants held unconditionally, the only ones that may be put in an
+// access token; Conditional are the grants only held under a condition,
+// once per distinct condition. Denied are the denials that apply to the
+// account; a denial beats any grant, see authz.PermissionSet.
 type PermissionList struct {
-	Permissions []string `json:"data"`
-	Count       int      `json:"count"`
+	Permissions []string                  `json:"data"`
+	Conditional []domain.ConditionalGrant `json:"conditional"`
+	Denied      []domain.DeniedGrant      `json:"denied"`
+	Count       int                       `json:"count"`
 }
 
 var emptyPermissionList = PermissionList{
 	Permissions: make([]string, 0),
+	Conditional: make([]domain.ConditionalGrant, 0),
+	Denied:      make([]domain.DeniedGrant, 0),
 	Count:       0,
 }
 
-// GetPermissionById implements ReadModel.
-func (r *repo) GetPermissionById(ctx context.Context, id ulid.ULID) (PermissionList, error) {
-	var itemCount int
-	var urls []string
+// GetPermissionById implements ReadModel. It covers the roles assigned to
+// the account in every store plus, unless storeId is the zero ULID, the
+// roles assigned in that store, and every role they inherit from.
+// Assignments outside of their validity window are left out, as are the
+// roles of dynamic constraints not activated in sessionId, assigned or
+// inherited, see effectiveRoles.
+// Conditional grants and denials are listed apart, see PermissionList.
+// Permissions are returned in grant form, one "METHOD url" entry per method,
+// see domain.FormatGrant.
+func (r *repo) GetPermissionById(ctx context.Context, id, storeId, sessionId ulid.ULID) (PermissionList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyPermissionList, err
+	}
+	tree, err := r.fetchRoleTree(ctx, id, storeId, sessionId)
+	if err != nil {
+		return emptyPermissionList, err
+	}
+	roleIds := effectiveRoles(tree)
 	rows, err := r.db.Query(
 		ctx,
 		`
-			SELECT p.url, COUNT(p.url) AS url_count
-			FROM account_roles ar
-			JOIN role_permissions rp ON ar.role_id = rp.role_id
+			SELECT DISTINCT p.url, COALESCE(m.method, '') AS method, rp.condition
+			FROM role_permissions rp
 			JOIN permissions p ON rp.permission_id = p.id
-			WHERE ar.account_id = $1
-			GROUP BY p.url;
+			LEFT JOIN LATERAL unnest(p.methods) AS m(method) ON TRUE
+			WHERE rp.role_id = ANY($1::bytea[]) AND p.organization_id = $2
+			ORDER BY p.url, method, rp.condition;
 		`,
-		id,
+		roleIds,
+		org,
 	)
 	if err != nil {
 		return emptyPermissionList, err
 	}
 	defer rows.Close()
+
+	grants := []string{}
+	conditional := []domain.ConditionalGrant{}
+	// Rows come ordered by grant with the empty condition first, so a grant
+	// held unconditionally through one role drops its conditional rows.
+	unconditional := map[string]bool{}
 	for rows.Next() {
 		var url string
-		var count int
-		if err := rows.Scan(&url, &count); err != nil {
+		var method string
+		var condition string
+		if err := rows.Scan(&url, &method, &condition); err != nil {
 			return emptyPermissionList, err
 		}
-		urls = append(urls, url)
-		itemCount++
+		grant := domain.FormatGrant(method, url)
+		switch {
+		case condition == "":
+			unconditional[grant] = true
+			grants = append(grants, grant)
+		case !unconditional[grant]:
+			conditional = append(conditional, domain.ConditionalGrant{
+				Grant:     grant,
+				Condition: condition,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return emptyPermissionList, err
+	}
+	rows.Close()
+
+	denied, err := r.fetchDenied(ctx, id, roleIds, org)
+	if err != nil {
+		return emptyPermissionList, err
 	}
 	list := PermissionList{
-		Permissions: urls,
-		Count:       itemCount,
+		Permissions: grants,
+		Conditional: conditional,
+		Denied:      denied,
+		Count:       len(grants) + len(conditional),
 	}
 	return list, nil
 }
 
+// fetchDenied returns the denials applying to an account holding roleIds:
+// its own denials first, then those of the roles ordered by role name,
+// each once per denied grant.
+func (r *repo) fetchDenied(ctx context.Context, id ulid.ULID, roleIds []ulid.ULID, org ulid.ULID) ([]domain.DeniedGrant, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				0 AS rank,
+				NULL::bytea AS role_id,
+				'' AS role_name,
+				p.id,
+				p.url,
+				COALESCE(m.method, '') AS method,
+				ad.reason
+			FROM account_denials ad
+			JOIN permissions p ON ad.permission_id = p.id
+			LEFT JOIN LATERAL unnest(p.methods) AS m(method) ON TRUE
+			WHERE ad.account_id = $1 AND p.organization_id = $3
+			UNION ALL
+			SELECT DISTINCT
+				1 AS rank,
+				r.id,
+				r.name,
+				p.id,
+				p.url,
+				COALESCE(m.method, '') AS method,
+				rd.reason
+			FROM role_denials rd
+			JOIN roles r ON rd.role_id = r.id
+			JOIN permissions p ON rd.permission_id = p.id
+			LEFT JOIN LATERAL unnest(p.methods) AS m(method) ON TRUE
+			WHERE rd.role_id = ANY($2::bytea[]) AND p.organization_id = $3
+			ORDER BY rank, role_name, role_id, url, method;
+		`,
+		id,
+		roleIds,
+		org,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	denied := []domain.DeniedGrant{}
+	for rows.Next() {
+		var rank int
+		var item domain.DeniedGrant
+		var url string
+		var method string
+		if err := rows.Scan(
+			&rank,
+			&item.RoleId,
+			&item.RoleName,
+			&item.PermissionId,
+			&url,
+			&method,
+			&item.Reason,
+		); err != nil {
+			return nil, err
+		}
+		item.On = domain.DenialOnAccount
+		if item.RoleId != nil {
+			item.On = domain.DenialOnRole
+		}
+		item.Grant = domain.FormatGrant(method, url)
+		denied = append(denied, item)
+	}
+	return denied, rows.Err()
+}
+
 func NewRepo(db *pgxpool.Pool) Repo {
 	return &repo{db: db}
 }
@@ -338,3 +766,9 @@ func NewRepo(db *pgxpool.Pool) Repo {
 func NewReadModel(db *pgxpool.Pool) ReadModel {
 	return &repo{db: db}
 }
+
+// NewReadModelTx reads through tx, so that it sees the uncommitted changes
+// made in it.
+func NewReadModelTx(tx pgx.Tx) ReadModel {
+	return &repo{db: tx}
+}
@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"context"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// roleNode is a role of the tree of an account: whether it is assigned to
+// the account directly, whether it belongs to a dynamic separation of
+// duties constraint and is activated in the session, and the roles it
+// inherits from.
+type roleNode struct {
+	assigned bool
+	dynamic  bool
+	active   bool
+	parents  []ulid.ULID
+}
+
+// fetchRoleTree returns every role account id holds in storeId, directly
+// or by inheritance, whatever the dynamic constraints; see effectiveRoles
+// for the roles that count. Assignments outside of their validity window
+// are left out.
+func (r *repo) fetchRoleTree(ctx context.Context, id, storeId, sessionId ulid.ULID) (map[ulid.ULID]*roleNode, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+			WITH RECURSIVE assigned(role_id) AS (
+				SELECT ar.role_id
+				FROM account_roles ar
+				WHERE ar.account_id = $1 AND (ar.store_id IS NULL OR ar.store_id = $2)
+					AND (ar.valid_from IS NULL OR ar.valid_from <= NOW())
+					AND (ar.valid_until IS NULL OR ar.valid_until > NOW())
+			), account_role_tree(role_id) AS (
+				SELECT role_id FROM assigned
+				UNION
+				SELECT rp.parent_id
+				FROM role_parents rp
+				JOIN account_role_tree t ON rp.role_id = t.role_id
+			)
+			SELECT
+				t.role_id,
+				rp.parent_id,
+				EXISTS (
+					SELECT 1 FROM assigned a WHERE a.role_id = t.role_id
+				),
+				EXISTS (
+					SELECT 1
+					FROM sod_constraint_roles cr
+					JOIN sod_constraints c ON cr.constraint_id = c.id
+					WHERE cr.role_id = t.role_id AND c.kind = 'dynamic'
+				),
+				EXISTS (
+					SELECT 1
+					FROM session_roles sr
+					WHERE sr.session_id = $3 AND sr.role_id = t.role_id
+				)
+			FROM account_role_tree t
+			LEFT JOIN role_parents rp ON rp.role_id = t.role_id;
+		`,
+		id,
+		storeId,
+		sessionId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tree := map[ulid.ULID]*roleNode{}
+	for rows.Next() {
+		var roleId ulid.ULID
+		var parentId *ulid.ULID
+		var node roleNode
+		if err := rows.Scan(
+			&roleId,
+			&parentId,
+			&node.assigned,
+			&node.dynamic,
+			&node.active,
+		); err != nil {
+			return nil, err
+		}
+		current, ok := tree[roleId]
+		if !ok {
+			current = &node
+			tree[roleId] = current
+		}
+		if parentId != nil {
+			current.parents = append(current.parents, *parentId)
+		}
+	}
+	return tree, rows.Err()
+}
+
+// effectiveRoles returns the roles of tree the account holds in the
+// session: the assigned roles and their ancestors, except that a role of
+// a dynamic constraint only counts once activated. A role left out is not
+// walked through either, so a role inheriting both roles of a dynamic
+// constraint does not hand them out together.
+func effectiveRoles(tree map[ulid.ULID]*roleNode) []ulid.ULID {
+	counts := func(id ulid.ULID) bool {
+		node, ok := tree[id]
+		return ok && (!node.dynamic || node.active)
+	}
+	res := []ulid.ULID{}
+	seen := map[ulid.ULID]bool{}
+	queue := []ulid.ULID{}
+	for id, node := range tree {
+		if node.assigned {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] || !counts(id) {
+			continue
+		}
+		seen[id] = true
+		res = append(res, id)
+		queue = append(queue, tree[id].parents...)
+	}
+	return res
+}
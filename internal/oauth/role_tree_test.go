@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+func TestEffectiveRolesInheritedDynamicPair(t *testing.T) {
+	supervisor := ulid.Make()
+	cashier := ulid.Make()
+	refunds := ulid.Make()
+	base := ulid.Make()
+	shared := ulid.Make()
+
+	// supervisor inherits cashier and refunds, the two roles of a dynamic
+	// constraint; refunds inherits base, and both inherit shared.
+	newTree := func(active ...ulid.ULID) map[ulid.ULID]*roleNode {
+		tree := map[ulid.ULID]*roleNode{
+			supervisor: {assigned: true, parents: []ulid.ULID{cashier, refunds}},
+			cashier:    {dynamic: true, parents: []ulid.ULID{shared}},
+			refunds:    {dynamic: true, parents: []ulid.ULID{base, shared}},
+			base:       {},
+			shared:     {},
+		}
+		for _, id := range active {
+			tree[id].active = true
+		}
+		return tree
+	}
+
+	tests := []struct {
+		name string
+		tree map[ulid.ULID]*roleNode
+		want []ulid.ULID
+	}{
+		{
+			name: "nothing activated",
+			tree: newTree(),
+			want: []ulid.ULID{supervisor},
+		},
+		{
+			name: "cashier activated",
+			tree: newTree(cashier),
+			want: []ulid.ULID{supervisor, cashier, shared},
+		},
+		{
+			name: "refunds activated",
+			tree: newTree(refunds),
+			want: []ulid.ULID{supervisor, refunds, base, shared},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := effectiveRoles(tt.tree)
+			sortIds(got)
+			want := append([]ulid.ULID{}, tt.want...)
+			sortIds(want)
+			if len(got) != len(want) {
+				t.Fatalf("effectiveRoles() = %v, want %v", got, want)
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("effectiveRoles() = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEffectiveRolesAssignedDynamicRole(t *testing.T) {
+	cashier := ulid.Make()
+	tree := map[ulid.ULID]*roleNode{
+		cashier: {assigned: true, dynamic: true},
+	}
+	if got := effectiveRoles(tree); len(got) != 0 {
+		t.Fatalf("effectiveRoles() = %v, want none before activation", got)
+	}
+	tree[cashier].active = true
+	if got := effectiveRoles(tree); len(got) != 1 || got[0] != cashier {
+		t.Fatalf("effectiveRoles() = %v, want [%v]", got, cashier)
+	}
+}
+
+func sortIds(ids []ulid.ULID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Compare(ids[j]) < 0
+	})
+}
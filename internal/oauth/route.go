@@ -1,50 +1,54 @@
 package oauth
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"io"
+	"net"
 	"net/http"
 	"pos/domain"
+	"pos/internal/account"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/keyring"
 	"pos/utils/httpresponse"
+	"pos/utils/key"
 	"strings"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
 )
 
 type accountRoute struct {
-	svc          ServiceOAuth
-	secret       string
-	refreshToken uint
+	svc     ServiceOAuth
+	keyring *keyring.Keyring
 }
 
 func NewRoute(
 	svc ServiceOAuth,
-	secret string,
-	refreshToken uint,
+	keyring *keyring.Keyring,
 ) *accountRoute {
 	return &accountRoute{
-		svc:          svc,
-		secret:       secret,
-		refreshToken: refreshToken,
+		svc:     svc,
+		keyring: keyring,
 	}
 }
 
 func (p *accountRoute) Routes() *chi.Mux {
 	r := chi.NewMux()
 	r.Post("/login", p.login)
+	r.Post("/login/pin", p.pinLogin)
 	r.Post("/logout", p.logout)
 	r.Post("/request-token", p.requestaccesstoken)
 	return r
 }
 
 type loginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"`
 }
 
 func (c loginRequest) Validate() error {
@@ -52,9 +56,23 @@ func (c loginRequest) Validate() error {
 		&c,
 		validation.Field(&c.Email, validation.Required, is.Email),
 		validation.Field(&c.Password, validation.Required, validation.Length(8, 32)),
+		validation.Field(&c.DeviceName, validation.Length(0, 255)),
 	)
 }
 
+// sessionMeta collects the client details stored alongside a new session.
+func sessionMeta(r *http.Request, deviceName string) domain.SessionMeta {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return domain.SessionMeta{
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		IPAddress:  ip,
+	}
+}
+
 func (p *accountRoute) logout(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -72,17 +90,6 @@ func (p *accountRoute) logout(
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	cookie := http.Cookie{
-		Name:     "permissions",
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	}
-	http.SetCookie(w, &cookie)
-
 	httpresponse.WriteMessage(w, http.StatusOK, "success logout")
 }
 
@@ -101,28 +108,74 @@ func (p *accountRoute) login(
 		return
 	}
 
+	// Credentials of a device bind the session to it.
+	device, err := custommiddleware.RequestDevice(r)
+	if err != nil && !errors.Is(err, custommiddleware.ErrDeviceRequired) {
+		httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
+		return
+	}
+
 	ctx := r.Context()
 
-	data, permissions, err := p.svc.Login(ctx, body.Email, body.Password)
+	data, err := p.svc.Login(ctx, body.Email, body.Password, sessionMeta(r, body.DeviceName), device)
 	if err != nil {
+		if errors.Is(err, account.ErrPasswordLocked) {
+			httpresponse.WriteError(w, http.StatusLocked, err)
+			return
+		}
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	listPermission := strings.Join(permissions, ",")
-	maxAge := p.refreshToken * 3600 * 24
-	valuuEncrypted := base64.URLEncoding.EncodeToString([]byte(listPermission))
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+type pinLoginRequest struct {
+	AccountId ulid.ULID `json:"account_id"`
+	Pin       string    `json:"pin"`
+}
+
+func (c pinLoginRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.AccountId, validation.Required),
+		validation.Field(&c.Pin, validation.Required, validation.Length(4, 8), is.Digit),
+	)
+}
 
-	cookie := http.Cookie{
-		Name:     "permissions",
-		Value:    valuuEncrypted,
-		Path:     "/",
-		MaxAge:   int(maxAge),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
+// pinLogin signs an account in with its PIN on the device authenticated by
+// the request headers, see custommiddleware.RequestDevice.
+func (p *accountRoute) pinLogin(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	device, err := custommiddleware.RequestDevice(r)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusUnauthorized, custommiddleware.ErrDeviceRequired)
+		return
+	}
+	var body pinLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	data, err := p.svc.PinLogin(ctx, device, body.AccountId, body.Pin, sessionMeta(r, ""))
+	if err != nil {
+		if errors.Is(err, account.ErrPinLocked) {
+			httpresponse.WriteError(w, http.StatusLocked, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
 	}
-	http.SetCookie(w, &cookie)
 
 	httpresponse.WriteData(w, http.StatusOK, data, nil)
 }
@@ -152,12 +205,9 @@ func (h *accountRoute) requestaccesstoken(
 
 	jwtToken := splittedToken[1]
 	claims := &domain.Oauth{}
-	token, err := jwt.ParseWithClaims(
+	token, err := h.keyring.Parse(
 		jwtToken,
 		claims,
-		func(t *jwt.Token) (interface{}, error) {
-			return []byte(h.secret), nil
-		},
 	)
 
 	if err != nil && !errors.Is(err, jwt.ErrTokenExpired) {
@@ -166,8 +216,22 @@ func (h *accountRoute) requestaccesstoken(
 		return
 	}
 	claims = token.Claims.(*domain.Oauth)
+	// The audience is checked apart: an expired token of another kind
+	// would otherwise pass as expired.
+	if !hasAudience(claims.Audience, domain.AudienceAccess) {
+		httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
+		ctx.Done()
+		return
+	}
+
+	device, err := custommiddleware.RequestDevice(r)
+	if err != nil && !errors.Is(err, custommiddleware.ErrDeviceRequired) {
+		httpresponse.WriteError(w, http.StatusUnauthorized, errors.New(http.StatusText((http.StatusUnauthorized))))
+		ctx.Done()
+		return
+	}
 
-	accessToken, err := h.svc.RefreshToken(ctx, body.Token, claims.Id, claims.Email)
+	data, err := h.svc.RefreshToken(ctx, body.Token, claims.Id, claims.OrganizationId, device)
 	if err != nil {
 		httpresponse.WriteError(w, http.StatusUnauthorized, err)
 		ctx.Done()
@@ -180,5 +244,300 @@ func (h *accountRoute) requestaccesstoken(
 		return
 	}
 
-	httpresponse.WriteData(w, http.StatusOK, accessToken, nil)
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+type sessionRoute struct {
+	svc SessionService
+}
+
+func NewSessionRoute(
+	svc SessionService,
+) *sessionRoute {
+	return &sessionRoute{
+		svc: svc,
+	}
+}
+
+func (p *sessionRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Get("/me", p.getMySessions)
+	r.Get("/me/roles", p.getMyActiveRoles)
+	r.Post("/me/roles", p.activateMyRole)
+	r.Delete("/me/roles/{roleId}", p.deactivateMyRole)
+	r.Post("/revoke-all", p.revokeAllMySessions)
+	r.Get("/{id}", p.getMySession)
+	r.Delete("/{id}", p.revokeMySession)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("user-management"))
+		r.Get("/account/{id}", p.getAccountSessions)
+		r.Post("/account/{id}/revoke-all", p.revokeAllAccountSessions)
+		r.Delete("/account/{id}/{sid}", p.revokeAccountSession)
+	})
+	return r
+}
+
+func (p *sessionRoute) getMySessions(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.ListSessions(ctx, token.Id, token.SessionId)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Sessions, meta)
+}
+
+func (p *sessionRoute) getMySession(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.GetSession(ctx, token.Id, id, token.SessionId)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *sessionRoute) revokeMySession(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.svc.RevokeSession(ctx, token.Id, id); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success revoke session")
+}
+
+type revokeAllRequest struct {
+	KeepCurrent bool `json:"keep_current"`
+}
+
+func (p *sessionRoute) revokeAllMySessions(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body revokeAllRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	var keep ulid.ULID
+	if body.KeepCurrent {
+		keep = token.SessionId
+	}
+	if err := p.svc.RevokeAllSessions(ctx, token.Id, keep); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success revoke sessions")
+}
+
+func (p *sessionRoute) getAccountSessions(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.ListSessions(ctx, id, ulid.ULID{})
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Sessions, meta)
+}
+
+func (p *sessionRoute) revokeAccountSession(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	id, err := ulid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	sid, err := ulid.Parse(chi.URLParam(r, "sid"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.svc.RevokeSession(ctx, id, sid); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success revoke session")
+}
+
+func (p *sessionRoute) revokeAllAccountSessions(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.svc.RevokeAllSessions(ctx, id, ulid.ULID{}); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success revoke sessions")
+}
+
+type activateRoleRequest struct {
+	RoleId ulid.ULID `json:"role_id" validate:"required"`
+}
+
+func (c activateRoleRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.RoleId, validation.Required),
+	)
+}
+
+func (p *sessionRoute) getMyActiveRoles(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.GetActiveRoles(ctx, token.Id, token.SessionId)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Roles, meta)
+}
+
+func (p *sessionRoute) activateMyRole(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body activateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.svc.ActivateRole(ctx, token.Id, token.SessionId, body.RoleId); err != nil {
+		var constraintErr *domain.ConstraintError
+		if errors.As(err, &constraintErr) {
+			httpresponse.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success activate role")
+}
+
+func (p *sessionRoute) deactivateMyRole(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	roleId, err := ulid.Parse(chi.URLParam(r, "roleId"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.svc.DeactivateRole(ctx, token.Id, token.SessionId, roleId); err != nil {
+		if errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrSessionRoleNotActive) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success deactivate role")
+}
+
+// hasAudience reports whether aud is one of audiences.
+func hasAudience(audiences jwt.ClaimStrings, aud string) bool {
+	for _, a := range audiences {
+		if a == aud {
+			return true
+		}
+	}
+	return false
 }
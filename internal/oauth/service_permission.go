@@ -0,0 +1,55 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/store"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type permissionSource struct {
+	readModel      ReadModel
+	storeReadModel store.ReadModel
+}
+
+// NewPermissionSource backs authz.Resolver with GetPermissionById, and with
+// the store time zones for time conditions.
+func NewPermissionSource(readModel ReadModel, storeReadModel store.ReadModel) authz.PermissionSource {
+	return &permissionSource{
+		readModel:      readModel,
+		storeReadModel: storeReadModel,
+	}
+}
+
+// EffectiveGrants implements authz.PermissionSource.
+func (p *permissionSource) EffectiveGrants(ctx context.Context, subject authz.Subject) (authz.Grants, error) {
+	list, err := p.readModel.GetPermissionById(ctx, subject.AccountId, subject.StoreId, subject.SessionId)
+	if err != nil {
+		return authz.Grants{}, err
+	}
+	allowed := make([]domain.ConditionalGrant, 0, list.Count)
+	for _, grant := range list.Permissions {
+		allowed = append(allowed, domain.ConditionalGrant{Grant: grant})
+	}
+	return authz.Grants{
+		Allowed: append(allowed, list.Conditional...),
+		Denied:  list.Denied,
+	}, nil
+}
+
+// StoreLocation implements authz.PermissionSource. A store that is not one
+// of the organization of ctx is authz.ErrUnknownStore.
+func (p *permissionSource) StoreLocation(ctx context.Context, storeId ulid.ULID) (*time.Location, error) {
+	data, err := p.storeReadModel.FindById(ctx, storeId)
+	if errors.Is(err, store.ErrStoreNotFound) {
+		return nil, authz.ErrUnknownStore
+	}
+	if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(data.Timezone)
+}
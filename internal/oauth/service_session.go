@@ -0,0 +1,113 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type SessionService interface {
+	ListSessions(ctx context.Context, uid, current ulid.ULID) (SessionList, error)
+	GetSession(ctx context.Context, uid, sid, current ulid.ULID) (*domain.Session, error)
+	RevokeSession(ctx context.Context, uid, sid ulid.ULID) error
+	RevokeAllSessions(ctx context.Context, uid, keep ulid.ULID) error
+	IsActive(ctx context.Context, sid ulid.ULID) (bool, error)
+	GetActiveRoles(ctx context.Context, uid, sid ulid.ULID) (ActiveRoleList, error)
+	ActivateRole(ctx context.Context, uid, sid, roleId ulid.ULID) error
+	DeactivateRole(ctx context.Context, uid, sid, roleId ulid.ULID) error
+}
+
+type serviceSession struct {
+	repo      Repo
+	readModel ReadModel
+}
+
+func NewSessionService(
+	repo Repo,
+	readModel ReadModel,
+) SessionService {
+	return &serviceSession{
+		repo:      repo,
+		readModel: readModel,
+	}
+}
+
+// ListSessions implements SessionService. The session matching current, if
+// any, is flagged so clients can tell which one they are using.
+func (s *serviceSession) ListSessions(ctx context.Context, uid, current ulid.ULID) (SessionList, error) {
+	list, err := s.readModel.FetchSessions(ctx, uid)
+	if err != nil {
+		return list, err
+	}
+	for i := range list.Sessions {
+		list.Sessions[i].Current = list.Sessions[i].Id == current
+	}
+	return list, nil
+}
+
+// GetSession implements SessionService.
+func (s *serviceSession) GetSession(ctx context.Context, uid, sid, current ulid.ULID) (*domain.Session, error) {
+	data, err := s.readModel.FindSession(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	if data.AccountId != uid {
+		return nil, ErrSessionNotFound
+	}
+	data.Current = data.Id == current
+	return data, nil
+}
+
+// RevokeSession implements SessionService.
+func (s *serviceSession) RevokeSession(ctx context.Context, uid, sid ulid.ULID) error {
+	data, err := s.GetSession(ctx, uid, sid, ulid.ULID{})
+	if err != nil {
+		return err
+	}
+	return s.repo.RevokeFamily(ctx, data.Id)
+}
+
+// RevokeAllSessions implements SessionService. Pass the zero ULID as keep to
+// revoke every session of the account.
+func (s *serviceSession) RevokeAllSessions(ctx context.Context, uid, keep ulid.ULID) error {
+	return s.repo.RevokeByAccount(ctx, uid, keep)
+}
+
+// IsActive implements SessionService.
+func (s *serviceSession) IsActive(ctx context.Context, sid ulid.ULID) (bool, error) {
+	_, err := s.readModel.FindSession(ctx, sid)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetActiveRoles implements SessionService.
+func (s *serviceSession) GetActiveRoles(ctx context.Context, uid, sid ulid.ULID) (ActiveRoleList, error) {
+	if _, err := s.GetSession(ctx, uid, sid, ulid.ULID{}); err != nil {
+		return emptyActiveRoleList, err
+	}
+	return s.readModel.FetchActiveRoles(ctx, sid)
+}
+
+// ActivateRole implements SessionService. The role must be one of a dynamic
+// separation of duties constraint, see Repo.ActivateRole.
+func (s *serviceSession) ActivateRole(ctx context.Context, uid, sid, roleId ulid.ULID) error {
+	if _, err := s.GetSession(ctx, uid, sid, ulid.ULID{}); err != nil {
+		return err
+	}
+	return s.repo.ActivateRole(ctx, sid, uid, roleId)
+}
+
+// DeactivateRole implements SessionService.
+func (s *serviceSession) DeactivateRole(ctx context.Context, uid, sid, roleId ulid.ULID) error {
+	if _, err := s.GetSession(ctx, uid, sid, ulid.ULID{}); err != nil {
+		return err
+	}
+	return s.repo.DeactivateRole(ctx, sid, roleId)
+}
@@ -2,153 +2,338 @@ package oauth
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"pos/domain"
 	"pos/internal/account"
+	"pos/internal/keyring"
 	"pos/internal/permission"
 	"pos/internal/role"
+	"pos/internal/tenant"
 	"pos/utils"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/oklog/ulid/v2"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/rs/zerolog/log"
 )
 
 var (
-	ErrPasswordWrong = errors.New("login: wrong password")
-	ErrAlreadyLogin  = errors.New("login: already login")
+	ErrPasswordWrong   = errors.New("login: wrong password")
+	ErrTooManySessions = errors.New("login: too many active sessions")
+	ErrDeviceMismatch  = errors.New("login: session bound to another device")
 )
 
+// refreshTokenBytes is the amount of entropy in a refresh token.
+const refreshTokenBytes = 32
+
+// Session limit policies applied when an account reaches its session cap.
+const (
+	SessionLimitEvictOldest = "evict_oldest"
+	SessionLimitReject      = "reject"
+)
+
+var ErrUnknownLimitPolicy = errors.New("session: unknown limit policy")
+
+// ValidateLimitPolicy makes sure policy is one of the session limit
+// policies, so that a typo is not taken for another policy.
+func ValidateLimitPolicy(policy string) error {
+	switch policy {
+	case SessionLimitEvictOldest, SessionLimitReject:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownLimitPolicy, policy)
+}
+
+// DeviceGuard counts the wrong PINs keyed in on a device, see PinLogin.
+type DeviceGuard interface {
+	RecordPinFailure(ctx context.Context, id ulid.ULID) error
+	ClearPinFailures(ctx context.Context, id ulid.ULID) error
+}
+
 type serviceOauth struct {
 	roleReadModel       role.ReadModel
 	permissionReadModel permission.ReadModel
 	accountReadModel    account.ReadModel
+	pins                account.PinService
+	passwords           account.PasswordService
+	devices             DeviceGuard
 	repo                Repo
 	readModel           ReadModel
-	secret              string
+	keyring             *keyring.Keyring
+	tokenPepper         string
 	refreshExpTime      uint
 	accessExpTime       uint
+	maxSessions         uint
+	sessionLimitPolicy  string
 }
 
-func (s *serviceOauth) RefreshToken(ctx context.Context, refreshToken string, uid ulid.ULID, email string) (accessToken string, err error) {
-	_, err = s.readModel.FindByToken(ctx, refreshToken)
+// RefreshToken implements ServiceOAuth. Every call rotates the refresh token:
+// the presented token is revoked and a new one is issued in the same family.
+// Presenting a token that was already rotated or logged out revokes the whole
+// family, since it means the token has been copied. uid and org come from
+// the previous access token; device is the device the request comes from,
+// nil if none, and must be the one a device bound session was opened on.
+func (s *serviceOauth) RefreshToken(ctx context.Context, refreshToken string, uid, org ulid.ULID, device *domain.Device) (*domain.LoginResponse, error) {
+	ctx = tenant.WithOrganization(ctx, org)
+	current, err := s.readModel.FindAnyByTokenHash(ctx, s.hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if current.UserID != uid {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if current.Revoked {
+		log.Warn().
+			Str("account", current.UserID.String()).
+			Str("family", current.FamilyID.String()).
+			Msg("refresh token reuse detected, revoking token family")
+		if err := s.repo.RevokeFamily(ctx, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if !current.ExpiresAt.After(time.Now()) {
+		return nil, ErrRefreshTokenExpired
+	}
+	if current.DeviceId != nil && (device == nil || device.Id != *current.DeviceId) {
+		return nil, ErrDeviceMismatch
+	}
+
+	refreshExpTime := time.Now().Add(time.Duration(s.refreshExpTime) * 24 * time.Hour)
+	tokenRefreshString, err := utils.RandToken(refreshTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	next := domain.NewRotatedRefreshToken(current, s.hashToken(tokenRefreshString), refreshExpTime)
+	if err := s.repo.Rotate(ctx, current, &next); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			if err := s.repo.RevokeFamily(ctx, current.FamilyID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	acc, err := s.accountReadModel.FindById(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.readModel.GetPermissionById(ctx, uid, ulid.ULID{}, next.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenAccessString, err := s.signAccessToken(acc, next.FamilyID, next.DeviceId, permissions)
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	return &domain.LoginResponse{
+		AccessToken:  tokenAccessString,
+		RefreshToken: tokenRefreshString,
+		Type:         "Bearer",
+		ExpiredAt:    refreshExpTime.Format(time.RFC3339),
+		Scope:        "*",
+	}, nil
+}
+
+// hashToken derives the value stored for a refresh token. The pepper never
+// reaches the database, so a dump of refresh_tokens holds no usable tokens.
+func (s *serviceOauth) hashToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(s.tokenPepper))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signAccessToken issues an access token carrying the account's effective
+// permissions, so they are covered by the token signature. Only roles valid
+// in every store are carried; store scoped roles and conditional grants are
+// resolved per request. Denials are carried too, so that they still beat
+// the carried grants. deviceId binds the token to the device of the
+// session.
+func (s *serviceOauth) signAccessToken(acc *domain.Account, sid ulid.ULID, deviceId *ulid.ULID, permissions PermissionList) (string, error) {
+	denials := make([]string, 0, len(permissions.Denied))
+	for _, d := range permissions.Denied {
+		denials = append(denials, d.Grant)
 	}
-	jwtKey := []byte(s.secret)
 	accessExpTime := time.Now().Add(time.Duration(s.accessExpTime) * time.Hour)
 	claims := &domain.Oauth{
-		Id:    uid,
-		Email: email,
+		Id:             acc.Id,
+		OrganizationId: acc.OrganizationId,
+		Email:          acc.Email,
+		SessionId:      sid,
+		Permissions:    permissions.Permissions,
+		Denials:        denials,
+		DeviceId:       deviceId,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{domain.AudienceAccess},
 			ExpiresAt: jwt.NewNumericDate(accessExpTime),
 		},
 	}
-	tokenAccess := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return tokenAccess.SignedString(jwtKey)
+	return s.keyring.Sign(claims)
 }
 
-// Login implements ServiceOAuth.
-func (s *serviceOauth) Login(ctx context.Context, email, password string) (res *domain.LoginResponse, permissions []string, err error) {
+// Login implements ServiceOAuth. Each login opens a new session; when the
+// account already holds maxSessions live sessions the configured limit
+// policy either evicts the oldest ones or rejects the login. A login on a
+// device, not nil, opens a session bound to it; the device must belong to
+// the organization of the account. Wrong passwords count towards the
+// lockout of account.PasswordService, the one approvers of overrides are
+// held to as well.
+func (s *serviceOauth) Login(ctx context.Context, email, password string, meta domain.SessionMeta, device *domain.Device) (*domain.LoginResponse, error) {
 	acc, err := s.accountReadModel.FindByEmail(ctx, email)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(
-		[]byte(acc.Password),
-		[]byte(password),
-	); err != nil {
-		return nil, permissions, ErrPasswordWrong
+	ctx = tenant.WithOrganization(ctx, acc.OrganizationId)
+	if err := s.passwords.VerifyPassword(ctx, acc.Id, password); err != nil {
+		if errors.Is(err, account.ErrPasswordWrong) {
+			return nil, ErrPasswordWrong
+		}
+		return nil, err
 	}
+	if device != nil {
+		if device.OrganizationId != acc.OrganizationId {
+			return nil, ErrDeviceMismatch
+		}
+		meta = deviceMeta(meta, device)
+	}
+	return s.openSession(ctx, acc, meta)
+}
 
-	refreshExpTime := time.Now().Add(time.Duration(s.refreshExpTime) * 24 * time.Hour)
-
-	jwtKey := []byte(s.secret)
-	tokenRefreshString := utils.RandString(24)
+// deviceMeta binds meta to device.
+func deviceMeta(meta domain.SessionMeta, device *domain.Device) domain.SessionMeta {
+	deviceId := device.Id
+	meta.DeviceId = &deviceId
+	meta.DeviceName = device.Name
+	return meta
+}
 
-	accessExpTime := time.Now().Add(time.Duration(s.accessExpTime) * time.Hour)
-	claims := &domain.Oauth{
-		Id:    acc.Id,
-		Email: acc.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(accessExpTime),
-		},
+// PinLogin implements ServiceOAuth. The account signs in on device with its
+// PIN, see account.PinService.VerifyPin, and must belong to the
+// organization of the device. The session opened is bound to the device.
+// A wrong PIN, or an account without a PIN or outside of the organization,
+// counts as a failure of the device, see DeviceGuard; a right PIN clears
+// them.
+func (s *serviceOauth) PinLogin(ctx context.Context, device *domain.Device, accountId ulid.ULID, pin string, meta domain.SessionMeta) (*domain.LoginResponse, error) {
+	ctx = tenant.WithOrganization(ctx, device.OrganizationId)
+	acc, err := s.accountReadModel.FindById(ctx, accountId)
+	if err == nil {
+		err = s.pins.VerifyPin(ctx, acc.Id, pin)
 	}
-	tokenAccess := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenAccessString, errSign := tokenAccess.SignedString(jwtKey)
-	if errSign != nil {
-		err = errSign
-		return
+	if err != nil {
+		if errors.Is(err, account.ErrAccountNotFound) ||
+			errors.Is(err, account.ErrPinNotSet) ||
+			errors.Is(err, account.ErrPinWrong) {
+			if err := s.devices.RecordPinFailure(ctx, device.Id); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
 	}
+	if err := s.devices.ClearPinFailures(ctx, device.Id); err != nil {
+		return nil, err
+	}
+	return s.openSession(ctx, acc, deviceMeta(meta, device))
+}
 
-	oauthToken := domain.LoginResponse{
-		AccessToken:  tokenAccessString,
-		RefreshToken: tokenRefreshString,
-		Type:         "Bearer",
-		ExpiredAt:    refreshExpTime.Format(time.RFC3339),
-		Scope:        "*",
+// openSession issues the tokens of a new session of acc.
+func (s *serviceOauth) openSession(ctx context.Context, acc *domain.Account, meta domain.SessionMeta) (*domain.LoginResponse, error) {
+	refreshExpTime := time.Now().Add(time.Duration(s.refreshExpTime) * 24 * time.Hour)
+
+	tokenRefreshString, err := utils.RandToken(refreshTokenBytes)
+	if err != nil {
+		return nil, err
 	}
 
 	refreshToken := domain.NewRefreshToken(
 		acc.Id,
-		tokenRefreshString,
+		s.hashToken(tokenRefreshString),
 		refreshExpTime,
+		meta,
 	)
 
-	data, err := s.readModel.GetPermissionById(ctx, acc.Id)
+	permissions, err := s.readModel.GetPermissionById(ctx, acc.Id, ulid.ULID{}, refreshToken.FamilyID)
 	if err != nil {
-		return
+		return nil, err
 	}
-	permissions = data.Permissions
 
-	_, err = s.readModel.FindByUserID(ctx, acc.Id)
-	if errors.Is(err, ErrRefreshTokenNotFound) {
-		err = s.repo.Save(ctx, &refreshToken)
-		if err != nil {
-			return
-		}
+	tokenAccessString, err := s.signAccessToken(acc, refreshToken.FamilyID, meta.DeviceId, permissions)
+	if err != nil {
+		return nil, err
+	}
 
-		return &oauthToken, permissions, nil
+	if err := s.repo.SaveSession(
+		ctx,
+		&refreshToken,
+		s.maxSessions,
+		s.sessionLimitPolicy == SessionLimitReject,
+	); err != nil {
+		return nil, err
 	}
-	err = ErrAlreadyLogin
-	return
+
+	return &domain.LoginResponse{
+		AccessToken:  tokenAccessString,
+		RefreshToken: tokenRefreshString,
+		Type:         "Bearer",
+		ExpiredAt:    refreshExpTime.Format(time.RFC3339),
+		Scope:        "*",
+	}, nil
 }
 
-// Logout implements ServiceOAuth.
+// Logout implements ServiceOAuth. The whole token family is revoked so that
+// earlier tokens of the same login cannot be replayed.
 func (s *serviceOauth) Logout(ctx context.Context, token string) error {
-	currentData, err := s.readModel.FindByToken(ctx, token)
+	currentData, err := s.readModel.FindByTokenHash(ctx, s.hashToken(token))
 	if err != nil {
 		return err
 	}
-	return s.repo.Revoke(ctx, currentData)
+	return s.repo.RevokeFamily(ctx, currentData.FamilyID)
 }
 
 type ServiceOAuth interface {
-	Login(ctx context.Context, email, pwd string) (*domain.LoginResponse, []string, error)
+	Login(ctx context.Context, email, pwd string, meta domain.SessionMeta, device *domain.Device) (*domain.LoginResponse, error)
+	PinLogin(ctx context.Context, device *domain.Device, accountId ulid.ULID, pin string, meta domain.SessionMeta) (*domain.LoginResponse, error)
 	Logout(ctx context.Context, token string) error
-	RefreshToken(ctx context.Context, refreshToken string, uid ulid.ULID, email string) (accessToken string, err error)
+	RefreshToken(ctx context.Context, refreshToken string, uid, org ulid.ULID, device *domain.Device) (*domain.LoginResponse, error)
 }
 
 func NewServiceOAuth(
 	accountReadModel account.ReadModel,
 	repo Repo,
 	readModel ReadModel,
-	secret string,
+	keyring *keyring.Keyring,
+	tokenPepper string,
 	refreshExpTime uint,
 	accessExpTime uint,
+	maxSessions uint,
+	sessionLimitPolicy string,
 	roleReadModel role.ReadModel,
 	permissionReadModel permission.ReadModel,
+	pins account.PinService,
+	passwords account.PasswordService,
+	devices DeviceGuard,
 ) ServiceOAuth {
 	return &serviceOauth{
 		accountReadModel:    accountReadModel,
 		repo:                repo,
 		readModel:           readModel,
-		secret:              secret,
+		keyring:             keyring,
+		tokenPepper:         tokenPepper,
 		refreshExpTime:      refreshExpTime,
 		accessExpTime:       accessExpTime,
+		maxSessions:         maxSessions,
+		sessionLimitPolicy:  sessionLimitPolicy,
 		roleReadModel:       roleReadModel,
 		permissionReadModel: permissionReadModel,
+		pins:                pins,
+		passwords:           passwords,
+		devices:             devices,
 	}
 }
@@ -0,0 +1,391 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/keyring"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeTokens keeps refresh tokens in memory, keyed by token hash. Only the
+// methods RefreshToken uses are implemented.
+type fakeTokens struct {
+	Repo
+	ReadModel
+	byHash    map[string]*domain.RefreshToken
+	revoked   []ulid.ULID
+	rotateErr error
+}
+
+func newFakeTokens() *fakeTokens {
+	return &fakeTokens{byHash: map[string]*domain.RefreshToken{}}
+}
+
+func (f *fakeTokens) FindAnyByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	data, ok := f.byHash[tokenHash]
+	if !ok {
+		return &domain.RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	copied := *data
+	return &copied, nil
+}
+
+func (f *fakeTokens) Rotate(ctx context.Context, current, next *domain.RefreshToken) error {
+	if f.rotateErr != nil {
+		return f.rotateErr
+	}
+	f.byHash[current.TokenHash].Revoked = true
+	f.byHash[next.TokenHash] = next
+	return nil
+}
+
+func (f *fakeTokens) RevokeFamily(ctx context.Context, familyId ulid.ULID) error {
+	f.revoked = append(f.revoked, familyId)
+	for _, data := range f.byHash {
+		if data.FamilyID == familyId {
+			data.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (f *fakeTokens) RevokeByDevice(ctx context.Context, deviceId ulid.ULID) error {
+	for _, data := range f.byHash {
+		if data.DeviceId != nil && *data.DeviceId == deviceId {
+			data.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (f *fakeTokens) SaveSession(ctx context.Context, data *domain.RefreshToken, maxSessions uint, reject bool) error {
+	f.byHash[data.TokenHash] = data
+	return nil
+}
+
+func (f *fakeTokens) GetPermissionById(ctx context.Context, id, storeId, sessionId ulid.ULID) (PermissionList, error) {
+	return emptyPermissionList, nil
+}
+
+type fakeAccounts struct {
+	account.ReadModel
+	acc *domain.Account
+}
+
+func (f *fakeAccounts) FindById(ctx context.Context, id ulid.ULID) (*domain.Account, error) {
+	return f.acc, nil
+}
+
+func (f *fakeAccounts) FindByEmail(ctx context.Context, email string) (*domain.Account, error) {
+	return f.acc, nil
+}
+
+// fakePasswords counts wrong passwords the way the accounts UPDATE does.
+type fakePasswords struct {
+	hash     string
+	failures uint
+	until    *time.Time
+}
+
+func (f *fakePasswords) ReservePasswordAttempt(ctx context.Context, accountId ulid.ULID, maxFailures uint, now, lockedUntil time.Time) (string, *time.Time, error) {
+	if f.until != nil && now.Before(*f.until) {
+		return "", nil, account.ErrPasswordLocked
+	}
+	f.failures++
+	f.until = nil
+	if f.failures >= maxFailures {
+		f.failures = 0
+		f.until = &lockedUntil
+	}
+	return f.hash, f.until, nil
+}
+
+func (f *fakePasswords) ResetPasswordFailures(ctx context.Context, accountId ulid.ULID) error {
+	f.failures = 0
+	f.until = nil
+	return nil
+}
+
+type refreshFixture struct {
+	svc    *serviceOauth
+	tokens *fakeTokens
+	acc    *domain.Account
+}
+
+func newRefreshFixture(t *testing.T) *refreshFixture {
+	t.Helper()
+	ring, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := &domain.Account{
+		Id:             ulid.Make(),
+		OrganizationId: ulid.Make(),
+		Email:          "cashier@example.com",
+	}
+	tokens := newFakeTokens()
+	svc := &serviceOauth{
+		accountReadModel: &fakeAccounts{acc: acc},
+		repo:             tokens,
+		readModel:        tokens,
+		keyring:          ring,
+		tokenPepper:      "pepper",
+		refreshExpTime:   1,
+		accessExpTime:    1,
+	}
+	return &refreshFixture{svc: svc, tokens: tokens, acc: acc}
+}
+
+// issue stores token as the first token of a new session.
+func (f *refreshFixture) issue(token string, expiresAt time.Time) *domain.RefreshToken {
+	data := domain.NewRefreshToken(f.acc.Id, f.svc.hashToken(token), expiresAt, domain.SessionMeta{})
+	f.tokens.byHash[data.TokenHash] = &data
+	return &data
+}
+
+func (f *refreshFixture) refresh(token string) (*domain.LoginResponse, error) {
+	return f.svc.RefreshToken(context.Background(), token, f.acc.Id, f.acc.OrganizationId, nil)
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	f := newRefreshFixture(t)
+	first := f.issue("first", time.Now().Add(time.Hour))
+
+	res, err := f.refresh("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RefreshToken == "" || res.RefreshToken == "first" {
+		t.Fatalf("refresh token not rotated: %q", res.RefreshToken)
+	}
+	if !f.tokens.byHash[first.TokenHash].Revoked {
+		t.Error("presented token still live after rotation")
+	}
+	next, ok := f.tokens.byHash[f.svc.hashToken(res.RefreshToken)]
+	if !ok {
+		t.Fatal("rotated token not stored")
+	}
+	if next.FamilyID != first.FamilyID {
+		t.Errorf("rotated token family = %s, want %s", next.FamilyID, first.FamilyID)
+	}
+	if next.ParentID == nil || *next.ParentID != first.ID {
+		t.Errorf("rotated token parent = %v, want %s", next.ParentID, first.ID)
+	}
+
+	if _, err := f.refresh(res.RefreshToken); err != nil {
+		t.Fatalf("refreshing the rotated token: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	f := newRefreshFixture(t)
+	first := f.issue("first", time.Now().Add(time.Hour))
+
+	res, err := f.refresh("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.refresh("first"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing a rotated token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if len(f.tokens.revoked) != 1 || f.tokens.revoked[0] != first.FamilyID {
+		t.Fatalf("revoked families = %v, want [%s]", f.tokens.revoked, first.FamilyID)
+	}
+	if _, err := f.refresh(res.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("successor of a reused token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+}
+
+func TestRefreshTokenConcurrentRotationRevokesFamily(t *testing.T) {
+	f := newRefreshFixture(t)
+	first := f.issue("first", time.Now().Add(time.Hour))
+	f.tokens.rotateErr = ErrRefreshTokenReused
+
+	if _, err := f.refresh("first"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if len(f.tokens.revoked) != 1 || f.tokens.revoked[0] != first.FamilyID {
+		t.Errorf("revoked families = %v, want [%s]", f.tokens.revoked, first.FamilyID)
+	}
+}
+
+func TestRefreshTokenRefused(t *testing.T) {
+	f := newRefreshFixture(t)
+	f.issue("expired", time.Now().Add(-time.Minute))
+	f.issue("live", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		token string
+		uid   ulid.ULID
+		want  error
+	}{
+		{"unknown token", "unknown", f.acc.Id, ErrRefreshTokenNotFound},
+		{"expired token", "expired", f.acc.Id, ErrRefreshTokenExpired},
+		{"token of another account", "live", ulid.Make(), ErrRefreshTokenNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.svc.RefreshToken(context.Background(), tt.token, tt.uid, f.acc.OrganizationId, nil)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if len(f.tokens.revoked) != 0 {
+		t.Errorf("revoked families = %v, want none", f.tokens.revoked)
+	}
+}
+
+func TestRefreshTokenOfDisabledDevice(t *testing.T) {
+	f := newRefreshFixture(t)
+	disabled := &domain.Device{Id: ulid.Make()}
+	other := &domain.Device{Id: ulid.Make()}
+	issueOn := func(token string, device *domain.Device) {
+		data := f.issue(token, time.Now().Add(time.Hour))
+		data.DeviceId = &device.Id
+	}
+	issueOn("till", disabled)
+	issueOn("back office", disabled)
+	issueOn("other till", other)
+	if err := f.tokens.RevokeByDevice(context.Background(), disabled.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		device *domain.Device
+		want   error
+	}{
+		{"session on the disabled device", "till", disabled, ErrRefreshTokenReused},
+		{"other session on the disabled device", "back office", disabled, ErrRefreshTokenReused},
+		{"session on another device", "other till", other, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.svc.RefreshToken(context.Background(), tt.token, f.acc.Id, f.acc.OrganizationId, tt.device)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLimitPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		valid  bool
+	}{
+		{SessionLimitEvictOldest, true},
+		{SessionLimitReject, true},
+		{"rejct", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		err := ValidateLimitPolicy(tt.policy)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateLimitPolicy(%q) = %v, want nil", tt.policy, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrUnknownLimitPolicy) {
+			t.Errorf("ValidateLimitPolicy(%q) = %v, want %v", tt.policy, err, ErrUnknownLimitPolicy)
+		}
+	}
+}
+
+func TestLoginSharesPasswordLockout(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("right password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := &domain.Account{Id: ulid.Make(), OrganizationId: ulid.Make(), Password: string(hash)}
+	passwords := account.NewPasswordService(nil, &fakePasswords{hash: string(hash)}, 3, time.Minute)
+	svc := &serviceOauth{
+		accountReadModel: &fakeAccounts{acc: acc},
+		passwords:        passwords,
+	}
+	ctx := context.Background()
+
+	// An override approval with a wrong password counts as well.
+	if err := passwords.VerifyPassword(ctx, acc.Id, "guess"); !errors.Is(err, account.ErrPasswordWrong) {
+		t.Fatalf("approval: err = %v, want %v", err, account.ErrPasswordWrong)
+	}
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"second failure", "guess", ErrPasswordWrong},
+		{"third failure locks", "guess", ErrPasswordWrong},
+		{"right password while locked", "right password", account.ErrPasswordLocked},
+	}
+	for _, tt := range tests {
+		_, err := svc.Login(ctx, acc.Email, tt.password, domain.SessionMeta{}, nil)
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	svc := &serviceOauth{tokenPepper: "pepper"}
+	other := &serviceOauth{tokenPepper: "other pepper"}
+	tests := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{"same token", svc.hashToken("token"), svc.hashToken("token"), true},
+		{"other token", svc.hashToken("token"), svc.hashToken("token2"), false},
+		{"other pepper", svc.hashToken("token"), other.hashToken("token"), false},
+		{"plain token", svc.hashToken("token"), "token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.a == tt.b) != tt.equal {
+				t.Errorf("%q == %q is %v, want %v", tt.a, tt.b, tt.a == tt.b, tt.equal)
+			}
+		})
+	}
+	if h := svc.hashToken("token"); len(h) != 64 {
+		t.Errorf("hash %q is not a hex encoded SHA-256 HMAC", h)
+	}
+}
+
+func TestLoginStoresOnlyTokenHash(t *testing.T) {
+	f := newRefreshFixture(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("right password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.acc.Password = string(hash)
+	f.svc.passwords = account.NewPasswordService(nil, &fakePasswords{hash: string(hash)}, 3, time.Minute)
+
+	res, err := f.svc.Login(context.Background(), f.acc.Email, "right password", domain.SessionMeta{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.tokens.byHash) != 1 {
+		t.Fatalf("stored tokens = %d, want 1", len(f.tokens.byHash))
+	}
+	for stored, data := range f.tokens.byHash {
+		if stored == res.RefreshToken || data.TokenHash == res.RefreshToken {
+			t.Fatal("refresh token stored in plain")
+		}
+		if stored != f.svc.hashToken(res.RefreshToken) {
+			t.Errorf("stored hash %q is not the HMAC of the token", stored)
+		}
+	}
+
+	// Without the pepper the stored hash leads nowhere.
+	f.svc.tokenPepper = "other pepper"
+	if _, err := f.refresh(res.RefreshToken); !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("refresh with another pepper: err = %v, want %v", err, ErrRefreshTokenNotFound)
+	}
+}
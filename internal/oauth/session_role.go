@@ -0,0 +1,245 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrSessionRoleNotHeld    = errors.New("session: role not held by the account")
+	ErrSessionRoleNotDynamic = errors.New("session: role is in no dynamic constraint")
+	ErrSessionRoleNotActive  = errors.New("session: role not active")
+)
+
+type ActiveRoleList struct {
+	Roles []domain.ActiveRole `json:"data"`
+	Count int                 `json:"count"`
+}
+
+var emptyActiveRoleList = ActiveRoleList{
+	Roles: []domain.ActiveRole{},
+	Count: 0,
+}
+
+// ActivateRole implements Repo. The account must currently hold the role,
+// in any store, through an assignment or by inheritance, and the role
+// must belong to a dynamic constraint. A *domain.ConstraintError is
+// returned when another role of one of its dynamic constraints is already
+// active in the session. Activating an active role is a no-op.
+func (r *repo) ActivateRole(ctx context.Context, sessionId, accountId, roleId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Activations in a session are serialised on an advisory lock keyed on
+	// the session, so that two of them cannot break a dynamic constraint
+	// together while other sessions go on.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1::text, 0))`, sessionId.String()); err != nil {
+		return err
+	}
+
+	var held bool
+	var dynamic bool
+	err = tx.QueryRow(
+		ctx,
+		`
+			WITH RECURSIVE account_role_tree(role_id) AS (
+				SELECT ar.role_id
+				FROM account_roles ar
+				WHERE ar.account_id = $1
+					AND (ar.valid_from IS NULL OR ar.valid_from <= NOW())
+					AND (ar.valid_until IS NULL OR ar.valid_until > NOW())
+				UNION
+				SELECT rp.parent_id
+				FROM role_parents rp
+				JOIN account_role_tree t ON rp.role_id = t.role_id
+			)
+			SELECT
+				EXISTS (
+					SELECT 1
+					FROM account_role_tree t
+					JOIN roles r ON t.role_id = r.id
+					WHERE t.role_id = $2 AND r.organization_id = $3
+				),
+				EXISTS (
+					SELECT 1
+					FROM sod_constraint_roles cr
+					JOIN sod_constraints c ON cr.constraint_id = c.id
+					WHERE cr.role_id = $2 AND c.kind = 'dynamic'
+				);
+		`,
+		accountId,
+		roleId,
+		org,
+	).Scan(&held, &dynamic)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return ErrSessionRoleNotHeld
+	}
+	if !dynamic {
+		return ErrSessionRoleNotDynamic
+	}
+
+	var constraintId ulid.ULID
+	var constraintName string
+	var roleName string
+	var conflictName string
+	err = tx.QueryRow(
+		ctx,
+		`
+			SELECT c.id, c.name, mine.name, other.name
+			FROM sod_constraints c
+			JOIN sod_constraint_roles cr ON cr.constraint_id = c.id AND cr.role_id = $2
+			JOIN roles mine ON mine.id = cr.role_id
+			JOIN sod_constraint_roles ocr ON ocr.constraint_id = c.id AND ocr.role_id <> $2
+			JOIN roles other ON other.id = ocr.role_id
+			JOIN session_roles sr ON sr.role_id = ocr.role_id AND sr.session_id = $1
+			WHERE c.kind = 'dynamic'
+			ORDER BY c.name, other.name
+			LIMIT 1;
+		`,
+		sessionId,
+		roleId,
+	).Scan(&constraintId, &constraintName, &roleName, &conflictName)
+	if err == nil {
+		return &domain.ConstraintError{
+			Violation: domain.ConstraintViolation{
+				Kind:           domain.SoDDynamic,
+				ConstraintId:   &constraintId,
+				ConstraintName: constraintName,
+				AccountId:      &accountId,
+				Roles:          []string{roleName, conflictName},
+			},
+		}
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`
+			INSERT INTO session_roles (
+				session_id,
+				account_id,
+				role_id,
+				activated_at
+			) VALUES (
+				$1,
+				$2,
+				$3,
+				$4
+			)
+			ON CONFLICT (session_id, role_id) DO NOTHING;
+		`,
+		sessionId,
+		accountId,
+		roleId,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeactivateRole implements Repo.
+func (r *repo) DeactivateRole(ctx context.Context, sessionId, roleId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			DELETE FROM session_roles
+			WHERE session_id = $1 AND role_id = $2
+				AND role_id IN (SELECT id FROM roles WHERE organization_id = $3);
+		`,
+		sessionId,
+		roleId,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionRoleNotActive
+	}
+	return nil
+}
+
+// FetchActiveRoles implements ReadModel.
+func (r *repo) FetchActiveRoles(ctx context.Context, sessionId ulid.ULID) (ActiveRoleList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyActiveRoleList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				r.id,
+				r.name,
+				r.description,
+				r.created_at,
+				sr.activated_at
+			FROM
+				session_roles sr
+			JOIN
+				roles r
+			ON
+				sr.role_id = r.id
+			WHERE
+				sr.session_id = $1 AND
+				r.organization_id = $2
+			ORDER BY
+				r.name;
+		`,
+		sessionId,
+		org,
+	)
+	if err != nil {
+		return emptyActiveRoleList, err
+	}
+	defer rows.Close()
+
+	items := []domain.ActiveRole{}
+	for rows.Next() {
+		var item domain.ActiveRole
+		if err := rows.Scan(
+			&item.Id,
+			&item.Name,
+			&item.Description,
+			&item.CreatedAt,
+			&item.ActivatedAt,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyActiveRoleList, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyActiveRoleList, err
+	}
+	list := ActiveRoleList{
+		Roles: items,
+		Count: len(items),
+	}
+	return list, nil
+}
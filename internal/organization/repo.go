@@ -0,0 +1,129 @@
+package organization
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrOrganizationNotFound     = errors.New("organization: not found")
+	ErrOrganizationAlreadyExist = errors.New("organization: name already exists")
+	ErrAdminAlreadyExist        = errors.New("organization: admin email already exists")
+)
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+// FindById implements ReadModel.
+func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Organization, error) {
+	row := r.db.QueryRow(
+		ctx,
+		`
+			SELECT
+				id,
+				name,
+				created_at
+			FROM
+				organizations
+			WHERE
+				id = $1
+		`,
+		id,
+	)
+	var data domain.Organization
+	if err := row.Scan(
+		&data.Id,
+		&data.Name,
+		&data.CreatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// Bootstrap implements Repo. The organization is created together with its
+// first administrator, holding a role granted permission, in one
+// transaction, so an organization never exists without someone able to
+// manage it.
+func (r *repo) Bootstrap(
+	ctx context.Context,
+	org *domain.Organization,
+	admin *domain.Account,
+	role *domain.Role,
+	permission *domain.Permission,
+) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	batch.Queue(
+		`INSERT INTO organizations (id, name, created_at) VALUES ($1, $2, $3)`,
+		org.Id, org.Name, org.CreatedAt,
+	)
+	batch.Queue(
+		`INSERT INTO accounts (id, organization_id, email, password, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		admin.Id, org.Id, admin.Email, admin.Password, admin.CreatedAt,
+	)
+	batch.Queue(
+		`INSERT INTO roles (id, organization_id, name, description, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		role.Id, org.Id, role.Name, role.Description, role.CreatedAt,
+	)
+	batch.Queue(
+		`INSERT INTO permissions (id, organization_id, name, description, url, methods, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		permission.Id, org.Id, permission.Name, permission.Description, permission.Url, permission.Methods, permission.CreatedAt,
+	)
+	batch.Queue(
+		`INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2)`,
+		role.Id, permission.Id,
+	)
+	batch.Queue(
+		`INSERT INTO account_roles (account_id, role_id) VALUES ($1, $2)`,
+		admin.Id, role.Id,
+	)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			if pqErr.ConstraintName == "accounts_email_key" {
+				return ErrAdminAlreadyExist
+			}
+			return ErrOrganizationAlreadyExist
+		}
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	admin.OrganizationId = org.Id
+	return nil
+}
+
+type Repo interface {
+	Bootstrap(ctx context.Context, org *domain.Organization, admin *domain.Account, role *domain.Role, permission *domain.Permission) error
+}
+
+type ReadModel interface {
+	FindById(ctx context.Context, id ulid.ULID) (*domain.Organization, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
+
+func NewReadModel(db *pgxpool.Pool) ReadModel {
+	return &repo{db: db}
+}
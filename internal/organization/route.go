@@ -0,0 +1,146 @@
+package organization
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pos/domain"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/tenant"
+	"pos/utils/httpresponse"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+// OperatorKeyHeader carries the key of the operator running the server,
+// which alone may create organizations.
+const OperatorKeyHeader = "X-Operator-Key"
+
+// Errors of the operator check in front of the sign-up.
+var (
+	ErrSignupClosed       = errors.New("organization: sign-up is closed")
+	ErrInvalidOperatorKey = errors.New("organization: invalid operator key")
+)
+
+type organizationRoute struct {
+	svc         Service
+	operatorKey string
+}
+
+// NewRoute returns the organization routes. An empty operatorKey closes
+// the sign-up.
+func NewRoute(
+	svc Service,
+	operatorKey string,
+) *organizationRoute {
+	return &organizationRoute{
+		svc:         svc,
+		operatorKey: operatorKey,
+	}
+}
+
+// Routes exposes the sign-up of a new organization, which needs the
+// operator key rather than a token, and the organization of the caller.
+func (p *organizationRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.With(p.operatorOnly).Post("/", p.createOrganization)
+	r.With(custommiddleware.AuthJwtMiddleware).Get("/current", p.getCurrentOrganization)
+	return r
+}
+
+// operatorOnly serves requests bearing the operator key in
+// OperatorKeyHeader. Organizations live side by side on one server, so
+// only the operator may add one and learn that a name or an email is
+// taken.
+func (p *organizationRoute) operatorOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if p.operatorKey == "" {
+				httpresponse.WriteError(w, http.StatusForbidden, ErrSignupClosed)
+				return
+			}
+			given := r.Header.Get(OperatorKeyHeader)
+			if subtle.ConstantTimeCompare([]byte(given), []byte(p.operatorKey)) != 1 {
+				httpresponse.WriteError(w, http.StatusUnauthorized, ErrInvalidOperatorKey)
+				return
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+type createOrganizationRequest struct {
+	Name          string `json:"name"`
+	AdminEmail    string `json:"admin_email"`
+	AdminPassword string `json:"admin_password"`
+}
+
+func (c createOrganizationRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&c.AdminEmail, validation.Required, is.Email),
+		validation.Field(&c.AdminPassword, validation.Required, validation.Length(8, 32)),
+	)
+}
+
+func (p *organizationRoute) createOrganization(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body createOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	org, admin, err := p.svc.CreateOrganization(ctx, body.Name, body.AdminEmail, body.AdminPassword)
+	if err != nil {
+		if errors.Is(err, ErrOrganizationAlreadyExist) || errors.Is(err, ErrAdminAlreadyExist) {
+			httpresponse.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	data := struct {
+		Organization *domain.Organization `json:"organization"`
+		Admin        *domain.Account      `json:"admin"`
+	}{
+		Organization: org,
+		Admin:        admin,
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+func (p *organizationRoute) getCurrentOrganization(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+	id, err := tenant.FromContext(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	data, err := p.svc.GetOneById(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrOrganizationNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
@@ -0,0 +1,56 @@
+package organization
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pos/domain"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type fakeService struct {
+	Service
+	created int
+}
+
+func (f *fakeService) CreateOrganization(ctx context.Context, name, email, password string) (*domain.Organization, *domain.Account, error) {
+	f.created++
+	org := domain.NewOrganization(name)
+	return &org, &domain.Account{Id: ulid.Make(), OrganizationId: org.Id, Email: email}, nil
+}
+
+func TestCreateOrganizationNeedsOperatorKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		operatorKey string
+		given       string
+		want        int
+	}{
+		{"sign-up closed", "", "", http.StatusForbidden},
+		{"sign-up closed with a key", "", "anything", http.StatusForbidden},
+		{"no key", "operator", "", http.StatusUnauthorized},
+		{"wrong key", "operator", "guess", http.StatusUnauthorized},
+		{"operator key", "operator", "operator", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{}
+			body := `{"name":"Acme","admin_email":"admin@acme.test","admin_password":"password"}`
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			if tt.given != "" {
+				r.Header.Set(OperatorKeyHeader, tt.given)
+			}
+			w := httptest.NewRecorder()
+			NewRoute(svc, tt.operatorKey).Routes().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if created := svc.created > 0; created != (tt.want == http.StatusCreated) {
+				t.Errorf("organization created = %v", created)
+			}
+		})
+	}
+}
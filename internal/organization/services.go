@@ -0,0 +1,54 @@
+package organization
+
+import (
+	"context"
+	"pos/domain"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Names of what CreateOrganization sets up for the first administrator.
+const (
+	adminRoleName       = "Administrator"
+	adminPermissionName = "Full Access"
+	// adminPermissionUrl matches every permission url, see authz.
+	adminPermissionUrl = "**"
+)
+
+type services struct {
+	repo      Repo
+	readModel ReadModel
+}
+
+// CreateOrganization implements Service. The administrator account gets an
+// Administrator role granting every permission of the organization.
+func (s *services) CreateOrganization(ctx context.Context, name, email, password string) (*domain.Organization, *domain.Account, error) {
+	org := domain.NewOrganization(name)
+	admin, err := domain.NewAccount(email, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	role := domain.NewRole(adminRoleName, "Full access to the organization.")
+	permission := domain.NewPermission(adminPermissionName, "Grants every permission.", adminPermissionUrl, nil)
+	if err := s.repo.Bootstrap(ctx, &org, &admin, &role, &permission); err != nil {
+		return nil, nil, err
+	}
+	return &org, &admin, nil
+}
+
+// GetOneById implements Service.
+func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.Organization, error) {
+	return s.readModel.FindById(ctx, id)
+}
+
+type Service interface {
+	CreateOrganization(ctx context.Context, name, email, password string) (*domain.Organization, *domain.Account, error)
+	GetOneById(ctx context.Context, id ulid.ULID) (*domain.Organization, error)
+}
+
+func NewService(
+	repo Repo,
+	readModel ReadModel,
+) Service {
+	return &services{repo: repo, readModel: readModel}
+}
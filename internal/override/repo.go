@@ -0,0 +1,184 @@
+package override
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrOverrideUsed = errors.New("override: already used or expired")
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+type OverrideList struct {
+	Overrides []domain.Override `json:"data"`
+	Count     int               `json:"count"`
+}
+
+var emptyList = OverrideList{
+	Overrides: []domain.Override{},
+	Count:     0,
+}
+
+// Fetch implements ReadModel. Overrides are listed the latest first.
+func (r *repo) Fetch(ctx context.Context) (OverrideList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				id,
+				organization_id,
+				account_id,
+				approver_id,
+				method,
+				resource,
+				store_id,
+				attributes,
+				created_at,
+				expires_at,
+				used_at
+			FROM
+				overrides
+			WHERE
+				organization_id = $1
+			ORDER BY
+				created_at DESC;
+		`,
+		org,
+	)
+	if err != nil {
+		return emptyList, err
+	}
+	defer rows.Close()
+
+	items := []domain.Override{}
+	for rows.Next() {
+		var item domain.Override
+		if err := rows.Scan(
+			&item.Id,
+			&item.OrganizationId,
+			&item.AccountId,
+			&item.ApproverId,
+			&item.Method,
+			&item.Resource,
+			&item.StoreId,
+			&item.Attributes,
+			&item.CreatedAt,
+			&item.ExpiresAt,
+			&item.UsedAt,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyList, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyList, err
+	}
+	list := OverrideList{
+		Overrides: items,
+		Count:     len(items),
+	}
+	return list, nil
+}
+
+// Save implements Repo.
+func (r *repo) Save(ctx context.Context, data *domain.Override) error {
+	_, err := r.db.Exec(
+		ctx,
+		`
+			INSERT INTO overrides (
+				id,
+				organization_id,
+				account_id,
+				approver_id,
+				method,
+				resource,
+				store_id,
+				attributes,
+				created_at,
+				expires_at
+			) VALUES (
+				$1,
+				$2,
+				$3,
+				$4,
+				$5,
+				$6,
+				$7,
+				$8,
+				$9,
+				$10
+			);
+		`,
+		data.Id,
+		data.OrganizationId,
+		data.AccountId,
+		data.ApproverId,
+		data.Method,
+		data.Resource,
+		data.StoreId,
+		data.Attributes,
+		data.CreatedAt,
+		data.ExpiresAt,
+	)
+	return err
+}
+
+// Redeem implements Repo and custommiddleware.OverrideRedeemer. Only one
+// of concurrent redemptions of an override succeeds.
+func (r *repo) Redeem(ctx context.Context, id ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE overrides
+			SET used_at = $3
+			WHERE id = $1 AND organization_id = $2
+				AND used_at IS NULL AND expires_at > $3;
+		`,
+		id,
+		org,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOverrideUsed
+	}
+	return nil
+}
+
+type Repo interface {
+	Save(ctx context.Context, data *domain.Override) error
+	Redeem(ctx context.Context, id ulid.ULID) error
+}
+
+type ReadModel interface {
+	Fetch(ctx context.Context) (OverrideList, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
+
+func NewReadModel(db *pgxpool.Pool) ReadModel {
+	return &repo{db: db}
+}
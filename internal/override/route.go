@@ -0,0 +1,147 @@
+package override
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/authz"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/policy"
+	"pos/utils/httpresponse"
+	"pos/utils/key"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/oklog/ulid/v2"
+)
+
+var methods = []interface{}{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+type overrideRoute struct {
+	svc Service
+}
+
+func NewRoute(
+	svc Service,
+) *overrideRoute {
+	return &overrideRoute{
+		svc: svc,
+	}
+}
+
+// Routes serves the overrides. Any account may ask for one, on the
+// credentials of an approver; those holding override:audit list them.
+func (p *overrideRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Post("/", p.grantOverride)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("override:audit"))
+		r.Get("/", p.getAllOverride)
+	})
+	return r
+}
+
+// grantRequest names the approver by email, with either their password or
+// their PIN. A PIN is only taken from a session opened on a device.
+type grantRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password"`
+	Pin      string `json:"pin"`
+	Method   string `json:"method" validate:"required"`
+	// Resource is the permission url with its parameters filled, such as
+	// generate-reports/01HV... for generate-reports/{id}.
+	Resource string     `json:"resource" validate:"required"`
+	StoreId  *ulid.ULID `json:"store_id"`
+	// Attributes are those of the request to override, such as its amount,
+	// that conditions are checked against; the request must carry the
+	// same ones.
+	Attributes policy.Attributes `json:"attributes"`
+}
+
+func (c grantRequest) Validate() error {
+	if (c.Password == "") == (c.Pin == "") {
+		return errors.New("either password or pin is required")
+	}
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Email, validation.Required, is.Email),
+		validation.Field(&c.Pin, validation.Length(4, 8), is.Digit),
+		validation.Field(&c.Method, validation.Required, validation.In(methods...)),
+		validation.Field(&c.Resource, validation.Required, validation.Length(1, 255)),
+	)
+}
+
+func (p *overrideRoute) grantOverride(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body grantRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	body.Method = strings.ToUpper(body.Method)
+	// Written the way the protected route is matched, so that the override
+	// can be redeemed there.
+	body.Resource = authz.Resource(body.Resource, nil)
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	storeId := ulid.ULID{}
+	if body.StoreId != nil {
+		storeId = *body.StoreId
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+	if body.Pin != "" && token.DeviceId == nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, custommiddleware.ErrDeviceRequired)
+		return
+	}
+
+	data, err := p.svc.Grant(ctx, token.Id, body.Email, body.Password, body.Pin, body.Method, body.Resource, storeId, body.Attributes)
+	if err != nil {
+		var denied *ApproverDeniedError
+		switch {
+		case errors.Is(err, ErrApproverCredentials):
+			httpresponse.WriteError(w, http.StatusUnauthorized, err)
+		case errors.Is(err, account.ErrPinLocked), errors.Is(err, account.ErrPasswordLocked):
+			httpresponse.WriteError(w, http.StatusLocked, err)
+		case errors.Is(err, ErrSelfOverride), errors.Is(err, ErrDeniedRequest), errors.As(err, &denied):
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+func (p *overrideRoute) getAllOverride(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+
+	data, err := p.svc.GetAll(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Overrides, meta)
+}
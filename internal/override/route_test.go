@@ -0,0 +1,54 @@
+package override
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pos/domain"
+	"pos/internal/policy"
+	"pos/utils/key"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type fakeService struct {
+	Service
+	resource string
+}
+
+func (f *fakeService) Grant(ctx context.Context, accountId ulid.ULID, email, password, pin, method, resource string, storeId ulid.ULID, attrs policy.Attributes) (*domain.OverrideResponse, error) {
+	f.resource = resource
+	return &domain.OverrideResponse{}, nil
+}
+
+func TestGrantOverrideNormalizesResource(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		want     string
+	}{
+		{"plain", "refund-transaction/42", "refund-transaction/42"},
+		{"surrounding slashes", "/refund-transaction/42/", "refund-transaction/42"},
+		{"duplicate slashes", "refund-transaction//42", "refund-transaction/42"},
+		{"colon separator", "inventory:items", "inventory/items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{}
+			body := `{"email":"manager@example.com","password":"secret","method":"POST","resource":"` + tt.resource + `"}`
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			claims := &domain.Oauth{Id: ulid.Make(), OrganizationId: ulid.Make()}
+			r = r.WithContext(context.WithValue(r.Context(), key.UserValueKey, claims))
+			w := httptest.NewRecorder()
+			NewRoute(svc).Routes().ServeHTTP(w, r)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+			}
+			if svc.resource != tt.want {
+				t.Errorf("resource = %q, want %q", svc.resource, tt.want)
+			}
+		})
+	}
+}
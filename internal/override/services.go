@@ -0,0 +1,171 @@
+package override
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/authz"
+	"pos/internal/keyring"
+	"pos/internal/policy"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrApproverCredentials = errors.New("override: wrong approver credentials")
+	ErrSelfOverride        = errors.New("override: the approver must be another account")
+	ErrDeniedRequest       = errors.New("override: the request is explicitly denied to the account")
+)
+
+// ApproverDeniedError is returned when the approver does not hold the
+// permission the override is asked for.
+type ApproverDeniedError struct {
+	Reason string
+}
+
+func (e *ApproverDeniedError) Error() string {
+	return "override: approver not allowed: " + e.Reason
+}
+
+type Service interface {
+	Grant(ctx context.Context, accountId ulid.ULID, email, password, pin, method, resource string, storeId ulid.ULID, attrs policy.Attributes) (*domain.OverrideResponse, error)
+	GetAll(ctx context.Context) (OverrideList, error)
+}
+
+type services struct {
+	repo             Repo
+	readModel        ReadModel
+	accountReadModel account.ReadModel
+	pins             account.PinService
+	passwords        account.PasswordService
+	resolver         *authz.Resolver
+	keyring          *keyring.Keyring
+	ttl              time.Duration
+}
+
+// NewService returns the overrides, valid for ttl once granted.
+func NewService(
+	repo Repo,
+	readModel ReadModel,
+	accountReadModel account.ReadModel,
+	pins account.PinService,
+	passwords account.PasswordService,
+	resolver *authz.Resolver,
+	keyring *keyring.Keyring,
+	ttl time.Duration,
+) Service {
+	return &services{
+		repo:             repo,
+		readModel:        readModel,
+		accountReadModel: accountReadModel,
+		pins:             pins,
+		passwords:        passwords,
+		resolver:         resolver,
+		keyring:          keyring,
+		ttl:              ttl,
+	}
+}
+
+// Grant implements Service. The approver, named by email and either their
+// password or, when pin is set, their PIN, must be another account of the
+// organization allowed to perform method on resource, a permission url
+// with its parameters filled, in the store, for a request with attrs. An
+// explicit denial of the request to the account cannot be overridden, see
+// ErrDeniedRequest. The override is saved with both identities and bound
+// to attrs, then returned with its token.
+func (s *services) Grant(ctx context.Context, accountId ulid.ULID, email, password, pin, method, resource string, storeId ulid.ULID, attrs policy.Attributes) (*domain.OverrideResponse, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	approver, err := s.accountReadModel.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, account.ErrAccountNotFound) {
+			return nil, ErrApproverCredentials
+		}
+		return nil, err
+	}
+	if approver.OrganizationId != org {
+		return nil, ErrApproverCredentials
+	}
+	if pin != "" {
+		err := s.pins.VerifyPin(ctx, approver.Id, pin)
+		switch {
+		case errors.Is(err, account.ErrPinWrong), errors.Is(err, account.ErrPinNotSet):
+			return nil, ErrApproverCredentials
+		case err != nil:
+			return nil, err
+		}
+		return s.grant(ctx, org, accountId, approver.Id, method, resource, storeId, attrs)
+	}
+	if err := s.passwords.VerifyPassword(ctx, approver.Id, password); err != nil {
+		if !errors.Is(err, account.ErrPasswordWrong) {
+			return nil, err
+		}
+		log.Warn().
+			Str("account", accountId.String()).
+			Str("approver", approver.Id.String()).
+			Msg("override refused, wrong approver password")
+		return nil, ErrApproverCredentials
+	}
+	return s.grant(ctx, org, accountId, approver.Id, method, resource, storeId, attrs)
+}
+
+func (s *services) grant(ctx context.Context, org, accountId, approverId ulid.ULID, method, resource string, storeId ulid.ULID, attrs policy.Attributes) (*domain.OverrideResponse, error) {
+	if approverId == accountId {
+		return nil, ErrSelfOverride
+	}
+	if attrs == nil {
+		attrs = policy.Attributes{}
+	}
+	requester := authz.Subject{AccountId: accountId, StoreId: storeId}
+	decision, err := s.resolver.Authorize(ctx, requester, method, resource, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if decision.Denied {
+		return nil, ErrDeniedRequest
+	}
+	subject := authz.Subject{AccountId: approverId, StoreId: storeId}
+	decision, err = s.resolver.Authorize(ctx, subject, method, resource, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if !decision.Allowed {
+		return nil, &ApproverDeniedError{Reason: decision.Reason()}
+	}
+
+	var store *ulid.ULID
+	if storeId != (ulid.ULID{}) {
+		store = &storeId
+	}
+	newData := domain.NewOverride(org, accountId, approverId, method, resource, store, attrs, s.ttl)
+	if err := s.repo.Save(ctx, &newData); err != nil {
+		return nil, err
+	}
+	token, err := s.keyring.Sign(&domain.OverrideClaims{
+		Override: newData,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{domain.AudienceOverride},
+			Subject:   accountId.String(),
+			ExpiresAt: jwt.NewNumericDate(newData.ExpiresAt),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.OverrideResponse{
+		Token:    token,
+		Override: newData,
+	}, nil
+}
+
+// GetAll implements Service.
+func (s *services) GetAll(ctx context.Context) (OverrideList, error) {
+	return s.readModel.Fetch(ctx)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"pos/domain"
+	"pos/internal/tenant"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -15,7 +16,7 @@ import (
 
 var (
 	ErrPermissionNotFound     = errors.New("permission: not found")
-	ErrPermissionAlreadyExist = errors.New("permission: url already exists")
+	ErrPermissionAlreadyExist = errors.New("permission: url and methods already exist")
 )
 
 type repo struct {
@@ -34,11 +35,16 @@ var emptyList = PermissionList{
 
 // Fetch implements ReadModel.
 func (r *repo) Fetch(ctx context.Context) (PermissionList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
 	var itemCount int
 
 	row := r.db.QueryRow(
 		ctx,
-		`SELECT COUNT(id) as c FROM permissions`,
+		`SELECT COUNT(id) as c FROM permissions WHERE organization_id = $1`,
+		org,
 	)
 	if err := row.Scan(&itemCount); err != nil {
 		log.Warn().Err(err).Msg("cannot find a count in permission")
@@ -58,12 +64,16 @@ func (r *repo) Fetch(ctx context.Context) (PermissionList, error) {
 				name,
 				description,
 				url,
+				methods,
 				created_at
 			FROM
 				permissions
+			WHERE
+				organization_id = $1
 			ORDER BY
 				id
 		`,
+		org,
 	)
 	if err != nil {
 		return emptyList, err
@@ -76,6 +86,7 @@ func (r *repo) Fetch(ctx context.Context) (PermissionList, error) {
 		var name string
 		var desc string
 		var url string
+		var methods []string
 		var createdAt time.Time
 		if !rows.Next() {
 			break
@@ -85,6 +96,7 @@ func (r *repo) Fetch(ctx context.Context) (PermissionList, error) {
 			&name,
 			&desc,
 			&url,
+			&methods,
 			&createdAt,
 		); err != nil {
 			log.Warn().Err(err).Msg("cannot scan an item")
@@ -95,6 +107,7 @@ func (r *repo) Fetch(ctx context.Context) (PermissionList, error) {
 			Name:        name,
 			Description: desc,
 			Url:         url,
+			Methods:     methods,
 			CreatedAt:   createdAt,
 		}
 	}
@@ -107,6 +120,10 @@ func (r *repo) Fetch(ctx context.Context) (PermissionList, error) {
 
 // FindById implements ReadModel.
 func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Permission, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	row := r.db.QueryRow(
 		ctx,
 		`
@@ -115,13 +132,16 @@ func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Permission,
 				name,
 				description,
 				url,
+				methods,
 				created_at
 			FROM
 				permissions
 			WHERE
-				id = $1
+				id = $1 AND
+				organization_id = $2
 		`,
 		id,
+		org,
 	)
 	var data domain.Permission
 	if err := row.Scan(
@@ -129,12 +149,14 @@ func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Permission,
 		&data.Name,
 		&data.Description,
 		&data.Url,
+		&data.Methods,
 		&data.CreatedAt,
 	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Debug().Err(err).Msg("can't find any item")
 			return nil, ErrPermissionNotFound
 		}
+		return nil, err
 	}
 	return &data, nil
 }
@@ -146,13 +168,18 @@ func (*repo) FindByUrl(ctx context.Context, url string) (*domain.Permission, err
 
 // Delete implements Repo.
 func (r *repo) Delete(ctx context.Context, data *domain.Permission) error {
-	_, err := r.db.Exec(
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			DELETE FROM permissions
-			WHERE id = $1
+			WHERE id = $1 AND organization_id = $2
 		`,
 		data.Id,
+		org,
 	)
 	if err != nil {
 		return err
@@ -162,35 +189,47 @@ func (r *repo) Delete(ctx context.Context, data *domain.Permission) error {
 
 // Save implements Repo.
 func (r *repo) Save(ctx context.Context, data *domain.Permission) error {
-	_, err := r.db.Exec(
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			INSERT INTO permissions (
 				id,
+				organization_id,
 				name,
 				description,
 				url,
+				methods,
 				created_at
 			) VALUES (
 				$1,
 				$2,
 				$3,
 				$4,
-				$5
+				$5,
+				$6,
+				$7
 			) ON CONFLICT (id) DO UPDATE
 			SET name = excluded.name,
 				description = excluded.description,
-				url = excluded.url;
+				url = excluded.url,
+				methods = excluded.methods
+			WHERE permissions.organization_id = excluded.organization_id;
 		`,
 		data.Id,
+		org,
 		data.Name,
 		data.Description,
 		data.Url,
+		data.Methods,
 		data.CreatedAt,
 	)
 	if err != nil {
-		pqErr := err.(*pgconn.PgError)
-		if pqErr.Code == "23505" {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return ErrPermissionAlreadyExist
 		}
 		return err
@@ -4,7 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"pos/domain"
+	"pos/internal/authz"
+	custommiddleware "pos/internal/custom_middleware"
 	"pos/utils/httpresponse"
+	"pos/utils/key"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	validation "github.com/go-ozzo/ozzo-validation"
@@ -28,11 +33,14 @@ func NewRoute(
 
 func (p *permissionRoute) Routes() *chi.Mux {
 	r := chi.NewMux()
-	r.Post("/", p.createPermission)
 	r.Get("/", p.getAllPermission)
 	r.Get("/{id}", p.getOnePermission)
-	r.Patch("/{id}", p.updatePermission)
-	r.Delete("/{id}", p.deletePermission)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("role:manage"))
+		r.Post("/", p.createPermission)
+		r.Patch("/{id}", p.updatePermission)
+		r.Delete("/{id}", p.deletePermission)
+	})
 	return r
 }
 
@@ -76,29 +84,60 @@ func (p *permissionRoute) updatePermission(
 		return
 	}
 	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
 
-	data, err := p.mutate.EditPermission(ctx, id, body.Name, body.Description, body.Url)
+	data, err := p.mutate.EditPermission(ctx, token.Id, id, body.Name, body.Description, body.Url, body.Methods)
 	if err != nil {
-		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		var delegationErr *authz.DelegationError
+		switch {
+		case errors.As(err, &delegationErr):
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrPermissionNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
 		return
 	}
 	httpresponse.WriteData(w, http.StatusOK, data, nil)
 }
 
+// allowedMethods are the HTTP methods a permission can be limited to.
+var allowedMethods = []interface{}{
+	"GET",
+	"POST",
+	"PUT",
+	"PATCH",
+	"DELETE",
+}
+
 type createPermissionRequest struct {
-	Name        string `json:"name" validate:"required"`
-	Description string `json:"description"`
-	Url         string `json:"url" validate:"required"`
+	Name        string   `json:"name" validate:"required"`
+	Description string   `json:"description"`
+	Url         string   `json:"url" validate:"required"`
+	Methods     []string `json:"methods"`
 }
 
 func (c createPermissionRequest) Validate() error {
+	c.Methods = domain.NormalizeMethods(c.Methods)
 	return validation.ValidateStruct(
 		&c,
 		validation.Field(&c.Name, validation.Required),
-		validation.Field(&c.Url, validation.Required),
+		validation.Field(&c.Url, validation.Required, validation.By(noSpace)),
+		validation.Field(&c.Methods, validation.Each(validation.In(allowedMethods...))),
 	)
 }
 
+// noSpace rejects urls containing spaces, which are reserved to separate
+// the method from the url in a grant.
+func noSpace(value interface{}) error {
+	s, _ := value.(string)
+	if strings.ContainsAny(s, " \t") {
+		return errors.New("must not contain spaces")
+	}
+	return nil
+}
+
 func (p *permissionRoute) createPermission(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -115,7 +154,7 @@ func (p *permissionRoute) createPermission(
 	}
 	ctx := r.Context()
 
-	data, err := p.mutate.CreatePermission(ctx, body.Name, body.Description, body.Url)
+	data, err := p.mutate.CreatePermission(ctx, body.Name, body.Description, body.Url, body.Methods)
 	if err != nil {
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
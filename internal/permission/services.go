@@ -3,13 +3,15 @@ package permission
 import (
 	"context"
 	"pos/domain"
+	"pos/internal/authz"
 
 	"github.com/oklog/ulid/v2"
 )
 
 type services struct {
-	repo      Repo
-	readModel ReadModel
+	repo        Repo
+	readModel   ReadModel
+	permissions authz.PermissionReader
 }
 
 // GetAll implements ReadData.
@@ -28,8 +30,8 @@ func (*services) GetOneByUrl(ctx context.Context, url string) (*domain.Permissio
 }
 
 // CreatePermission implements MutationData.
-func (s *services) CreatePermission(ctx context.Context, name, desc, url string) (*domain.Permission, error) {
-	newData := domain.NewPermission(name, desc, url)
+func (s *services) CreatePermission(ctx context.Context, name, desc, url string, methods []string) (*domain.Permission, error) {
+	newData := domain.NewPermission(name, desc, url, methods)
 	if err := s.repo.Save(ctx, &newData); err != nil {
 		return nil, err
 	}
@@ -45,15 +47,24 @@ func (s *services) DeletePermission(ctx context.Context, id ulid.ULID) error {
 	return s.repo.Delete(ctx, currentData)
 }
 
-// EditPermission implements MutationData.
-func (s *services) EditPermission(ctx context.Context, id ulid.ULID, name, desc, url string) (*domain.Permission, error) {
+// EditPermission implements MutationData. The change applies to every
+// role holding the permission, so account uid, the administrator, must
+// hold both the current grants and the new ones, wildcards included,
+// without condition; otherwise an *authz.DelegationError is returned.
+func (s *services) EditPermission(ctx context.Context, uid, id ulid.ULID, name, desc, url string, methods []string) (*domain.Permission, error) {
 	currentData, err := s.readModel.FindById(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	next := domain.Permission{Url: url, Methods: domain.NormalizeMethods(methods)}
+	grants := append(currentData.Grants(), next.Grants()...)
+	if err := authz.CheckDelegation(ctx, s.permissions, authz.Subject{AccountId: uid}, grants); err != nil {
+		return nil, err
+	}
 	currentData.Name = name
 	currentData.Description = desc
 	currentData.Url = url
+	currentData.Methods = domain.NormalizeMethods(methods)
 	if err := s.repo.Save(ctx, currentData); err != nil {
 		return nil, err
 	}
@@ -61,16 +72,19 @@ func (s *services) EditPermission(ctx context.Context, id ulid.ULID, name, desc,
 }
 
 type MutationData interface {
-	CreatePermission(ctx context.Context, name, desc, url string) (*domain.Permission, error)
-	EditPermission(ctx context.Context, id ulid.ULID, name, desc, url string) (*domain.Permission, error)
+	CreatePermission(ctx context.Context, name, desc, url string, methods []string) (*domain.Permission, error)
+	EditPermission(ctx context.Context, uid, id ulid.ULID, name, desc, url string, methods []string) (*domain.Permission, error)
 	DeletePermission(ctx context.Context, id ulid.ULID) error
 }
 
+// NewMutationData checks with permissions that administrators only edit
+// permissions into grants they hold, see EditPermission.
 func NewMutationData(
 	repo Repo,
 	readModel ReadModel,
+	permissions authz.PermissionReader,
 ) MutationData {
-	return &services{repo: repo, readModel: readModel}
+	return &services{repo: repo, readModel: readModel, permissions: permissions}
 }
 
 type ReadData interface {
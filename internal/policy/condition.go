@@ -0,0 +1,272 @@
+// Package policy implements the condition language attached to role
+// permissions, such as
+//
+//	amount <= 50.00
+//	time between 06:00 and 23:00 and weekday != 'sun'
+//	(amount < 100 or store = 'main') and not channel = 'online'
+//
+// A condition compares request attributes with literals. Literals are
+// numbers (50, 49.99), times of day (06:00, 23:59:59) or quoted strings
+// ('sun', "main"); the literal decides how the attribute value is read.
+// Numbers and times support =, !=, <, <=, > and >=, strings only = and !=.
+// "x between a and b" is inclusive and, for times, wraps around midnight
+// when a is after b. Conditions combine with and, or, not and parentheses;
+// keywords are case insensitive.
+//
+// A condition referring to an attribute the request does not carry is not
+// satisfied.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Attributes are the request attributes a condition is evaluated against.
+type Attributes map[string]string
+
+// Attributes filled in by authz for every request.
+const (
+	AttrTime    = "time"    // time of day in the store time zone, 15:04:05
+	AttrWeekday = "weekday" // day of the week in the store time zone, mon..sun
+)
+
+// Condition is a parsed condition, ready to be evaluated.
+type Condition struct {
+	src  string
+	root node
+}
+
+// String returns the condition as it was written.
+func (c *Condition) String() string {
+	return c.src
+}
+
+// Evaluate returns nil when attrs satisfy the condition, or an error
+// explaining which part of it failed.
+func (c *Condition) Evaluate(attrs Attributes) error {
+	return c.root.eval(attrs)
+}
+
+// Validate reports whether src is a valid condition.
+func Validate(src string) error {
+	_, err := Parse(src)
+	return err
+}
+
+type node interface {
+	eval(attrs Attributes) error
+	String() string
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(attrs Attributes) error {
+	if err := n.left.eval(attrs); err != nil {
+		return err
+	}
+	return n.right.eval(attrs)
+}
+
+func (n andNode) String() string {
+	return "(" + n.left.String() + " and " + n.right.String() + ")"
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(attrs Attributes) error {
+	left := n.left.eval(attrs)
+	if left == nil {
+		return nil
+	}
+	right := n.right.eval(attrs)
+	if right == nil {
+		return nil
+	}
+	var attrErr *attributeError
+	if errors.As(left, &attrErr) || errors.As(right, &attrErr) {
+		return newAttributeError("%v; %v", left, right)
+	}
+	return fmt.Errorf("%v; %v", left, right)
+}
+
+func (n orNode) String() string {
+	return "(" + n.left.String() + " or " + n.right.String() + ")"
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(attrs Attributes) error {
+	err := n.operand.eval(attrs)
+	if err == nil {
+		return fmt.Errorf("%s is true", n.operand)
+	}
+	// A missing or unreadable attribute does not make the negation hold.
+	var attrErr *attributeError
+	if errors.As(err, &attrErr) {
+		return err
+	}
+	return nil
+}
+
+func (n notNode) String() string {
+	return "not " + n.operand.String()
+}
+
+// attributeError reports an attribute that is missing or cannot be read as
+// the literal it is compared with.
+type attributeError struct {
+	msg string
+}
+
+func (e *attributeError) Error() string {
+	return e.msg
+}
+
+func newAttributeError(format string, args ...interface{}) error {
+	return &attributeError{msg: fmt.Sprintf(format, args...)}
+}
+
+type compareNode struct {
+	attr  string
+	op    string
+	value literal
+}
+
+func (n compareNode) eval(attrs Attributes) error {
+	raw, ok := attrs[n.attr]
+	if !ok {
+		return newAttributeError("%s: attribute %s is missing", n, n.attr)
+	}
+	c, err := n.value.compare(raw)
+	if err != nil {
+		return newAttributeError("%s: %v", n, err)
+	}
+	var holds bool
+	switch n.op {
+	case "=":
+		holds = c == 0
+	case "!=":
+		holds = c != 0
+	case "<":
+		holds = c < 0
+	case "<=":
+		holds = c <= 0
+	case ">":
+		holds = c > 0
+	case ">=":
+		holds = c >= 0
+	}
+	if !holds {
+		return fmt.Errorf("%s failed, %s is %s", n, n.attr, raw)
+	}
+	return nil
+}
+
+func (n compareNode) String() string {
+	return n.attr + " " + n.op + " " + n.value.String()
+}
+
+type betweenNode struct {
+	attr      string
+	low, high literal
+}
+
+func (n betweenNode) eval(attrs Attributes) error {
+	raw, ok := attrs[n.attr]
+	if !ok {
+		return newAttributeError("%s: attribute %s is missing", n, n.attr)
+	}
+	lowCmp, err := n.low.compare(raw)
+	if err != nil {
+		return newAttributeError("%s: %v", n, err)
+	}
+	highCmp, err := n.high.compare(raw)
+	if err != nil {
+		return newAttributeError("%s: %v", n, err)
+	}
+	holds := lowCmp >= 0 && highCmp <= 0
+	if n.low.kind == timeLiteral && n.low.clock > n.high.clock {
+		// 22:00 to 06:00 spans midnight.
+		holds = lowCmp >= 0 || highCmp <= 0
+	}
+	if !holds {
+		return fmt.Errorf("%s failed, %s is %s", n, n.attr, raw)
+	}
+	return nil
+}
+
+func (n betweenNode) String() string {
+	return n.attr + " between " + n.low.String() + " and " + n.high.String()
+}
+
+type literalKind int
+
+const (
+	numberLiteral literalKind = iota
+	timeLiteral
+	stringLiteral
+)
+
+type literal struct {
+	kind   literalKind
+	src    string
+	number *big.Rat
+	clock  time.Duration
+	text   string
+}
+
+func (l literal) String() string {
+	return l.src
+}
+
+// compare reads raw the way the literal is written and returns -1, 0 or 1
+// as raw is lower than, equal to or greater than the literal.
+func (l literal) compare(raw string) (int, error) {
+	switch l.kind {
+	case numberLiteral:
+		v, ok := new(big.Rat).SetString(strings.TrimSpace(raw))
+		if !ok {
+			return 0, fmt.Errorf("%q is not a number", raw)
+		}
+		return v.Cmp(l.number), nil
+	case timeLiteral:
+		v, err := parseClock(strings.TrimSpace(raw))
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a time of day", raw)
+		}
+		switch {
+		case v < l.clock:
+			return -1, nil
+		case v > l.clock:
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return strings.Compare(raw, l.text), nil
+	}
+}
+
+// parseClock reads a time of day written 15:04 or 15:04:05.
+func parseClock(s string) (time.Duration, error) {
+	layout := "15:04"
+	if strings.Count(s, ":") == 2 {
+		layout = "15:04:05"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second, nil
+}
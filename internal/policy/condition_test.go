@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"amount <= 50.00", "amount <= 50.00"},
+		{"amount == 5", "amount = 5"},
+		{"time between 06:00 and 23:00", "time between 06:00 and 23:00"},
+		{"weekday != 'sun'", "weekday != 'sun'"},
+		{`store = "main"`, "store = 'main'"},
+		{"amount < 100 or store = 'main'", "(amount < 100 or store = 'main')"},
+		{"a = 1 or b = 2 and c = 3", "(a = 1 or (b = 2 and c = 3))"},
+		{"(a = 1 or b = 2) and c = 3", "((a = 1 or b = 2) and c = 3)"},
+		{"NOT channel = 'online' AND amount > -1", "(not channel = 'online' and amount > -1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			c, err := Parse(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.root.String(); got != tt.want {
+				t.Errorf("parsed as %s, want %s", got, tt.want)
+			}
+			if c.String() != tt.src {
+				t.Errorf("String() = %q, want %q", c.String(), tt.src)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"amount",
+		"amount <=",
+		"amount ! 5",
+		"amount <= 50 and",
+		"(amount <= 50",
+		"amount <= 50)",
+		"store < 'main'",
+		"name = 'unterminated",
+		"amount between 10 and 1",
+		"time between 06:00 and 5",
+		"weekday between 'mon' and 'fri'",
+		"time between 25:00 and 26:00",
+		"and = 1",
+		"amount <= 50 @",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			if err := Validate(src); err == nil {
+				t.Errorf("Validate(%q) = nil, want an error", src)
+			}
+		})
+	}
+	if _, err := Parse(" "); !errors.Is(err, ErrEmptyCondition) {
+		t.Errorf("Parse of a blank condition: err = %v, want %v", err, ErrEmptyCondition)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		attrs Attributes
+		want  bool
+	}{
+		{"number below", "amount <= 50", Attributes{"amount": "49.99"}, true},
+		{"number equal", "amount <= 50", Attributes{"amount": "50.00"}, true},
+		{"number above", "amount <= 50", Attributes{"amount": "50.01"}, false},
+		{"number exact decimals", "amount = 0.3", Attributes{"amount": "0.30"}, true},
+		{"not a number", "amount <= 50", Attributes{"amount": "fifty"}, false},
+		{"missing attribute", "amount <= 50", Attributes{}, false},
+		{"string equal", "weekday = 'sun'", Attributes{"weekday": "sun"}, true},
+		{"string not equal", "weekday != 'sun'", Attributes{"weekday": "sun"}, false},
+		{"time in range", "time between 06:00 and 23:00", Attributes{"time": "06:00:00"}, true},
+		{"time out of range", "time between 06:00 and 23:00", Attributes{"time": "05:59:59"}, false},
+		{"time across midnight late", "time between 22:00 and 06:00", Attributes{"time": "23:30"}, true},
+		{"time across midnight early", "time between 22:00 and 06:00", Attributes{"time": "05:00"}, true},
+		{"time across midnight day", "time between 22:00 and 06:00", Attributes{"time": "12:00"}, false},
+		{"number between", "amount between 10 and 20", Attributes{"amount": "20"}, true},
+		{"and", "amount <= 50 and weekday != 'sun'", Attributes{"amount": "10", "weekday": "sun"}, false},
+		{"or", "amount <= 50 or store = 'main'", Attributes{"amount": "100", "store": "main"}, true},
+		{"or with a missing attribute", "amount <= 50 or store = 'main'", Attributes{"store": "main"}, true},
+		{"not", "not channel = 'online'", Attributes{"channel": "store"}, true},
+		{"not with a missing attribute", "not channel = 'online'", Attributes{}, false},
+		{"not with an unreadable attribute", "not amount > 50", Attributes{"amount": "lots"}, false},
+		{"double not", "not not amount > 50", Attributes{"amount": "60"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.Evaluate(tt.attrs)
+			if got := err == nil; got != tt.want {
+				t.Errorf("Evaluate(%v) = %v, want satisfied %v", tt.attrs, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptyCondition = errors.New("policy: empty condition")
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokTime
+	tokString
+	tokOperator
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Parse compiles a condition, see the package documentation for the
+// syntax.
+func Parse(src string) (*Condition, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return nil, ErrEmptyCondition
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return &Condition{
+		src:  strings.TrimSpace(src),
+		root: root,
+	}, nil
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", start})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", start})
+			i++
+		case r == '\'' || r == '"':
+			i++
+			for i < len(runes) && runes[i] != r {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("policy: unterminated string at %d", start)
+			}
+			tokens = append(tokens, token{tokString, string(runes[start+1 : i]), start})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			i++
+			if i < len(runes) && runes[i] == '=' {
+				i++
+			}
+			op := string(runes[start:i])
+			if op == "==" {
+				op = "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("policy: unexpected \"!\" at %d", start)
+			}
+			tokens = append(tokens, token{tokOperator, op, start})
+		case unicode.IsDigit(r) || r == '-' || r == '.':
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == ':') {
+				i++
+			}
+			text := string(runes[start:i])
+			kind := tokNumber
+			if strings.Contains(text, ":") {
+				kind = tokTime
+			}
+			tokens = append(tokens, token{kind, text, start})
+		case unicode.IsLetter(r) || r == '_':
+			i++
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[start:i]), start})
+		default:
+			return nil, fmt.Errorf("policy: unexpected %q at %d", r, start)
+		}
+	}
+	tokens = append(tokens, token{tokEOF, "end of condition", len(runes)})
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("policy: "+format+" at %d", append(args, t.pos)...)
+}
+
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	switch {
+	case isKeyword(t, "not"):
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	case t.kind == tokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, p.errorf(t, "expected \")\", got %q", t.text)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	attr := p.next()
+	if attr.kind != tokIdent || isKeyword(attr, "and") || isKeyword(attr, "or") || isKeyword(attr, "between") {
+		return nil, p.errorf(attr, "expected an attribute, got %q", attr.text)
+	}
+
+	if isKeyword(p.peek(), "between") {
+		p.next()
+		low, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); !isKeyword(t, "and") {
+			return nil, p.errorf(t, "expected \"and\", got %q", t.text)
+		}
+		high, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if low.kind != high.kind {
+			return nil, p.errorf(attr, "between bounds of %s are not of the same type", attr.text)
+		}
+		if low.kind == stringLiteral {
+			return nil, p.errorf(attr, "between does not apply to strings")
+		}
+		if low.kind == numberLiteral && low.number.Cmp(high.number) > 0 {
+			return nil, p.errorf(attr, "between bounds of %s are reversed", attr.text)
+		}
+		return betweenNode{attr: attr.text, low: low, high: high}, nil
+	}
+
+	op := p.next()
+	if op.kind != tokOperator {
+		return nil, p.errorf(op, "expected an operator after %s, got %q", attr.text, op.text)
+	}
+	value, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	if value.kind == stringLiteral && op.text != "=" && op.text != "!=" {
+		return nil, p.errorf(op, "strings only compare with = and !=")
+	}
+	return compareNode{attr: attr.text, op: op.text, value: value}, nil
+}
+
+func (p *parser) parseLiteral() (literal, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, ok := new(big.Rat).SetString(t.text)
+		if !ok {
+			return literal{}, p.errorf(t, "invalid number %q", t.text)
+		}
+		return literal{kind: numberLiteral, src: t.text, number: v}, nil
+	case tokTime:
+		v, err := parseClock(t.text)
+		if err != nil {
+			return literal{}, p.errorf(t, "invalid time of day %q", t.text)
+		}
+		return literal{kind: timeLiteral, src: t.text, clock: v}, nil
+	case tokString:
+		return literal{kind: stringLiteral, src: "'" + t.text + "'", text: t.text}, nil
+	}
+	return literal{}, p.errorf(t, "expected a value, got %q", t.text)
+}
@@ -1,28 +1,32 @@
 package protected
 
 import (
+	"encoding/json"
+	"errors"
+	"math/big"
 	"net/http"
 	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/policy"
 
 	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
 )
 
+type protectedRoute struct {
+	name        string
+	route       string
+	method      string
+	description string
+	slug        string
+}
+
 func Routes() *chi.Mux {
 	r := chi.NewMux()
-	permissions := []struct {
-		name        string
-		route       string
-		method      string
-		description string
-		slug        string
-	}{
-		{"Create Sale", "/create-sale", "POST", "Adding Sale", "create-sale"},
-		{"Edit Sale", "/edit-sale", "PUT", "Editing Sale", "edit-sale"},
-		{"Refund Transaction", "/refund-transaction", "POST", "Processing Refunds", "refund-transaction"},
-		{"View Inventory", "/view-inventory", "GET", "Viewing Inventory", "view-inventory"},
-		{"Manage Inventory", "/manage-inventory", "POST", "Adding items to Inventory", "manage-inventory"},
-		{"Manage Inventory", "/manage-inventory", "PUT", "Updating Inventory", "manage-inventory"},
-		{"Manage Inventory", "/manage-inventory", "DELETE", "Removing items from Inventory", "manage-inventory"},
+	permissions := []protectedRoute{
+		{"View Inventory", "/inventory", "GET", "Viewing Inventory", "inventory"},
+		{"Manage Inventory", "/inventory", "POST", "Adding items to Inventory", "inventory"},
+		{"Manage Inventory", "/inventory", "PUT", "Updating Inventory", "inventory"},
+		{"Manage Inventory", "/inventory", "DELETE", "Removing items from Inventory", "inventory"},
 		{"Generate Reports", "/generate-reports", "GET", "Generating Reports", "generate-reports"},
 		{"Generate Reports with ID", "/generate-reports/{id}", "GET", "Generating Reports: {id}", "generate-reports/{id}"},
 		{"Customer Management", "/customer-management", "POST", "Adding Customers", "customer-management"},
@@ -33,42 +37,88 @@ func Routes() *chi.Mux {
 		{"User Management", "/user-management", "DELETE", "Deleting Users", "user-management"},
 		{"Access Settings", "/access-settings", "GET", "Accessing Settings", "access-settings"},
 	}
+	// Sales happen in an outlet: these routes are only granted through
+	// roles valid in every store or assigned in the store of the path.
+	storePermissions := []protectedRoute{
+		{"Create Sale", "/create-sale", "POST", "Adding Sale", "create-sale"},
+		{"Edit Sale", "/edit-sale", "PUT", "Editing Sale", "edit-sale"},
+		{"Refund Transaction", "/refund-transaction", "POST", "Processing Refunds", "refund-transaction"},
+	}
+
+	mount(r, permissions)
+	r.Route("/store/{"+custommiddleware.StoreParam+"}", func(r chi.Router) {
+		mount(r, storePermissions)
+	})
+
+	return r
+}
+
+// attributeHooks extract the condition attributes of the routes whose
+// conditions depend on the request body, by slug.
+var attributeHooks = map[string]custommiddleware.AttributeHook{
+	"refund-transaction": amountAttributes,
+}
 
+type amountRequest struct {
+	Amount json.Number `json:"amount"`
+}
+
+func (c amountRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Amount, validation.Required, validation.By(nonNegativeNumber)),
+	)
+}
+
+func nonNegativeNumber(value interface{}) error {
+	n, _ := value.(json.Number)
+	v, ok := new(big.Rat).SetString(n.String())
+	if !ok || v.Sign() < 0 {
+		return errors.New("must be a non-negative number")
+	}
+	return nil
+}
+
+// amountAttributes reads the amount of a sale or refund, so that a grant
+// can be limited with a condition such as amount <= 50.
+func amountAttributes(r *http.Request) (policy.Attributes, error) {
+	var body amountRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	if err := body.Validate(); err != nil {
+		return nil, err
+	}
+	return policy.Attributes{"amount": body.Amount.String()}, nil
+}
+
+func mount(r chi.Router, permissions []protectedRoute) {
 	for _, p := range permissions {
+		p := p
+		var hooks []custommiddleware.AttributeHook
+		if hook, ok := attributeHooks[p.slug]; ok {
+			hooks = append(hooks, hook)
+		}
 		r.Group(func(r chi.Router) {
-			r.Use(custommiddleware.ProtectedMiddleware(p.slug))
+			r.Use(custommiddleware.ProtectedMiddleware(p.slug, hooks...))
+			handler := func(w http.ResponseWriter, req *http.Request) {
+				_, err := w.Write([]byte(p.description))
+				if err != nil {
+					return
+				}
+			}
 			switch p.method {
 			case "GET":
-				r.Get(p.route, func(w http.ResponseWriter, req *http.Request) {
-					_, err := w.Write([]byte(p.description))
-					if err != nil {
-						return
-					}
-				})
+				r.Get(p.route, handler)
 			case "POST":
-				r.Post(p.route, func(w http.ResponseWriter, req *http.Request) {
-					_, err := w.Write([]byte(p.description))
-					if err != nil {
-						return
-					}
-				})
+				r.Post(p.route, handler)
 			case "PUT":
-				r.Put(p.route, func(w http.ResponseWriter, req *http.Request) {
-					_, err := w.Write([]byte(p.description))
-					if err != nil {
-						return
-					}
-				})
+				r.Put(p.route, handler)
 			case "DELETE":
-				r.Delete(p.route, func(w http.ResponseWriter, req *http.Request) {
-					_, err := w.Write([]byte(p.description))
-					if err != nil {
-						return
-					}
-				})
+				r.Delete(p.route, handler)
 			}
 		})
 	}
-
-	return r
 }
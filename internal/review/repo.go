@@ -0,0 +1,632 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrReviewNotFound   = errors.New("review: campaign not found")
+	ErrItemNotFound     = errors.New("review: item not found")
+	ErrReviewerNotFound = errors.New("review: reviewer account, role or store not found")
+	ErrReviewClosed     = errors.New("review: campaign closed")
+)
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+type ReviewList struct {
+	Reviews []domain.AccessReview `json:"data"`
+	Count   int                   `json:"count"`
+}
+
+var emptyList = ReviewList{
+	Reviews: []domain.AccessReview{},
+	Count:   0,
+}
+
+type ItemList struct {
+	Items []domain.ReviewItem `json:"data"`
+	Count int                 `json:"count"`
+}
+
+var emptyItemList = ItemList{
+	Items: []domain.ReviewItem{},
+	Count: 0,
+}
+
+const reviewQuery = `
+	SELECT
+		id,
+		name,
+		status,
+		include_permissions,
+		created_by,
+		created_at,
+		due_at,
+		closed_by,
+		closed_at
+	FROM
+		access_reviews
+`
+
+func scanReview(row pgx.Row, item *domain.AccessReview) error {
+	return row.Scan(
+		&item.Id,
+		&item.Name,
+		&item.Status,
+		&item.IncludePermissions,
+		&item.CreatedBy,
+		&item.CreatedAt,
+		&item.DueAt,
+		&item.ClosedBy,
+		&item.ClosedAt,
+	)
+}
+
+const itemQuery = `
+	SELECT
+		i.id,
+		i.kind,
+		i.account_id,
+		i.account_email,
+		i.role_id,
+		i.role_name,
+		i.store_id,
+		i.permission_id,
+		i.grants,
+		i.valid_from,
+		i.valid_until,
+		COALESCE(i.decision, ''),
+		i.decided_by,
+		i.decided_at,
+		i.comment,
+		i.applied_at
+	FROM
+		access_review_items i
+	JOIN
+		access_reviews ar
+	ON
+		i.review_id = ar.id
+`
+
+func scanItem(row pgx.Row, item *domain.ReviewItem) error {
+	return row.Scan(
+		&item.Id,
+		&item.Kind,
+		&item.AccountId,
+		&item.AccountEmail,
+		&item.RoleId,
+		&item.RoleName,
+		&item.StoreId,
+		&item.PermissionId,
+		&item.Grants,
+		&item.From,
+		&item.Until,
+		&item.Decision,
+		&item.DecidedBy,
+		&item.DecidedAt,
+		&item.Comment,
+		&item.AppliedAt,
+	)
+}
+
+// reviewerScope matches the items reviewed by account $3 in campaign $2,
+// those of a role or of a store it was given.
+const reviewerScope = `
+	EXISTS (
+		SELECT 1
+		FROM access_review_reviewers rv
+		WHERE rv.review_id = $2 AND rv.account_id = $3
+			AND (rv.role_id = i.role_id OR rv.store_id = i.store_id)
+	)
+`
+
+// Fetch implements ReadModel. The zero ULID as reviewerId lists every
+// campaign, otherwise only those the account reviews.
+func (r *repo) Fetch(ctx context.Context, reviewerId ulid.ULID) (ReviewList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		reviewQuery+`
+			WHERE organization_id = $1 AND ($2::bytea IS NULL OR id IN (
+				SELECT review_id FROM access_review_reviewers WHERE account_id = $2
+			))
+			ORDER BY created_at DESC;
+		`,
+		org,
+		optional(reviewerId),
+	)
+	if err != nil {
+		return emptyList, err
+	}
+	defer rows.Close()
+
+	items := []domain.AccessReview{}
+	for rows.Next() {
+		var item domain.AccessReview
+		if err := scanReview(rows, &item); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyList, err
+		}
+		item.Reviewers = []domain.Reviewer{}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyList, err
+	}
+	list := ReviewList{
+		Reviews: items,
+		Count:   len(items),
+	}
+	return list, nil
+}
+
+// FindById implements ReadModel.
+func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.AccessReview, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		reviewQuery+`
+			WHERE id = $1 AND organization_id = $2;
+		`,
+		id,
+		org,
+	)
+	var data domain.AccessReview
+	if err := scanReview(row, &data); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT account_id, role_id, store_id
+			FROM access_review_reviewers
+			WHERE review_id = $1
+			ORDER BY account_id;
+		`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	data.Reviewers = []domain.Reviewer{}
+	for rows.Next() {
+		var item domain.Reviewer
+		if err := rows.Scan(&item.AccountId, &item.RoleId, &item.StoreId); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return nil, err
+		}
+		data.Reviewers = append(data.Reviewers, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// FetchItems implements ReadModel. The zero ULID as reviewerId lists every
+// item of the campaign, otherwise only those the account reviews.
+func (r *repo) FetchItems(ctx context.Context, id, reviewerId ulid.ULID) (ItemList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyItemList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		itemQuery+`
+			WHERE ar.organization_id = $1 AND i.review_id = $2
+				AND ($3::bytea IS NULL OR `+reviewerScope+`)
+			ORDER BY i.kind, i.role_name, i.account_email, i.id;
+		`,
+		org,
+		id,
+		optional(reviewerId),
+	)
+	if err != nil {
+		return emptyItemList, err
+	}
+	defer rows.Close()
+
+	items := []domain.ReviewItem{}
+	for rows.Next() {
+		var item domain.ReviewItem
+		if err := scanItem(rows, &item); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyItemList, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyItemList, err
+	}
+	list := ItemList{
+		Items: items,
+		Count: len(items),
+	}
+	return list, nil
+}
+
+// FindItem implements ReadModel. The zero ULID as reviewerId finds any
+// item of the campaign, otherwise only one the account reviews.
+func (r *repo) FindItem(ctx context.Context, id, reviewerId, itemId ulid.ULID) (*domain.ReviewItem, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		itemQuery+`
+			WHERE ar.organization_id = $1 AND i.review_id = $2 AND i.id = $4
+				AND ($3::bytea IS NULL OR `+reviewerScope+`);
+		`,
+		org,
+		id,
+		optional(reviewerId),
+		itemId,
+	)
+	var data domain.ReviewItem
+	if err := scanItem(row, &data); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrItemNotFound
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// Save implements Repo. It snapshots the current role assignments of the
+// organization of ctx, and the role permissions when the campaign includes
+// them, as the items of the campaign. Every reviewer, and the role or store
+// it reviews, must belong to the organization.
+func (r *repo) Save(ctx context.Context, data *domain.AccessReview) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`
+			INSERT INTO access_reviews (
+				id,
+				organization_id,
+				name,
+				status,
+				include_permissions,
+				created_by,
+				created_at,
+				due_at
+			) VALUES (
+				$1,
+				$2,
+				$3,
+				$4,
+				$5,
+				$6,
+				$7,
+				$8
+			);
+		`,
+		data.Id,
+		org,
+		data.Name,
+		data.Status,
+		data.IncludePermissions,
+		data.CreatedBy,
+		data.CreatedAt,
+		data.DueAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, reviewer := range data.Reviewers {
+		tag, err := tx.Exec(
+			ctx,
+			`
+				INSERT INTO access_review_reviewers (
+					review_id,
+					account_id,
+					role_id,
+					store_id
+				)
+				SELECT $1, a.id, $3::bytea, $4::bytea
+				FROM accounts a
+				WHERE a.id = $2 AND a.organization_id = $5
+					AND ($3::bytea IS NULL OR EXISTS (
+						SELECT 1 FROM roles r WHERE r.id = $3 AND r.organization_id = $5
+					))
+					AND ($4::bytea IS NULL OR EXISTS (
+						SELECT 1 FROM stores s WHERE s.id = $4 AND s.organization_id = $5
+					));
+			`,
+			data.Id,
+			reviewer.AccountId,
+			reviewer.RoleId,
+			reviewer.StoreId,
+			org,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrReviewerNotFound
+		}
+	}
+
+	items, err := snapshot(ctx, tx, org, data.IncludePermissions)
+	if err != nil {
+		return err
+	}
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"access_review_items"},
+		[]string{
+			"id",
+			"review_id",
+			"kind",
+			"account_id",
+			"account_email",
+			"role_id",
+			"role_name",
+			"store_id",
+			"permission_id",
+			"grants",
+			"valid_from",
+			"valid_until",
+		},
+		pgx.CopyFromSlice(len(items), func(i int) ([]any, error) {
+			item := items[i]
+			grants := item.Grants
+			if grants == nil {
+				grants = []string{}
+			}
+			return []any{
+				item.Id[:],
+				data.Id[:],
+				item.Kind,
+				optionalRef(item.AccountId),
+				item.AccountEmail,
+				item.RoleId[:],
+				item.RoleName,
+				optionalRef(item.StoreId),
+				optionalRef(item.PermissionId),
+				grants,
+				item.From,
+				item.Until,
+			}, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// snapshot reads the items of a new campaign: the role assignments of org
+// that did not expire and, with permissions, the permissions of its roles.
+func snapshot(ctx context.Context, tx pgx.Tx, org ulid.ULID, permissions bool) ([]domain.ReviewItem, error) {
+	rows, err := tx.Query(
+		ctx,
+		`
+			SELECT a.id, a.email, r.id, r.name, ar.store_id, ar.valid_from, ar.valid_until
+			FROM account_roles ar
+			JOIN accounts a ON ar.account_id = a.id
+			JOIN roles r ON ar.role_id = r.id
+			WHERE a.organization_id = $1
+				AND (ar.valid_until IS NULL OR ar.valid_until > NOW());
+		`,
+		org,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []domain.ReviewItem{}
+	for rows.Next() {
+		item := domain.ReviewItem{
+			Id:   ulid.Make(),
+			Kind: domain.ReviewItemAccountRole,
+		}
+		var accountId ulid.ULID
+		if err := rows.Scan(
+			&accountId,
+			&item.AccountEmail,
+			&item.RoleId,
+			&item.RoleName,
+			&item.StoreId,
+			&item.From,
+			&item.Until,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return nil, err
+		}
+		item.AccountId = &accountId
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !permissions {
+		return items, nil
+	}
+
+	rows, err = tx.Query(
+		ctx,
+		`
+			SELECT r.id, r.name, p.id, p.url, p.methods
+			FROM role_permissions rp
+			JOIN roles r ON rp.role_id = r.id
+			JOIN permissions p ON rp.permission_id = p.id
+			WHERE r.organization_id = $1;
+		`,
+		org,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := domain.ReviewItem{
+			Id:   ulid.Make(),
+			Kind: domain.ReviewItemRolePermission,
+		}
+		var permission domain.Permission
+		if err := rows.Scan(
+			&item.RoleId,
+			&item.RoleName,
+			&permission.Id,
+			&permission.Url,
+			&permission.Methods,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return nil, err
+		}
+		item.PermissionId = &permission.Id
+		item.Grants = permission.Grants()
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Decide implements Repo. Only items of an open campaign can be decided.
+func (r *repo) Decide(ctx context.Context, id, itemId, reviewerId ulid.ULID, decision, comment string) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE access_review_items i
+			SET decision = $4, decided_by = $5, decided_at = $6, comment = $7
+			FROM access_reviews ar
+			WHERE i.review_id = ar.id AND ar.id = $2 AND i.id = $3
+				AND ar.organization_id = $1 AND ar.status = 'open';
+		`,
+		org,
+		id,
+		itemId,
+		decision,
+		reviewerId,
+		time.Now(),
+		comment,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrReviewClosed
+	}
+	return nil
+}
+
+// MarkApplied implements Repo.
+func (r *repo) MarkApplied(ctx context.Context, id, itemId ulid.ULID) error {
+	_, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE access_review_items
+			SET applied_at = $3
+			WHERE review_id = $1 AND id = $2;
+		`,
+		id,
+		itemId,
+		time.Now(),
+	)
+	return err
+}
+
+// Close implements Repo.
+func (r *repo) Close(ctx context.Context, id, closedBy ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE access_reviews
+			SET status = 'closed', closed_by = $3, closed_at = $4
+			WHERE id = $1 AND organization_id = $2 AND status = 'open';
+		`,
+		id,
+		org,
+		closedBy,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrReviewClosed
+	}
+	return nil
+}
+
+// optional turns the zero ULID into NULL.
+func optional(id ulid.ULID) *ulid.ULID {
+	if id == (ulid.ULID{}) {
+		return nil
+	}
+	return &id
+}
+
+// optionalRef turns a ULID into its bytes for COPY, nil into NULL.
+func optionalRef(id *ulid.ULID) []byte {
+	if id == nil {
+		return nil
+	}
+	return id[:]
+}
+
+type Repo interface {
+	Save(ctx context.Context, data *domain.AccessReview) error
+	Decide(ctx context.Context, id, itemId, reviewerId ulid.ULID, decision, comment string) error
+	MarkApplied(ctx context.Context, id, itemId ulid.ULID) error
+	Close(ctx context.Context, id, closedBy ulid.ULID) error
+}
+
+type ReadModel interface {
+	Fetch(ctx context.Context, reviewerId ulid.ULID) (ReviewList, error)
+	FindById(ctx context.Context, id ulid.ULID) (*domain.AccessReview, error)
+	FetchItems(ctx context.Context, id, reviewerId ulid.ULID) (ItemList, error)
+	FindItem(ctx context.Context, id, reviewerId, itemId ulid.ULID) (*domain.ReviewItem, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
+
+func NewReadModel(db *pgxpool.Pool) ReadModel {
+	return &repo{db: db}
+}
@@ -0,0 +1,323 @@
+package review
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pos/domain"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/utils/httpresponse"
+	"pos/utils/key"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/oklog/ulid/v2"
+)
+
+type reviewRoute struct {
+	svc Service
+}
+
+func NewRoute(
+	svc Service,
+) *reviewRoute {
+	return &reviewRoute{
+		svc: svc,
+	}
+}
+
+// Routes serves the campaigns. Those holding access-review:manage open,
+// close and report on them; reviewers only need to be named in a campaign
+// to list and decide on their items.
+func (p *reviewRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Get("/assigned", p.getAssignedReview)
+	r.Get("/{id}/items/assigned", p.getAssignedItems)
+	r.Put("/{id}/items/{itemId}", p.decide)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("access-review:manage"))
+		r.Post("/", p.createReview)
+		r.Get("/", p.getAllReview)
+		r.Get("/{id}", p.getOneReview)
+		r.Get("/{id}/items", p.getAllItems)
+		r.Post("/{id}/close", p.closeReview)
+		r.Get("/{id}/report", p.getReport)
+	})
+	return r
+}
+
+type reviewerRequest struct {
+	AccountId ulid.ULID  `json:"account_id"`
+	RoleId    *ulid.ULID `json:"role_id"`
+	StoreId   *ulid.ULID `json:"store_id"`
+}
+
+func (c reviewerRequest) Validate() error {
+	if (c.RoleId == nil) == (c.StoreId == nil) {
+		return errors.New("either role_id or store_id is required")
+	}
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.AccountId, validation.Required),
+	)
+}
+
+type createReviewRequest struct {
+	Name string `json:"name" validate:"required"`
+	// IncludePermissions adds the permissions of every role to the review,
+	// next to the role assignments.
+	IncludePermissions bool              `json:"include_permissions"`
+	DueAt              *time.Time        `json:"due_at"`
+	Reviewers          []reviewerRequest `json:"reviewers" validate:"required"`
+}
+
+func (c createReviewRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&c.DueAt, validation.By(futureTime)),
+		validation.Field(&c.Reviewers, validation.Required),
+	)
+}
+
+func futureTime(value interface{}) error {
+	t, _ := value.(*time.Time)
+	if t != nil && !t.After(time.Now()) {
+		return errors.New("must be in the future")
+	}
+	return nil
+}
+
+type decideRequest struct {
+	Decision string `json:"decision" validate:"required"`
+	Comment  string `json:"comment"`
+}
+
+func (c decideRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Decision, validation.Required, validation.In(domain.ReviewKeep, domain.ReviewRevoke)),
+		validation.Field(&c.Comment, validation.Length(0, 1024)),
+	)
+}
+
+// writeReviewError answers a request on a campaign that cannot be served.
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrReviewNotFound), errors.Is(err, ErrItemNotFound), errors.Is(err, ErrReviewerNotFound):
+		httpresponse.WriteError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrSelfReview):
+		httpresponse.WriteError(w, http.StatusForbidden, err)
+	case errors.Is(err, ErrReviewClosed):
+		httpresponse.WriteError(w, http.StatusConflict, err)
+	default:
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+	}
+}
+
+func (p *reviewRoute) createReview(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body createReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	reviewers := make([]domain.Reviewer, len(body.Reviewers))
+	for i, reviewer := range body.Reviewers {
+		if err := reviewer.Validate(); err != nil {
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		reviewers[i] = domain.Reviewer{
+			AccountId: reviewer.AccountId,
+			RoleId:    reviewer.RoleId,
+			StoreId:   reviewer.StoreId,
+		}
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.CreateReview(ctx, token.Id, body.Name, body.IncludePermissions, body.DueAt, reviewers)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+func (p *reviewRoute) getAllReview(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+
+	data, err := p.svc.GetAll(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Reviews, meta)
+}
+
+func (p *reviewRoute) getAssignedReview(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.GetAssigned(ctx, token.Id)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Reviews, meta)
+}
+
+func (p *reviewRoute) getOneReview(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.GetOneById(ctx, id)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *reviewRoute) getAllItems(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	p.writeItems(w, r, ulid.ULID{})
+}
+
+func (p *reviewRoute) getAssignedItems(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	token := r.Context().Value(key.UserValueKey).(*domain.Oauth)
+	p.writeItems(w, r, token.Id)
+}
+
+func (p *reviewRoute) writeItems(w http.ResponseWriter, r *http.Request, reviewerId ulid.ULID) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.GetItems(ctx, id, reviewerId)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Items, meta)
+}
+
+func (p *reviewRoute) decide(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	id, err := ulid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	itemId, err := ulid.Parse(chi.URLParam(r, "itemId"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body decideRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.Decide(ctx, token.Id, id, itemId, body.Decision, body.Comment)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *reviewRoute) closeReview(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	data, err := p.svc.Close(ctx, token.Id, id)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *reviewRoute) getReport(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.Report(ctx, id)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
@@ -0,0 +1,218 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/keyring"
+	"pos/internal/role"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+var ErrSelfReview = errors.New("review: reviewers cannot decide on their own access")
+
+type Service interface {
+	CreateReview(ctx context.Context, createdBy ulid.ULID, name string, includePermissions bool, dueAt *time.Time, reviewers []domain.Reviewer) (*domain.AccessReview, error)
+	GetAll(ctx context.Context) (ReviewList, error)
+	GetAssigned(ctx context.Context, reviewerId ulid.ULID) (ReviewList, error)
+	GetOneById(ctx context.Context, id ulid.ULID) (*domain.AccessReview, error)
+	GetItems(ctx context.Context, id, reviewerId ulid.ULID) (ItemList, error)
+	Decide(ctx context.Context, reviewerId, id, itemId ulid.ULID, decision, comment string) (*domain.ReviewItem, error)
+	Close(ctx context.Context, closedBy, id ulid.ULID) (*domain.AccessReview, error)
+	Report(ctx context.Context, id ulid.ULID) (SignedReport, error)
+}
+
+// SignedReport is a campaign report with its signature. Signature is a JWT
+// signed by the keyring, verifiable with the published keys, whose report
+// claim holds Report and whose audience is domain.AudienceReviewReport.
+type SignedReport struct {
+	Report    domain.ReviewReport `json:"report"`
+	Signature string              `json:"signature"`
+}
+
+type reportClaims struct {
+	Report domain.ReviewReport `json:"report"`
+	jwt.RegisteredClaims
+}
+
+type services struct {
+	repo           Repo
+	readModel      ReadModel
+	accountRoleSvc account.RoleAccountService
+	rolePermission role.RolePermissionService
+	keyring        *keyring.Keyring
+}
+
+// NewService returns the access reviews. Revokes are applied through
+// accountRoleSvc and rolePermission, reports signed with keyring.
+func NewService(
+	repo Repo,
+	readModel ReadModel,
+	accountRoleSvc account.RoleAccountService,
+	rolePermission role.RolePermissionService,
+	keyring *keyring.Keyring,
+) Service {
+	return &services{
+		repo:           repo,
+		readModel:      readModel,
+		accountRoleSvc: accountRoleSvc,
+		rolePermission: rolePermission,
+		keyring:        keyring,
+	}
+}
+
+// CreateReview implements Service.
+func (s *services) CreateReview(ctx context.Context, createdBy ulid.ULID, name string, includePermissions bool, dueAt *time.Time, reviewers []domain.Reviewer) (*domain.AccessReview, error) {
+	newData := domain.NewAccessReview(createdBy, name, includePermissions, dueAt, reviewers)
+	if err := s.repo.Save(ctx, &newData); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, newData.Id)
+}
+
+// GetAll implements Service.
+func (s *services) GetAll(ctx context.Context) (ReviewList, error) {
+	return s.readModel.Fetch(ctx, ulid.ULID{})
+}
+
+// GetAssigned implements Service.
+func (s *services) GetAssigned(ctx context.Context, reviewerId ulid.ULID) (ReviewList, error) {
+	return s.readModel.Fetch(ctx, reviewerId)
+}
+
+// GetOneById implements Service.
+func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.AccessReview, error) {
+	return s.readModel.FindById(ctx, id)
+}
+
+// GetItems implements Service. The zero ULID as reviewerId lists every
+// item, otherwise those the account reviews.
+func (s *services) GetItems(ctx context.Context, id, reviewerId ulid.ULID) (ItemList, error) {
+	if _, err := s.readModel.FindById(ctx, id); err != nil {
+		return emptyItemList, err
+	}
+	return s.readModel.FetchItems(ctx, id, reviewerId)
+}
+
+// Decide implements Service. The reviewer must review the role or the store
+// of the item, and cannot decide on an assignment of their own. A decision
+// can be changed until the campaign closes.
+func (s *services) Decide(ctx context.Context, reviewerId, id, itemId ulid.ULID, decision, comment string) (*domain.ReviewItem, error) {
+	data, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if data.Status != domain.ReviewOpen {
+		return nil, ErrReviewClosed
+	}
+	item, err := s.readModel.FindItem(ctx, id, reviewerId, itemId)
+	if err != nil {
+		return nil, err
+	}
+	if item.AccountId != nil && *item.AccountId == reviewerId {
+		return nil, ErrSelfReview
+	}
+	if err := s.repo.Decide(ctx, id, itemId, reviewerId, decision, comment); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindItem(ctx, id, ulid.ULID{}, itemId)
+}
+
+// Close implements Service. Every item to revoke is removed, role
+// assignments through RoleAccountService.DeleteRole and role permissions
+// through RolePermissionService.DeletePermission; items already removed
+// since the snapshot count as revoked. Undecided items are kept. On a
+// failure the campaign stays open, and closing it again carries on with
+// the items left.
+func (s *services) Close(ctx context.Context, closedBy, id ulid.ULID) (*domain.AccessReview, error) {
+	data, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if data.Status != domain.ReviewOpen {
+		return nil, ErrReviewClosed
+	}
+	items, err := s.readModel.FetchItems(ctx, id, ulid.ULID{})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items.Items {
+		if item.Decision != domain.ReviewRevoke || item.AppliedAt != nil {
+			continue
+		}
+		if err := s.revoke(ctx, closedBy, item); err != nil {
+			return nil, err
+		}
+		if err := s.repo.MarkApplied(ctx, id, item.Id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.Close(ctx, id, closedBy); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, id)
+}
+
+func (s *services) revoke(ctx context.Context, closedBy ulid.ULID, item domain.ReviewItem) error {
+	var err error
+	switch item.Kind {
+	case domain.ReviewItemAccountRole:
+		storeId := ulid.ULID{}
+		if item.StoreId != nil {
+			storeId = *item.StoreId
+		}
+		err = s.accountRoleSvc.DeleteRole(ctx, item.RoleId, *item.AccountId, storeId)
+		if errors.Is(err, account.ErrRoleNotFound) {
+			return nil
+		}
+	case domain.ReviewItemRolePermission:
+		err = s.rolePermission.DeletePermission(ctx, closedBy, item.RoleId, *item.PermissionId)
+		if errors.Is(err, role.ErrPermissionNotFound) {
+			return nil
+		}
+	}
+	return err
+}
+
+// Report implements Service.
+func (s *services) Report(ctx context.Context, id ulid.ULID) (SignedReport, error) {
+	data, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return SignedReport{}, err
+	}
+	items, err := s.readModel.FetchItems(ctx, id, ulid.ULID{})
+	if err != nil {
+		return SignedReport{}, err
+	}
+	report := domain.ReviewReport{
+		Review:      *data,
+		Items:       items.Items,
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	for _, item := range items.Items {
+		switch item.Decision {
+		case domain.ReviewKeep:
+			report.Kept++
+		case domain.ReviewRevoke:
+			report.Revoked++
+		default:
+			report.Undecided++
+		}
+	}
+	signature, err := s.keyring.Sign(&reportClaims{
+		Report: report,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience: jwt.ClaimStrings{domain.AudienceReviewReport},
+			Subject:  id.String(),
+			IssuedAt: jwt.NewNumericDate(report.GeneratedAt),
+		},
+	})
+	if err != nil {
+		return SignedReport{}, err
+	}
+	return SignedReport{Report: report, Signature: signature}, nil
+}
@@ -0,0 +1,322 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/keyring"
+	"pos/internal/role"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+var errAny = errors.New("review test: failure")
+
+// fakeReviews keeps one campaign and its items in memory.
+type fakeReviews struct {
+	Repo
+	ReadModel
+	data    domain.AccessReview
+	items   []domain.ReviewItem
+	applied []ulid.ULID
+	decided []ulid.ULID
+}
+
+func (f *fakeReviews) Decide(ctx context.Context, id, itemId, reviewerId ulid.ULID, decision, comment string) error {
+	f.decided = append(f.decided, itemId)
+	return nil
+}
+
+func (f *fakeReviews) MarkApplied(ctx context.Context, id, itemId ulid.ULID) error {
+	f.applied = append(f.applied, itemId)
+	return nil
+}
+
+func (f *fakeReviews) Close(ctx context.Context, id, closedBy ulid.ULID) error {
+	f.data.Status = domain.ReviewClosed
+	f.data.ClosedBy = &closedBy
+	return nil
+}
+
+func (f *fakeReviews) FindById(ctx context.Context, id ulid.ULID) (*domain.AccessReview, error) {
+	copied := f.data
+	return &copied, nil
+}
+
+func (f *fakeReviews) FetchItems(ctx context.Context, id, reviewerId ulid.ULID) (ItemList, error) {
+	return ItemList{Items: f.items, Count: len(f.items)}, nil
+}
+
+func (f *fakeReviews) FindItem(ctx context.Context, id, reviewerId, itemId ulid.ULID) (*domain.ReviewItem, error) {
+	for _, item := range f.items {
+		if item.Id == itemId {
+			return &item, nil
+		}
+	}
+	return nil, ErrItemNotFound
+}
+
+// fakeAccountRoles records the role assignments removed, failing with err.
+type fakeAccountRoles struct {
+	account.RoleAccountService
+	err     error
+	deleted []ulid.ULID
+	stores  []ulid.ULID
+}
+
+func (f *fakeAccountRoles) DeleteRole(ctx context.Context, rid, uid, storeId ulid.ULID) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted = append(f.deleted, uid)
+	f.stores = append(f.stores, storeId)
+	return nil
+}
+
+// fakeRolePermissions records the role permissions removed, failing with
+// err.
+type fakeRolePermissions struct {
+	role.RolePermissionService
+	err     error
+	deleted []ulid.ULID
+}
+
+func (f *fakeRolePermissions) DeletePermission(ctx context.Context, uid, rid, pid ulid.ULID) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted = append(f.deleted, pid)
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	closedBy, accountId, store := ulid.Make(), ulid.Make(), ulid.Make()
+	permissionId := ulid.Make()
+	now := time.Now()
+	assignment := func(decision string, storeId *ulid.ULID) domain.ReviewItem {
+		return domain.ReviewItem{
+			Id:        ulid.Make(),
+			Kind:      domain.ReviewItemAccountRole,
+			AccountId: &accountId,
+			RoleId:    ulid.Make(),
+			StoreId:   storeId,
+			Decision:  decision,
+		}
+	}
+	grant := func(decision string) domain.ReviewItem {
+		return domain.ReviewItem{
+			Id:           ulid.Make(),
+			Kind:         domain.ReviewItemRolePermission,
+			RoleId:       ulid.Make(),
+			PermissionId: &permissionId,
+			Decision:     decision,
+		}
+	}
+	applied := assignment(domain.ReviewRevoke, nil)
+	applied.AppliedAt = &now
+
+	tests := []struct {
+		name            string
+		status          string
+		items           []domain.ReviewItem
+		roleErr         error
+		permissionErr   error
+		wantErr         error
+		wantRoles       []ulid.ULID
+		wantStores      []ulid.ULID
+		wantPermissions []ulid.ULID
+		wantApplied     int
+	}{
+		{
+			name:        "revoked assignment",
+			status:      domain.ReviewOpen,
+			items:       []domain.ReviewItem{assignment(domain.ReviewRevoke, &store)},
+			wantRoles:   []ulid.ULID{accountId},
+			wantStores:  []ulid.ULID{store},
+			wantApplied: 1,
+		},
+		{
+			name:        "revoked assignment outside of any store",
+			status:      domain.ReviewOpen,
+			items:       []domain.ReviewItem{assignment(domain.ReviewRevoke, nil)},
+			wantRoles:   []ulid.ULID{accountId},
+			wantStores:  []ulid.ULID{{}},
+			wantApplied: 1,
+		},
+		{
+			name:            "revoked role permission",
+			status:          domain.ReviewOpen,
+			items:           []domain.ReviewItem{grant(domain.ReviewRevoke)},
+			wantPermissions: []ulid.ULID{permissionId},
+			wantApplied:     1,
+		},
+		{
+			name:   "kept and undecided items",
+			status: domain.ReviewOpen,
+			items: []domain.ReviewItem{
+				assignment(domain.ReviewKeep, nil),
+				assignment("", nil),
+				grant(domain.ReviewKeep),
+			},
+		},
+		{
+			name:   "item applied by an earlier close",
+			status: domain.ReviewOpen,
+			items:  []domain.ReviewItem{applied},
+		},
+		{
+			name:        "assignment removed since the snapshot",
+			status:      domain.ReviewOpen,
+			items:       []domain.ReviewItem{assignment(domain.ReviewRevoke, nil)},
+			roleErr:     account.ErrRoleNotFound,
+			wantApplied: 1,
+		},
+		{
+			name:          "role permission removed since the snapshot",
+			status:        domain.ReviewOpen,
+			items:         []domain.ReviewItem{grant(domain.ReviewRevoke)},
+			permissionErr: role.ErrPermissionNotFound,
+			wantApplied:   1,
+		},
+		{
+			name:    "failed revoke",
+			status:  domain.ReviewOpen,
+			items:   []domain.ReviewItem{assignment(domain.ReviewRevoke, nil)},
+			roleErr: errAny,
+			wantErr: errAny,
+		},
+		{
+			name:    "closed campaign",
+			status:  domain.ReviewClosed,
+			items:   []domain.ReviewItem{assignment(domain.ReviewRevoke, nil)},
+			wantErr: ErrReviewClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviews := &fakeReviews{
+				data:  domain.AccessReview{Id: ulid.Make(), Status: tt.status},
+				items: tt.items,
+			}
+			roles := &fakeAccountRoles{err: tt.roleErr}
+			permissions := &fakeRolePermissions{err: tt.permissionErr}
+			svc := NewService(reviews, reviews, roles, permissions, nil)
+
+			data, err := svc.Close(context.Background(), closedBy, reviews.data.Id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !equalIds(roles.deleted, tt.wantRoles) {
+				t.Errorf("assignments removed for %v, want %v", roles.deleted, tt.wantRoles)
+			}
+			if !equalIds(roles.stores, tt.wantStores) {
+				t.Errorf("assignments removed in stores %v, want %v", roles.stores, tt.wantStores)
+			}
+			if !equalIds(permissions.deleted, tt.wantPermissions) {
+				t.Errorf("permissions removed %v, want %v", permissions.deleted, tt.wantPermissions)
+			}
+			if len(reviews.applied) != tt.wantApplied {
+				t.Errorf("%d items marked applied, want %d", len(reviews.applied), tt.wantApplied)
+			}
+			if tt.wantErr != nil {
+				if tt.status == domain.ReviewOpen && reviews.data.Status != domain.ReviewOpen {
+					t.Error("campaign closed despite the failure")
+				}
+				return
+			}
+			if data.Status != domain.ReviewClosed || data.ClosedBy == nil || *data.ClosedBy != closedBy {
+				t.Errorf("campaign = %+v, want closed by %s", data, closedBy)
+			}
+		})
+	}
+}
+
+func equalIds(a, b []ulid.ULID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDecide(t *testing.T) {
+	reviewer, other := ulid.Make(), ulid.Make()
+	item := func(accountId *ulid.ULID) domain.ReviewItem {
+		return domain.ReviewItem{
+			Id:        ulid.Make(),
+			Kind:      domain.ReviewItemAccountRole,
+			AccountId: accountId,
+			RoleId:    ulid.Make(),
+		}
+	}
+	tests := []struct {
+		name    string
+		status  string
+		item    domain.ReviewItem
+		wantErr error
+	}{
+		{"assignment of another account", domain.ReviewOpen, item(&other), nil},
+		{"role permission", domain.ReviewOpen, item(nil), nil},
+		{"own assignment", domain.ReviewOpen, item(&reviewer), ErrSelfReview},
+		{"closed campaign", domain.ReviewClosed, item(&other), ErrReviewClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviews := &fakeReviews{
+				data:  domain.AccessReview{Id: ulid.Make(), Status: tt.status},
+				items: []domain.ReviewItem{tt.item},
+			}
+			svc := NewService(reviews, reviews, nil, nil, nil)
+			_, err := svc.Decide(context.Background(), reviewer, reviews.data.Id, tt.item.Id, domain.ReviewRevoke, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if decided := len(reviews.decided) > 0; decided != (tt.wantErr == nil) {
+				t.Errorf("decision recorded = %v", decided)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	k, err := keyring.New("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviews := &fakeReviews{
+		data: domain.AccessReview{Id: ulid.Make(), Status: domain.ReviewClosed},
+		items: []domain.ReviewItem{
+			{Id: ulid.Make(), Decision: domain.ReviewKeep},
+			{Id: ulid.Make(), Decision: domain.ReviewRevoke},
+			{Id: ulid.Make(), Decision: domain.ReviewRevoke},
+			{Id: ulid.Make()},
+		},
+	}
+	svc := NewService(reviews, reviews, nil, nil, k)
+	res, err := svc.Report(context.Background(), reviews.data.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Report.Kept != 1 || res.Report.Revoked != 2 || res.Report.Undecided != 1 {
+		t.Errorf("kept %d, revoked %d, undecided %d, want 1, 2, 1", res.Report.Kept, res.Report.Revoked, res.Report.Undecided)
+	}
+
+	claims := &reportClaims{}
+	if _, err := k.Parse(res.Signature, claims, jwt.WithAudience(domain.AudienceReviewReport)); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	if claims.Subject != reviews.data.Id.String() {
+		t.Errorf("subject = %q, want %s", claims.Subject, reviews.data.Id)
+	}
+	if claims.Report.Revoked != res.Report.Revoked || len(claims.Report.Items) != len(reviews.items) {
+		t.Errorf("signed report = %+v, want %+v", claims.Report, res.Report)
+	}
+}
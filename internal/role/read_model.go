@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"pos/domain"
+	"pos/internal/tenant"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -24,11 +25,16 @@ var emptyList = RoleList{
 
 // Fetch implements ReadModel.
 func (r *repo) Fetch(ctx context.Context) (RoleList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
 	var itemCount int
 
 	row := r.db.QueryRow(
 		ctx,
-		`SELECT COUNT(id) as c FROM roles`,
+		`SELECT COUNT(id) as c FROM roles WHERE organization_id = $1`,
+		org,
 	)
 	if err := row.Scan(&itemCount); err != nil {
 		log.Warn().Err(err).Msg("cannot find a count in Role")
@@ -50,9 +56,12 @@ func (r *repo) Fetch(ctx context.Context) (RoleList, error) {
 				created_at
 			FROM
 				roles
+			WHERE
+				organization_id = $1
 			ORDER BY
 				id
 		`,
+		org,
 	)
 	if err != nil {
 		return emptyList, err
@@ -93,6 +102,10 @@ func (r *repo) Fetch(ctx context.Context) (RoleList, error) {
 
 // FindById implements ReadModel.
 func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Role, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	row := r.db.QueryRow(
 		ctx,
 		`
@@ -104,9 +117,11 @@ func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Role, error)
 			FROM
 				roles
 			WHERE
-				id = $1
+				id = $1 AND
+				organization_id = $2
 		`,
 		id,
+		org,
 	)
 	var data domain.Role
 	if err := row.Scan(
@@ -119,6 +134,7 @@ func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Role, error)
 			log.Debug().Err(err).Msg("can't find any item")
 			return nil, ErrRoleNotFound
 		}
+		return nil, err
 	}
 	return &data, nil
 }
@@ -126,6 +142,8 @@ func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Role, error)
 type ReadModel interface {
 	Fetch(ctx context.Context) (RoleList, error)
 	FindById(ctx context.Context, id ulid.ULID) (*domain.Role, error)
+	FetchParents(ctx context.Context, id ulid.ULID) (RoleList, error)
+	FetchDenials(ctx context.Context, id ulid.ULID) (DenialList, error)
 }
 
 func NewReadModel(db *pgxpool.Pool) ReadModel {
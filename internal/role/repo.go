@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"pos/domain"
+	"pos/internal/database"
+	"pos/internal/tenant"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
 )
 
 var (
@@ -15,18 +18,23 @@ var (
 )
 
 type repo struct {
-	db *pgxpool.Pool
+	db database.DBTX
 }
 
 // Delete implements Repo.
 func (r *repo) Delete(ctx context.Context, data *domain.Role) error {
-	_, err := r.db.Exec(
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			DELETE FROM roles
-			WHERE id = $1
+			WHERE id = $1 AND organization_id = $2
 		`,
 		data.Id,
+		org,
 	)
 	if err != nil {
 		return err
@@ -36,11 +44,16 @@ func (r *repo) Delete(ctx context.Context, data *domain.Role) error {
 
 // Save implements Repo.
 func (r *repo) Save(ctx context.Context, data *domain.Role) error {
-	_, err := r.db.Exec(
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			INSERT INTO roles (
 				id,
+				organization_id,
 				name,
 				description,
 				created_at
@@ -48,19 +61,22 @@ func (r *repo) Save(ctx context.Context, data *domain.Role) error {
 				$1,
 				$2,
 				$3,
-				$4
+				$4,
+				$5
 			) ON CONFLICT (id) DO UPDATE
 			SET name = excluded.name,
-				description = excluded.description;
+				description = excluded.description
+			WHERE roles.organization_id = excluded.organization_id;
 		`,
 		data.Id,
+		org,
 		data.Name,
 		data.Description,
 		data.CreatedAt,
 	)
 	if err != nil {
-		pqErr := err.(*pgconn.PgError)
-		if pqErr.Code == "23505" {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return ErrRoleAlreadyExist
 		}
 		return err
@@ -71,6 +87,10 @@ func (r *repo) Save(ctx context.Context, data *domain.Role) error {
 type Repo interface {
 	Save(ctx context.Context, data *domain.Role) error
 	Delete(ctx context.Context, data *domain.Role) error
+	AddParent(ctx context.Context, roleId, parentId ulid.ULID) error
+	RemoveParent(ctx context.Context, roleId, parentId ulid.ULID) error
+	AddDenial(ctx context.Context, roleId, permissionId ulid.ULID, reason string) error
+	RemoveDenial(ctx context.Context, roleId, permissionId ulid.ULID) error
 }
 
 func NewRepo(db *pgxpool.Pool) Repo {
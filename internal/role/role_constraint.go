@@ -0,0 +1,139 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// constraintLock is the advisory lock key serialising role assignments and
+// changes to role parents, so that two concurrent changes can never break a
+// constraint together.
+const constraintLock = 0x61636374
+
+// LockConstraints takes the lock every change checked against separation
+// of duties constraints holds until tx ends.
+func LockConstraints(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, constraintLock)
+	return err
+}
+
+// CheckStaticConstraints returns a *domain.ConstraintError when one of
+// accountIds, given roleId and so every role roleId inherits from, would
+// hold two roles of a static separation of duties constraint. The roles an
+// account holds are those assigned to it that have not expired, in any
+// store, and every role they inherit from.
+func CheckStaticConstraints(ctx context.Context, tx pgx.Tx, org, roleId ulid.ULID, accountIds []ulid.ULID) error {
+	if len(accountIds) == 0 {
+		return nil
+	}
+	accounts := make([][]byte, len(accountIds))
+	for i, id := range accountIds {
+		id := id
+		accounts[i] = id[:]
+	}
+	var constraintId ulid.ULID
+	var constraintName string
+	var accountId ulid.ULID
+	var roleName string
+	var conflictName string
+	row := tx.QueryRow(
+		ctx,
+		`
+			WITH RECURSIVE added(role_id) AS (
+				SELECT $2::bytea
+				UNION
+				SELECT rp.parent_id
+				FROM role_parents rp
+				JOIN added a ON rp.role_id = a.role_id
+			),
+			held(account_id, role_id) AS (
+				SELECT ar.account_id, ar.role_id
+				FROM account_roles ar
+				WHERE ar.account_id = ANY($1::bytea[])
+					AND (ar.valid_until IS NULL OR ar.valid_until > NOW())
+				UNION
+				SELECT h.account_id, rp.parent_id
+				FROM role_parents rp
+				JOIN held h ON rp.role_id = h.role_id
+			)
+			SELECT c.id, c.name, acc.id, mine.name, other.name
+			FROM unnest($1::bytea[]) AS acc(id)
+			CROSS JOIN sod_constraints c
+			JOIN sod_constraint_roles cr ON cr.constraint_id = c.id
+			JOIN added ad ON ad.role_id = cr.role_id
+			JOIN roles mine ON mine.id = cr.role_id
+			JOIN sod_constraint_roles ocr ON ocr.constraint_id = c.id AND ocr.role_id <> cr.role_id
+			JOIN roles other ON other.id = ocr.role_id
+			WHERE c.kind = 'static' AND c.organization_id = $3
+				AND (
+					ocr.role_id IN (SELECT role_id FROM added)
+					OR EXISTS (
+						SELECT 1
+						FROM held h
+						WHERE h.account_id = acc.id AND h.role_id = ocr.role_id
+					)
+				)
+			ORDER BY c.name, acc.id, mine.name, other.name
+			LIMIT 1;
+		`,
+		accounts,
+		roleId,
+		org,
+	)
+	err := row.Scan(&constraintId, &constraintName, &accountId, &roleName, &conflictName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &domain.ConstraintError{
+		Violation: domain.ConstraintViolation{
+			Kind:           domain.SoDStatic,
+			ConstraintId:   &constraintId,
+			ConstraintName: constraintName,
+			AccountId:      &accountId,
+			Roles:          []string{roleName, conflictName},
+		},
+	}
+}
+
+// holders returns the accounts holding roleId, directly or through a role
+// inheriting from it, with an assignment that has not expired.
+func holders(ctx context.Context, tx pgx.Tx, roleId ulid.ULID) ([]ulid.ULID, error) {
+	rows, err := tx.Query(
+		ctx,
+		`
+			WITH RECURSIVE descendants(id) AS (
+				SELECT $1::bytea
+				UNION
+				SELECT rp.role_id
+				FROM role_parents rp
+				JOIN descendants d ON rp.parent_id = d.id
+			)
+			SELECT DISTINCT ar.account_id
+			FROM account_roles ar
+			JOIN descendants d ON ar.role_id = d.id
+			WHERE ar.valid_until IS NULL OR ar.valid_until > NOW();
+		`,
+		roleId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []ulid.ULID
+	for rows.Next() {
+		var id ulid.ULID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		res = append(res, id)
+	}
+	return res, rows.Err()
+}
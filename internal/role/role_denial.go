@@ -0,0 +1,160 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDenialAlreadyExist = errors.New("role: permission already denied")
+	ErrDenialNotFound     = errors.New("role: denial not found")
+)
+
+type DenialList struct {
+	Denials []domain.Denial `json:"data"`
+	Count   int             `json:"count"`
+}
+
+var emptyDenialList = DenialList{
+	Denials: []domain.Denial{},
+	Count:   0,
+}
+
+// AddDenial implements Repo. Every account holding the role, or a role
+// inheriting from it, loses the permission whatever grants it. Both the
+// role and the permission must belong to the organization of ctx.
+func (r *repo) AddDenial(ctx context.Context, roleId, permissionId ulid.ULID, reason string) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			INSERT INTO role_denials (
+				role_id,
+				permission_id,
+				reason,
+				created_at
+			)
+			SELECT r.id, p.id, $4, $5
+			FROM roles r, permissions p
+			WHERE r.id = $1 AND p.id = $2
+				AND r.organization_id = $3 AND p.organization_id = $3;
+		`,
+		roleId,
+		permissionId,
+		org,
+		reason,
+		time.Now(),
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrAssignmentTargetNotFound
+	}
+	if err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDenialAlreadyExist
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveDenial implements Repo.
+func (r *repo) RemoveDenial(ctx context.Context, roleId, permissionId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			DELETE FROM role_denials
+			WHERE role_id = $1 AND permission_id = $2
+				AND role_id IN (SELECT id FROM roles WHERE organization_id = $3);
+		`,
+		roleId,
+		permissionId,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDenialNotFound
+	}
+	return nil
+}
+
+// FetchDenials implements ReadModel. Only the denials set on the role itself
+// are returned, not those it inherits.
+func (r *repo) FetchDenials(ctx context.Context, id ulid.ULID) (DenialList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyDenialList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				p.id,
+				p.name,
+				p.url,
+				p.methods,
+				rd.reason,
+				rd.created_at
+			FROM
+				role_denials rd
+			JOIN
+				permissions p
+			ON
+				rd.permission_id = p.id
+			WHERE
+				rd.role_id = $1 AND
+				p.organization_id = $2
+			ORDER BY
+				p.url, p.id;
+		`,
+		id,
+		org,
+	)
+	if err != nil {
+		return emptyDenialList, err
+	}
+	defer rows.Close()
+
+	items := []domain.Denial{}
+	for rows.Next() {
+		var item domain.Denial
+		var permission domain.Permission
+		if err := rows.Scan(
+			&item.PermissionId,
+			&item.Name,
+			&permission.Url,
+			&permission.Methods,
+			&item.Reason,
+			&item.CreatedAt,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyDenialList, err
+		}
+		item.Grants = permission.Grants()
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyDenialList, err
+	}
+	list := DenialList{
+		Denials: items,
+		Count:   len(items),
+	}
+	return list, nil
+}
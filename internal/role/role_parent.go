@@ -0,0 +1,232 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrRoleCycle             = errors.New("role: parent would create a cycle")
+	ErrParentAlreadyAssigned = errors.New("role: parent already assigned")
+	ErrParentNotFound        = errors.New("role: parent not found")
+)
+
+// roleHierarchyLock is the advisory lock key serialising changes to
+// role_parents, so that two concurrent edges can never close a cycle.
+const roleHierarchyLock = 0x726f6c65
+
+// fetchParentEdges returns the parents of every role of org that has one.
+func fetchParentEdges(ctx context.Context, tx pgx.Tx, org ulid.ULID) (map[ulid.ULID][]ulid.ULID, error) {
+	rows, err := tx.Query(
+		ctx,
+		`
+			SELECT rp.role_id, rp.parent_id
+			FROM role_parents rp
+			JOIN roles r ON rp.role_id = r.id
+			WHERE r.organization_id = $1
+		`,
+		org,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := map[ulid.ULID][]ulid.ULID{}
+	for rows.Next() {
+		var roleId, parentId ulid.ULID
+		if err := rows.Scan(&roleId, &parentId); err != nil {
+			return nil, err
+		}
+		parents[roleId] = append(parents[roleId], parentId)
+	}
+	return parents, rows.Err()
+}
+
+// closesCycle reports whether making parentId a parent of roleId closes a
+// cycle in parents: whether roleId is parentId or one of its ancestors.
+func closesCycle(parents map[ulid.ULID][]ulid.ULID, roleId, parentId ulid.ULID) bool {
+	seen := map[ulid.ULID]bool{}
+	queue := []ulid.ULID{parentId}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == roleId {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, parents[id]...)
+	}
+	return false
+}
+
+// AddParent implements Repo. The role inherits every permission of parent;
+// the edge is refused with ErrRoleCycle when role is already an ancestor of
+// parent, and with a *domain.ConstraintError when an account holding role,
+// directly or through a role inheriting from it, would then hold two roles
+// of a static separation of duties constraint. Both roles must belong to
+// the organization of ctx.
+func (r *repo) AddParent(ctx context.Context, roleId, parentId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if roleId == parentId {
+		return ErrRoleCycle
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, roleHierarchyLock); err != nil {
+		return err
+	}
+
+	parents, err := fetchParentEdges(ctx, tx, org)
+	if err != nil {
+		return err
+	}
+	if closesCycle(parents, roleId, parentId) {
+		return ErrRoleCycle
+	}
+
+	if err := LockConstraints(ctx, tx); err != nil {
+		return err
+	}
+	accounts, err := holders(ctx, tx, roleId)
+	if err != nil {
+		return err
+	}
+	if err := CheckStaticConstraints(ctx, tx, org, parentId, accounts); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`
+			INSERT INTO role_parents (
+				role_id,
+				parent_id
+			)
+			SELECT r.id, p.id
+			FROM roles r, roles p
+			WHERE r.id = $1 AND p.id = $2
+				AND r.organization_id = $3 AND p.organization_id = $3;
+		`,
+		roleId,
+		parentId,
+		org,
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case "23505":
+				return ErrParentAlreadyAssigned
+			case "23503":
+				return ErrRoleNotFound
+			}
+		}
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RemoveParent implements Repo.
+func (r *repo) RemoveParent(ctx context.Context, roleId, parentId ulid.ULID) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			DELETE FROM role_parents
+			WHERE role_id = $1 AND parent_id = $2
+				AND role_id IN (SELECT id FROM roles WHERE organization_id = $3);
+		`,
+		roleId,
+		parentId,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrParentNotFound
+	}
+	return nil
+}
+
+// FetchParents implements ReadModel. Only the direct parents are returned.
+func (r *repo) FetchParents(ctx context.Context, id ulid.ULID) (RoleList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				r.id,
+				r.name,
+				r.description,
+				r.created_at
+			FROM
+				role_parents rp
+			JOIN
+				roles r
+			ON
+				rp.parent_id = r.id
+			WHERE
+				rp.role_id = $1 AND
+				r.organization_id = $2
+			ORDER BY
+				r.id;
+		`,
+		id,
+		org,
+	)
+	if err != nil {
+		return emptyList, err
+	}
+	defer rows.Close()
+
+	items := []domain.Role{}
+	for rows.Next() {
+		var item domain.Role
+		if err := rows.Scan(
+			&item.Id,
+			&item.Name,
+			&item.Description,
+			&item.CreatedAt,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyList, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyList, err
+	}
+	list := RoleList{
+		Roles: items,
+		Count: len(items),
+	}
+	return list, nil
+}
@@ -0,0 +1,45 @@
+package role
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+func TestClosesCycle(t *testing.T) {
+	cashier := ulid.Make()
+	supervisor := ulid.Make()
+	manager := ulid.Make()
+	auditor := ulid.Make()
+	base := ulid.Make()
+
+	// manager inherits supervisor, which inherits cashier; auditor and
+	// cashier both inherit base.
+	parents := map[ulid.ULID][]ulid.ULID{
+		manager:    {supervisor},
+		supervisor: {cashier},
+		cashier:    {base},
+		auditor:    {base},
+	}
+	tests := []struct {
+		name     string
+		role     ulid.ULID
+		parent   ulid.ULID
+		wantLoop bool
+	}{
+		{"own parent", cashier, cashier, true},
+		{"parent of its parent", supervisor, manager, true},
+		{"ancestor of an ancestor", base, manager, true},
+		{"sibling", auditor, cashier, false},
+		{"shared ancestor", manager, auditor, false},
+		{"role already inherited", manager, cashier, false},
+		{"unrelated role", ulid.Make(), base, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := closesCycle(parents, tt.role, tt.parent); got != tt.wantLoop {
+				t.Errorf("closesCycle() = %v, want %v", got, tt.wantLoop)
+			}
+		})
+	}
+}
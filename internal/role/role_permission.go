@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"pos/domain"
+	"pos/internal/tenant"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -16,12 +17,14 @@ import (
 var (
 	ErrPermissionAlreadyAssigned = errors.New("role: permission already assigned")
 	ErrPermissionNotFound        = errors.New("role: permission not found")
+	ErrAssignmentTargetNotFound  = errors.New("role: role or permission not found")
 )
 
 type ReadModelRolePermission interface {
 	FetchByPermission(ctx context.Context, id ulid.ULID) (PermissionRoleList, error)
 	FetchByRole(ctx context.Context, id ulid.ULID) (RolePermissionList, error)
 	Find(ctx context.Context, pid, rid ulid.ULID) (*domain.RolePermission, error)
+	FetchInheritedByRole(ctx context.Context, id ulid.ULID) (InheritedPermissionList, error)
 }
 
 type PermissionRoleList struct {
@@ -36,11 +39,21 @@ var emptyRole = PermissionRoleList{
 
 // FetchByPermission implements ReadModelRolePermission.
 func (r *repo) FetchByPermission(ctx context.Context, id ulid.ULID) (PermissionRoleList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyRole, err
+	}
 	var itemCount int
 	row := r.db.QueryRow(
 		ctx,
-		`SELECT COUNT(*) as c FROM role_permissions WHERE permission_id = $1`,
+		`
+			SELECT COUNT(*) as c
+			FROM role_permissions rp
+			JOIN roles r ON rp.role_id = r.id
+			WHERE rp.permission_id = $1 AND r.organization_id = $2
+		`,
 		id,
+		org,
 	)
 	if err := row.Scan(&itemCount); err != nil {
 		log.Warn().Err(err).Msg("cannot find a count in role permission")
@@ -66,9 +79,11 @@ func (r *repo) FetchByPermission(ctx context.Context, id ulid.ULID) (PermissionR
 			ON
 				rp.role_id = p.id
 			WHERE
-				rp.permission_id = $1;
+				rp.permission_id = $1 AND
+				p.organization_id = $2;
 		`,
 		id,
+		org,
 	)
 	if err != nil {
 		return emptyRole, err
@@ -105,23 +120,38 @@ func (r *repo) FetchByPermission(ctx context.Context, id ulid.ULID) (PermissionR
 	return list, nil
 }
 
+// RolePermissionList holds the grants of a role. Conditions maps the grants
+// that only apply under a condition to that condition.
 type RolePermissionList struct {
-	Permissions []string `json:"data"`
-	Count       int      `json:"count"`
+	Permissions []string          `json:"data"`
+	Conditions  map[string]string `json:"conditions"`
+	Count       int               `json:"count"`
 }
 
 var emptyPermission = RolePermissionList{
 	Permissions: []string{},
+	Conditions:  map[string]string{},
 	Count:       0,
 }
 
-// FetchByRole implements ReadModelRolePermission.
+// FetchByRole implements ReadModelRolePermission. Permissions are returned
+// in grant form, see domain.FormatGrant.
 func (r *repo) FetchByRole(ctx context.Context, id ulid.ULID) (RolePermissionList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyPermission, err
+	}
 	var itemCount int
 	row := r.db.QueryRow(
 		ctx,
-		`SELECT COUNT(*) as c FROM role_permissions WHERE role_id = $1`,
+		`
+			SELECT COUNT(*) as c
+			FROM role_permissions rp
+			JOIN roles r ON rp.role_id = r.id
+			WHERE rp.role_id = $1 AND r.organization_id = $2
+		`,
 		id,
+		org,
 	)
 	if err := row.Scan(&itemCount); err != nil {
 		log.Warn().Err(err).Msg("cannot find a count in role permission")
@@ -132,12 +162,15 @@ func (r *repo) FetchByRole(ctx context.Context, id ulid.ULID) (RolePermissionLis
 		return emptyPermission, nil
 	}
 	log.Debug().Int("count", itemCount).Msg("found role permission items")
-	items := make([]string, itemCount)
+	items := make([]string, 0, itemCount)
+	conditions := map[string]string{}
 	rows, err := r.db.Query(
 		ctx,
 		`
 			SELECT
-				p.url
+				p.url,
+				p.methods,
+				rp.condition
 			FROM
 				role_permissions rp
 			JOIN
@@ -145,57 +178,176 @@ func (r *repo) FetchByRole(ctx context.Context, id ulid.ULID) (RolePermissionLis
 			ON
 				rp.permission_id = p.id
 			WHERE
-				rp.role_id = $1;
+				rp.role_id = $1 AND
+				p.organization_id = $2
+			ORDER BY
+				p.url;
 		`,
 		id,
+		org,
 	)
 	if err != nil {
 		return emptyPermission, err
 	}
 	defer rows.Close()
 
-	var count int
-	for count = range items {
-		var url string
-		if !rows.Next() {
-			break
-		}
+	for rows.Next() {
+		var permission domain.Permission
+		var condition string
 		if err := rows.Scan(
-			&url,
+			&permission.Url,
+			&permission.Methods,
+			&condition,
 		); err != nil {
 			log.Warn().Err(err).Msg("cannot scan an item")
 			return emptyPermission, err
 		}
-		items[count] = url
+		grants := permission.Grants()
+		items = append(items, grants...)
+		if condition != "" {
+			for _, grant := range grants {
+				conditions[grant] = condition
+			}
+		}
 	}
 	list := RolePermissionList{
 		Permissions: items,
-		Count:       itemCount,
+		Conditions:  conditions,
+		Count:       len(items),
+	}
+	return list, nil
+}
+
+type InheritedPermissionList struct {
+	Permissions []domain.InheritedPermission `json:"data"`
+	Count       int                          `json:"count"`
+}
+
+var emptyInheritedPermission = InheritedPermissionList{
+	Permissions: []domain.InheritedPermission{},
+	Count:       0,
+}
+
+// FetchInheritedByRole implements ReadModelRolePermission. It returns the
+// grants of every ancestor of the role, each with the ancestor it is
+// assigned to; the role's own grants are left to FetchByRole.
+func (r *repo) FetchInheritedByRole(ctx context.Context, id ulid.ULID) (InheritedPermissionList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyInheritedPermission, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			WITH RECURSIVE ancestors(id) AS (
+				SELECT parent_id FROM role_parents WHERE role_id = $1
+				UNION
+				SELECT rp.parent_id
+				FROM role_parents rp
+				JOIN ancestors a ON rp.role_id = a.id
+			)
+			SELECT
+				r.id,
+				r.name,
+				p.url,
+				p.methods,
+				rp.condition
+			FROM
+				ancestors a
+			JOIN
+				roles r
+			ON
+				a.id = r.id
+			JOIN
+				role_permissions rp
+			ON
+				rp.role_id = r.id
+			JOIN
+				permissions p
+			ON
+				rp.permission_id = p.id
+			WHERE
+				r.id <> $1 AND
+				r.organization_id = $2
+			ORDER BY
+				p.url, r.id;
+		`,
+		id,
+		org,
+	)
+	if err != nil {
+		return emptyInheritedPermission, err
+	}
+	defer rows.Close()
+
+	items := []domain.InheritedPermission{}
+	for rows.Next() {
+		var roleId ulid.ULID
+		var roleName string
+		var permission domain.Permission
+		var condition string
+		if err := rows.Scan(
+			&roleId,
+			&roleName,
+			&permission.Url,
+			&permission.Methods,
+			&condition,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyInheritedPermission, err
+		}
+		for _, grant := range permission.Grants() {
+			items = append(items, domain.InheritedPermission{
+				Grant:     grant,
+				Condition: condition,
+				RoleId:    roleId,
+				RoleName:  roleName,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return emptyInheritedPermission, err
+	}
+	list := InheritedPermissionList{
+		Permissions: items,
+		Count:       len(items),
 	}
 	return list, nil
 }
 
 // Find implements ReadModelRolePermission.
 func (r *repo) Find(ctx context.Context, pid, rid ulid.ULID) (*domain.RolePermission, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	row := r.db.QueryRow(
 		ctx,
 		`
 			SELECT
-				permission_id,
-				role_id
+				rp.permission_id,
+				rp.role_id,
+				rp.condition
 			FROM
-				role_permissions
+				role_permissions rp
+			JOIN
+				roles r
+			ON
+				rp.role_id = r.id
 			WHERE
-				permission_id = $1 AND
-				role_id = $2
+				rp.permission_id = $1 AND
+				rp.role_id = $2 AND
+				r.organization_id = $3
 		`,
 		pid,
 		rid,
+		org,
 	)
 	var data domain.RolePermission
 	if err := row.Scan(
 		&data.PermissionId,
 		&data.RoleId,
+		&data.Condition,
 	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			log.Debug().Err(err).Msg("can't find any item")
@@ -206,50 +358,47 @@ func (r *repo) Find(ctx context.Context, pid, rid ulid.ULID) (*domain.RolePermis
 	return &data, nil
 }
 
-func (r *repo) RevokeSession(ctx context.Context, id ulid.ULID) error {
-	query := `
-		UPDATE refresh_tokens
-		SET revoked = true
-		WHERE account_id = $1;
-	`
-	if _, err := r.db.Exec(
-		ctx,
-		query,
-		id,
-	); err != nil {
-		return err
-	}
-	return nil
-}
 func NewReadModelRolePermission(db *pgxpool.Pool) ReadModelRolePermission {
 	return &repo{db: db}
 }
 
 type RepoRolePermission interface {
-	AssignPermission(ctx context.Context, roleId, permissionId ulid.ULID) error
+	AssignPermission(ctx context.Context, roleId, permissionId ulid.ULID, condition string) error
 	RemovePermission(ctx context.Context, roleId, permissionId ulid.ULID) error
-	RevokeSession(ctx context.Context, id ulid.ULID) error
 }
 
-// AssignPermission implements RepoRolePermission.
-func (r *repo) AssignPermission(ctx context.Context, roleId, permissionId ulid.ULID) error {
-	_, err := r.db.Exec(
+// AssignPermission implements RepoRolePermission. Both the role and the
+// permission must belong to the organization of ctx. An empty condition
+// grants the permission unconditionally.
+func (r *repo) AssignPermission(ctx context.Context, roleId, permissionId ulid.ULID, condition string) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
 		ctx,
 		`
 			INSERT INTO role_permissions (
 				role_id,
-				permission_id
-			) VALUES (
-				$1,
-				$2
-			);
+				permission_id,
+				condition
+			)
+			SELECT r.id, p.id, $4
+			FROM roles r, permissions p
+			WHERE r.id = $1 AND p.id = $2
+				AND r.organization_id = $3 AND p.organization_id = $3;
 		`,
 		roleId,
 		permissionId,
+		org,
+		condition,
 	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrAssignmentTargetNotFound
+	}
 	if err != nil {
-		pqErr := err.(*pgconn.PgError)
-		if pqErr.Code == "23505" {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return ErrPermissionNotFound
 		}
 		return err
@@ -259,18 +408,24 @@ func (r *repo) AssignPermission(ctx context.Context, roleId, permissionId ulid.U
 
 // RemovePermission implements RepoRolePermission.
 func (r *repo) RemovePermission(ctx context.Context, roleId, permissionId ulid.ULID) error {
-	_, err := r.db.Exec(
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		ctx,
 		`
 			DELETE FROM role_permissions 
-			WHERE permission_id = $1 AND role_id = $2;
+			WHERE permission_id = $1 AND role_id = $2
+				AND role_id IN (SELECT id FROM roles WHERE organization_id = $3);
 		`,
 		permissionId,
 		roleId,
+		org,
 	)
 	if err != nil {
-		pqErr := err.(*pgconn.PgError)
-		if pqErr.Code == "23505" {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
 			return ErrPermissionNotFound
 		}
 		return err
@@ -281,3 +436,9 @@ func (r *repo) RemovePermission(ctx context.Context, roleId, permissionId ulid.U
 func NewRepoRolePermission(db *pgxpool.Pool) RepoRolePermission {
 	return &repo{db: db}
 }
+
+// NewRepoRolePermissionTx runs the mutations in tx, leaving the commit to
+// the caller.
+func NewRepoRolePermissionTx(tx pgx.Tx) RepoRolePermission {
+	return &repo{db: tx}
+}
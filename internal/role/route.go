@@ -5,9 +5,11 @@ import (
 	"errors"
 	"net/http"
 	"pos/domain"
+	"pos/internal/authz"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/permission"
 	"pos/utils/httpresponse"
 	"pos/utils/key"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	validation "github.com/go-ozzo/ozzo-validation"
@@ -34,14 +36,239 @@ func NewRoute(
 
 func (p *roleRoute) Routes() *chi.Mux {
 	r := chi.NewMux()
-	r.Post("/", p.createRole)
 	r.Get("/", p.getAllRole)
 	r.Get("/{id}", p.getOneRole)
-	r.Patch("/{id}", p.updateRole)
-	r.Delete("/{id}", p.deleteRole)
+	r.Get("/{id}/parent", p.getParents)
+	r.Get("/{id}/deny", p.getDenials)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("role:manage"))
+		r.Post("/", p.createRole)
+		r.Patch("/{id}", p.updateRole)
+		r.Delete("/{id}", p.deleteRole)
+		r.Post("/{id}/parent", p.addParent)
+		r.Delete("/{id}/parent/{parentId}", p.removeParent)
+		r.Post("/{id}/deny", p.addDenial)
+		r.Delete("/{id}/deny/{permissionId}", p.removeDenial)
+	})
 	return r
 }
 
+type addParentRequest struct {
+	ParentId ulid.ULID `json:"parent_id" validate:"required"`
+}
+
+func (c addParentRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.ParentId, validation.Required),
+	)
+}
+
+func (p *roleRoute) getParents(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.read.GetParents(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Roles, meta)
+}
+
+func (p *roleRoute) addParent(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body addParentRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.mutate.AddParent(ctx, token.Id, id, body.ParentId); err != nil {
+		var constraintErr *domain.ConstraintError
+		var delegationErr *authz.DelegationError
+		switch {
+		case errors.As(err, &delegationErr):
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+		case errors.As(err, &constraintErr):
+			httpresponse.WriteError(w, http.StatusConflict, err)
+		case errors.Is(err, ErrRoleNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrRoleCycle), errors.Is(err, ErrParentAlreadyAssigned):
+			httpresponse.WriteError(w, http.StatusConflict, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusCreated, "success assign a parent role")
+}
+
+func (p *roleRoute) removeParent(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	id, err := ulid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	parentId, err := ulid.Parse(chi.URLParam(r, "parentId"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.mutate.RemoveParent(ctx, id, parentId); err != nil {
+		if errors.Is(err, ErrParentNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success remove a parent role")
+}
+
+type addDenialRequest struct {
+	PermissionId ulid.ULID `json:"permission_id" validate:"required"`
+	Reason       string    `json:"reason"`
+}
+
+func (c addDenialRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.PermissionId, validation.Required),
+		validation.Field(&c.Reason, validation.Length(0, 255)),
+	)
+}
+
+func (p *roleRoute) getDenials(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.read.GetDenials(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Denials, meta)
+}
+
+func (p *roleRoute) addDenial(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body addDenialRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.mutate.AddDenial(ctx, id, body.PermissionId, body.Reason); err != nil {
+		switch {
+		case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrAssignmentTargetNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, ErrDenialAlreadyExist):
+			httpresponse.WriteError(w, http.StatusConflict, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusCreated, "success deny a permission")
+}
+
+func (p *roleRoute) removeDenial(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	id, err := ulid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	permissionId, err := ulid.Parse(chi.URLParam(r, "permissionId"))
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	token := ctx.Value(key.UserValueKey).(*domain.Oauth)
+
+	if err := p.mutate.RemoveDenial(ctx, token.Id, id, permissionId); err != nil {
+		var delegationErr *authz.DelegationError
+		switch {
+		case errors.As(err, &delegationErr):
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+		case errors.Is(err, ErrDenialNotFound), errors.Is(err, permission.ErrPermissionNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success remove a denial")
+}
+
 func (p *roleRoute) deleteRole(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -189,9 +416,12 @@ func NewPermissionRoute(
 func (p *permissionRoleRoute) Routes() *chi.Mux {
 	r := chi.NewMux()
 	r.Get("/{id}/role", p.getListRole)
-	r.Post("/", p.assignPermission)
-	r.Delete("/", p.deletePermission)
 	r.Get("/{id}/permission", p.getPermission)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("role:manage"))
+		r.Post("/", p.assignPermission)
+		r.Delete("/", p.deletePermission)
+	})
 	return r
 }
 
@@ -217,9 +447,11 @@ func (p *permissionRoleRoute) getPermission(
 		return
 	}
 	var meta struct {
-		Total int `json:"total"`
+		Total      int               `json:"total"`
+		Conditions map[string]string `json:"conditions"`
 	}
 	meta.Total = data.Count
+	meta.Conditions = data.Conditions
 	httpresponse.WriteData(w, http.StatusOK, data.Permissions, meta)
 }
 
@@ -254,6 +486,9 @@ func (p *permissionRoleRoute) getListRole(
 type assignPermissionRequest struct {
 	PermissionId ulid.ULID `json:"permission_id" validate:"required"`
 	RoleId       ulid.ULID `json:"role_id" validate:"required"`
+	// Condition limits when the grant applies, see package policy; left
+	// out, the permission is granted unconditionally.
+	Condition string `json:"condition"`
 }
 
 func (c assignPermissionRequest) Validate() error {
@@ -281,21 +516,20 @@ func (p *permissionRoleRoute) assignPermission(
 		return
 	}
 
-	err := p.rolePermission.AssignPermisson(ctx, token.Id, body.RoleId, body.PermissionId)
+	err := p.rolePermission.AssignPermisson(ctx, token.Id, body.RoleId, body.PermissionId, body.Condition)
 	if err != nil {
+		var delegationErr *authz.DelegationError
+		if errors.As(err, &delegationErr) {
+			httpresponse.WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		if errors.Is(err, permission.ErrPermissionNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	cookie := http.Cookie{
-		Name:     "permissions",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		Expires:  time.Now().Add(-1 * time.Minute),
-		SameSite: http.SameSiteLaxMode,
-	}
-	http.SetCookie(w, &cookie)
 	httpresponse.WriteMessage(w, http.StatusCreated, "success assign a permission")
 }
 
@@ -321,15 +555,5 @@ func (p *permissionRoleRoute) deletePermission(
 		httpresponse.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	cookie := http.Cookie{
-		Name:     "permissions",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		Expires:  time.Now().Add(-1 * time.Minute),
-		SameSite: http.SameSiteLaxMode,
-	}
-	http.SetCookie(w, &cookie)
 	httpresponse.WriteMessage(w, http.StatusCreated, "success remove a permission")
 }
@@ -3,6 +3,8 @@ package role
 import (
 	"context"
 	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/permission"
 
 	"github.com/oklog/ulid/v2"
 )
@@ -39,15 +41,79 @@ func (s *services) EditRole(ctx context.Context, id ulid.ULID, name, desc string
 	return currentData, nil
 }
 
+// AddParent implements MutationData. Role id inherits every grant of the
+// parent, so account uid, the administrator, must hold each of them, the
+// parent's own and inherited ones, without condition; otherwise an
+// *authz.DelegationError is returned.
+func (s *services) AddParent(ctx context.Context, uid, id, parentId ulid.ULID) error {
+	if _, err := s.readModel.FindById(ctx, id); err != nil {
+		return err
+	}
+	if _, err := s.readModel.FindById(ctx, parentId); err != nil {
+		return err
+	}
+	grants, err := Grants(ctx, s.rolePermissionReadModel, parentId)
+	if err != nil {
+		return err
+	}
+	if err := authz.CheckDelegation(ctx, s.permissions, authz.Subject{AccountId: uid}, grants); err != nil {
+		return err
+	}
+	return s.repo.AddParent(ctx, id, parentId)
+}
+
+// RemoveParent implements MutationData.
+func (s *services) RemoveParent(ctx context.Context, id, parentId ulid.ULID) error {
+	return s.repo.RemoveParent(ctx, id, parentId)
+}
+
+// AddDenial implements MutationData.
+func (s *services) AddDenial(ctx context.Context, id, permissionId ulid.ULID, reason string) error {
+	if _, err := s.readModel.FindById(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.AddDenial(ctx, id, permissionId, reason)
+}
+
+// RemoveDenial implements MutationData. Lifting a denial hands the grant
+// back to every account of the role, so account uid, the administrator,
+// must hold it without condition; otherwise an *authz.DelegationError is
+// returned.
+func (s *services) RemoveDenial(ctx context.Context, uid, id, permissionId ulid.ULID) error {
+	data, err := s.permissionReadModel.FindById(ctx, permissionId)
+	if err != nil {
+		return err
+	}
+	if err := authz.CheckDelegation(ctx, s.permissions, authz.Subject{AccountId: uid}, data.Grants()); err != nil {
+		return err
+	}
+	return s.repo.RemoveDenial(ctx, id, permissionId)
+}
+
 type MutationData interface {
 	CreateRole(ctx context.Context, name, desc string) (*domain.Role, error)
 	EditRole(ctx context.Context, id ulid.ULID, name, desc string) (*domain.Role, error)
 	DeleteRole(ctx context.Context, id ulid.ULID) error
+	AddParent(ctx context.Context, uid, id, parentId ulid.ULID) error
+	RemoveParent(ctx context.Context, id, parentId ulid.ULID) error
+	AddDenial(ctx context.Context, id, permissionId ulid.ULID, reason string) error
+	RemoveDenial(ctx context.Context, uid, id, permissionId ulid.ULID) error
 }
 
+// NewMutationData checks with permissions that administrators only hand
+// out what they hold, see AddParent and RemoveDenial.
 func NewMutationData(
 	repo Repo,
 	readModel ReadModel,
+	rolePermissionReadModel ReadModelRolePermission,
+	permissionReadModel permission.ReadModel,
+	permissions authz.PermissionReader,
 ) MutationData {
-	return &services{repo: repo, readModel: readModel}
+	return &services{
+		repo:                    repo,
+		readModel:               readModel,
+		rolePermissionReadModel: rolePermissionReadModel,
+		permissionReadModel:     permissionReadModel,
+		permissions:             permissions,
+	}
 }
@@ -3,6 +3,8 @@ package role
 import (
 	"context"
 	"pos/domain"
+	"pos/internal/authz"
+	"pos/internal/permission"
 
 	"github.com/oklog/ulid/v2"
 )
@@ -12,6 +14,8 @@ type services struct {
 	readModel               ReadModel
 	rolePermissionRepo      RepoRolePermission
 	rolePermissionReadModel ReadModelRolePermission
+	permissionReadModel     permission.ReadModel
+	permissions             authz.PermissionReader
 }
 
 // GetAll implements ReadData.
@@ -29,17 +33,51 @@ func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.ReadRo
 	if err != nil {
 		return nil, err
 	}
+	parentList, err := s.readModel.FetchParents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	inheritedList, err := s.rolePermissionReadModel.FetchInheritedByRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	denialList, err := s.readModel.FetchDenials(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	data := domain.ReadRoleResponse{
-		Role:             *role,
-		TotalPermissions: permissionList.Count,
-		Permissions:      permissionList.Permissions,
+		Role:                 *role,
+		TotalPermissions:     permissionList.Count + inheritedList.Count,
+		Permissions:          permissionList.Permissions,
+		Conditions:           permissionList.Conditions,
+		Parents:              parentList.Roles,
+		InheritedPermissions: inheritedList.Permissions,
+		Denials:              denialList.Denials,
 	}
 	return &data, nil
 }
 
+// GetDenials implements ReadData.
+func (s *services) GetDenials(ctx context.Context, id ulid.ULID) (DenialList, error) {
+	if _, err := s.readModel.FindById(ctx, id); err != nil {
+		return emptyDenialList, err
+	}
+	return s.readModel.FetchDenials(ctx, id)
+}
+
+// GetParents implements ReadData.
+func (s *services) GetParents(ctx context.Context, id ulid.ULID) (RoleList, error) {
+	if _, err := s.readModel.FindById(ctx, id); err != nil {
+		return emptyList, err
+	}
+	return s.readModel.FetchParents(ctx, id)
+}
+
 type ReadData interface {
 	GetAll(ctx context.Context) (RoleList, error)
 	GetOneById(ctx context.Context, id ulid.ULID) (*domain.ReadRoleResponse, error)
+	GetParents(ctx context.Context, id ulid.ULID) (RoleList, error)
+	GetDenials(ctx context.Context, id ulid.ULID) (DenialList, error)
 }
 
 func NewReadData(
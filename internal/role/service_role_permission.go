@@ -3,6 +3,10 @@ package role
 import (
 	"context"
 	"errors"
+	"pos/internal/authz"
+	"pos/internal/permission"
+	"pos/internal/policy"
+	"strings"
 
 	"github.com/oklog/ulid/v2"
 )
@@ -10,21 +14,27 @@ import (
 type RolePermissionService interface {
 	GetPermission(ctx context.Context, rid ulid.ULID) (RolePermissionList, error)
 	GetRoleByPermission(ctx context.Context, pid ulid.ULID) (PermissionRoleList, error)
-	AssignPermisson(ctx context.Context, uid, rid, pid ulid.ULID) error
+	AssignPermisson(ctx context.Context, uid, rid, pid ulid.ULID, condition string) error
 	DeletePermission(ctx context.Context, uid, rid, pid ulid.ULID) error
 }
 
+// NewRolePermissionService checks with permissions that administrators
+// only grant what they hold, see AssignPermisson.
 func NewRolePermissionService(
 	repo Repo,
 	readModel ReadModel,
 	rolePermissionRepo RepoRolePermission,
 	rolePermissionReadModel ReadModelRolePermission,
+	permissionReadModel permission.ReadModel,
+	permissions authz.PermissionReader,
 ) RolePermissionService {
 	return &services{
 		repo:                    repo,
 		readModel:               readModel,
 		rolePermissionRepo:      rolePermissionRepo,
 		rolePermissionReadModel: rolePermissionReadModel,
+		permissionReadModel:     permissionReadModel,
+		permissions:             permissions,
 	}
 }
 
@@ -34,23 +44,31 @@ func (s *services) DeletePermission(ctx context.Context, uid, rid, pid ulid.ULID
 	if err != nil {
 		return err
 	}
-	err = s.rolePermissionRepo.RemovePermission(ctx, data.RoleId, data.PermissionId)
+	return s.rolePermissionRepo.RemovePermission(ctx, data.RoleId, data.PermissionId)
+}
+
+// AssignPermisson implements RolePermissionService. The grant only applies
+// when condition, written in the language of package policy, holds.
+// Account uid, the administrator, must hold the permission in every store
+// and without condition; otherwise an *authz.DelegationError is returned.
+func (s *services) AssignPermisson(ctx context.Context, uid, rid, pid ulid.ULID, condition string) error {
+	condition = strings.TrimSpace(condition)
+	if condition != "" {
+		if err := policy.Validate(condition); err != nil {
+			return err
+		}
+	}
+	data, err := s.permissionReadModel.FindById(ctx, pid)
 	if err != nil {
 		return err
 	}
-	return s.rolePermissionRepo.RevokeSession(ctx, uid)
-}
-
-// AssignPermisson implements RolePermissionService.
-func (s *services) AssignPermisson(ctx context.Context, uid, rid, pid ulid.ULID) error {
-	_, err := s.rolePermissionReadModel.Find(ctx, pid, rid)
+	if err := authz.CheckDelegation(ctx, s.permissions, authz.Subject{AccountId: uid}, data.Grants()); err != nil {
+		return err
+	}
+	_, err = s.rolePermissionReadModel.Find(ctx, pid, rid)
 	if err != nil {
 		if errors.Is(err, ErrPermissionNotFound) {
-			err := s.rolePermissionRepo.AssignPermission(ctx, rid, pid)
-			if err != nil {
-				return err
-			}
-			return s.rolePermissionRepo.RevokeSession(ctx, uid)
+			return s.rolePermissionRepo.AssignPermission(ctx, rid, pid, condition)
 		}
 	}
 	return ErrPermissionAlreadyAssigned
@@ -65,3 +83,21 @@ func (s *services) GetPermission(ctx context.Context, rid ulid.ULID) (RolePermis
 func (s *services) GetRoleByPermission(ctx context.Context, pid ulid.ULID) (PermissionRoleList, error) {
 	return s.rolePermissionReadModel.FetchByPermission(ctx, pid)
 }
+
+// Grants returns every grant of role id, its own and those it inherits
+// from its ancestors, conditional or not.
+func Grants(ctx context.Context, readModel ReadModelRolePermission, id ulid.ULID) ([]string, error) {
+	own, err := readModel.FetchByRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := readModel.FetchInheritedByRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := append([]string{}, own.Permissions...)
+	for _, ip := range inherited.Permissions {
+		res = append(res, ip.Grant)
+	}
+	return res, nil
+}
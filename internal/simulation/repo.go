@@ -0,0 +1,327 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"pos/domain"
+	"pos/internal/account"
+	"pos/internal/authz"
+	"pos/internal/oauth"
+	"pos/internal/role"
+	"pos/internal/tenant"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+)
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+type DiffList struct {
+	Accounts []domain.AccountDiff `json:"data"`
+	Count    int                  `json:"count"`
+}
+
+var emptyList = DiffList{
+	Accounts: []domain.AccountDiff{},
+	Count:    0,
+}
+
+// Simulate implements Repo. The changes are applied with the role and
+// account repositories in a transaction that is always rolled back; the
+// effective permissions of every account they may reach are read through
+// oauth.ReadModel before and after. Roles of dynamic separation of duties
+// constraints are left out, as in a session that activated none of them.
+// Only accounts whose permissions change are returned.
+func (r *repo) Simulate(ctx context.Context, changes domain.ChangeSet) (DiffList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	defer tx.Rollback(ctx)
+
+	accounts, err := affectedAccounts(ctx, tx, org, changes)
+	if err != nil {
+		return emptyList, err
+	}
+	if len(accounts) == 0 {
+		return emptyList, nil
+	}
+	stores, err := accountStores(ctx, tx, accounts, changes)
+	if err != nil {
+		return emptyList, err
+	}
+
+	readModel := oauth.NewReadModelTx(tx)
+	before := make(map[ulid.ULID]grantSet, len(accounts))
+	for _, id := range accounts {
+		if before[id], err = effectiveGrants(ctx, readModel, id, stores[id]); err != nil {
+			return emptyList, err
+		}
+	}
+	if err := apply(ctx, tx, changes); err != nil {
+		return emptyList, err
+	}
+
+	items := []domain.AccountDiff{}
+	for _, id := range accounts {
+		after, err := effectiveGrants(ctx, readModel, id, stores[id])
+		if err != nil {
+			return emptyList, err
+		}
+		diff := domain.AccountDiff{
+			AccountId: id,
+			Gained:    after.minus(before[id]),
+			Lost:      before[id].minus(after),
+		}
+		if len(diff.Gained) == 0 && len(diff.Lost) == 0 {
+			continue
+		}
+		items = append(items, diff)
+	}
+	if err := fillEmails(ctx, tx, items); err != nil {
+		return emptyList, err
+	}
+	list := DiffList{
+		Accounts: items,
+		Count:    len(items),
+	}
+	return list, nil
+}
+
+// apply runs changes in tx, failing on the first one that is rejected.
+func apply(ctx context.Context, tx pgx.Tx, changes domain.ChangeSet) error {
+	rolePermissionRepo := role.NewRepoRolePermissionTx(tx)
+	accountRoleRepo := account.NewRepoAccountRoleTx(tx)
+	for i, c := range changes.AddRolePermissions {
+		if err := rolePermissionRepo.AssignPermission(ctx, c.RoleId, c.PermissionId, c.Condition); err != nil {
+			return fmt.Errorf("add_role_permissions[%d]: %w", i, err)
+		}
+	}
+	for i, c := range changes.RemoveRolePermissions {
+		if err := rolePermissionRepo.RemovePermission(ctx, c.RoleId, c.PermissionId); err != nil {
+			return fmt.Errorf("remove_role_permissions[%d]: %w", i, err)
+		}
+	}
+	for i, c := range changes.AddAccountRoles {
+		if err := accountRoleRepo.AssignRole(ctx, c.RoleId, c.AccountId, c.StoreId, c.Validity); err != nil {
+			return fmt.Errorf("add_account_roles[%d]: %w", i, err)
+		}
+	}
+	for i, c := range changes.RemoveAccountRoles {
+		if err := accountRoleRepo.RemoveRole(ctx, c.AccountId, c.RoleId, c.StoreId); err != nil {
+			return fmt.Errorf("remove_account_roles[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// affectedAccounts returns the accounts of the organization named by the
+// account role changes, plus those holding a role whose permissions change
+// or a role inheriting from it, ordered by id.
+func affectedAccounts(ctx context.Context, tx pgx.Tx, org ulid.ULID, changes domain.ChangeSet) ([]ulid.ULID, error) {
+	roleIds := [][]byte{}
+	for _, list := range [][]domain.RolePermissionChange{changes.AddRolePermissions, changes.RemoveRolePermissions} {
+		for _, c := range list {
+			id := c.RoleId
+			roleIds = append(roleIds, id[:])
+		}
+	}
+	accountIds := [][]byte{}
+	for _, list := range [][]domain.AccountRoleChange{changes.AddAccountRoles, changes.RemoveAccountRoles} {
+		for _, c := range list {
+			id := c.AccountId
+			accountIds = append(accountIds, id[:])
+		}
+	}
+	rows, err := tx.Query(
+		ctx,
+		`
+			WITH RECURSIVE descendants(id) AS (
+				SELECT unnest($1::bytea[])
+				UNION
+				SELECT rp.role_id
+				FROM role_parents rp
+				JOIN descendants d ON rp.parent_id = d.id
+			)
+			SELECT a.id
+			FROM accounts a
+			WHERE a.organization_id = $3 AND (
+				a.id = ANY($2)
+				OR a.id IN (
+					SELECT ar.account_id
+					FROM account_roles ar
+					JOIN descendants d ON ar.role_id = d.id
+				)
+			)
+			ORDER BY a.id;
+		`,
+		roleIds,
+		accountIds,
+		org,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []ulid.ULID{}
+	for rows.Next() {
+		var id ulid.ULID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		res = append(res, id)
+	}
+	return res, rows.Err()
+}
+
+// accountStores returns, for each account, the stores it holds a role in
+// or would hold one in after changes.
+func accountStores(ctx context.Context, tx pgx.Tx, accounts []ulid.ULID, changes domain.ChangeSet) (map[ulid.ULID][]ulid.ULID, error) {
+	ids := make([][]byte, len(accounts))
+	for i := range accounts {
+		id := accounts[i]
+		ids[i] = id[:]
+	}
+	rows, err := tx.Query(
+		ctx,
+		`
+			SELECT DISTINCT account_id, store_id
+			FROM account_roles
+			WHERE account_id = ANY($1) AND store_id IS NOT NULL;
+		`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[[2]ulid.ULID]bool{}
+	res := map[ulid.ULID][]ulid.ULID{}
+	add := func(accountId, storeId ulid.ULID) {
+		if storeId == (ulid.ULID{}) || seen[[2]ulid.ULID{accountId, storeId}] {
+			return
+		}
+		seen[[2]ulid.ULID{accountId, storeId}] = true
+		res[accountId] = append(res[accountId], storeId)
+	}
+	for rows.Next() {
+		var accountId ulid.ULID
+		var storeId ulid.ULID
+		if err := rows.Scan(&accountId, &storeId); err != nil {
+			return nil, err
+		}
+		add(accountId, storeId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, c := range changes.AddAccountRoles {
+		add(c.AccountId, c.StoreId)
+	}
+	return res, nil
+}
+
+func fillEmails(ctx context.Context, tx pgx.Tx, items []domain.AccountDiff) error {
+	for i := range items {
+		err := tx.QueryRow(
+			ctx,
+			`SELECT email FROM accounts WHERE id = $1`,
+			items[i].AccountId,
+		).Scan(&items[i].Email)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grantSet holds the effective grants of an account by scope, the zero
+// ULID being the scope of every store, then by grant and condition.
+type grantSet map[ulid.ULID]map[[2]string]bool
+
+// effectiveGrants reads the grants of an account outside of any store and
+// in each of stores. A grant restricted by a denial is left out.
+func effectiveGrants(ctx context.Context, readModel oauth.ReadModel, accountId ulid.ULID, stores []ulid.ULID) (grantSet, error) {
+	res := grantSet{}
+	for _, storeId := range append([]ulid.ULID{{}}, stores...) {
+		list, err := readModel.GetPermissionById(ctx, accountId, storeId, ulid.ULID{})
+		if err != nil {
+			return nil, err
+		}
+		denials := authz.NewPermissionSet(nil).WithDenials(list.Denied)
+		scope := map[[2]string]bool{}
+		for _, grant := range list.Permissions {
+			if len(denials.Restricting(grant)) == 0 {
+				scope[[2]string{grant, ""}] = true
+			}
+		}
+		for _, grant := range list.Conditional {
+			if len(denials.Restricting(grant.Grant)) == 0 {
+				scope[[2]string{grant.Grant, grant.Condition}] = true
+			}
+		}
+		res[storeId] = scope
+	}
+	return res, nil
+}
+
+// minus returns the grants of s missing from other. A store grant is only
+// listed when the change is particular to the store, not when it is
+// already listed for every store.
+func (s grantSet) minus(other grantSet) []domain.SimulatedGrant {
+	global := map[[2]string]bool{}
+	res := []domain.SimulatedGrant{}
+	for key := range s[ulid.ULID{}] {
+		if !other[ulid.ULID{}][key] {
+			global[key] = true
+			res = append(res, domain.SimulatedGrant{Grant: key[0], Condition: key[1]})
+		}
+	}
+	for storeId, scope := range s {
+		if storeId == (ulid.ULID{}) {
+			continue
+		}
+		storeId := storeId
+		for key := range scope {
+			if !other[storeId][key] && !global[key] {
+				res = append(res, domain.SimulatedGrant{
+					Grant:     key[0],
+					Condition: key[1],
+					StoreId:   &storeId,
+				})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if (a.StoreId == nil) != (b.StoreId == nil) {
+			return a.StoreId == nil
+		}
+		if a.StoreId != nil && *a.StoreId != *b.StoreId {
+			return a.StoreId.Compare(*b.StoreId) < 0
+		}
+		if a.Grant != b.Grant {
+			return a.Grant < b.Grant
+		}
+		return a.Condition < b.Condition
+	})
+	return res
+}
+
+type Repo interface {
+	Simulate(ctx context.Context, changes domain.ChangeSet) (DiffList, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
@@ -0,0 +1,117 @@
+package simulation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pos/domain"
+	"pos/internal/account"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/role"
+	"pos/utils/httpresponse"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/oklog/ulid/v2"
+)
+
+// maxChanges bounds the changes of a single simulation.
+const maxChanges = 100
+
+var ErrNoChange = errors.New("simulation: the change set is empty")
+
+type simulationRoute struct {
+	svc Service
+}
+
+func NewRoute(
+	svc Service,
+) *simulationRoute {
+	return &simulationRoute{
+		svc: svc,
+	}
+}
+
+func (p *simulationRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("role:manage"))
+		r.Post("/", p.simulate)
+	})
+	return r
+}
+
+type simulateRequest struct {
+	domain.ChangeSet
+}
+
+func (c simulateRequest) Validate() error {
+	if c.Len() == 0 {
+		return ErrNoChange
+	}
+	return validation.ValidateStruct(
+		&c.ChangeSet,
+		validation.Field(&c.AddRolePermissions, validation.Length(0, maxChanges), validation.By(rolePermissionChanges)),
+		validation.Field(&c.RemoveRolePermissions, validation.Length(0, maxChanges), validation.By(rolePermissionChanges)),
+		validation.Field(&c.AddAccountRoles, validation.Length(0, maxChanges), validation.By(accountRoleChanges)),
+		validation.Field(&c.RemoveAccountRoles, validation.Length(0, maxChanges), validation.By(accountRoleChanges)),
+	)
+}
+
+func rolePermissionChanges(value interface{}) error {
+	changes, _ := value.([]domain.RolePermissionChange)
+	for _, c := range changes {
+		if c.RoleId == (ulid.ULID{}) || c.PermissionId == (ulid.ULID{}) {
+			return errors.New("role_id and permission_id are required")
+		}
+	}
+	return nil
+}
+
+func accountRoleChanges(value interface{}) error {
+	changes, _ := value.([]domain.AccountRoleChange)
+	for _, c := range changes {
+		if c.AccountId == (ulid.ULID{}) || c.RoleId == (ulid.ULID{}) {
+			return errors.New("account_id and role_id are required")
+		}
+	}
+	return nil
+}
+
+func (p *simulationRoute) simulate(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body simulateRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.svc.Simulate(ctx, body.ChangeSet)
+	if err != nil {
+		var constraintErr *domain.ConstraintError
+		switch {
+		case errors.As(err, &constraintErr),
+			errors.Is(err, account.ErrAccountRoleAlreadyAssigned):
+			httpresponse.WriteError(w, http.StatusConflict, err)
+		case errors.Is(err, account.ErrAssignmentTargetNotFound),
+			errors.Is(err, role.ErrAssignmentTargetNotFound):
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+		default:
+			httpresponse.WriteError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Accounts, meta)
+}
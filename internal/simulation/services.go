@@ -0,0 +1,38 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"pos/domain"
+	"pos/internal/policy"
+	"strings"
+)
+
+type services struct {
+	repo Repo
+}
+
+// Simulate implements Service. Nothing is changed: the result tells which
+// accounts would gain or lose which grants were changes applied.
+func (s *services) Simulate(ctx context.Context, changes domain.ChangeSet) (DiffList, error) {
+	for i := range changes.AddRolePermissions {
+		condition := strings.TrimSpace(changes.AddRolePermissions[i].Condition)
+		if condition != "" {
+			if err := policy.Validate(condition); err != nil {
+				return emptyList, fmt.Errorf("add_role_permissions[%d]: %w", i, err)
+			}
+		}
+		changes.AddRolePermissions[i].Condition = condition
+	}
+	return s.repo.Simulate(ctx, changes)
+}
+
+type Service interface {
+	Simulate(ctx context.Context, changes domain.ChangeSet) (DiffList, error)
+}
+
+func NewService(
+	repo Repo,
+) Service {
+	return &services{repo: repo}
+}
@@ -0,0 +1,392 @@
+package sod
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrConstraintNotFound     = errors.New("sod: constraint not found")
+	ErrConstraintAlreadyExist = errors.New("sod: constraint name already exists")
+	ErrRoleNotFound           = errors.New("sod: role not found")
+)
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+type ConstraintList struct {
+	Constraints []domain.SoDConstraint `json:"data"`
+	Count       int                    `json:"count"`
+}
+
+var emptyList = ConstraintList{
+	Constraints: []domain.SoDConstraint{},
+	Count:       0,
+}
+
+type ViolationList struct {
+	Violations []domain.ConstraintViolation `json:"data"`
+	Count      int                          `json:"count"`
+}
+
+var emptyViolationList = ViolationList{
+	Violations: []domain.ConstraintViolation{},
+	Count:      0,
+}
+
+const constraintQuery = `
+	SELECT
+		c.id,
+		c.name,
+		c.kind,
+		c.created_at,
+		r.id,
+		r.name,
+		r.description,
+		r.created_at
+	FROM
+		sod_constraints c
+	JOIN
+		sod_constraint_roles cr
+	ON
+		cr.constraint_id = c.id
+	JOIN
+		roles r
+	ON
+		cr.role_id = r.id
+`
+
+func scanConstraints(rows pgx.Rows) ([]domain.SoDConstraint, error) {
+	defer rows.Close()
+	items := []domain.SoDConstraint{}
+	for rows.Next() {
+		var item domain.SoDConstraint
+		var role domain.Role
+		if err := rows.Scan(
+			&item.Id,
+			&item.Name,
+			&item.Kind,
+			&item.CreatedAt,
+			&role.Id,
+			&role.Name,
+			&role.Description,
+			&role.CreatedAt,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return nil, err
+		}
+		// Rows are ordered by constraint, one per role.
+		if n := len(items); n > 0 && items[n-1].Id == item.Id {
+			items[n-1].Roles = append(items[n-1].Roles, role)
+			continue
+		}
+		item.Roles = []domain.Role{role}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Fetch implements ReadModel.
+func (r *repo) Fetch(ctx context.Context) (ConstraintList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		constraintQuery+`
+			WHERE c.organization_id = $1
+			ORDER BY c.id, r.name;
+		`,
+		org,
+	)
+	if err != nil {
+		return emptyList, err
+	}
+	items, err := scanConstraints(rows)
+	if err != nil {
+		return emptyList, err
+	}
+	list := ConstraintList{
+		Constraints: items,
+		Count:       len(items),
+	}
+	return list, nil
+}
+
+// FindById implements ReadModel.
+func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.SoDConstraint, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		constraintQuery+`
+			WHERE c.id = $1 AND c.organization_id = $2
+			ORDER BY r.name;
+		`,
+		id,
+		org,
+	)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanConstraints(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrConstraintNotFound
+	}
+	return &items[0], nil
+}
+
+// FetchViolations implements ReadModel. It reports the accounts holding
+// several roles of a static constraint, the sessions with several roles of
+// a dynamic constraint active and the roles held by more accounts than
+// they allow, as they stand after a constraint was added.
+func (r *repo) FetchViolations(ctx context.Context) (ViolationList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyViolationList, err
+	}
+	items := []domain.ConstraintViolation{}
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT c.id, c.name, c.kind, held.account_id, array_agg(DISTINCT r.name ORDER BY r.name)
+			FROM sod_constraints c
+			JOIN sod_constraint_roles cr ON cr.constraint_id = c.id
+			JOIN roles r ON cr.role_id = r.id
+			JOIN (
+				SELECT 'static' AS kind, account_id, account_id AS holder, role_id
+				FROM account_roles
+				WHERE valid_until IS NULL OR valid_until > NOW()
+				UNION ALL
+				SELECT 'dynamic', account_id, session_id, role_id
+				FROM session_roles
+			) held ON held.role_id = cr.role_id AND held.kind = c.kind
+			WHERE c.organization_id = $1
+			GROUP BY c.id, c.name, c.kind, held.account_id, held.holder
+			HAVING COUNT(DISTINCT cr.role_id) > 1
+			ORDER BY c.name, held.account_id;
+		`,
+		org,
+	)
+	if err != nil {
+		return emptyViolationList, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item domain.ConstraintViolation
+		var constraintId ulid.ULID
+		var accountId ulid.ULID
+		if err := rows.Scan(
+			&constraintId,
+			&item.ConstraintName,
+			&item.Kind,
+			&accountId,
+			&item.Roles,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyViolationList, err
+		}
+		item.ConstraintId = &constraintId
+		item.AccountId = &accountId
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyViolationList, err
+	}
+	rows.Close()
+
+	rows, err = r.db.Query(
+		ctx,
+		`
+			SELECT r.name, r.max_accounts, COUNT(DISTINCT ar.account_id)
+			FROM roles r
+			JOIN account_roles ar ON ar.role_id = r.id
+			WHERE r.organization_id = $1 AND r.max_accounts IS NOT NULL
+				AND (ar.valid_until IS NULL OR ar.valid_until > NOW())
+			GROUP BY r.id, r.name, r.max_accounts
+			HAVING COUNT(DISTINCT ar.account_id) > r.max_accounts
+			ORDER BY r.name;
+		`,
+		org,
+	)
+	if err != nil {
+		return emptyViolationList, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roleName string
+		item := domain.ConstraintViolation{Kind: domain.ViolationCardinality}
+		if err := rows.Scan(
+			&roleName,
+			&item.Limit,
+			&item.Count,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyViolationList, err
+		}
+		item.Roles = []string{roleName}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyViolationList, err
+	}
+
+	list := ViolationList{
+		Violations: items,
+		Count:      len(items),
+	}
+	return list, nil
+}
+
+// Save implements Repo. Every role of the constraint must belong to the
+// organization of ctx.
+func (r *repo) Save(ctx context.Context, data *domain.SoDConstraint) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`
+			INSERT INTO sod_constraints (
+				id,
+				organization_id,
+				name,
+				kind,
+				created_at
+			) VALUES (
+				$1,
+				$2,
+				$3,
+				$4,
+				$5
+			);
+		`,
+		data.Id,
+		org,
+		data.Name,
+		data.Kind,
+		data.CreatedAt,
+	)
+	if err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrConstraintAlreadyExist
+		}
+		return err
+	}
+
+	roleIds := make([][]byte, len(data.Roles))
+	for i, role := range data.Roles {
+		id := role.Id
+		roleIds[i] = id[:]
+	}
+	tag, err := tx.Exec(
+		ctx,
+		`
+			INSERT INTO sod_constraint_roles (
+				constraint_id,
+				role_id
+			)
+			SELECT $1, r.id
+			FROM roles r
+			WHERE r.id = ANY($2) AND r.organization_id = $3;
+		`,
+		data.Id,
+		roleIds,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if int(tag.RowsAffected()) != len(roleIds) {
+		return ErrRoleNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// Delete implements Repo.
+func (r *repo) Delete(ctx context.Context, data *domain.SoDConstraint) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		ctx,
+		`
+			DELETE FROM sod_constraints
+			WHERE id = $1 AND organization_id = $2
+		`,
+		data.Id,
+		org,
+	)
+	return err
+}
+
+// SetRoleLimit implements Repo. A nil limit lifts it.
+func (r *repo) SetRoleLimit(ctx context.Context, roleId ulid.ULID, limit *int) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(
+		ctx,
+		`
+			UPDATE roles
+			SET max_accounts = $2
+			WHERE id = $1 AND organization_id = $3
+		`,
+		roleId,
+		limit,
+		org,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+type Repo interface {
+	Save(ctx context.Context, data *domain.SoDConstraint) error
+	Delete(ctx context.Context, data *domain.SoDConstraint) error
+	SetRoleLimit(ctx context.Context, roleId ulid.ULID, limit *int) error
+}
+
+type ReadModel interface {
+	Fetch(ctx context.Context) (ConstraintList, error)
+	FindById(ctx context.Context, id ulid.ULID) (*domain.SoDConstraint, error)
+	FetchViolations(ctx context.Context) (ViolationList, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
+
+func NewReadModel(db *pgxpool.Pool) ReadModel {
+	return &repo{db: db}
+}
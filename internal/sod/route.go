@@ -0,0 +1,239 @@
+package sod
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pos/domain"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/utils/httpresponse"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/oklog/ulid/v2"
+)
+
+type sodRoute struct {
+	mutate MutationData
+	read   ReadData
+}
+
+func NewRoute(
+	mutate MutationData,
+	read ReadData,
+) *sodRoute {
+	return &sodRoute{
+		mutate: mutate,
+		read:   read,
+	}
+}
+
+func (p *sodRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Get("/", p.getAllConstraint)
+	r.Get("/violations", p.getViolations)
+	r.Get("/{id}", p.getOneConstraint)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("role:manage"))
+		r.Post("/", p.createConstraint)
+		r.Delete("/{id}", p.deleteConstraint)
+		r.Put("/role/{id}/limit", p.setRoleLimit)
+	})
+	return r
+}
+
+type createConstraintRequest struct {
+	Name string `json:"name" validate:"required"`
+	// Kind is static, the roles may not be held together, or dynamic,
+	// they may not be active together in a session.
+	Kind    string      `json:"kind" validate:"required"`
+	RoleIds []ulid.ULID `json:"role_ids" validate:"required"`
+}
+
+func (c createConstraintRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&c.Kind, validation.Required, validation.In(domain.SoDStatic, domain.SoDDynamic)),
+		validation.Field(&c.RoleIds, validation.Required, validation.By(distinctRoles)),
+	)
+}
+
+func distinctRoles(value interface{}) error {
+	ids, _ := value.([]ulid.ULID)
+	seen := make(map[ulid.ULID]bool, len(ids))
+	for _, id := range ids {
+		if id == (ulid.ULID{}) {
+			return errors.New("must not contain an empty id")
+		}
+		if seen[id] {
+			return errors.New("must not repeat a role")
+		}
+		seen[id] = true
+	}
+	if len(seen) < 2 {
+		return errors.New("must name at least two roles")
+	}
+	return nil
+}
+
+type setRoleLimitRequest struct {
+	// MaxAccounts is the most accounts that may hold the role at once,
+	// null to lift the limit.
+	MaxAccounts *int `json:"max_accounts"`
+}
+
+func (c setRoleLimitRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.MaxAccounts, validation.Min(1)),
+	)
+}
+
+func (p *sodRoute) createConstraint(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body createConstraintRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.mutate.CreateConstraint(ctx, body.Name, body.Kind, body.RoleIds)
+	if err != nil {
+		if errors.Is(err, ErrConstraintAlreadyExist) {
+			httpresponse.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		if errors.Is(err, ErrRoleNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+func (p *sodRoute) deleteConstraint(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.mutate.DeleteConstraint(ctx, id); err != nil {
+		if errors.Is(err, ErrConstraintNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success delete constraint")
+}
+
+func (p *sodRoute) getOneConstraint(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.read.GetOneById(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrConstraintNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *sodRoute) getAllConstraint(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+
+	data, err := p.read.GetAll(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Constraints, meta)
+}
+
+func (p *sodRoute) getViolations(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+
+	data, err := p.read.GetViolations(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Violations, meta)
+}
+
+func (p *sodRoute) setRoleLimit(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body setRoleLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.mutate.SetRoleLimit(ctx, id, body.MaxAccounts); err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success set role limit")
+}
@@ -0,0 +1,82 @@
+package sod
+
+import (
+	"context"
+	"pos/domain"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type services struct {
+	repo      Repo
+	readModel ReadModel
+}
+
+// GetAll implements ReadData.
+func (s *services) GetAll(ctx context.Context) (ConstraintList, error) {
+	return s.readModel.Fetch(ctx)
+}
+
+// GetOneById implements ReadData.
+func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.SoDConstraint, error) {
+	return s.readModel.FindById(ctx, id)
+}
+
+// GetViolations implements ReadData.
+func (s *services) GetViolations(ctx context.Context) (ViolationList, error) {
+	return s.readModel.FetchViolations(ctx)
+}
+
+// CreateConstraint implements MutationData. Existing assignments are left
+// as they are; GetViolations reports those breaking the new constraint.
+func (s *services) CreateConstraint(ctx context.Context, name, kind string, roleIds []ulid.ULID) (*domain.SoDConstraint, error) {
+	roles := make([]domain.Role, len(roleIds))
+	for i, id := range roleIds {
+		roles[i] = domain.Role{Id: id}
+	}
+	newData := domain.NewSoDConstraint(name, kind, roles)
+	if err := s.repo.Save(ctx, &newData); err != nil {
+		return nil, err
+	}
+	return s.readModel.FindById(ctx, newData.Id)
+}
+
+// DeleteConstraint implements MutationData.
+func (s *services) DeleteConstraint(ctx context.Context, id ulid.ULID) error {
+	currentData, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, currentData)
+}
+
+// SetRoleLimit implements MutationData.
+func (s *services) SetRoleLimit(ctx context.Context, roleId ulid.ULID, limit *int) error {
+	return s.repo.SetRoleLimit(ctx, roleId, limit)
+}
+
+type MutationData interface {
+	CreateConstraint(ctx context.Context, name, kind string, roleIds []ulid.ULID) (*domain.SoDConstraint, error)
+	DeleteConstraint(ctx context.Context, id ulid.ULID) error
+	SetRoleLimit(ctx context.Context, roleId ulid.ULID, limit *int) error
+}
+
+func NewMutationData(
+	repo Repo,
+	readModel ReadModel,
+) MutationData {
+	return &services{repo: repo, readModel: readModel}
+}
+
+type ReadData interface {
+	GetAll(ctx context.Context) (ConstraintList, error)
+	GetOneById(ctx context.Context, id ulid.ULID) (*domain.SoDConstraint, error)
+	GetViolations(ctx context.Context) (ViolationList, error)
+}
+
+func NewReadData(
+	repo Repo,
+	readModel ReadModel,
+) ReadData {
+	return &services{repo: repo, readModel: readModel}
+}
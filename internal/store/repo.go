@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"pos/domain"
+	"pos/internal/tenant"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrStoreNotFound     = errors.New("store: not found")
+	ErrStoreAlreadyExist = errors.New("store: name already exists")
+	ErrStoreHasDevices   = errors.New("store: devices are assigned to the store")
+)
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+type StoreList struct {
+	Stores []domain.Store `json:"data"`
+	Count  int            `json:"count"`
+}
+
+var emptyList = StoreList{
+	Stores: []domain.Store{},
+	Count:  0,
+}
+
+// Fetch implements ReadModel.
+func (r *repo) Fetch(ctx context.Context) (StoreList, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return emptyList, err
+	}
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				id,
+				name,
+				address,
+				timezone,
+				created_at
+			FROM
+				stores
+			WHERE
+				organization_id = $1
+			ORDER BY
+				id
+		`,
+		org,
+	)
+	if err != nil {
+		return emptyList, err
+	}
+	defer rows.Close()
+
+	items := []domain.Store{}
+	for rows.Next() {
+		var item domain.Store
+		if err := rows.Scan(
+			&item.Id,
+			&item.Name,
+			&item.Address,
+			&item.Timezone,
+			&item.CreatedAt,
+		); err != nil {
+			log.Warn().Err(err).Msg("cannot scan an item")
+			return emptyList, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return emptyList, err
+	}
+	list := StoreList{
+		Stores: items,
+		Count:  len(items),
+	}
+	return list, nil
+}
+
+// FindById implements ReadModel.
+func (r *repo) FindById(ctx context.Context, id ulid.ULID) (*domain.Store, error) {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	row := r.db.QueryRow(
+		ctx,
+		`
+			SELECT
+				id,
+				name,
+				address,
+				timezone,
+				created_at
+			FROM
+				stores
+			WHERE
+				id = $1 AND
+				organization_id = $2
+		`,
+		id,
+		org,
+	)
+	var data domain.Store
+	if err := row.Scan(
+		&data.Id,
+		&data.Name,
+		&data.Address,
+		&data.Timezone,
+		&data.CreatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Debug().Err(err).Msg("can't find any item")
+			return nil, ErrStoreNotFound
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// Delete implements Repo. Role assignments scoped to the store go with it.
+// A store devices are assigned to is kept, see ErrStoreHasDevices: they
+// must be moved or removed first.
+func (r *repo) Delete(ctx context.Context, data *domain.Store) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		ctx,
+		`
+			DELETE FROM stores
+			WHERE id = $1 AND organization_id = $2
+		`,
+		data.Id,
+		org,
+	)
+	if err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.ConstraintName == "devices_store_id_fkey" {
+			return ErrStoreHasDevices
+		}
+		return err
+	}
+	return nil
+}
+
+// Save implements Repo.
+func (r *repo) Save(ctx context.Context, data *domain.Store) error {
+	org, err := tenant.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		ctx,
+		`
+			INSERT INTO stores (
+				id,
+				organization_id,
+				name,
+				address,
+				timezone,
+				created_at
+			) VALUES (
+				$1,
+				$2,
+				$3,
+				$4,
+				$5,
+				$6
+			) ON CONFLICT (id) DO UPDATE
+			SET name = excluded.name,
+				address = excluded.address,
+				timezone = excluded.timezone
+			WHERE stores.organization_id = excluded.organization_id;
+		`,
+		data.Id,
+		org,
+		data.Name,
+		data.Address,
+		data.Timezone,
+		data.CreatedAt,
+	)
+	if err != nil {
+		var pqErr *pgconn.PgError
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrStoreAlreadyExist
+		}
+		return err
+	}
+	return nil
+}
+
+type Repo interface {
+	Save(ctx context.Context, data *domain.Store) error
+	Delete(ctx context.Context, data *domain.Store) error
+}
+
+type ReadModel interface {
+	Fetch(ctx context.Context) (StoreList, error)
+	FindById(ctx context.Context, id ulid.ULID) (*domain.Store, error)
+}
+
+func NewRepo(db *pgxpool.Pool) Repo {
+	return &repo{db: db}
+}
+
+func NewReadModel(db *pgxpool.Pool) ReadModel {
+	return &repo{db: db}
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	custommiddleware "pos/internal/custom_middleware"
+	"pos/utils/httpresponse"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/oklog/ulid/v2"
+)
+
+type storeRoute struct {
+	mutate MutationData
+	read   ReadData
+}
+
+func NewRoute(
+	mutate MutationData,
+	read ReadData,
+) *storeRoute {
+	return &storeRoute{
+		mutate: mutate,
+		read:   read,
+	}
+}
+
+// Routes serves the stores. Creating, changing and removing a store
+// requires store:manage: the time zone of a store is the clock its time
+// conditions are evaluated against.
+func (p *storeRoute) Routes() *chi.Mux {
+	r := chi.NewMux()
+	r.Get("/", p.getAllStore)
+	r.Get("/{id}", p.getOneStore)
+	r.Group(func(r chi.Router) {
+		r.Use(custommiddleware.ProtectedMiddleware("store:manage"))
+		r.Post("/", p.createStore)
+		r.Patch("/{id}", p.updateStore)
+		r.Delete("/{id}", p.deleteStore)
+	})
+	return r
+}
+
+type createStoreRequest struct {
+	Name    string `json:"name" validate:"required"`
+	Address string `json:"address"`
+	// Timezone is an IANA time zone name such as Asia/Jakarta, UTC when
+	// left out.
+	Timezone string `json:"timezone"`
+}
+
+func (c createStoreRequest) Validate() error {
+	return validation.ValidateStruct(
+		&c,
+		validation.Field(&c.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&c.Timezone, validation.Length(0, 64), validation.By(knownTimezone)),
+	)
+}
+
+func knownTimezone(value interface{}) error {
+	name, _ := value.(string)
+	if name == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return errors.New("must be a known time zone")
+	}
+	return nil
+}
+
+func (p *storeRoute) deleteStore(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	if err := p.mutate.DeleteStore(ctx, id); err != nil {
+		if errors.Is(err, ErrStoreNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if errors.Is(err, ErrStoreHasDevices) {
+			httpresponse.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteMessage(w, http.StatusOK, "success delete store")
+}
+
+func (p *storeRoute) updateStore(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var body createStoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.mutate.EditStore(ctx, id, body.Name, body.Address, body.Timezone)
+	if err != nil {
+		if errors.Is(err, ErrStoreNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *storeRoute) createStore(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var body createStoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.mutate.CreateStore(ctx, body.Name, body.Address, body.Timezone)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusCreated, data, nil)
+}
+
+func (p *storeRoute) getOneStore(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	idStr := chi.URLParam(r, "id")
+	id, err := ulid.Parse(idStr)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+
+	data, err := p.read.GetOneById(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrStoreNotFound) {
+			httpresponse.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	httpresponse.WriteData(w, http.StatusOK, data, nil)
+}
+
+func (p *storeRoute) getAllStore(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	ctx := r.Context()
+
+	data, err := p.read.GetAll(ctx)
+	if err != nil {
+		httpresponse.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var meta struct {
+		Total int `json:"total"`
+	}
+	meta.Total = data.Count
+	httpresponse.WriteData(w, http.StatusOK, data.Stores, meta)
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"pos/domain"
+	"pos/internal/authz"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type services struct {
+	repo      Repo
+	readModel ReadModel
+	stores    authz.StoreInvalidator
+}
+
+// GetAll implements ReadData.
+func (s *services) GetAll(ctx context.Context) (StoreList, error) {
+	return s.readModel.Fetch(ctx)
+}
+
+// GetOneById implements ReadData.
+func (s *services) GetOneById(ctx context.Context, id ulid.ULID) (*domain.Store, error) {
+	return s.readModel.FindById(ctx, id)
+}
+
+// CreateStore implements MutationData.
+func (s *services) CreateStore(ctx context.Context, name, address, timezone string) (*domain.Store, error) {
+	newData := domain.NewStore(name, address, timezone)
+	if err := s.repo.Save(ctx, &newData); err != nil {
+		return nil, err
+	}
+	return &newData, nil
+}
+
+// EditStore implements MutationData. The cached time zone of the store is
+// dropped, so that time conditions follow a new one.
+func (s *services) EditStore(ctx context.Context, id ulid.ULID, name, address, timezone string) (*domain.Store, error) {
+	currentData, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	currentData.Name = name
+	currentData.Address = address
+	if timezone != "" {
+		currentData.Timezone = timezone
+	}
+	if err := s.repo.Save(ctx, currentData); err != nil {
+		return nil, err
+	}
+	s.stores.InvalidateStore(id)
+	return currentData, nil
+}
+
+// DeleteStore implements MutationData.
+func (s *services) DeleteStore(ctx context.Context, id ulid.ULID) error {
+	currentData, err := s.readModel.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, currentData); err != nil {
+		return err
+	}
+	s.stores.InvalidateStore(id)
+	return nil
+}
+
+type MutationData interface {
+	CreateStore(ctx context.Context, name, address, timezone string) (*domain.Store, error)
+	EditStore(ctx context.Context, id ulid.ULID, name, address, timezone string) (*domain.Store, error)
+	DeleteStore(ctx context.Context, id ulid.ULID) error
+}
+
+// NewMutationData drops what stores has cached about a store as it changes
+// or goes away.
+func NewMutationData(
+	repo Repo,
+	readModel ReadModel,
+	stores authz.StoreInvalidator,
+) MutationData {
+	return &services{repo: repo, readModel: readModel, stores: stores}
+}
+
+type ReadData interface {
+	GetAll(ctx context.Context) (StoreList, error)
+	GetOneById(ctx context.Context, id ulid.ULID) (*domain.Store, error)
+}
+
+func NewReadData(
+	repo Repo,
+	readModel ReadModel,
+) ReadData {
+	return &services{repo: repo, readModel: readModel}
+}
@@ -0,0 +1,31 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// ErrNoTenant is returned by repositories asked for data without an
+// organization in the context: they fail closed rather than read across
+// organizations.
+var ErrNoTenant = errors.New("tenant: no organization in context")
+
+type key int
+
+const organizationKey key = iota
+
+// WithOrganization returns a copy of ctx scoped to an organization.
+func WithOrganization(ctx context.Context, id ulid.ULID) context.Context {
+	return context.WithValue(ctx, organizationKey, id)
+}
+
+// FromContext returns the organization ctx is scoped to.
+func FromContext(ctx context.Context) (ulid.ULID, error) {
+	id, ok := ctx.Value(organizationKey).(ulid.ULID)
+	if !ok || id == (ulid.ULID{}) {
+		return ulid.ULID{}, ErrNoTenant
+	}
+	return id, nil
+}
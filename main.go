@@ -5,13 +5,29 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"pos/internal/account"
+	"pos/internal/approval"
+	"pos/internal/authz"
 	custommiddleware "pos/internal/custom_middleware"
+	"pos/internal/decision"
+	"pos/internal/device"
+	"pos/internal/keyring"
 	"pos/internal/oauth"
+	"pos/internal/organization"
+	"pos/internal/override"
 	"pos/internal/permission"
 	"pos/internal/protected"
+	"pos/internal/review"
 	"pos/internal/role"
+	"pos/internal/simulation"
+	"pos/internal/sod"
+	"pos/internal/store"
+	"syscall"
 	"time"
+	// Store time zones must resolve on hosts without a zoneinfo database.
+	_ "time/tzdata"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -27,6 +43,9 @@ func main() {
 
 	cfg := loadConfig(configFileName)
 	log.Debug().Any("config", cfg).Msg("config loaded")
+	if err := cfg.validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid config")
+	}
 
 	ctx := context.Background()
 
@@ -34,7 +53,12 @@ func main() {
 	if err != nil {
 		log.Error().Err(err).Msg("unable to connect to database")
 	}
-	custommiddleware.SetJwtSecret(cfg.JwtCfg.Secret)
+	jwtKeyring, err := keyring.New(cfg.JwtCfg.KeysDir, cfg.JwtCfg.Secret)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to load signing keys")
+	}
+	go reloadKeyringOnSighup(jwtKeyring)
+	custommiddleware.SetKeyring(jwtKeyring)
 
 	r := chi.NewRouter()
 	r.Use(middleware.RealIP)
@@ -53,6 +77,31 @@ func main() {
 	rolePermissionReadModel := role.NewReadModelRolePermission(pool)
 	accountRoleRepo := account.NewRepoAccountRole(pool)
 	accountRoleReadModel := account.NewReadModelAccountRole(pool)
+	storeRepo := store.NewRepo(pool)
+	storeReadModel := store.NewReadModel(pool)
+	organizationRepo := organization.NewRepo(pool)
+	organizationReadModel := organization.NewReadModel(pool)
+	sodRepo := sod.NewRepo(pool)
+	simulationRepo := simulation.NewRepo(pool)
+	sodReadModel := sod.NewReadModel(pool)
+	approvalRepo := approval.NewRepo(pool)
+	approvalReadModel := approval.NewReadModel(pool)
+	reviewRepo := review.NewRepo(pool)
+	reviewReadModel := review.NewReadModel(pool)
+	overrideRepo := override.NewRepo(pool)
+	overrideReadModel := override.NewReadModel(pool)
+	deviceRepo := device.NewRepo(pool)
+	deviceReadModel := device.NewReadModel(pool)
+	accountPinRepo := account.NewRepoPin(pool)
+	accountPinReadModel := account.NewReadModelPin(pool)
+	accountPasswordRepo := account.NewRepoPassword(pool)
+
+	permissionResolver := authz.NewResolver(
+		oauth.NewPermissionSource(oauthReadModel, storeReadModel),
+		time.Second*time.Duration(cfg.AuthzCfg.CacheTTL),
+	)
+	go permissionResolver.Listen(ctx, pool)
+	custommiddleware.SetPermissionResolver(permissionResolver)
 
 	readDataPermission := permission.NewReadData(
 		permissionRepo,
@@ -61,6 +110,7 @@ func main() {
 	mutateDataPermission := permission.NewMutationData(
 		permissionRepo,
 		permissionReadModel,
+		permissionResolver,
 	)
 	readDataRole := role.NewReadData(
 		roleRepo,
@@ -71,6 +121,9 @@ func main() {
 	mutateDataRole := role.NewMutationData(
 		roleRepo,
 		roleReadModel,
+		rolePermissionReadModel,
+		permissionReadModel,
+		permissionResolver,
 	)
 	readDataAccount := account.NewReadData(
 		accountRepo,
@@ -79,29 +132,133 @@ func main() {
 	mutateDataAccount := account.NewMutationData(
 		accountRepo,
 		accountReadModel,
+		accountRoleReadModel,
+		rolePermissionReadModel,
+		permissionReadModel,
+		permissionResolver,
+	)
+	readDataStore := store.NewReadData(
+		storeRepo,
+		storeReadModel,
+	)
+	mutateDataStore := store.NewMutationData(
+		storeRepo,
+		storeReadModel,
+		permissionResolver,
+	)
+	readDataSoD := sod.NewReadData(
+		sodRepo,
+		sodReadModel,
+	)
+	mutateDataSoD := sod.NewMutationData(
+		sodRepo,
+		sodReadModel,
+	)
+	simulationSvc := simulation.NewService(
+		simulationRepo,
+	)
+	organizationSvc := organization.NewService(
+		organizationRepo,
+		organizationReadModel,
 	)
+	pinSvc := account.NewPinService(
+		accountReadModel,
+		accountPinRepo,
+		accountPinReadModel,
+		cfg.SessionCfg.PinMaxFailures,
+		cfg.SessionCfg.PinMaxLockouts,
+		time.Minute*time.Duration(cfg.SessionCfg.PinLockout),
+	)
+	passwordSvc := account.NewPasswordService(
+		accountReadModel,
+		accountPasswordRepo,
+		cfg.SessionCfg.PinMaxFailures,
+		time.Minute*time.Duration(cfg.SessionCfg.PinLockout),
+	)
+	deviceSvc := device.NewService(
+		deviceRepo,
+		deviceReadModel,
+		oauthRepo,
+		cfg.SessionCfg.TokenPepper,
+		time.Hour*time.Duration(cfg.SessionCfg.EnrollmentTTL),
+		cfg.SessionCfg.DeviceMaxPinFailures,
+	)
+	custommiddleware.SetDeviceAuthenticator(deviceSvc)
 	oauthSvc := oauth.NewServiceOAuth(
 		accountReadModel,
 		oauthRepo,
 		oauthReadModel,
-		cfg.JwtCfg.Secret,
+		jwtKeyring,
+		cfg.SessionCfg.TokenPepper,
 		cfg.JwtCfg.RefreshExpTime,
 		cfg.JwtCfg.AccessExpTime,
+		cfg.SessionCfg.MaxPerAccount,
+		cfg.SessionCfg.LimitPolicy,
 		roleReadModel,
 		permissionReadModel,
+		pinSvc,
+		passwordSvc,
+		deviceSvc,
 	)
+	sessionSvc := oauth.NewSessionService(
+		oauthRepo,
+		oauthReadModel,
+	)
+	custommiddleware.SetSessionValidator(sessionSvc)
+
+	assignmentSweeper := account.NewAssignmentSweeper(
+		accountRoleRepo,
+		time.Second*time.Duration(cfg.AuthzCfg.SweepInterval),
+	)
+	go assignmentSweeper.Run(ctx)
 
 	rolePermissionSvc := role.NewRolePermissionService(
 		roleRepo,
 		roleReadModel,
 		rolePermissionRepo,
 		rolePermissionReadModel,
+		permissionReadModel,
+		permissionResolver,
+	)
+	approvalSvc := approval.NewService(
+		approvalRepo,
+		approvalReadModel,
+		rolePermissionReadModel,
+		permissionResolver,
+		time.Hour*time.Duration(cfg.AuthzCfg.ApprovalDeadline),
 	)
 	accountRoleSvc := account.NewAccountRoleService(
 		accountRepo,
 		accountReadModel,
 		accountRoleRepo,
 		accountRoleReadModel,
+		rolePermissionReadModel,
+		permissionResolver,
+		approvalSvc,
+	)
+	reviewSvc := review.NewService(
+		reviewRepo,
+		reviewReadModel,
+		accountRoleSvc,
+		rolePermissionSvc,
+		jwtKeyring,
+	)
+	overrideSvc := override.NewService(
+		overrideRepo,
+		overrideReadModel,
+		accountReadModel,
+		pinSvc,
+		passwordSvc,
+		permissionResolver,
+		jwtKeyring,
+		time.Second*time.Duration(cfg.AuthzCfg.OverrideTTL),
+	)
+	custommiddleware.SetOverrideRedeemer(overrideRepo)
+	effectivePermissionSvc := account.NewEffectivePermissionService(
+		accountReadModel,
+		accountRoleReadModel,
+		roleReadModel,
+		rolePermissionReadModel,
 	)
 
 	permissionRoute := permission.NewRoute(
@@ -121,23 +278,62 @@ func main() {
 	accountRoute := account.NewRoute(
 		mutateDataAccount,
 		readDataAccount,
-	)
-	accountPublicRoute := account.NewPublicRoute(
-		mutateDataAccount,
-		readDataAccount,
+		effectivePermissionSvc,
+		pinSvc,
 	)
 	accountRoleRoute := account.NewRoleRoute(
 		mutateDataAccount,
 		readDataAccount,
 		accountRoleSvc,
 	)
+	storeRoute := store.NewRoute(
+		mutateDataStore,
+		readDataStore,
+	)
+	sodRoute := sod.NewRoute(
+		mutateDataSoD,
+		readDataSoD,
+	)
+	approvalRoute := approval.NewRoute(
+		approvalSvc,
+	)
+	reviewRoute := review.NewRoute(
+		reviewSvc,
+	)
+	deviceRoute := device.NewRoute(
+		deviceSvc,
+	)
+	devicePublicRoute := device.NewPublicRoute(
+		deviceSvc,
+	)
+	overrideRoute := override.NewRoute(
+		overrideSvc,
+	)
+	simulationRoute := simulation.NewRoute(
+		simulationSvc,
+	)
+	organizationRoute := organization.NewRoute(
+		organizationSvc,
+		cfg.OrganizationCfg.OperatorKey,
+	)
 	oauthRoute := oauth.NewRoute(
 		oauthSvc,
-		cfg.JwtCfg.Secret,
-		cfg.JwtCfg.RefreshExpTime,
+		jwtKeyring,
 	)
+	sessionRoute := oauth.NewSessionRoute(
+		sessionSvc,
+	)
+	decisionRoute := decision.NewRoute(
+		permissionResolver,
+		accountReadModel,
+	)
+	jwksRoute := keyring.NewRoute(
+		jwtKeyring,
+	)
+	r.Mount("/.well-known", jwksRoute.Routes())
 	r.Mount("/api", oauthRoute.Routes())
-	r.Mount("/api/register", accountPublicRoute.Routes())
+	r.Mount("/api/enroll", devicePublicRoute.Routes())
+	r.Mount("/api/organization", organizationRoute.Routes())
 
 	r.Group(func(r chi.Router) {
 		r.Use(custommiddleware.AuthJwtMiddleware)
@@ -146,7 +342,16 @@ func main() {
 		r.Mount("/api/role-permission", rolePermissionRoute.Routes())
 		r.Mount("/api/role", roleRoute.Routes())
 		r.Mount("/api/account-role", accountRoleRoute.Routes())
+		r.Mount("/api/store", storeRoute.Routes())
+		r.Mount("/api/device", deviceRoute.Routes())
+		r.Mount("/api/sod", sodRoute.Routes())
+		r.Mount("/api/approval", approvalRoute.Routes())
+		r.Mount("/api/review", reviewRoute.Routes())
+		r.Mount("/api/override", overrideRoute.Routes())
+		r.Mount("/api/simulate", simulationRoute.Routes())
 		r.Mount("/api/dashboard", protected.Routes())
+		r.Mount("/api/sessions", sessionRoute.Routes())
+		r.Mount("/api/authz", decisionRoute.Routes())
 	})
 
 	log.Info().Msg(fmt.Sprintf("starting up server on: %s", cfg.Listen.Addr()))
@@ -163,3 +368,15 @@ func main() {
 	}
 	log.Info().Msg("server stop")
 }
+
+// reloadKeyringOnSighup re-reads the signing keys whenever the process
+// receives SIGHUP, so keys can be rotated without a restart.
+func reloadKeyringOnSighup(k *keyring.Keyring) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		if err := k.Reload(); err != nil {
+			log.Error().Err(err).Msg("unable to reload signing keys, keeping the previous ones")
+		}
+	}
+}
@@ -12,15 +12,24 @@ create_role() {
   curl -X POST -H "Content-Type: application/json" -H "Authorization: Bearer $BEARER_TOKEN" -d "$data" "$SERVER_URL/api/role"
 }
 
-# Function to create a permission
+# Function to create a permission, optionally limited to a JSON list of methods
 create_permission() {
   name="$1"
   description="$2"
   url="$3"
-  data='{"name":"'$name'", "description":"'$description'", "url":"'$url'"}'
+  methods="${4:-[]}"
+  data='{"name":"'$name'", "description":"'$description'", "url":"'$url'", "methods":'$methods'}'
   curl -X POST -H "Content-Type: application/json" -H "Authorization: Bearer $BEARER_TOKEN" -d "$data" "$SERVER_URL/api/permission"
 }
 
+# Function to create a store
+create_store() {
+  name="$1"
+  address="$2"
+  data='{"name":"'$name'", "address":"'$address'"}'
+  curl -X POST -H "Content-Type: application/json" -H "Authorization: Bearer $BEARER_TOKEN" -d "$data" "$SERVER_URL/api/store"
+}
+
 # Create 3 roles
 create_role "Cashier" "Responsible for processing sales and refunds."
 create_role "Manager" "Has additional access to inventory management and reports."
@@ -30,9 +39,20 @@ create_role "Administrator" "Full access to all system features and settings."
 create_permission "Create Sale" "Permission to create a new sale transaction." "create-sale"
 create_permission "Edit Sale" "Permission to modify an existing sale transaction." "edit-sale"
 create_permission "Refund Transaction" "Permission to process refunds for sales." "refund-transaction"
-create_permission "View Inventory" "Permission to view inventory and stock levels." "view-inventory"
-create_permission "Manage Inventory" "Permission to add, update, or remove items from inventory." "manage-inventory"
+create_permission "View Inventory" "Permission to view inventory and stock levels." "inventory" '["GET"]'
+create_permission "Manage Inventory" "Permission to add, update, or remove items from inventory." "inventory" '["POST","PUT","DELETE"]'
 create_permission "Generate Reports" "Permission to generate sales and inventory reports." "generate-reports"
 create_permission "Customer Management" "Permission to add, edit, or delete customer records." "customer-management"
 create_permission "User Management" "Permission to manage user accounts and roles." "user-management"
 create_permission "Access Settings" "Permission to access and configure application settings." "access-settings"
+create_permission "Manage Roles" "Permission to manage roles, permissions and their constraints." "role:manage"
+create_permission "Assign Roles" "Permission to assign roles to and deny grants from accounts." "account-role:assign"
+create_permission "Manage Access Reviews" "Permission to open, close and report on access review campaigns." "access-review:manage"
+create_permission "Approve Roles" "Permission to approve or reject role assignments awaiting a second approver." "account-role:approve"
+create_permission "Audit Overrides" "Permission to list the manager overrides granted in the organization." "override:audit"
+create_permission "Manage Stores" "Permission to create, change and remove the outlets of the organization." "store:manage"
+create_permission "Manage Devices" "Permission to register, rename and remove the POS terminals of the organization." "device:manage"
+create_permission "Check Authorization" "Permission to ask whether an account may perform a request." "authz/check"
+
+# Create the first outlet
+create_store "Main Outlet" ""
@@ -4,4 +4,5 @@ type key int
 
 const (
 	UserValueKey key = iota
+	DeviceValueKey
 )